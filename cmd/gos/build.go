@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buildFlags are the flags of run, build and debug that are forwarded to
+// go build
+type buildFlags struct {
+	tags    string
+	race    bool
+	ldflags string
+	goos    string
+	goarch  string
+
+	// static builds without cgo and with -trimpath, as release builds do
+	static bool
+
+	// gcflags are passed to the Go compiler; gos debug --dap turns off
+	// optimizations with them
+	gcflags string
+}
+
+// register adds the go build flags to fs
+func (b *buildFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&b.tags, "tags", "", "a comma-separated `list` of build tags, as for go build")
+	fs.BoolVar(&b.race, "race", false, "enable the race detector")
+	fs.StringVar(&b.ldflags, "ldflags", "", "`flags` to pass to the Go linker")
+	fs.StringVar(&b.goos, "goos", "", "the operating system to build for, instead of the host's")
+	fs.StringVar(&b.goarch, "goarch", "", "the architecture to build for, instead of the host's")
+}
+
+// args returns the go build arguments for the flags
+func (b *buildFlags) args() []string {
+	var args []string
+	if b.tags != "" {
+		args = append(args, "-tags", b.tags)
+	}
+	if b.race {
+		args = append(args, "-race")
+	}
+	if b.ldflags != "" {
+		args = append(args, "-ldflags", b.ldflags)
+	}
+	if b.gcflags != "" {
+		args = append(args, "-gcflags", b.gcflags)
+	}
+	if b.static {
+		args = append(args, "-trimpath")
+	}
+	return args
+}
+
+// vars returns the environment variables the flags set for go build, which
+// select the target platform with GOOS and GOARCH
+func (b *buildFlags) vars() []string {
+	var vars []string
+	if b.goos != "" {
+		vars = append(vars, "GOOS="+b.goos)
+	}
+	if b.goarch != "" {
+		vars = append(vars, "GOARCH="+b.goarch)
+	}
+	if b.static {
+		vars = append(vars, "CGO_ENABLED=0")
+	}
+	return vars
+}
+
+// compileOrExit compiles a .gos file to Go code and returns the code and
+// how long compiling took. It reports a missing file or compile errors and
+// exits.
+func compileOrExit(filename string) (string, time.Duration) {
+	if !strings.HasSuffix(filename, ".gos") {
+		printError("file must have .gos extension")
+		os.Exit(1)
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		printError(fmt.Sprintf("file '%s' does not exist", filename))
+		os.Exit(1)
+	}
+
+	var goCode string
+	var err error
+	compileTime := measureExecutionTime(func() {
+		goCode, err = compileFile(filename)
+	})
+	if err != nil {
+		if compErr, ok := err.(*compileError); ok {
+			printCompilationError(filename, compErr.errors)
+		} else {
+			printError(fmt.Sprintf("compilation failed: %v", err))
+		}
+		os.Exit(1)
+	}
+	return goCode, compileTime
+}
+
+// goBuild writes Go code as a module in dir and builds it into the binary
+// at output, with the go build output on stderr. It returns how long the
+// build took.
+func goBuild(dir, goCode, output string, flags *buildFlags) (time.Duration, error) {
+	goFlags, err := writeGoModule(dir, map[string]string{"main.go": goCode})
+	if err != nil {
+		return 0, err
+	}
+
+	args := append([]string{"build"}, goFlags...)
+	args = append(append(args, flags.args()...), "-o", output, "main.go")
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), flags.vars()...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	printVerbose("%s (in %s)", flags.commandLine(args), dir)
+
+	buildTime := timePhase("go build", func() {
+		err = cmd.Run()
+	})
+	return buildTime, err
+}
+
+// commandLine returns the go command with args as a shell would take it,
+// for -v to show
+func (b *buildFlags) commandLine(args []string) string {
+	words := append(b.vars(), "go")
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t'\"") {
+			arg = strconv.Quote(arg)
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
+}
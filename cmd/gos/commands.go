@@ -0,0 +1,523 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A command is one of the gos subcommands. Each command parses its own
+// flags, so gos help <command> can list them, and run gets the arguments
+// left after the flags. The flags may come before or after the arguments.
+type command struct {
+	name     string
+	args     string // the arguments after the flags, as in "<file>"
+	summary  string // shown in the command list
+	help     string // shown by gos help <command>
+	group    string // the heading the command is listed under
+	minArgs  int
+	maxArgs  int  // -1 for any number
+	passArgs bool // the arguments after the first are passed on, not parsed for flags
+	setFlags func(fs *flag.FlagSet)
+	run      func(args []string)
+}
+
+// commands are the gos subcommands in the order gos help lists them. They
+// are set in init because the help command refers to them.
+var commands []*command
+
+func init() {
+	var run, build, debug buildFlags
+	var output, targets string
+	var goCode, watch, completeJSON, lib bool
+	var library libraryFlags
+	var test testFlags
+	var vetOpts vetFlags
+	var debugOpts debugFlags
+	var dap dapFlags
+
+	commands = []*command{
+		{
+			name:    "run",
+			args:    "<file> [--] [args]",
+			summary: "Compile and run a .gos file with arguments",
+			help: `Run compiles a .gos file and runs it with the given arguments. The
+arguments after the file, or after a --, are the program's, and gos
+exits with the program's exit code.
+
+A file can also be run as gos <file>.gos, so a script can start with
+the line #!/usr/bin/env gos.
+
+With --watch, run stays running and runs the file again each time it,
+a .gos file it imports or its gos.mod changes: the program is stopped
+and the new one started once it compiles, so the last version keeps
+running while the code has errors. After the first errors, only the
+new ones are listed, with the number fixed. Ctrl+C stops both.`,
+			minArgs:  1,
+			maxArgs:  -1,
+			passArgs: true,
+			setFlags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&watch, "watch", false, "run the file again each time it changes")
+				run.register(fs)
+			},
+			run: func(args []string) {
+				if watch {
+					watchRun(args[0], programArgs(args[1:]), &run)
+					return
+				}
+				runFile(args[0], programArgs(args[1:]), &run)
+			},
+		},
+		{
+			name:    "build",
+			args:    "<file or dir>",
+			summary: "Compile a .gos file to Go code, or to a binary with -o",
+			help: `Build compiles a .gos file to Go code, written next to it with the .go
+extension. With -o, it builds an executable binary instead, and the
+go build flags apply.
+
+With --target, build makes a release: a static binary for each target
+platform in the directory given by -o, named after the file and the
+platform, and a SHA256SUMS manifest of their checksums. Release builds
+disable cgo, use -trimpath, and stamp the version from gos.mod into the
+string variable version of the program:
+
+    gos build --target linux/arm64,darwin/amd64,windows/amd64 -o dist/ tool.gos
+
+With --watch, build stays running and builds the file again each time
+it, a .gos file it imports or its gos.mod changes, like gos run --watch.
+
+With --lib, build compiles a package other than main, the .gos files of
+a directory or a single file, into a Go package that Go modules can
+import, with a go.mod of its own, in the directory given by -o or next
+to the files. The module path is given by --module, or is that of
+gos.mod with the directory within the project. Comments above the
+package and its declarations become Go doc comments:
+
+    gos build --lib --module example.com/rules -o out/ rules/`,
+			minArgs: 1,
+			maxArgs: 1,
+			setFlags: func(fs *flag.FlagSet) {
+				fs.StringVar(&output, "o", "", "build a binary and write it to `file`, or with --lib the package to the directory")
+				fs.BoolVar(&goCode, "go", false, "write Go code, which is what build does without -o")
+				fs.StringVar(&targets, "target", "", "build a release for a comma-separated `list` of os/arch platforms into the -o directory")
+				fs.BoolVar(&watch, "watch", false, "build the file again each time it changes")
+				fs.BoolVar(&lib, "lib", false, "build a package into a Go package that Go modules can import")
+				fs.StringVar(&library.module, "module", "", "with --lib, the module `path` of the Go package")
+				build.register(fs)
+			},
+			run: func(args []string) {
+				if lib {
+					switch {
+					case targets != "":
+						exitUsage("build", "--target builds programs, so it cannot be used with --lib")
+					case watch:
+						exitUsage("build", "--watch cannot be used with --lib")
+					case goCode:
+						exitUsage("build", "-go cannot be used with --lib")
+					case len(build.args()) > 0 || len(build.vars()) > 0:
+						exitUsage("build", "the go build flags only apply when building a binary with -o")
+					}
+					library.output = output
+					buildLibrary(args[0], &library)
+					return
+				}
+				if library.module != "" {
+					exitUsage("build", "--module only applies to --lib")
+				}
+				if output == "" {
+					if targets != "" {
+						exitUsage("build", "--target needs the output directory given by -o")
+					}
+					if len(build.args()) > 0 || len(build.vars()) > 0 {
+						exitUsage("build", "the go build flags only apply when building a binary with -o")
+					}
+					if watch {
+						watchBuildFile(args[0], "", &build)
+						return
+					}
+					buildFile(args[0])
+					return
+				}
+				if goCode {
+					exitUsage("build", "-go and -o cannot be used together")
+				}
+				if targets == "" && watch {
+					watchBuildFile(args[0], output, &build)
+					return
+				}
+				if targets == "" {
+					buildBinary(args[0], output, &build)
+					return
+				}
+				if watch {
+					exitUsage("build", "--watch cannot be used with --target")
+				}
+				if build.goos != "" || build.goarch != "" {
+					exitUsage("build", "--target sets the platforms, so it cannot be used with --goos or --goarch")
+				}
+				list, err := parseTargets(targets)
+				if err != nil {
+					exitUsage("build", err.Error())
+				}
+				buildRelease(args[0], output, list, &build)
+			},
+		},
+		{
+			name:    "debug",
+			args:    "<file>",
+			summary: "Debug a .gos file, or show its tokens, syntax tree or Go code",
+			help: `Debug prints the tokens of a .gos file, then compiles and runs it
+like gos run.
+
+--dap debugs the program with Delve (dlv), the Go debugger, for editors
+that speak the Debug Adapter Protocol, such as VS Code. gos serves the
+editor on stdin and stdout, or on the address given by --listen, and
+builds the .gos file of the launch request, or the file given here,
+without optimizations. Breakpoints, stack frames and variables use the
+lines and names of the .gos file.
+
+--tokens, --ast and --go print the tokens, the syntax tree or the
+generated Go code instead, without running the program, and may be
+combined. With --json they are written as one JSON document with the
+members file, tokens, ast, go and, when the file has errors, errors:
+
+    gos debug --ast --json main.gos | jq .ast.statements[0].node`,
+			maxArgs: 1,
+			setFlags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&dap.enabled, "dap", false, "serve the Debug Adapter Protocol and debug the program with Delve")
+				fs.StringVar(&dap.listen, "listen", "", "with --dap, serve on the TCP `address` instead of stdin and stdout")
+				fs.StringVar(&dap.dlv, "dlv", "dlv", "with --dap, the Delve `command`")
+				fs.BoolVar(&debugOpts.tokens, "tokens", false, "print the tokens instead of running the program")
+				fs.BoolVar(&debugOpts.ast, "ast", false, "print the syntax tree instead of running the program")
+				fs.BoolVar(&debugOpts.goCode, "go", false, "print the generated Go code instead of running the program")
+				fs.BoolVar(&debugOpts.json, "json", false, "write the output of --tokens, --ast and --go as JSON")
+				debug.register(fs)
+			},
+			run: func(args []string) {
+				switch {
+				case dap.enabled && debugOpts.dumps():
+					exitUsage("debug", "--dap cannot be used with --tokens, --ast or --go")
+				case !dap.enabled && dap.listen != "":
+					exitUsage("debug", "--listen needs --dap")
+				case dap.enabled && len(args) > 0:
+					serveDAP(args[0], &dap, &debug)
+				case dap.enabled:
+					serveDAP("", &dap, &debug)
+				case len(args) == 0:
+					exitUsage("debug", "debug requires <file>")
+				default:
+					debugFile(args[0], &debugOpts, &debug)
+				}
+			},
+		},
+		{
+			name:    "test",
+			args:    "[paths]",
+			summary: "Run the tests in *_test.gos files",
+			help: `Test runs the tests of .gos programs. The tests of name.gos go in
+name_test.gos next to it, as functions that take the test they run and
+check results with assert:
+
+    func test_add(t):
+        assert add(2, 3) == 5
+
+Each test file is built with the program it tests and run in its
+directory. A failed assert stops its test and reports the line of the
+assert and the values of the operands of its comparison.
+
+Without arguments, test runs the test files of the current directory;
+./... also runs those of the subdirectories. -run selects the tests whose
+names match a regular expression, and -v lists every test as it runs.`,
+			maxArgs: -1,
+			setFlags: func(fs *flag.FlagSet) {
+				fs.StringVar(&test.run, "run", "", "only run the tests whose names match the regular expression `pattern`")
+				fs.BoolVar(&test.cover, "cover", false, "report the test coverage of the generated Go code")
+			},
+			run: func(args []string) {
+				runTests(args, &test)
+			},
+		},
+		{
+			name:    "vet",
+			args:    "[paths]",
+			summary: "Report likely mistakes in .gos files",
+			help: `Vet reports likely mistakes in .gos files that the parser accepts, such
+as unused variables, := that hides a variable, code after a return and
+functions that can end without returning. Each problem is reported on a
+line with its severity and the ID of the check that found it:
+
+    main.gos:4: error: count is declared but never used [unused-variable]
+
+Errors are code the Go compiler rejects once it is generated, and
+warnings code that likely does not do what was meant. A comment
+# gos:ignore with the IDs of checks leaves out their reports on its line,
+or on the next line when the comment is on a line of its own:
+
+    # gos:ignore shadow
+    err := save(item)
+
+Like test, vet takes files, directories and ./..., and the current
+directory without arguments. --list lists the checks, and --checks runs
+only some of them. Vet exits with code 1 when it reports anything.`,
+			maxArgs: -1,
+			setFlags: func(fs *flag.FlagSet) {
+				fs.StringVar(&vetOpts.checks, "checks", "", "only run the checks with the comma-separated `IDs`")
+				fs.BoolVar(&vetOpts.list, "list", false, "list the checks with their IDs and severities")
+			},
+			run: func(args []string) {
+				vetFiles(args, &vetOpts)
+			},
+		},
+		{
+			name:    "complete",
+			args:    "<file> <name>",
+			summary: "List the members of a Go package a .gos file uses",
+			help: `Complete lists the exported names of the Go package that a .gos file
+refers to by name, for editors to complete name. with: one per line
+with its kind and Go type, or as JSON with --json. The package is one
+the file imports, or one gos imports for it, such as fmt.
+
+    gos complete main.gos http
+    Get     func    func(url string) (resp *Response, err error)
+
+The file is read from stdin when it is -, so an editor can pass the text
+being edited. The members of standard library packages are cached per
+Go version in the user's cache directory.`,
+			minArgs: 2,
+			maxArgs: 2,
+			setFlags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&completeJSON, "json", false, "print the members as JSON")
+			},
+			run: func(args []string) {
+				completeMember(args[0], args[1], completeJSON)
+			},
+		},
+		{
+			name:    "init",
+			summary: "Initialize a new Go-Script project",
+			help:    "Init creates gos.mod, main.gos and the project directories in the current directory.",
+			group:   "Package Management",
+			run: func(args []string) {
+				initProject()
+			},
+		},
+		{
+			name:    "mod",
+			args:    "<subcommand>",
+			summary: "Initialize a module or manage its dependencies",
+			help: `Mod manages the module in gos.mod:
+
+    mod init <name>         Initialize a new module
+    mod tidy                Clean up module dependencies
+    mod download            Download module dependencies`,
+			group:   "Package Management",
+			minArgs: 1,
+			maxArgs: -1,
+			run:     handleModCommand,
+		},
+		{
+			name:    "install",
+			args:    "<module>",
+			summary: "Install a Go-Script module",
+			help:    "Install installs a Go-Script module into the modules directory.",
+			group:   "Module Commands",
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(args []string) {
+				installModule(args[0])
+			},
+		},
+		{
+			name:    "uninstall",
+			args:    "<module>",
+			summary: "Uninstall a Go-Script module",
+			help:    "Uninstall removes a module from the modules directory.",
+			group:   "Module Commands",
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(args []string) {
+				uninstallModule(args[0])
+			},
+		},
+		{
+			name:    "list",
+			summary: "List installed modules",
+			help:    "List lists the modules in the modules directory.",
+			group:   "Module Commands",
+			run: func(args []string) {
+				listModules()
+			},
+		},
+		{
+			name:    "search",
+			args:    "<query>",
+			summary: "Search for available modules",
+			help:    "Search lists the available modules whose name or description contains the query.",
+			group:   "Module Commands",
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(args []string) {
+				searchModules(args[0])
+			},
+		},
+		{
+			name:    "stdlib",
+			summary: "Show available import aliases",
+			help:    "Stdlib lists the short names that import Go standard library packages.",
+			group:   "Standard Library",
+			run: func(args []string) {
+				showStdlibAliases()
+			},
+		},
+		{
+			name:    "version",
+			summary: "Show version information",
+			help:    "Version prints the version of gos.",
+			group:   "Other",
+			run: func(args []string) {
+				fmt.Printf("%sGo-Script v%s%s\n", ColorBold, version, ColorReset)
+			},
+		},
+		{
+			name:    "help",
+			args:    "[command]",
+			summary: "Show help for gos or for a command",
+			help:    "Help shows the commands of gos, or the usage and flags of one command.",
+			group:   "Other",
+			maxArgs: 1,
+			run: func(args []string) {
+				if len(args) == 0 {
+					printUsage(os.Stdout)
+					return
+				}
+				cmd := findCommand(args[0])
+				if cmd == nil {
+					printError(fmt.Sprintf("unknown command '%s'; run 'gos help' for the list of commands", args[0]))
+					os.Exit(1)
+				}
+				printCommandHelp(os.Stdout, cmd)
+			},
+		},
+	}
+}
+
+// findCommand returns the command called name, or nil if there is none
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flag set of cmd, which takes the flags every command
+// takes as well as its own
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("gos "+cmd.name, flag.ExitOnError)
+	addCommonFlags(fs)
+	if cmd.setFlags != nil {
+		cmd.setFlags(fs)
+	}
+	fs.Usage = func() {
+		printCommandHelp(os.Stderr, cmd)
+	}
+	return fs
+}
+
+// execute parses the flags of cmd from args and runs it
+func (cmd *command) execute(args []string) {
+	fs := cmd.flagSet()
+	args = parseFlags(fs, args, cmd.passArgs)
+	if len(args) < cmd.minArgs {
+		exitUsage(cmd.name, fmt.Sprintf("%s requires %s", cmd.name, cmd.args))
+	}
+	if cmd.maxArgs >= 0 && len(args) > cmd.maxArgs {
+		takes := "no arguments"
+		if cmd.args != "" {
+			takes = cmd.args
+		}
+		exitUsage(cmd.name, fmt.Sprintf("unexpected argument '%s'; %s takes %s", args[cmd.maxArgs], cmd.name, takes))
+	}
+	cmd.run(args)
+}
+
+// parseFlags parses the flags in args, before and after the other
+// arguments, as in gos build main.gos -o app, and returns the other
+// arguments. The arguments after a -- are not flags, nor with passArgs
+// are those after the first argument, which are the program's.
+func parseFlags(fs *flag.FlagSet, args []string, passArgs bool) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional
+		}
+		if n := len(args) - len(rest); passArgs || n > 0 && args[n-1] == "--" {
+			return append(positional, rest...)
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// exitUsage reports a misused command and exits
+func exitUsage(name, message string) {
+	printError(message)
+	fmt.Fprintf(os.Stderr, "Run 'gos help %s' for usage.\n", name)
+	os.Exit(2)
+}
+
+// printUsage prints the commands of gos and the flags they all take
+func printUsage(w *os.File) {
+	fmt.Fprintf(w, "Go-Script Compiler v%s\n\n", version)
+	fmt.Fprintf(w, "Usage:\n    gos [flags] <command> [flags] [arguments]\n    gos [flags] <file>.gos [args]\n\nCommands:\n")
+	group := ""
+	for _, cmd := range commands {
+		if cmd.group != group {
+			group = cmd.group
+			fmt.Fprintf(w, "\n    # %s\n", group)
+		}
+		fmt.Fprintf(w, "    %-24s%s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+	}
+	fmt.Fprint(w, `
+Flags:
+    -q, --quiet             Only report errors
+    -v, --verbose           Always show status lines, and show the steps taken
+    --timing                Report how long each compilation phase took
+
+Examples:
+    gos run hello.gos
+    gos run tool.gos -- -verbose input.txt
+    gos run --watch server.gos
+    gos build main.gos
+    gos build -o myapp main.gos
+    gos build -o myapp -race -tags netgo main.gos
+    gos build --target linux/amd64,windows/amd64 -o dist/ main.gos
+    gos build --lib -o out/ rules/
+    gos debug main.gos
+    gos debug --ast --json main.gos
+    gos debug --dap --listen 127.0.0.1:4711 main.gos
+    gos test ./...
+    gos vet ./...
+    gos complete main.gos http
+    gos init
+    gos mod init myproject
+    gos install math-utils
+    gos list
+
+Run 'gos help <command>' for the flags of a command.
+`)
+}
+
+// printCommandHelp prints the usage, description and flags of cmd
+func printCommandHelp(w *os.File, cmd *command) {
+	fmt.Fprintf(w, "Usage: %s\n\n", strings.TrimSpace("gos "+cmd.name+" [flags] "+cmd.args))
+	fmt.Fprintf(w, "%s\n\nFlags:\n", cmd.help)
+	fs := cmd.flagSet()
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/gopkg"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+	"github.com/GrandpaEJ/go-script/pkg/parser"
+	"github.com/GrandpaEJ/go-script/pkg/stdlib"
+)
+
+// gos complete lists what can follow name. in a .gos file, for editors:
+// the exported members of the Go package the file refers to by name, one
+// per line with its kind and type, or as JSON:
+//
+//	Get	func	func(url string) (resp *Response, err error)
+//
+// The file is usually being edited, so it is read from stdin when it is
+// -, and only its imports need to parse.
+
+// completeMember lists the members of the Go package called name in a file
+func completeMember(filename, name string, asJSON bool) {
+	var content []byte
+	var err error
+	if filename == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		printError(fmt.Sprintf("reading file: %v", err))
+		os.Exit(1)
+	}
+
+	path := packagePath(string(content), name)
+	if path == "" {
+		printError(fmt.Sprintf("%s is not a Go package the file imports", name))
+		os.Exit(1)
+	}
+	pkg, err := goPackages().Load(path)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+
+	members := make([]*gopkg.Member, 0, len(pkg.Members))
+	for _, member := range pkg.Names() {
+		members = append(members, pkg.Lookup(member))
+	}
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(members)
+		return
+	}
+	for _, m := range members {
+		fmt.Printf("%s\t%s\t%s\n", m.Name, m.Kind, m.Type)
+	}
+}
+
+// packagePath returns the path of the Go package a program refers to by
+// name: one it imports, or one gos imports for it, such as fmt
+func packagePath(source, name string) string {
+	program := parser.New(lexer.New(source)).ParseProgram()
+	for _, imp := range program.Imports {
+		for _, pkg := range imp.Packages() {
+			if len(pkg.Names) == 0 && pkg.Name == name && !strings.HasSuffix(pkg.Path, ".gos") {
+				return pkg.Path
+			}
+		}
+	}
+	return stdlib.AutoImports[name]
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/GrandpaEJ/go-script/pkg/codegen"
+)
+
+// gos debug --dap debugs a .gos program with Delve, the Go debugger, for
+// editors that speak the Debug Adapter Protocol (DAP), such as VS Code. It
+// serves one editor on stdin and stdout, or on a TCP address with --listen,
+// runs dlv dap and stands between the two. It passes the messages on, and
+// translates those that differ between the .gos program and the Go
+// program Delve debugs:
+//
+//   - A launch request names the .gos file. gos builds it without
+//     optimizations and with a line directive on the code of every
+//     statement, so Delve places breakpoints and reports positions on the
+//     .gos lines, and launches the binary in its place.
+//   - Stack frames, variables and expressions use the .gos names of
+//     functions, types, fields and methods that the Go code renames, and
+//     the variables the generated code declares for itself are hidden.
+
+// delveReadyPrefix starts the line dlv dap prints when it accepts clients
+const delveReadyPrefix = "DAP server listening at:"
+
+// dapFlags are the flags of gos debug --dap
+type dapFlags struct {
+	enabled bool
+	listen  string // the address to serve on instead of stdin and stdout
+	dlv     string // the dlv command
+}
+
+// dapMessage is a DAP request, response or event. It is kept as decoded,
+// so the members gos does not translate are passed on unchanged.
+type dapMessage map[string]interface{}
+
+// object returns the member key of m as an object, or nil
+func (m dapMessage) object(key string) map[string]interface{} {
+	value, _ := m[key].(map[string]interface{})
+	return value
+}
+
+// dapConn reads and writes the DAP messages of one side of a session. The
+// messages are JSON with a Content-Length header, as in HTTP.
+type dapConn struct {
+	r  *bufio.Reader
+	w  io.Writer
+	mu sync.Mutex // writes come from both directions of the session
+}
+
+func newDAPConn(r io.Reader, w io.Writer) *dapConn {
+	return &dapConn{r: bufio.NewReader(r), w: w}
+}
+
+// read reads the next message
+func (c *dapConn) read() (dapMessage, error) {
+	length := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid DAP header %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("DAP message without a Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var msg dapMessage
+	if err := decoder.Decode(&msg); err != nil {
+		return nil, fmt.Errorf("invalid DAP message: %v", err)
+	}
+	return msg, nil
+}
+
+// write writes a message
+func (c *dapConn) write(msg dapMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// debugSession is a DAP session between an editor and Delve
+type debugSession struct {
+	client  *dapConn
+	delve   *dapConn
+	program string // the .gos file given to gos debug, if any
+	build   *buildFlags
+	dir     string // the directory of the built program
+
+	// The names of the program being debugged, see codegen.Names. They are
+	// set by the launch request and read by both directions of the session.
+	mu       sync.Mutex
+	pkg      string            // its Go package
+	names    codegen.Names     // .gos names to Go names
+	topLevel map[string]string // Go names of functions and types to .gos names
+	members  map[string]string // Go names of fields and methods to .gos names
+}
+
+// serveDAP runs a DAP session for one editor, with the .gos file to debug
+// given by program or by the launch request
+func serveDAP(program string, flags *dapFlags, build *buildFlags) {
+	var client *dapConn
+	if flags.listen == "" {
+		client = newDAPConn(os.Stdin, os.Stdout)
+	} else {
+		listener, err := net.Listen("tcp", flags.listen)
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+		// Tools that start gos debug read the address from this line, as
+		// they do from dlv dap
+		fmt.Printf("%s %s\n", delveReadyPrefix, listener.Addr())
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+		defer conn.Close()
+		client = newDAPConn(conn, conn)
+	}
+
+	dlv, conn, err := startDelve(flags.dlv)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	session := &debugSession{
+		client:  client,
+		delve:   newDAPConn(conn, conn),
+		program: program,
+		build:   build,
+	}
+	err = session.serve()
+	conn.Close()
+	dlv.Process.Kill()
+	dlv.Wait()
+	if session.dir != "" {
+		os.RemoveAll(session.dir)
+	}
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// startDelve starts dlv dap on a free local port and connects to it. The
+// output of dlv, which includes that of the program unless the editor
+// shows it, goes to stderr, because stdout may carry the messages of the
+// editor.
+func startDelve(dlv string) (*exec.Cmd, net.Conn, error) {
+	path, err := exec.LookPath(dlv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("debugging needs Delve; install it with go install github.com/go-delve/delve/cmd/dlv@latest (%v)", err)
+	}
+	cmd := exec.Command(path, "dap", "--listen", "127.0.0.1:0")
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	printVerbose("%s dap --listen 127.0.0.1:0", path)
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("starting Delve: %v", err)
+	}
+
+	output := bufio.NewReader(stdout)
+	for {
+		line, err := output.ReadString('\n')
+		if addr, ok := strings.CutPrefix(strings.TrimSpace(line), delveReadyPrefix); ok {
+			go io.Copy(os.Stderr, output)
+			conn, err := net.Dial("tcp", strings.TrimSpace(addr))
+			if err != nil {
+				cmd.Process.Kill()
+				return nil, nil, fmt.Errorf("connecting to Delve: %v", err)
+			}
+			return cmd, conn, nil
+		}
+		os.Stderr.WriteString(line)
+		if err != nil {
+			cmd.Wait()
+			return nil, nil, fmt.Errorf("Delve exited before it accepted a connection")
+		}
+	}
+}
+
+// serve passes messages between the editor and Delve until either side
+// ends the session
+func (s *debugSession) serve() error {
+	done := make(chan error, 2)
+	go func() {
+		done <- s.forward(s.client, s.delve, s.translateRequest)
+	}()
+	go func() {
+		done <- s.forward(s.delve, s.client, s.translateReply)
+	}()
+	// A session ends when either side closes its connection
+	if err := <-done; err != io.EOF && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// forward passes the messages of from on to to, translated. Translate
+// returns false for messages it answered itself, which are not passed on.
+func (s *debugSession) forward(from, to *dapConn, translate func(dapMessage) bool) error {
+	for {
+		msg, err := from.read()
+		if err != nil {
+			return err
+		}
+		if !translate(msg) {
+			continue
+		}
+		if err := to.write(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// translateRequest translates a message of the editor for Delve
+func (s *debugSession) translateRequest(msg dapMessage) bool {
+	if msg["type"] != "request" {
+		return true
+	}
+	if msg["command"] == "launch" {
+		return s.launch(msg)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	args := msg.object("arguments")
+	switch msg["command"] {
+	case "attach":
+		s.reply(msg, "gos debug launches the .gos program it debugs, and cannot attach to a running one")
+		return false
+	case "setBreakpoints":
+		// The line directives name the .gos file by its absolute path
+		if source, _ := args["source"].(map[string]interface{}); source != nil {
+			if path, _ := source["path"].(string); strings.HasSuffix(path, ".gos") {
+				if abs, err := filepath.Abs(path); err == nil {
+					source["path"] = abs
+				}
+			}
+		}
+	case "evaluate", "setExpression":
+		if expr, ok := args["expression"].(string); ok {
+			args["expression"] = translateNames(expr, s.names.TopLevel, s.names.Members)
+		}
+	case "setVariable":
+		if name, ok := args["name"].(string); ok {
+			args["name"] = translateNames(name, nil, s.names.Members)
+		}
+	}
+	return true
+}
+
+// launch builds the .gos program of a launch request and has Delve run the
+// binary instead
+func (s *debugSession) launch(msg dapMessage) bool {
+	args := msg.object("arguments")
+	if args == nil {
+		args = make(map[string]interface{})
+		msg["arguments"] = args
+	}
+	program, _ := args["program"].(string)
+	if program == "" {
+		program = s.program
+	}
+	if !strings.HasSuffix(program, ".gos") {
+		s.reply(msg, "the program to debug must be a .gos file")
+		return false
+	}
+
+	binary, err := s.buildProgram(program)
+	if err != nil {
+		message := err.Error()
+		if compErr, ok := err.(*compileError); ok {
+			message = fmt.Sprintf("%s has errors:\n%s", program, strings.Join(compErr.errors, "\n"))
+		}
+		s.reply(msg, message)
+		return false
+	}
+	args["mode"] = "exec"
+	args["program"] = binary
+	return true
+}
+
+// buildProgram compiles a .gos file for debugging and builds it, and
+// returns the path of the binary
+func (s *debugSession) buildProgram(filename string) (string, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return "", err
+	}
+	goCode, err := s.compile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+	if s.dir, err = os.MkdirTemp("", "gos-debug-*"); err != nil {
+		return "", err
+	}
+	binary := binaryPath(s.dir)
+	flags := *s.build
+	flags.gcflags = "all=-N -l"
+	if _, err := goBuild(s.dir, goCode, binary, &flags); err != nil {
+		return "", fmt.Errorf("building %s failed, see the output of gos: %v", filename, err)
+	}
+	return binary, nil
+}
+
+// compile compiles a .gos file to Go code with a line directive on every
+// statement, and records the names the code renames
+func (s *debugSession) compile(filename string) (string, error) {
+	program, err := parseFile(filename)
+	if err != nil {
+		return "", err
+	}
+	c := newChecker()
+	c.Check(program)
+	if err := checkResult(filename, c); err != nil {
+		return "", err
+	}
+
+	options, err := codegenOptions(filename)
+	if err != nil {
+		return "", err
+	}
+	if options.SourceFile, err = filepath.Abs(filename); err != nil {
+		return "", err
+	}
+	options.OutputFile = "main.go"
+	options.LineDirectives = true
+	g := codegen.NewWithOptions(options)
+	goCode := g.Generate(program)
+	if err := checkErrors(filename, g.Errors()); err != nil {
+		return "", err
+	}
+
+	names := g.Names()
+	topLevel := make(map[string]string)
+	members := make(map[string]string)
+	for name, goName := range names.TopLevel {
+		topLevel[goName] = name
+	}
+	for name, goName := range names.Constructors {
+		topLevel[goName] = name + ".init"
+	}
+	for name, goName := range names.Members {
+		members[goName] = name
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pkg, s.names, s.topLevel, s.members = program.Package, names, topLevel, members
+	return goCode, nil
+}
+
+// reply answers a request of the editor with an error
+func (s *debugSession) reply(request dapMessage, message string) {
+	s.client.write(dapMessage{
+		"seq":         0,
+		"type":        "response",
+		"request_seq": request["seq"],
+		"command":     request["command"],
+		"success":     false,
+		"message":     message,
+		"body": map[string]interface{}{
+			"error": map[string]interface{}{"id": 1, "format": message},
+		},
+	})
+}
+
+// translateReply translates a message of Delve for the editor
+func (s *debugSession) translateReply(msg dapMessage) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg["type"] != "response" || msg["success"] != true || s.pkg == "" {
+		return true
+	}
+	body := msg.object("body")
+	switch msg["command"] {
+	case "stackTrace":
+		frames, _ := body["stackFrames"].([]interface{})
+		for _, f := range frames {
+			frame, _ := f.(map[string]interface{})
+			if frame == nil {
+				continue
+			}
+			if name, ok := frame["name"].(string); ok {
+				frame["name"] = s.functionName(name)
+			}
+			// Frames outside the .gos program, in the runtime or the
+			// generated code, are shown dimmed
+			source, _ := frame["source"].(map[string]interface{})
+			if path, _ := source["path"].(string); !strings.HasSuffix(path, ".gos") {
+				frame["presentationHint"] = "subtle"
+			}
+		}
+	case "variables":
+		variables, _ := body["variables"].([]interface{})
+		kept := []interface{}{}
+		for _, v := range variables {
+			variable, _ := v.(map[string]interface{})
+			if name, _ := variable["name"].(string); codegen.IsTemporary(name) {
+				continue
+			}
+			s.translateVariable(variable)
+			kept = append(kept, v)
+		}
+		body["variables"] = kept
+	case "evaluate", "setExpression", "setVariable":
+		s.translateValue(body, "result")
+		s.translateValue(body, "value")
+	}
+	return true
+}
+
+// translateVariable gives a variable of Delve the .gos names of the
+// variable, its type and the expression that evaluates it
+func (s *debugSession) translateVariable(variable map[string]interface{}) {
+	if variable == nil {
+		return
+	}
+	if name, ok := variable["name"].(string); ok {
+		if gosName, ok := s.members[name]; ok {
+			variable["name"] = gosName
+		}
+	}
+	if expr, ok := variable["evaluateName"].(string); ok {
+		variable["evaluateName"] = translateNames(expr, s.topLevel, s.members)
+	}
+	s.translateValue(variable, "value")
+}
+
+// translateValue gives the type of a variable or result, and the type its
+// value starts with, as in main.Point {X: 1}, their .gos names
+func (s *debugSession) translateValue(v map[string]interface{}, valueKey string) {
+	typ, _ := v["type"].(string)
+	if typ == "" {
+		return
+	}
+	gosType := s.typeName(typ)
+	v["type"] = gosType
+	if value, ok := v[valueKey].(string); ok && strings.HasPrefix(value, typ) {
+		v[valueKey] = gosType + value[len(typ):]
+	}
+}
+
+// qualifiedName matches a name of the program's package in a Go type, as
+// in *main.Point
+var qualifiedName = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// typeName returns the .gos name of a Go type
+func (s *debugSession) typeName(typ string) string {
+	return qualifiedName.ReplaceAllStringFunc(typ, func(name string) string {
+		pkg, ident, _ := strings.Cut(name, ".")
+		if pkg != s.pkg {
+			return name
+		}
+		if gosName, ok := s.topLevel[ident]; ok {
+			return gosName
+		}
+		return ident
+	})
+}
+
+// functionName returns the .gos name of a function as Delve names it:
+// main.add, main.(*Point).Move, main.Stack[go.shape.int].push or
+// main.main.func1 for a func literal
+func (s *debugSession) functionName(name string) string {
+	rest, ok := strings.CutPrefix(stripTypeArgs(name), s.pkg+".")
+	if !ok {
+		return name
+	}
+	parts := strings.Split(rest, ".")
+	for i, part := range parts {
+		part = strings.TrimSuffix(strings.TrimPrefix(part, "(*"), ")")
+		names := s.members
+		if i == 0 {
+			names = s.topLevel
+		}
+		if gosName, ok := names[part]; ok {
+			part = gosName
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, ".")
+}
+
+// stripTypeArgs removes the type arguments in brackets from a Go name
+func stripTypeArgs(name string) string {
+	var out strings.Builder
+	depth := 0
+	for _, r := range name {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// translateNames renames the names of an expression: names after a dot
+// by members, other names by topLevel. Strings and runes in quotes are
+// left as they are.
+func translateNames(expr string, topLevel, members map[string]string) string {
+	var out strings.Builder
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '"' || r == '\'' || r == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' && r != '`' {
+					j++
+				}
+				j++
+			}
+			if j < len(runes) {
+				j++
+			}
+			out.WriteString(string(runes[i:j]))
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			name := string(runes[i:j])
+			names := topLevel
+			if i > 0 && runes[i-1] == '.' {
+				names = members
+			}
+			if renamed, ok := names[name]; ok {
+				name = renamed
+			}
+			out.WriteString(name)
+			i = j
+		default:
+			out.WriteRune(r)
+			i++
+		}
+	}
+	return out.String()
+}
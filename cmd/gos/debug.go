@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+)
+
+// gos debug shows what the compiler makes of a .gos file. Without flags it
+// prints the tokens and runs the program; --tokens, --ast and --go print
+// the tokens, the syntax tree or the generated Go code instead of running
+// it, as text or, with --json, as one JSON document for tools:
+//
+//	{
+//	  "file": "hello.gos",
+//	  "tokens": [{"type": "FUNC", "literal": "func", "line": 1, "column": 1, "offset": 0}, ...],
+//	  "ast": {"node": "Program", "package": "main", "statements": [...]},
+//	  "go": "package main\n..."
+//	}
+//
+// Members that were not asked for are left out. When the file has errors,
+// the document has an "errors" list instead of the output that needs a
+// valid program, and gos exits with code 1.
+
+// debugFlags are the flags of gos debug that choose what it prints
+type debugFlags struct {
+	tokens bool
+	ast    bool
+	goCode bool
+	json   bool
+}
+
+// dumps reports whether any output was asked for, which means the program
+// is not run
+func (f *debugFlags) dumps() bool {
+	return f.tokens || f.ast || f.goCode
+}
+
+// debugToken is a token in the JSON output of gos debug
+type debugToken struct {
+	Type    string `json:"type"`
+	Literal string `json:"literal"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Offset  int    `json:"offset"`
+}
+
+// debugOutput is the JSON document gos debug writes
+type debugOutput struct {
+	File   string       `json:"file"`
+	Tokens []debugToken `json:"tokens,omitempty"`
+	AST    interface{}  `json:"ast,omitempty"`
+	Go     string       `json:"go,omitempty"`
+	Errors []string     `json:"errors,omitempty"`
+}
+
+func debugFile(filename string, flags *debugFlags, build *buildFlags) {
+	// Check if file exists and has .gos extension
+	if !strings.HasSuffix(filename, ".gos") {
+		printError("file must have .gos extension")
+		os.Exit(1)
+	}
+
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		printError(fmt.Sprintf("file '%s' does not exist", filename))
+		os.Exit(1)
+	} else if err != nil {
+		printError(fmt.Sprintf("reading file: %v", err))
+		os.Exit(1)
+	}
+
+	if flags.json && !flags.dumps() {
+		exitUsage("debug", "--json needs --tokens, --ast or --go to choose the output")
+	}
+	if !flags.dumps() {
+		fmt.Fprintf(os.Stderr, "%sDebug Mode:%s %s%s%s\n\n", ColorYellow, ColorReset, ColorCyan, filename, ColorReset)
+		tokens, _ := tokenList(string(content))
+		printTokens(tokens)
+
+		// Compile and run with debug info
+		runFile(filename, nil, build)
+		return
+	}
+
+	out := debugOutput{File: filename}
+	if flags.tokens {
+		var errors []string
+		if out.Tokens, errors = tokenList(string(content)); len(errors) > 0 {
+			out.Errors = errors
+		}
+	}
+	if flags.ast && out.Errors == nil {
+		program, err := parseFile(filename)
+		if err != nil {
+			out.Errors = debugErrors(err)
+		} else {
+			out.AST = ast.JSON(program)
+			if !flags.json {
+				out.AST = ast.Dump(program)
+			}
+		}
+	}
+	if flags.goCode && out.Errors == nil {
+		out.Go, err = compileFile(filename)
+		if err != nil {
+			out.Errors = debugErrors(err)
+		}
+	}
+
+	if flags.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(out); err != nil {
+			printError(fmt.Sprintf("writing JSON: %v", err))
+			os.Exit(1)
+		}
+	} else {
+		if out.Tokens != nil {
+			printTokens(out.Tokens)
+		}
+		if out.AST != nil {
+			fmt.Print(out.AST)
+		}
+		if out.Go != "" {
+			fmt.Print(out.Go)
+		}
+		if out.Errors != nil {
+			printCompilationError(filename, out.Errors)
+		}
+	}
+	if out.Errors != nil {
+		os.Exit(1)
+	}
+}
+
+// tokenList returns the tokens of a .gos file, up to but not including the
+// end of the file, and the errors of the lexer
+func tokenList(content string) ([]debugToken, []string) {
+	tokens := []debugToken{}
+	l := lexer.New(content)
+	for {
+		tok := l.NextToken()
+		if tok.Type == lexer.EOF {
+			return tokens, l.Errors()
+		}
+		tokens = append(tokens, debugToken{
+			Type:    lexer.TokenTypeString(tok.Type),
+			Literal: tok.Literal,
+			Line:    tok.Line,
+			Column:  tok.Column,
+			Offset:  tok.Position,
+		})
+	}
+}
+
+// debugErrors returns the errors of a failed compilation as a list
+func debugErrors(err error) []string {
+	if compErr, ok := err.(*compileError); ok {
+		return compErr.errors
+	}
+	return []string{err.Error()}
+}
+
+// printTokens prints the tokens other than comments and newlines with
+// their positions
+func printTokens(tokens []debugToken) {
+	fmt.Printf("%sLexer Tokens:%s\n", ColorBlue, ColorReset)
+	count := 0
+	for _, tok := range tokens {
+		if tok.Type == "COMMENT" || tok.Type == "NEWLINE" {
+			continue
+		}
+		count++
+		fmt.Printf("  %s%d.%s %s%s%s: %q %s(%d:%d)%s\n", ColorYellow, count, ColorReset,
+			ColorGreen, tok.Type, ColorReset, tok.Literal, ColorCyan, tok.Line, tok.Column, ColorReset)
+	}
+	fmt.Printf("Total tokens: %d\n\n", count)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// programArgs returns the arguments for the program from the arguments
+// after its file name, where a leading -- separates them from gos flags
+func programArgs(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// binaryPath returns the path of the program built in dir
+func binaryPath(dir string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "program.exe")
+	}
+	return filepath.Join(dir, "program")
+}
+
+// runBinary runs the program at path with args on the terminal of gos and
+// returns its exit code. The program gets name as its argv[0], as the path
+// is a temporary file gone once it ends. Interrupts and termination requests are passed on
+// to the program, and a program ended by a signal gets the code a shell
+// would report: 128 plus the signal number.
+func runBinary(path, name string, args []string) (int, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Args[0] = name
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0, nil
+	case !errors.As(err, &exitErr):
+		return 1, err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return exitErr.ExitCode(), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/codegen"
+	gosruntime "github.com/GrandpaEJ/go-script/runtime"
+)
+
+// runtimeModule is the module that provides the runtime package. Generated
+// modules require it at a placeholder version and get its sources vendored,
+// so they build without network access.
+const (
+	runtimeModule        = "github.com/GrandpaEJ/go-script"
+	runtimeModuleVersion = "v0.0.0"
+	goVersion            = "1.22"
+)
+
+// writeGoModule writes generated Go files, by name, as a module named temp
+// in dir, vendoring the runtime package when the code imports it. It
+// returns the flags to pass to go build and go run for the module.
+func writeGoModule(dir string, files map[string]string) ([]string, error) {
+	usesRuntime := false
+	for name, goCode := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(goCode), 0644); err != nil {
+			return nil, fmt.Errorf("writing Go code: %v", err)
+		}
+		usesRuntime = usesRuntime || strings.Contains(goCode, `"`+codegen.RuntimePath+`"`)
+	}
+
+	var flags []string
+	goMod := fmt.Sprintf("module temp\n\ngo %s\n", goVersion)
+	if usesRuntime {
+		goMod += fmt.Sprintf("\nrequire %s %s\n", runtimeModule, runtimeModuleVersion)
+		if err := vendorRuntime(dir); err != nil {
+			return nil, fmt.Errorf("vendoring runtime: %v", err)
+		}
+		// Overrides a -mod=mod in GOFLAGS, which would ignore the vendor
+		// directory and try to download the placeholder version
+		flags = append(flags, "-mod=vendor")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		return nil, fmt.Errorf("writing go.mod: %v", err)
+	}
+	return flags, nil
+}
+
+// vendorRuntime copies the runtime package into the vendor directory of the
+// module in dir
+func vendorRuntime(dir string) error {
+	if err := copyRuntime(filepath.Join(dir, "vendor", filepath.FromSlash(codegen.RuntimePath))); err != nil {
+		return err
+	}
+	modules := fmt.Sprintf("# %s %s\n## explicit; go %s\n%s\n",
+		runtimeModule, runtimeModuleVersion, goVersion, codegen.RuntimePath)
+	return os.WriteFile(filepath.Join(dir, "vendor", "modules.txt"), []byte(modules), 0644)
+}
+
+// copyRuntime writes the Go files of the runtime package into pkgDir
+func copyRuntime(pkgDir string) error {
+	if err := os.MkdirAll(pkgDir, 0755); err != nil {
+		return err
+	}
+	files, err := fs.ReadDir(gosruntime.Source, ".")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(gosruntime.Source, file.Name())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(pkgDir, file.Name()), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
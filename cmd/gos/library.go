@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/codegen"
+)
+
+// gos build --lib builds the .gos files of a package into a Go package that
+// Go modules can import, with a go.mod of its own:
+//
+//	gos build --lib --module example.com/pricing -o ../pricing-go pricing/
+//
+// The files are those of a directory, other than its tests, or a single
+// file, and all declare the package, as in package pricing. They are
+// compiled together into one Go file named after the package, so they
+// can use each other's functions and structs. Their pub declarations, or
+// all of them with auto_export in gos.mod, are the API of the package, and
+// the comments above declarations become their doc comments.
+//
+// The generated code does not import the runtime package of gos, which
+// importing modules could not download at the version generated modules
+// require; the package gets a copy of it as an internal package.
+
+// libraryRuntime is the directory of the copy of the runtime package,
+// within the directory of the library
+const libraryRuntime = "internal/runtime"
+
+// libraryFlags are the flags of gos build --lib
+type libraryFlags struct {
+	output string // the directory of the Go package, or "" for the sources'
+	module string // the module path, or "" to derive it
+}
+
+// buildLibrary builds the .gos package at source, a directory or a file,
+// into a Go package
+func buildLibrary(source string, flags *libraryFlags) {
+	start := time.Now()
+	files, err := libraryFiles(source)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	program, lines, err := parsePackage(files)
+	if err != nil {
+		if compErr, ok := err.(*compileError); ok {
+			printCompilationError(compErr.file, compErr.errors)
+		} else {
+			printError(err.Error())
+		}
+		os.Exit(1)
+	}
+
+	dir := filepath.Dir(files[0])
+	module := flags.module
+	if module == "" {
+		if module, err = libraryModule(dir, program.Package); err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	c := newChecker()
+	timePhase("check", func() {
+		c.Check(program)
+	})
+	if err := checkResultLines(source, lines, c); err != nil {
+		printCompilationError(source, err.(*compileError).errors)
+		os.Exit(1)
+	}
+	options, err := codegenOptions(files[0])
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	options.RuntimePath = path.Join(module, libraryRuntime)
+	var goCode string
+	g := codegen.NewWithOptions(options)
+	timePhase("codegen", func() {
+		goCode = g.Generate(program)
+	})
+	if err := checkErrorLines(source, lines, g.Errors()); err != nil {
+		printCompilationError(source, err.(*compileError).errors)
+		os.Exit(1)
+	}
+	if !exportsAPI(program, options.AutoExport) {
+		printWarning(fmt.Sprintf("package %s exports nothing; declare its API with pub, or set auto_export in gos.mod", program.Package))
+	}
+
+	output := flags.output
+	if output == "" {
+		output = dir
+	}
+	if err := writeLibrary(output, module, program.Package, goCode, options.RuntimePath, goModVersion(dir)); err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	compileTime := time.Since(start)
+
+	// The package must build for Go modules to import it
+	printStatus("Compiled in", compileTime.String())
+	printStatus("Building package", ColorCyan+module+ColorReset)
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = output
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	buildTime := timePhase("go build", func() {
+		err = cmd.Run()
+	})
+	if err != nil {
+		printError(fmt.Sprintf("building package %s: %v", module, err))
+		os.Exit(1)
+	}
+
+	printSuccess(fmt.Sprintf("built package %s of module %s in '%s' in %v", program.Package, module, output, compileTime+buildTime))
+	printTimings()
+}
+
+// libraryFiles returns the .gos files of the package at source: the file
+// itself, or the files of the directory other than its tests, in order
+func libraryFiles(source string) ([]string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("file '%s' does not exist", source)
+	}
+	if !info.IsDir() {
+		if !isGosFile(source) {
+			return nil, fmt.Errorf("%s is not a .gos file", source)
+		}
+		return []string{source}, nil
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isGosFile(entry.Name()) && !isTestFile(entry.Name()) {
+			files = append(files, filepath.Join(source, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .gos files in %s", source)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parsePackage parses the files of a package into one program, with the
+// imports and statements of each file in turn, so the startup code of the
+// files runs in order. The files must all declare the same package, other
+// than main, and may only import Go packages. The lines of each file follow
+// those of the files before it in the program, and the sourceLines tell
+// which file and line they are.
+func parsePackage(files []string) (*ast.Program, sourceLines, error) {
+	var program *ast.Program
+	imported := make(map[string]bool)
+	firstLines := make([]int, len(files)) // the line of the program each file starts after
+	lines := func(line int) (string, int) {
+		i := sort.Search(len(files), func(i int) bool { return firstLines[i] >= line }) - 1
+		if i < 0 {
+			return files[0], line
+		}
+		return files[i], line - firstLines[i]
+	}
+	offset := 0
+	for i, file := range files {
+		p, err := parseFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		firstLines[i] = offset
+		ast.ShiftLines(p, offset)
+		offset += strings.Count(string(content), "\n") + 1
+
+		if p.Package == "main" {
+			return nil, nil, fmt.Errorf("%s is in package main, which is a program; a library declares its package, as in package %s",
+				file, packageName(filepath.Dir(file)))
+		}
+		if program == nil {
+			program = &ast.Program{Package: p.Package}
+		} else if p.Package != program.Package {
+			return nil, nil, fmt.Errorf("%s is in package %s, but %s is in package %s", file, p.Package, files[0], program.Package)
+		}
+		if program.Doc == "" {
+			program.Doc = p.Doc
+		}
+
+		for _, imp := range p.Imports {
+			for _, pkg := range imp.Packages() {
+				if strings.HasSuffix(pkg.Path, ".gos") {
+					return nil, nil, &compileError{file: file, phase: "Checking", errors: []string{
+						fmt.Sprintf("a library can only import Go packages, not %s", pkg.Path),
+					}}
+				}
+			}
+			if !imported[imp.String()] {
+				imported[imp.String()] = true
+				program.Imports = append(program.Imports, imp)
+			}
+		}
+		program.Statements = append(program.Statements, p.Statements...)
+	}
+	return program, lines, nil
+}
+
+// packageName returns the name a package in dir could have, for messages
+func packageName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if name := strings.ToLower(filepath.Base(abs)); err == nil && token.IsIdentifier(name) {
+		return name
+	}
+	return "name"
+}
+
+// libraryModule returns the module path of the package in dir: the module
+// of its gos.mod with the path of dir within the project, or the package
+// name when there is no gos.mod
+func libraryModule(dir, pkg string) (string, error) {
+	mod, err := findModFile(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read gos.mod: %v", err)
+	}
+	if mod == nil || mod.Module == "" {
+		return pkg, nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(filepath.Dir(mod.Path), abs)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(mod.Module, filepath.ToSlash(rel)), nil
+}
+
+// goModVersion returns the Go version of the project of dir, from its
+// gos.mod, or the version generated modules declare
+func goModVersion(dir string) string {
+	if mod, err := findModFile(dir); err == nil && mod != nil && mod.GoVersion != "" {
+		return mod.GoVersion
+	}
+	return goVersion
+}
+
+// exportsAPI reports whether a program exports any function or struct
+func exportsAPI(program *ast.Program, autoExport bool) bool {
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionDecl:
+			if s.Name != "main" && s.Name != "init" && (s.Public || autoExport) {
+				return true
+			}
+		case *ast.StructDecl:
+			if s.Public || autoExport {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeLibrary writes the Go code of package pkg into dir as the module
+// called module, with the copy of the runtime package the code imports at
+// runtimePath. The code is gofmt'd, as Go packages are. A go.mod that dir
+// has for the module already is kept, since it may require other modules.
+func writeLibrary(dir, module, pkg, goCode, runtimePath, version string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Code gofmt rejects is left for go build to report
+	if formatted, err := format.Source([]byte(goCode)); err == nil {
+		goCode = string(formatted)
+	}
+	if err := os.WriteFile(filepath.Join(dir, pkg+".go"), []byte(goCode), 0644); err != nil {
+		return fmt.Errorf("writing Go code: %v", err)
+	}
+	if strings.Contains(goCode, `"`+runtimePath+`"`) {
+		if err := copyRuntime(filepath.Join(dir, filepath.FromSlash(libraryRuntime))); err != nil {
+			return fmt.Errorf("copying runtime: %v", err)
+		}
+	}
+
+	goMod := filepath.Join(dir, "go.mod")
+	if content, err := os.ReadFile(goMod); err == nil && modulePath(string(content)) == module {
+		return nil
+	}
+	content := fmt.Sprintf("module %s\n\ngo %s\n", module, version)
+	if err := os.WriteFile(goMod, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing go.mod: %v", err)
+	}
+	return nil
+}
+
+// modulePath returns the module path a go.mod declares
+func modulePath(goMod string) string {
+	for _, line := range strings.Split(goMod, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
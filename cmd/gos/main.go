@@ -1,197 +1,57 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/checker"
 	"github.com/GrandpaEJ/go-script/pkg/codegen"
+	"github.com/GrandpaEJ/go-script/pkg/gopkg"
 	"github.com/GrandpaEJ/go-script/pkg/lexer"
 	"github.com/GrandpaEJ/go-script/pkg/parser"
 	"github.com/GrandpaEJ/go-script/pkg/stdlib"
 )
 
-const (
-	version = "0.1.0"
-	usage   = `Go-Script Compiler v%s
-
-Usage:
-    gos <command> [arguments]
-
-Commands:
-    run <file>              Compile and run a .gos file
-    build <file>            Compile a .gos file to Go code
-    build -o <file>         Compile and create binary executable
-    build -go <file>        Compile to Go code (same as build)
-    debug <file>            Compile and run with debug information
-
-    # Package Management
-    init                    Initialize a new Go-Script project
-    mod init <name>         Initialize a new module
-    mod tidy                Clean up module dependencies
-    mod download            Download module dependencies
-
-    # Module Commands
-    install <module>        Install a Go-Script module
-    uninstall <module>      Uninstall a Go-Script module
-    list                    List installed modules
-    search <query>          Search for available modules
-
-    # Standard Library
-    stdlib                  Show available import aliases
-
-    version                 Show version information
-    help                    Show this help message
-
-Examples:
-    gos run hello.gos
-    gos build main.gos
-    gos build -o myapp main.gos
-    gos debug main.gos
-    gos init
-    gos mod init myproject
-    gos install math-utils
-    gos list
-`
-)
-
-// ANSI color codes
-const (
-	ColorReset  = "\033[0m"
-	ColorRed    = "\033[31m"
-	ColorGreen  = "\033[32m"
-	ColorYellow = "\033[33m"
-	ColorBlue   = "\033[34m"
-	ColorPurple = "\033[35m"
-	ColorCyan   = "\033[36m"
-	ColorWhite  = "\033[37m"
-	ColorBold   = "\033[1m"
-)
+const version = "0.1.0"
 
 func main() {
-	if len(os.Args) < 2 {
-		printUsage()
-		os.Exit(1)
+	// The flags every command takes can also come before the command
+	global := flag.NewFlagSet("gos", flag.ExitOnError)
+	addCommonFlags(global)
+	global.Usage = func() {
+		printUsage(os.Stderr)
 	}
+	global.Parse(os.Args[1:])
+	setupColors()
 
-	command := os.Args[1]
-
-	switch command {
-	case "run":
-		if len(os.Args) < 3 {
-			printError("run command requires a file argument")
-			printUsage()
-			os.Exit(1)
-		}
-		runFile(os.Args[2])
-	case "build":
-		if len(os.Args) < 3 {
-			printError("build command requires a file argument")
-			printUsage()
-			os.Exit(1)
-		}
-		// Handle build flags
-		if len(os.Args) >= 4 && os.Args[2] == "-o" {
-			// gos build -o output file.gos
-			if len(os.Args) < 5 {
-				printError("build -o requires output name and file argument")
-				printUsage()
-				os.Exit(1)
-			}
-			buildBinary(os.Args[4], os.Args[3])
-		} else if len(os.Args) >= 4 && os.Args[2] == "-go" {
-			// gos build -go file.gos
-			buildFile(os.Args[3])
-		} else {
-			// gos build file.gos
-			buildFile(os.Args[2])
-		}
-	case "debug":
-		if len(os.Args) < 3 {
-			printError("debug command requires a file argument")
-			printUsage()
-			os.Exit(1)
-		}
-		debugFile(os.Args[2])
-	case "init":
-		initProject()
-	case "mod":
-		if len(os.Args) < 3 {
-			printError("mod command requires a subcommand")
-			printUsage()
-			os.Exit(1)
-		}
-		handleModCommand(os.Args[2:])
-	case "install":
-		if len(os.Args) < 3 {
-			printError("install command requires a module name")
-			printUsage()
-			os.Exit(1)
-		}
-		installModule(os.Args[2])
-	case "uninstall":
-		if len(os.Args) < 3 {
-			printError("uninstall command requires a module name")
-			printUsage()
-			os.Exit(1)
-		}
-		uninstallModule(os.Args[2])
-	case "list":
-		listModules()
-	case "search":
-		if len(os.Args) < 3 {
-			printError("search command requires a query")
-			printUsage()
-			os.Exit(1)
-		}
-		searchModules(os.Args[2])
-	case "stdlib":
-		showStdlibAliases()
-	case "version":
-		fmt.Printf("%sGo-Script v%s%s\n", ColorBold, version, ColorReset)
-	case "help":
-		printUsage()
-	default:
-		printError(fmt.Sprintf("unknown command '%s'", command))
-		printUsage()
-		os.Exit(1)
+	args := global.Args()
+	if len(args) < 1 {
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
-}
-
-func printUsage() {
-	fmt.Printf(usage, version)
-}
-
-// Enhanced error formatting functions
-func printError(message string) {
-	fmt.Printf("%s%sError:%s %s\n", ColorBold, ColorRed, ColorReset, message)
-}
-
-func printSuccess(message string) {
-	fmt.Printf("%s%sSuccess:%s %s\n", ColorBold, ColorGreen, ColorReset, message)
-}
-
-func printWarning(message string) {
-	fmt.Printf("%s%sWarning:%s %s\n", ColorBold, ColorYellow, ColorReset, message)
-}
-
-func printInfo(message string) {
-	fmt.Printf("%s%sInfo:%s %s\n", ColorBold, ColorBlue, ColorReset, message)
-}
-
-func printCompilationError(filename string, errors []string) {
-	fmt.Printf("%s%sCompilation failed:%s %s%s%s\n", ColorBold, ColorRed, ColorReset, ColorCyan, filename, ColorReset)
-	fmt.Println()
 
-	for i, err := range errors {
-		fmt.Printf("%s%d.%s %s\n", ColorYellow, i+1, ColorReset, err)
+	name := args[0]
+	if cmd := findCommand(name); cmd != nil {
+		cmd.execute(args[1:])
+		return
 	}
 
-	fmt.Println()
-	fmt.Printf("%sHint:%s Check your syntax, especially indentation and colons after function definitions.\n", ColorBlue, ColorReset)
+	// gos file.gos runs the file, so a script can start with the line
+	// #!/usr/bin/env gos
+	if strings.HasSuffix(name, ".gos") {
+		runFile(name, programArgs(args[1:]), &buildFlags{})
+		return
+	}
+	printError(fmt.Sprintf("unknown command '%s'", name))
+	fmt.Fprintln(os.Stderr, "Run 'gos help' for the list of commands.")
+	os.Exit(2)
 }
 
 func measureExecutionTime(fn func()) time.Duration {
@@ -200,42 +60,10 @@ func measureExecutionTime(fn func()) time.Duration {
 	return time.Since(start)
 }
 
-func runFile(filename string) {
-	// Check if file exists and has .gos extension
-	if !strings.HasSuffix(filename, ".gos") {
-		printError("file must have .gos extension")
-		os.Exit(1)
-	}
-
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		printError(fmt.Sprintf("file '%s' does not exist", filename))
-		os.Exit(1)
-	}
-
-	// Compile to Go code with timing
-	var goCode string
-	var err error
-	compileTime := measureExecutionTime(func() {
-		goCode, err = compileFile(filename)
-	})
-
-	if err != nil {
-		if strings.Contains(err.Error(), "Parsing errors:") {
-			// Extract error list from error message
-			errorMsg := err.Error()
-			lines := strings.Split(errorMsg, "\n")
-			var errors []string
-			for _, line := range lines[1:] { // Skip first line "Parsing errors:"
-				if strings.TrimSpace(line) != "" {
-					errors = append(errors, strings.TrimPrefix(strings.TrimSpace(line), "- "))
-				}
-			}
-			printCompilationError(filename, errors)
-		} else {
-			printError(fmt.Sprintf("compilation failed: %v", err))
-		}
-		os.Exit(1)
-	}
+// runFile compiles and runs a .gos file with the given arguments, and exits
+// with the program's exit code if it fails
+func runFile(filename string, args []string, flags *buildFlags) {
+	goCode, compileTime := compileOrExit(filename)
 
 	// Create temporary directory for generated Go code
 	tempDir, err := os.MkdirTemp("", "gos-*")
@@ -243,134 +71,60 @@ func runFile(filename string) {
 		printError(fmt.Sprintf("creating temp directory: %v", err))
 		os.Exit(1)
 	}
-	defer os.RemoveAll(tempDir)
-
-	// Write Go code to temporary file
-	goFile := filepath.Join(tempDir, "main.go")
-	err = os.WriteFile(goFile, []byte(goCode), 0644)
-	if err != nil {
-		printError(fmt.Sprintf("writing Go code: %v", err))
-		os.Exit(1)
+	// exit removes the directory, which a deferred call would not do
+	exit := func(code int) {
+		printTimings()
+		os.RemoveAll(tempDir)
+		os.Exit(code)
 	}
 
-	// Initialize Go module in temp directory
-	cmd := exec.Command("go", "mod", "init", "temp")
-	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
-		printError(fmt.Sprintf("initializing Go module: %v", err))
-		os.Exit(1)
+	// Build the program rather than use go run, which reports every
+	// failure as exit code 1
+	program := binaryPath(tempDir)
+	if _, err := goBuild(tempDir, goCode, program, flags); err != nil {
+		printError(fmt.Sprintf("building program: %v", err))
+		exit(1)
 	}
 
 	// Run the Go code with timing
-	fmt.Printf("%sCompiled in:%s %v\n", ColorGreen, ColorReset, compileTime)
-	fmt.Printf("%sRunning:%s %s%s%s\n", ColorBlue, ColorReset, ColorCyan, filename, ColorReset)
-	fmt.Println()
+	printStatus("Compiled in", compileTime.String())
+	printStatus("Running", ColorCyan+filename+ColorReset)
 
-	var execTime time.Duration
-	execTime = measureExecutionTime(func() {
-		cmd = exec.Command("go", "run", "main.go")
-		cmd.Dir = tempDir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-
-		if err := cmd.Run(); err != nil {
-			printError(fmt.Sprintf("runtime error: %v", err))
-			os.Exit(1)
-		}
+	var code int
+	execTime := timePhase("run", func() {
+		code, err = runBinary(program, filename, args)
 	})
-
-	fmt.Println()
-	fmt.Printf("%sExecution completed in:%s %v\n", ColorGreen, ColorReset, execTime)
-}
-
-func buildFile(filename string) {
-	// Check if file exists and has .gos extension
-	if !strings.HasSuffix(filename, ".gos") {
-		printError("file must have .gos extension")
-		os.Exit(1)
+	if err != nil {
+		printError(fmt.Sprintf("running program: %v", err))
+		exit(1)
 	}
-
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		printError(fmt.Sprintf("file '%s' does not exist", filename))
-		os.Exit(1)
+	if code != 0 {
+		printVerbose("exit code %d", code)
+		exit(code)
 	}
 
-	// Compile to Go code with timing
-	var goCode string
-	var err error
-	compileTime := measureExecutionTime(func() {
-		goCode, err = compileFile(filename)
-	})
-
-	if err != nil {
-		if strings.Contains(err.Error(), "Parsing errors:") {
-			// Extract error list from error message
-			errorMsg := err.Error()
-			lines := strings.Split(errorMsg, "\n")
-			var errors []string
-			for _, line := range lines[1:] { // Skip first line "Parsing errors:"
-				if strings.TrimSpace(line) != "" {
-					errors = append(errors, strings.TrimPrefix(strings.TrimSpace(line), "- "))
-				}
-			}
-			printCompilationError(filename, errors)
-		} else {
-			printError(fmt.Sprintf("compilation failed: %v", err))
-		}
-		os.Exit(1)
-	}
+	printStatus("Execution completed in", execTime.String())
+	exit(0)
+}
 
-	// Generate output filename
-	baseName := strings.TrimSuffix(filename, ".gos")
-	outputFile := baseName + ".go"
+// buildFile compiles a .gos file to Go code next to it
+func buildFile(filename string) {
+	goCode, compileTime := compileOrExit(filename)
 
-	// Write Go code to file
-	err = os.WriteFile(outputFile, []byte(goCode), 0644)
-	if err != nil {
+	// Write Go code to a file with the .go extension
+	outputFile := strings.TrimSuffix(filename, ".gos") + ".go"
+	if err := os.WriteFile(outputFile, []byte(goCode), 0644); err != nil {
 		printError(fmt.Sprintf("writing output file: %v", err))
 		os.Exit(1)
 	}
 
 	printSuccess(fmt.Sprintf("compiled '%s' to '%s' in %v", filename, outputFile, compileTime))
+	printTimings()
 }
 
-func buildBinary(filename, outputName string) {
-	// Check if file exists and has .gos extension
-	if !strings.HasSuffix(filename, ".gos") {
-		printError("file must have .gos extension")
-		os.Exit(1)
-	}
-
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		printError(fmt.Sprintf("file '%s' does not exist", filename))
-		os.Exit(1)
-	}
-
-	// Compile to Go code with timing
-	var goCode string
-	var err error
-	compileTime := measureExecutionTime(func() {
-		goCode, err = compileFile(filename)
-	})
-
-	if err != nil {
-		if strings.Contains(err.Error(), "Parsing errors:") {
-			// Extract error list from error message
-			errorMsg := err.Error()
-			lines := strings.Split(errorMsg, "\n")
-			var errors []string
-			for _, line := range lines[1:] { // Skip first line "Parsing errors:"
-				if strings.TrimSpace(line) != "" {
-					errors = append(errors, strings.TrimPrefix(strings.TrimSpace(line), "- "))
-				}
-			}
-			printCompilationError(filename, errors)
-		} else {
-			printError(fmt.Sprintf("compilation failed: %v", err))
-		}
-		os.Exit(1)
-	}
+// buildBinary compiles a .gos file into an executable binary
+func buildBinary(filename, outputName string, flags *buildFlags) {
+	goCode, compileTime := compileOrExit(filename)
 
 	// Create temporary directory for generated Go code
 	tempDir, err := os.MkdirTemp("", "gos-*")
@@ -380,201 +134,201 @@ func buildBinary(filename, outputName string) {
 	}
 	defer os.RemoveAll(tempDir)
 
-	// Write Go code to temporary file
-	goFile := filepath.Join(tempDir, "main.go")
-	err = os.WriteFile(goFile, []byte(goCode), 0644)
+	printStatus("Compiled in", compileTime.String())
+	printStatus("Building binary", ColorCyan+outputName+ColorReset)
+
+	// go build runs in the temporary directory, so the output path must
+	// be absolute
+	outputPath, err := filepath.Abs(outputName)
 	if err != nil {
-		printError(fmt.Sprintf("writing Go code: %v", err))
+		printError(err.Error())
 		os.Exit(1)
 	}
-
-	// Initialize Go module in temp directory
-	cmd := exec.Command("go", "mod", "init", "temp")
-	cmd.Dir = tempDir
-	if err := cmd.Run(); err != nil {
-		printError(fmt.Sprintf("initializing Go module: %v", err))
+	buildTime, err := goBuild(tempDir, goCode, outputPath, flags)
+	if err != nil {
+		printError(fmt.Sprintf("building binary: %v", err))
+		os.RemoveAll(tempDir)
 		os.Exit(1)
 	}
 
-	// Build binary
-	fmt.Printf("%sCompiled in:%s %v\n", ColorGreen, ColorReset, compileTime)
-	fmt.Printf("%sBuilding binary:%s %s%s%s\n", ColorBlue, ColorReset, ColorCyan, outputName, ColorReset)
-
-	// Get absolute path for output
-	currentDir, _ := os.Getwd()
-	outputPath := filepath.Join(currentDir, outputName)
-
-	var buildTime time.Duration
-	buildTime = measureExecutionTime(func() {
-		cmd = exec.Command("go", "build", "-o", outputPath, "main.go")
-		cmd.Dir = tempDir
-		if err := cmd.Run(); err != nil {
-			printError(fmt.Sprintf("building binary: %v", err))
-			os.Exit(1)
-		}
-	})
-
 	printSuccess(fmt.Sprintf("built binary '%s' in %v (total: %v)", outputName, buildTime, compileTime+buildTime))
+	printTimings()
 }
 
-func debugFile(filename string) {
-	// Check if file exists and has .gos extension
-	if !strings.HasSuffix(filename, ".gos") {
-		printError("file must have .gos extension")
-		os.Exit(1)
+// compileError is returned by compileFile when the source has parse or
+// semantic errors, so callers can list them individually
+type compileError struct {
+	file   string // the .gos file with the errors
+	phase  string // "Parsing" or "Checking"
+	errors []string
+}
+
+func (e *compileError) Error() string {
+	var errorMsg strings.Builder
+	errorMsg.WriteString(e.phase + " errors:\n")
+	for _, err := range e.errors {
+		errorMsg.WriteString(fmt.Sprintf("  - %s\n", err))
 	}
+	return errorMsg.String()
+}
 
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		printError(fmt.Sprintf("file '%s' does not exist", filename))
-		os.Exit(1)
+func compileFile(filename string) (string, error) {
+	program, err := parseFile(filename)
+	if err != nil {
+		return "", err
 	}
 
-	fmt.Printf("%sDebug Mode:%s %s%s%s\n", ColorYellow, ColorReset, ColorCyan, filename, ColorReset)
-	fmt.Println()
+	// Check struct literals and other whole-program rules
+	c := newChecker()
+	timePhase("check", func() {
+		c.Check(program)
+	})
+	if err := checkResult(filename, c); err != nil {
+		return "", err
+	}
 
-	// Show lexer tokens
-	content, err := os.ReadFile(filename)
+	options, err := codegenOptions(filename)
 	if err != nil {
-		printError(fmt.Sprintf("reading file: %v", err))
-		os.Exit(1)
+		return "", err
 	}
 
-	fmt.Printf("%sLexer Tokens:%s\n", ColorBlue, ColorReset)
-	l := lexer.New(string(content))
-	tokenCount := 0
-	for {
-		tok := l.NextToken()
-		if tok.Type == lexer.EOF {
-			break
-		}
-		if tok.Type != lexer.COMMENT && tok.Type != lexer.NEWLINE {
-			fmt.Printf("  %s%d.%s %s%s%s: %q\n", ColorYellow, tokenCount+1, ColorReset,
-				ColorGreen, lexer.TokenTypeString(tok.Type), ColorReset, tok.Literal)
-			tokenCount++
-		}
+	// Generate Go code
+	var goCode string
+	g := codegen.NewWithOptions(options)
+	timePhase("codegen", func() {
+		goCode = g.Generate(program)
+	})
+	if err := checkErrors(filename, g.Errors()); err != nil {
+		return "", err
 	}
-	fmt.Printf("Total tokens: %d\n\n", tokenCount)
 
-	// Compile and run with debug info
-	runFile(filename)
+	return goCode, nil
 }
 
-func compileFile(filename string) (string, error) {
-	// Read the source file
+// goPackages loads the Go packages programs refer to for the checker, with
+// the standard library cached per Go version in the user's cache directory
+var goPackages = sync.OnceValue(func() *gopkg.Loader {
+	return gopkg.NewLoader(gopkg.DefaultCacheDir())
+})
+
+// newChecker returns a checker that also checks the use of Go packages
+func newChecker() *checker.Checker {
+	c := checker.New()
+	c.UsePackages(goPackages())
+	return c
+}
+
+// parseFile reads and parses a .gos file
+func parseFile(filename string) (*ast.Program, error) {
 	content, err := os.ReadFile(filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return nil, fmt.Errorf("failed to read file: %v", err)
 	}
 
-	// Create lexer
-	l := lexer.New(string(content))
-
-	// Create parser
-	p := parser.New(l)
-
-	// Parse the program
-	program := p.ParseProgram()
+	// The parser lexes as it goes, so lexing is timed on its own in a
+	// separate pass, and only when --timing asks for it
+	if showTiming {
+		timePhase("lex", func() {
+			l := lexer.New(string(content))
+			for l.NextToken().Type != lexer.EOF {
+			}
+		})
+	}
 
-	// Check for parsing errors
+	p := parser.New(lexer.New(string(content)))
+	var program *ast.Program
+	timePhase("parse", func() {
+		program = p.ParseProgram()
+	})
 	if errors := p.Errors(); len(errors) > 0 {
-		var errorMsg strings.Builder
-		errorMsg.WriteString("Parsing errors:\n")
-		for _, err := range errors {
-			errorMsg.WriteString(fmt.Sprintf("  - %s\n", err))
-		}
-		return "", fmt.Errorf(errorMsg.String())
+		return nil, &compileError{file: filename, phase: "Parsing", errors: errors}
 	}
+	return program, nil
+}
 
-	// Generate Go code
-	generator := codegen.New()
-	goCode := generator.Generate(program)
-
-	// Add necessary imports if they're used
-	goCode = addRequiredImports(goCode)
+// sourceLines returns the .gos file and line that a line of a program is:
+// the line of its file, or for the files of a library compiled together,
+// see parsePackage, the line of the file it comes from
+type sourceLines func(line int) (string, int)
 
-	return goCode, nil
+// fileLines returns the sourceLines of a program parsed from one file
+func fileLines(filename string) sourceLines {
+	return func(line int) (string, int) {
+		return filename, line
+	}
 }
 
-func addRequiredImports(code string) string {
-	var imports []string
-
-	// Always add fmt for built-in functions (print, printf, etc.)
-	imports = append(imports, `"fmt"`)
+// checkResult returns the errors the checker found in the file as a
+// compileError, and prints its warnings
+func checkResult(filename string, c *checker.Checker) error {
+	return checkResultLines(filename, fileLines(filename), c)
+}
 
-	// Add other imports based on usage
-	if strings.Contains(code, "bufio.") {
-		imports = append(imports, `"bufio"`)
+// checkResultLines is checkResult for the program of source, a file or
+// the directory of a library, whose lines are those lines gives
+func checkResultLines(source string, lines sourceLines, c *checker.Checker) error {
+	if err := checkErrorLines(source, lines, c.Errors()); err != nil {
+		return err
 	}
-	if strings.Contains(code, "os.") {
-		imports = append(imports, `"os"`)
+	for _, warning := range c.Warnings() {
+		if shownWarnings != nil {
+			if shownWarnings[warning] {
+				continue
+			}
+			shownWarnings[warning] = true
+		}
+		printWarning(positioned(lines, warning))
 	}
-	if strings.Contains(code, "time.") {
-		imports = append(imports, `"time"`)
+	return nil
+}
+
+// checkErrors returns the errors the checker or the code generator found
+// in the file as a compileError, positioned in the file, or nil if they
+// found none
+func checkErrors(filename string, errors []string) error {
+	return checkErrorLines(filename, fileLines(filename), errors)
+}
+
+// checkErrorLines is checkErrors for the program of source, whose lines
+// are those lines gives
+func checkErrorLines(source string, lines sourceLines, errors []string) error {
+	if len(errors) == 0 {
+		return nil
 	}
-	if strings.Contains(code, "strings.") {
-		imports = append(imports, `"strings"`)
+	positionedErrors := make([]string, len(errors))
+	for i, err := range errors {
+		positionedErrors[i] = positioned(lines, err)
 	}
-	if strings.Contains(code, "strconv.") {
-		imports = append(imports, `"strconv"`)
+	return &compileError{file: source, phase: "Checking", errors: positionedErrors}
+}
+
+// positioned returns a checker message about a line, as line 3: message,
+// with the position in the .gos file: main.gos:3: message
+func positioned(lines sourceLines, msg string) string {
+	rest, ok := strings.CutPrefix(msg, "line ")
+	if !ok {
+		return msg
 	}
-	if strings.Contains(code, "reflect.") {
-		imports = append(imports, `"reflect"`)
+	n, text, ok := strings.Cut(rest, ": ")
+	if line, err := strconv.Atoi(n); ok && err == nil {
+		file, line := lines(line)
+		return fmt.Sprintf("%s:%d: %s", file, line, text)
 	}
+	return msg
+}
 
-	// Check if imports already exist to avoid duplicates
-	hasExistingImports := strings.Contains(code, "import (") || strings.Contains(code, `import "`)
-
-	// Only add automatic imports if there are no existing imports
-	if !hasExistingImports {
-		// Check for math usage (power operator)
-		if strings.Contains(code, "math.Pow") {
-			imports = append(imports, `"math"`)
-		}
+// codegenOptions returns the code generation settings of the project of a
+// .gos file, from its gos.mod if it has one
+func codegenOptions(filename string) (codegen.Options, error) {
+	options := codegen.Options{}
+	mod, err := findModFile(filepath.Dir(filename))
+	if err != nil {
+		return options, fmt.Errorf("failed to read gos.mod: %v", err)
 	}
-
-	// If we have imports to add, insert them
-	if len(imports) > 0 {
-		lines := strings.Split(code, "\n")
-		var result []string
-
-		// Find package declaration
-		packageFound := false
-		importSectionAdded := false
-
-		for _, line := range lines {
-			result = append(result, line)
-
-			if strings.HasPrefix(line, "package ") {
-				packageFound = true
-			}
-
-			// Add imports after package declaration and empty line
-			if packageFound && !importSectionAdded && line == "" {
-				result = append(result, "import (")
-				for _, imp := range imports {
-					result = append(result, "\t"+imp)
-				}
-				result = append(result, ")")
-				result = append(result, "")
-				importSectionAdded = true
-			}
-		}
-
-		// If no empty line was found after package, add imports at the end
-		if packageFound && !importSectionAdded {
-			result = append(result, "")
-			result = append(result, "import (")
-			for _, imp := range imports {
-				result = append(result, "\t"+imp)
-			}
-			result = append(result, ")")
-			result = append(result, "")
-		}
-
-		return strings.Join(result, "\n")
+	if mod != nil {
+		options.AutoExport = mod.boolConfig("auto_export")
 	}
-
-	return code
+	return options, nil
 }
 
 // Package management functions
@@ -589,6 +343,7 @@ go 1.21
 
 # Go-Script module configuration
 gos_version "1.0.0"
+version "0.1.0"  # stamped into release builds
 
 # Dependencies
 require (
@@ -600,6 +355,7 @@ config {
     default_package "main"
     output_dir "./generated"
     module_paths ["./modules", "./lib"]
+    auto_export false  # export all names without pub
 }
 `
 
@@ -666,10 +422,12 @@ func initModule(name string) {
 go 1.21
 
 gos_version "1.0.0"
+version "0.1.0"
 
 config {
     default_package "main"
     output_dir "./generated"
+    auto_export false
 }
 `, name)
 
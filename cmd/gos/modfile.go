@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// modFile holds the settings read from a project's gos.mod
+type modFile struct {
+	Path       string
+	Module     string
+	GoVersion  string
+	GosVersion string
+	Version    string            // the project's version, stamped into release builds
+	Config     map[string]string // raw values from the config block
+}
+
+// findModFile looks for gos.mod in dir and its parents and parses the first
+// one found. It returns nil if there is none.
+func findModFile(dir string) (*modFile, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		path := filepath.Join(dir, "gos.mod")
+		content, err := os.ReadFile(path)
+		if err == nil {
+			mod := parseModFile(string(content))
+			mod.Path = path
+			return mod, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// parseModFile parses the line-based gos.mod format. Unknown directives are
+// ignored so older compilers can read newer files.
+func parseModFile(content string) *modFile {
+	mod := &modFile{Config: make(map[string]string)}
+	inConfig := false
+
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if inConfig {
+			if line == "}" {
+				inConfig = false
+				continue
+			}
+			key, value, _ := strings.Cut(line, " ")
+			mod.Config[key] = strings.Trim(strings.TrimSpace(value), `"`)
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch key {
+		case "module":
+			mod.Module = value
+		case "go":
+			mod.GoVersion = value
+		case "gos_version":
+			mod.GosVersion = value
+		case "version":
+			mod.Version = value
+		case "config":
+			inConfig = value == "{"
+		}
+	}
+
+	return mod
+}
+
+// boolConfig reports whether a config key is set to true
+func (m *modFile) boolConfig(key string) bool {
+	return m.Config[key] == "true"
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Program output goes to stdout and everything gos reports to stderr, so
+// the output of a script can be piped. Status lines, such as the compile
+// time, are only shown on a terminal unless -v asks for them.
+
+// Output settings, set from the common flags by parseCommonFlags
+var (
+	verbosity  = 0     // -1 with -q, 1 with -v
+	showTiming = false // --timing
+
+	// shownWarnings, when set, holds the checker warnings already shown,
+	// so watch mode shows each once rather than on every build
+	shownWarnings map[string]bool
+)
+
+// ANSI color codes, cleared by setupColors when colors are not wanted
+var (
+	ColorReset  = "\033[0m"
+	ColorRed    = "\033[31m"
+	ColorGreen  = "\033[32m"
+	ColorYellow = "\033[33m"
+	ColorBlue   = "\033[34m"
+	ColorPurple = "\033[35m"
+	ColorCyan   = "\033[36m"
+	ColorWhite  = "\033[37m"
+	ColorBold   = "\033[1m"
+)
+
+// addCommonFlags adds the flags every command takes to fs: -q/--quiet,
+// -v/--verbose and --timing. They can also come before the command, so
+// they set the output settings rather than reset them to a default.
+func addCommonFlags(fs *flag.FlagSet) {
+	quiet := func(string) error {
+		verbosity = -1
+		return nil
+	}
+	verbose := func(string) error {
+		verbosity = 1
+		return nil
+	}
+	fs.BoolFunc("q", "only report errors", quiet)
+	fs.BoolFunc("quiet", "only report errors", quiet)
+	fs.BoolFunc("v", "always show status lines, and show the steps taken", verbose)
+	fs.BoolFunc("verbose", "always show status lines, and show the steps taken", verbose)
+	fs.BoolFunc("timing", "report how long each compilation phase took", func(string) error {
+		showTiming = true
+		return nil
+	})
+}
+
+// setupColors turns colors off when NO_COLOR is set, the terminal cannot
+// show them, or the output of gos is redirected
+func setupColors() {
+	if os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(os.Stdout) && isTerminal(os.Stderr) {
+		return
+	}
+	for _, color := range []*string{&ColorReset, &ColorRed, &ColorGreen, &ColorYellow, &ColorBlue,
+		&ColorPurple, &ColorCyan, &ColorWhite, &ColorBold} {
+		*color = ""
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// showStatus reports whether status lines are shown
+func showStatus() bool {
+	return verbosity > 0 || verbosity == 0 && isTerminal(os.Stderr)
+}
+
+// printStatus prints a status line such as "Compiled in: 2ms"
+func printStatus(label, value string) {
+	if showStatus() {
+		fmt.Fprintf(os.Stderr, "%s%s:%s %s\n", ColorGreen, label, ColorReset, value)
+	}
+}
+
+// printVerbose prints details that only -v shows
+func printVerbose(format string, args ...interface{}) {
+	if verbosity > 0 {
+		fmt.Fprintf(os.Stderr, "%s"+format+"%s\n", append(append([]interface{}{ColorPurple}, args...), ColorReset)...)
+	}
+}
+
+func printError(message string) {
+	fmt.Fprintf(os.Stderr, "%s%sError:%s %s\n", ColorBold, ColorRed, ColorReset, message)
+}
+
+func printSuccess(message string) {
+	if verbosity >= 0 {
+		fmt.Fprintf(os.Stderr, "%s%sSuccess:%s %s\n", ColorBold, ColorGreen, ColorReset, message)
+	}
+}
+
+func printWarning(message string) {
+	if verbosity >= 0 {
+		fmt.Fprintf(os.Stderr, "%s%sWarning:%s %s\n", ColorBold, ColorYellow, ColorReset, message)
+	}
+}
+
+func printInfo(message string) {
+	if verbosity >= 0 {
+		fmt.Fprintf(os.Stderr, "%s%sInfo:%s %s\n", ColorBold, ColorBlue, ColorReset, message)
+	}
+}
+
+func printCompilationError(filename string, errors []string) {
+	fmt.Fprintf(os.Stderr, "%s%sCompilation failed:%s %s%s%s\n", ColorBold, ColorRed, ColorReset, ColorCyan, filename, ColorReset)
+	fmt.Fprintln(os.Stderr)
+
+	for i, err := range errors {
+		fmt.Fprintf(os.Stderr, "%s%d.%s %s\n", ColorYellow, i+1, ColorReset, err)
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "%sHint:%s Check your syntax, especially indentation and colons after function definitions.\n", ColorBlue, ColorReset)
+}
+
+// phase is the duration of one step of compiling and running a program
+type phase struct {
+	name     string
+	duration time.Duration
+}
+
+// phases are the steps timed so far, which --timing reports
+var phases []phase
+
+// timePhase runs fn and records its duration under name
+func timePhase(name string, fn func()) time.Duration {
+	duration := measureExecutionTime(fn)
+	phases = append(phases, phase{name, duration})
+	return duration
+}
+
+// printTimings prints the phase durations when --timing is given
+func printTimings() {
+	if !showTiming || len(phases) == 0 {
+		return
+	}
+	var total time.Duration
+	fmt.Fprintf(os.Stderr, "%sTiming:%s\n", ColorBold, ColorReset)
+	for _, p := range phases {
+		fmt.Fprintf(os.Stderr, "  %-10s %v\n", p.name, p.duration)
+		// Parsing lexes the source too, so the lex pass is already counted
+		if p.name != "lex" {
+			total += p.duration
+		}
+	}
+	fmt.Fprintf(os.Stderr, "  %-10s %v\n", "total", total)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A release build compiles a .gos file once and builds a static binary for
+// each target platform into a directory, with a checksum manifest:
+//
+//	gos build --target linux/arm64,darwin/amd64,windows/amd64 -o dist/ tool.gos
+//
+// The binaries are named tool-linux-arm64, tool-darwin-amd64 and
+// tool-windows-amd64.exe. When gos.mod has a version, it is stamped into
+// the string variable version of the program.
+
+// checksumsFile is the manifest of a release build, in the format of
+// sha256sum, so sha256sum -c can check the binaries
+const checksumsFile = "SHA256SUMS"
+
+// A target is a platform to build for
+type target struct {
+	goos   string
+	goarch string
+}
+
+func (t target) String() string {
+	return t.goos + "/" + t.goarch
+}
+
+// parseTargets parses a comma-separated list of os/arch targets
+func parseTargets(list string) ([]target, error) {
+	var targets []target
+	seen := make(map[target]bool)
+	for _, item := range strings.Split(list, ",") {
+		goos, goarch, ok := strings.Cut(strings.TrimSpace(item), "/")
+		if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+			return nil, fmt.Errorf("invalid target '%s'; targets are written os/arch, as in linux/amd64", item)
+		}
+		t := target{goos, goarch}
+		if !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// binaryName returns the name of the binary for t in a release of the
+// program called name
+func (t target) binaryName(name string) string {
+	if t.goos == "windows" {
+		return fmt.Sprintf("%s-%s-%s.exe", name, t.goos, t.goarch)
+	}
+	return fmt.Sprintf("%s-%s-%s", name, t.goos, t.goarch)
+}
+
+// buildRelease builds the .gos file for each target into dir and writes
+// the checksums of the binaries to the manifest in dir
+func buildRelease(filename, dir string, targets []target, flags *buildFlags) {
+	goCode, compileTime := compileOrExit(filename)
+	printStatus("Compiled in", compileTime.String())
+
+	release := *flags
+	release.static = true
+	mod, err := findModFile(filepath.Dir(filename))
+	if err != nil {
+		printError(fmt.Sprintf("reading gos.mod: %v", err))
+		os.Exit(1)
+	}
+	if mod != nil && mod.Version != "" {
+		release.ldflags = strings.TrimSpace(release.ldflags + " -X main.version=" + mod.Version)
+	} else {
+		printVerbose("no version in gos.mod to stamp into the binaries")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		printError(fmt.Sprintf("creating output directory: %v", err))
+		os.Exit(1)
+	}
+	tempDir, err := os.MkdirTemp("", "gos-*")
+	if err != nil {
+		printError(fmt.Sprintf("creating temp directory: %v", err))
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tempDir)
+
+	name := strings.TrimSuffix(filepath.Base(filename), ".gos")
+	var manifest strings.Builder
+	for _, t := range targets {
+		binary := t.binaryName(name)
+		printStatus("Building", ColorCyan+t.String()+ColorReset)
+
+		outputPath, err := filepath.Abs(filepath.Join(dir, binary))
+		if err == nil {
+			release.goos, release.goarch = t.goos, t.goarch
+			_, err = goBuild(tempDir, goCode, outputPath, &release)
+		}
+		if err != nil {
+			printError(fmt.Sprintf("building %s: %v", t, err))
+			os.RemoveAll(tempDir)
+			os.Exit(1)
+		}
+
+		sum, err := fileChecksum(outputPath)
+		if err != nil {
+			printError(fmt.Sprintf("computing the checksum of %s: %v", binary, err))
+			os.RemoveAll(tempDir)
+			os.Exit(1)
+		}
+		fmt.Fprintf(&manifest, "%s  %s\n", sum, binary)
+	}
+
+	manifestPath := filepath.Join(dir, checksumsFile)
+	if err := os.WriteFile(manifestPath, []byte(manifest.String()), 0644); err != nil {
+		printError(fmt.Sprintf("writing checksums: %v", err))
+		os.RemoveAll(tempDir)
+		os.Exit(1)
+	}
+
+	printSuccess(fmt.Sprintf("built %d binaries in '%s', with checksums in '%s'", len(targets), dir, manifestPath))
+	printTimings()
+}
+
+// fileChecksum returns the hex SHA-256 checksum of the file at path
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/codegen"
+)
+
+// gos test runs the tests of .gos programs. The tests of name.gos are in
+// name_test.gos next to it. Each test file is compiled with the program it
+// tests into a Go test package, which is built into a test binary and run
+// in the directory of the test file:
+//
+//	gos test                  the test files of the current directory
+//	gos test ./...            and of its subdirectories
+//	gos test calc_test.gos    one test file
+
+// testFlags are the flags of gos test
+type testFlags struct {
+	run   string
+	cover bool
+}
+
+// runTests runs the test files the arguments name, and exits with code 1
+// if any of them fails
+func runTests(args []string, flags *testFlags) {
+	files, err := findTestFiles(args)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		printWarning("no test files; tests of name.gos go in name_test.gos")
+		return
+	}
+
+	failed := 0
+	for _, file := range files {
+		if !runTestFile(file, flags) {
+			failed++
+		}
+	}
+	printTimings()
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// isTestFile reports whether the file at path is a test file
+func isTestFile(path string) bool {
+	return strings.HasSuffix(filepath.Base(path), "_test.gos")
+}
+
+// findTestFiles returns the test files the arguments of gos test name
+func findTestFiles(args []string) ([]string, error) {
+	return findFiles(args, isTestFile, "is not a test file; test files are named name_test.gos")
+}
+
+// findFiles returns the files the arguments of a command name that match:
+// those of a directory, those of a directory and its subdirectories for
+// dir/..., or a file itself, which is an error with the given reason if it
+// does not match. No arguments name the current directory. Like go test,
+// ./... skips testdata and directories whose names start with . or _.
+func findFiles(args []string, match func(path string) bool, mismatch string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, arg := range args {
+		if root, ok := strings.CutSuffix(filepath.ToSlash(arg), "..."); ok {
+			root = strings.TrimSuffix(root, "/")
+			if root == "" {
+				root = "."
+			}
+			err := filepath.WalkDir(filepath.FromSlash(root), func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					name := d.Name()
+					if path != filepath.FromSlash(root) && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if match(path) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' does not exist", arg)
+		}
+		if !info.IsDir() {
+			if !match(arg) {
+				return nil, fmt.Errorf("'%s' %s", arg, mismatch)
+			}
+			add(arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && match(entry.Name()) {
+				add(filepath.Join(arg, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// compileTests compiles a test file, and the .gos file it tests if there
+// is one, to the Go files of a test package by name
+func compileTests(filename string) (map[string]string, error) {
+	tests, err := parseFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var code *ast.Program
+	codeFile := strings.TrimSuffix(filename, "_test.gos") + ".gos"
+	if _, err := os.Stat(codeFile); err == nil {
+		if code, err = parseFile(codeFile); err != nil {
+			return nil, err
+		}
+		c := newChecker()
+		timePhase("check", func() {
+			c.Check(code)
+		})
+		if err := checkResult(codeFile, c); err != nil {
+			return nil, err
+		}
+	}
+
+	c := newChecker()
+	timePhase("check", func() {
+		c.CheckTests(tests, code)
+	})
+	if err := checkResult(filename, c); err != nil {
+		return nil, err
+	}
+
+	options, err := codegenOptions(filename)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	codeGen := codegen.NewWithOptions(options)
+	var testGen *codegen.Generator
+	timePhase("codegen", func() {
+		if code != nil {
+			files["main.go"] = codeGen.Generate(code)
+		}
+		// Failed asserts report their line in the test file
+		options.SourceFile, err = filepath.Abs(filename)
+		options.OutputFile = "main_test.go"
+		testGen = codegen.NewWithOptions(options)
+		files["main_test.go"] = testGen.GenerateTests(tests, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkErrors(codeFile, codeGen.Errors()); err != nil {
+		return nil, err
+	}
+	if err := checkErrors(filename, testGen.Errors()); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// runTestFile builds and runs the tests of a test file, and prints a line
+// with the result, as go test does for a package. The output of the tests
+// is shown when they fail, or always with -v, which also lists each test.
+func runTestFile(filename string, flags *testFlags) bool {
+	fail := func(reason string) bool {
+		fmt.Printf("%sFAIL%s\t%s [%s]\n", ColorRed, ColorReset, filename, reason)
+		return false
+	}
+
+	files, err := compileTests(filename)
+	if err != nil {
+		if compErr, ok := err.(*compileError); ok {
+			printCompilationError(compErr.file, compErr.errors)
+		} else {
+			printError(fmt.Sprintf("compilation failed: %v", err))
+		}
+		return fail("build failed")
+	}
+
+	tempDir, err := os.MkdirTemp("", "gos-*")
+	if err != nil {
+		printError(fmt.Sprintf("creating temp directory: %v", err))
+		return fail("build failed")
+	}
+	defer os.RemoveAll(tempDir)
+
+	binary := binaryPath(tempDir)
+	if err := goTestBuild(tempDir, files, binary, flags); err != nil {
+		printError(fmt.Sprintf("building tests: %v", err))
+		return fail("build failed")
+	}
+
+	var args []string
+	if verbosity > 0 {
+		args = append(args, "-test.v")
+	}
+	if flags.run != "" {
+		// The Go name of test_add is Test_add
+		args = append(args, "-test.run", "(?i)"+flags.run)
+	}
+	var output bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = filepath.Dir(filename)
+	cmd.Stdout = &output
+	if verbosity > 0 {
+		cmd.Stdout = io.MultiWriter(os.Stdout, &output)
+	}
+	cmd.Stderr = cmd.Stdout
+
+	var runErr error
+	elapsed := timePhase("test", func() {
+		runErr = cmd.Run()
+	})
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		printError(fmt.Sprintf("running tests: %v", runErr))
+		return fail("run failed")
+	}
+	if runErr != nil && verbosity <= 0 {
+		os.Stdout.Write(output.Bytes())
+	}
+
+	result := fmt.Sprintf("%sok%s  ", ColorGreen, ColorReset)
+	if runErr != nil {
+		result = fmt.Sprintf("%sFAIL%s", ColorRed, ColorReset)
+	}
+	summary := fmt.Sprintf("%s\t%s\t%.3fs", result, filename, elapsed.Seconds())
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		switch line := scanner.Text(); {
+		case strings.HasPrefix(line, "coverage: "):
+			summary += "\t" + line
+		case strings.HasPrefix(line, "testing: warning: no tests to run"):
+			summary += " [no tests to run]"
+		}
+	}
+	fmt.Println(summary)
+	return runErr == nil
+}
+
+// goTestBuild writes the Go files of a test package as a module in dir and
+// builds its test binary at output, with the go output on stderr
+func goTestBuild(dir string, files map[string]string, output string, flags *testFlags) error {
+	goFlags, err := writeGoModule(dir, files)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"test", "-c"}, goFlags...)
+	if flags.cover {
+		args = append(args, "-cover")
+	}
+	args = append(args, "-o", output, ".")
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	printVerbose("%s (in %s)", (&buildFlags{}).commandLine(args), dir)
+
+	timePhase("go build", func() {
+		err = cmd.Run()
+	})
+	return err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/vet"
+)
+
+// gos vet reports likely mistakes in .gos programs, found by the checks of
+// the vet package, one line each:
+//
+//	main.gos:4: error: count is declared but never used [unused-variable]
+//
+// Files with syntax or checker errors have those reported instead. Like
+// go vet, gos vet exits with code 1 when it reports anything.
+
+// vetFlags are the flags of gos vet
+type vetFlags struct {
+	checks string
+	list   bool
+}
+
+// vetFiles vets the .gos files the arguments name, as gos test finds test
+// files
+func vetFiles(args []string, flags *vetFlags) {
+	if flags.list {
+		for _, check := range vet.Checks() {
+			fmt.Printf("%-16s %-8s %s\n", check.ID, check.Severity, check.Doc)
+		}
+		return
+	}
+	checks := vet.Checks()
+	if flags.checks != "" {
+		checks = nil
+		for _, id := range strings.Split(flags.checks, ",") {
+			check := vet.Lookup(strings.TrimSpace(id))
+			if check == nil {
+				exitUsage("vet", fmt.Sprintf("unknown check '%s'; gos vet --list lists the checks", id))
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	files, err := findFiles(args, isGosFile, "is not a .gos file")
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		printWarning("no .gos files to vet")
+		return
+	}
+
+	failed := false
+	for _, file := range files {
+		if !vetFile(file, checks) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func isGosFile(path string) bool {
+	return strings.HasSuffix(path, ".gos")
+}
+
+// vetFile runs checks over a .gos file and reports what they find, and
+// whether the file is free of problems
+func vetFile(filename string, checks []*vet.Check) bool {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		printError(fmt.Sprintf("reading file: %v", err))
+		return false
+	}
+	program, err := parseFile(filename)
+	if err == nil {
+		err = checkVetted(filename, program)
+	}
+	if compErr, ok := err.(*compileError); ok {
+		printCompilationError(compErr.file, compErr.errors)
+		return false
+	} else if err != nil {
+		printError(err.Error())
+		return false
+	}
+
+	diagnostics := vet.Run(program, string(content), checks)
+	for _, d := range diagnostics {
+		color := ColorYellow
+		if d.Severity == vet.Error {
+			color = ColorRed
+		}
+		fmt.Fprintf(os.Stderr, "%s%s:%d:%s %s%s:%s %s %s[%s]%s\n", ColorCyan, filename, d.Line, ColorReset,
+			color, d.Severity, ColorReset, d.Message, ColorPurple, d.Check, ColorReset)
+	}
+	return len(diagnostics) == 0
+}
+
+// checkVetted runs the checker over a program, as a test file with the
+// program it tests if it is one. Its warnings are left out: the unused
+// imports and value receivers it warns about are vet checks, which report
+// their lines.
+func checkVetted(filename string, program *ast.Program) error {
+	c := newChecker()
+	if !isTestFile(filename) {
+		c.Check(program)
+	} else {
+		var code *ast.Program
+		codeFile := strings.TrimSuffix(filename, "_test.gos") + ".gos"
+		if _, err := os.Stat(codeFile); err == nil {
+			if code, err = parseFile(codeFile); err != nil {
+				return err
+			}
+		}
+		c.CheckTests(program, code)
+	}
+	return checkErrors(filename, c.Errors())
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+	"github.com/GrandpaEJ/go-script/pkg/parser"
+)
+
+// gos run --watch and gos build --watch compile a .gos file again each
+// time it, a .gos file it imports or its gos.mod changes. The files are
+// watched with the file notifications of the operating system where gos
+// supports them, and by polling elsewhere. A run stops the program and
+// starts the new one once it builds, so a server keeps running while the
+// code has errors. Errors are reported in full once; after that, only the
+// new ones and the number fixed are.
+
+const (
+	// debounceDelay is how long watch mode waits after a change for more,
+	// since editors write a file in several steps
+	debounceDelay = 100 * time.Millisecond
+
+	// pollInterval is how often files are checked when they are polled
+	pollInterval = 500 * time.Millisecond
+
+	// stopTimeout is how long a program has to exit when it is interrupted
+	// before it is killed
+	stopTimeout = 3 * time.Second
+)
+
+// A fileWatcher reports changes to a set of files
+type fileWatcher interface {
+	// Changes receives the path of a file when it changes. It is closed
+	// when the watcher fails.
+	Changes() <-chan string
+	Close() error
+}
+
+// newFileWatcher watches files with file notifications, or by polling if
+// they are not supported or polling is set
+func newFileWatcher(files []string, polling bool) fileWatcher {
+	if !polling {
+		w, err := newNotifyWatcher(files)
+		if err == nil {
+			return w
+		}
+		printVerbose("polling for changes: %v", err)
+	}
+	return newPollWatcher(files, pollInterval)
+}
+
+// notify sends a change without waiting; one pending change is enough to
+// rebuild
+func notify(changes chan string, path string) {
+	select {
+	case changes <- path:
+	default:
+	}
+}
+
+// pollWatcher watches files by checking their size and modification time
+type pollWatcher struct {
+	changes chan string
+	done    chan struct{}
+}
+
+// fileStamp is what a pollWatcher checks of a file
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stampOf(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+func newPollWatcher(files []string, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{changes: make(chan string, 1), done: make(chan struct{})}
+	stamps := make(map[string]fileStamp)
+	for _, file := range files {
+		stamps[file] = stampOf(file)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			for file, stamp := range stamps {
+				if now := stampOf(file); now != stamp {
+					stamps[file] = now
+					notify(w.changes, file)
+				}
+			}
+		}
+	}()
+	return w
+}
+
+func (w *pollWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+// watchedFiles returns the absolute paths of the files a .gos file is built
+// from: the file, the .gos files it imports, and theirs, and its gos.mod,
+// or where a gos.mod next to it would be. The imports of a file that does
+// not parse are those the parser got to.
+func watchedFiles(filename string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	var add func(path string)
+	add = func(path string) {
+		path, err := filepath.Abs(path)
+		if err != nil || seen[path] {
+			return
+		}
+		seen[path] = true
+		files = append(files, path)
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		program := parser.New(lexer.New(string(content))).ParseProgram()
+		for _, imp := range program.Imports {
+			for _, pkg := range imp.Packages() {
+				// .gos imports are relative to the file that imports them
+				if strings.HasSuffix(pkg.Path, ".gos") {
+					add(filepath.Join(filepath.Dir(path), filepath.FromSlash(pkg.Path)))
+				}
+			}
+		}
+	}
+	add(filename)
+
+	if mod, err := findModFile(filepath.Dir(files[0])); err == nil && mod != nil {
+		files = append(files, mod.Path)
+	} else {
+		files = append(files, filepath.Join(filepath.Dir(files[0]), "gos.mod"))
+	}
+	return files
+}
+
+// watchBuild is what watch mode makes of a .gos file each time it compiles
+type watchBuild struct {
+	// build builds the Go code of the file, and reports whether it did;
+	// it reports why it did not itself
+	build func(goCode string) bool
+
+	// start, if set, starts what build made after stopping what it started
+	// before, and returns a function that stops it
+	start func() (stop func())
+}
+
+// watchFile compiles a .gos file and builds it, and again each time the
+// files it is built from change, until gos is interrupted
+func watchFile(filename string, b watchBuild) {
+	if !strings.HasSuffix(filename, ".gos") {
+		printError("file must have .gos extension")
+		os.Exit(1)
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		printError(fmt.Sprintf("file '%s' does not exist", filename))
+		os.Exit(1)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	shownWarnings = make(map[string]bool)
+
+	var diags diagnostics
+	stop := func() {}
+	polling := false
+	for {
+		// The files are watched before the build, so changes made while
+		// it runs are not missed
+		files := watchedFiles(filename)
+		watcher := newFileWatcher(files, polling)
+		if goCode, ok := diags.compile(filename); ok && b.build(goCode) && b.start != nil {
+			stop()
+			stop = b.start()
+		}
+		printStatus("Watching", fmt.Sprintf("%d files for changes (Ctrl+C to stop)", len(files)))
+
+		changed, ok := waitForChange(watcher, signals)
+		watcher.Close()
+		if !ok {
+			stop()
+			return
+		}
+		if changed == "" {
+			printWarning("file notifications failed; polling for changes instead")
+			polling = true
+			continue
+		}
+		printStatus("Changed", changed)
+	}
+}
+
+// waitForChange waits for a change, and then for the changes that follow
+// it within debounceDelay. It returns the path that changed first, or ""
+// when the watcher failed, and false when gos was interrupted.
+func waitForChange(watcher fileWatcher, signals chan os.Signal) (string, bool) {
+	var first string
+	select {
+	case <-signals:
+		return "", false
+	case path, ok := <-watcher.Changes():
+		if !ok {
+			return "", true
+		}
+		first = path
+	}
+
+	timer := time.NewTimer(debounceDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-signals:
+			return "", false
+		case _, ok := <-watcher.Changes():
+			if !ok {
+				return first, true
+			}
+			timer.Reset(debounceDelay)
+		case <-timer.C:
+			return first, true
+		}
+	}
+}
+
+// diagnostics are the errors of the last compilation in watch mode
+type diagnostics struct {
+	errors []string // nil when the last compilation succeeded
+}
+
+// compile compiles a .gos file. After a failed compilation, it only reports
+// the errors that are new and how many were fixed.
+func (d *diagnostics) compile(filename string) (string, bool) {
+	start := time.Now()
+	goCode, err := compileFile(filename)
+	if err == nil {
+		if d.errors != nil {
+			printSuccess(fmt.Sprintf("fixed all %d errors", len(d.errors)))
+		}
+		d.errors = nil
+		printStatus("Compiled in", time.Since(start).String())
+		return goCode, true
+	}
+
+	file, errors := filename, []string{err.Error()}
+	if compErr, ok := err.(*compileError); ok {
+		file, errors = compErr.file, compErr.errors
+	}
+	if d.errors == nil {
+		printCompilationError(file, errors)
+		d.errors = errors
+		return "", false
+	}
+
+	previous := make(map[string]bool)
+	for _, e := range d.errors {
+		previous[e] = true
+	}
+	current := make(map[string]bool)
+	added := 0
+	for _, e := range errors {
+		current[e] = true
+		if !previous[e] {
+			fmt.Fprintf(os.Stderr, "%s+%s %s\n", ColorRed, ColorReset, e)
+			added++
+		}
+	}
+	fixed := 0
+	for _, e := range d.errors {
+		if !current[e] {
+			fixed++
+		}
+	}
+	printInfo(fmt.Sprintf("%s: %d errors, %d new, %d fixed", file, len(errors), added, fixed))
+	d.errors = errors
+	return "", false
+}
+
+// watchRun runs a .gos file with args, and runs it again each time it
+// changes
+func watchRun(filename string, args []string, flags *buildFlags) {
+	var dir, next string // the build that start runs
+	watchFile(filename, watchBuild{
+		build: func(goCode string) bool {
+			// Each build gets its own directory, since the program of the
+			// last one runs until this one is built
+			var err error
+			if dir, err = os.MkdirTemp("", "gos-*"); err != nil {
+				printError(fmt.Sprintf("creating temp directory: %v", err))
+				return false
+			}
+			next = binaryPath(dir)
+			if _, err := goBuild(dir, goCode, next, flags); err != nil {
+				printError(fmt.Sprintf("building program: %v", err))
+				os.RemoveAll(dir)
+				return false
+			}
+			return true
+		},
+		start: func() func() {
+			printStatus("Running", ColorCyan+filename+ColorReset)
+			stop, dir := startProgram(next, args), dir
+			return func() {
+				stop()
+				os.RemoveAll(dir)
+			}
+		},
+	})
+}
+
+// watchBuildFile builds a .gos file to Go code, or to a binary with
+// output, and again each time it changes
+func watchBuildFile(filename, output string, flags *buildFlags) {
+	watchFile(filename, watchBuild{
+		build: func(goCode string) bool {
+			if output == "" {
+				outputFile := strings.TrimSuffix(filename, ".gos") + ".go"
+				if err := os.WriteFile(outputFile, []byte(goCode), 0644); err != nil {
+					printError(fmt.Sprintf("writing output file: %v", err))
+					return false
+				}
+				printSuccess(fmt.Sprintf("compiled '%s' to '%s'", filename, outputFile))
+				return true
+			}
+
+			dir, err := os.MkdirTemp("", "gos-*")
+			if err != nil {
+				printError(fmt.Sprintf("creating temp directory: %v", err))
+				return false
+			}
+			defer os.RemoveAll(dir)
+			outputPath, err := filepath.Abs(output)
+			if err == nil {
+				_, err = goBuild(dir, goCode, outputPath, flags)
+			}
+			if err != nil {
+				printError(fmt.Sprintf("building binary: %v", err))
+				return false
+			}
+			printSuccess(fmt.Sprintf("built binary '%s'", output))
+			return true
+		},
+	})
+}
+
+// startProgram starts the program at path with args on the terminal of
+// gos, and returns a function that stops it: it is interrupted, and killed
+// if it has not exited within stopTimeout. A program that exits on its own
+// is reported.
+func startProgram(path string, args []string) func() {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		printError(fmt.Sprintf("running program: %v", err))
+		return func() {}
+	}
+
+	stopping := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		// Ctrl+C interrupts the program too, which is not worth reporting
+		status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+		interrupted := ok && status.Signaled() && status.Signal() == syscall.SIGINT
+		select {
+		case <-stopping:
+		default:
+			if interrupted {
+				break
+			}
+			if err != nil {
+				printInfo(fmt.Sprintf("program exited: %v; waiting for changes", err))
+			} else {
+				printInfo("program exited; waiting for changes")
+			}
+		}
+		close(exited)
+	}()
+
+	return func() {
+		close(stopping)
+		select {
+		case <-exited:
+			return
+		default:
+		}
+		// Interrupts are not supported everywhere, as on Windows
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			cmd.Process.Kill()
+		}
+		select {
+		case <-exited:
+		case <-time.After(stopTimeout):
+			cmd.Process.Kill()
+			<-exited
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// notifyWatcher watches files with inotify. It watches their directories
+// rather than the files, since editors often save a file by writing a new
+// one and renaming it over the old.
+type notifyWatcher struct {
+	file    *os.File
+	changes chan string
+}
+
+const watchEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+	syscall.IN_CREATE | syscall.IN_DELETE
+
+func newNotifyWatcher(files []string) (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// An os.File polls the descriptor, so Close stops a Read that waits
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	dirs := make(map[int]string)   // the directories watched by descriptor
+	names := make(map[string]bool) // the files watched
+	for _, path := range files {
+		names[path] = true
+		dir := filepath.Dir(path)
+		wd, err := syscall.InotifyAddWatch(fd, dir, watchEvents)
+		if err == syscall.ENOENT {
+			// A file in a missing directory is not created without it
+			continue
+		}
+		if err != nil {
+			file.Close()
+			return nil, os.NewSyscallError("inotify_add_watch", err)
+		}
+		dirs[wd] = dir
+	}
+
+	w := &notifyWatcher{file: file, changes: make(chan string, 1)}
+	go w.read(dirs, names)
+	return w, nil
+}
+
+// read sends the changes to the watched files until the watcher is closed
+func (w *notifyWatcher) read(dirs map[int]string, names map[string]bool) {
+	defer close(w.changes)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := buf[offset:]
+			wd := int(int32(binary.NativeEndian.Uint32(event[0:])))
+			nameLen := int(binary.NativeEndian.Uint32(event[12:]))
+			name := event[syscall.SizeofInotifyEvent : syscall.SizeofInotifyEvent+nameLen]
+			offset += syscall.SizeofInotifyEvent + nameLen
+
+			// The name is padded with zero bytes
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			if path := filepath.Join(dirs[wd], string(name)); names[path] {
+				notify(w.changes, path)
+			}
+		}
+	}
+}
+
+func (w *notifyWatcher) Changes() <-chan string {
+	return w.changes
+}
+
+func (w *notifyWatcher) Close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// newNotifyWatcher fails where gos does not use file notifications, so
+// the files are polled
+func newNotifyWatcher(files []string) (fileWatcher, error) {
+	return nil, errors.New("file notifications are not supported on this system")
+}
@@ -2,7 +2,10 @@ package ast
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Node represents any node in the AST
@@ -29,6 +32,7 @@ type Visitor interface {
 	VisitFunctionDecl(*FunctionDecl) interface{}
 	VisitStructDecl(*StructDecl) interface{}
 	VisitVarDecl(*VarDecl) interface{}
+	VisitAssignStmt(*AssignStmt) interface{}
 	VisitIfStmt(*IfStmt) interface{}
 	VisitForStmt(*ForStmt) interface{}
 	VisitWhileStmt(*WhileStmt) interface{}
@@ -42,13 +46,27 @@ type Visitor interface {
 	VisitLiteral(*Literal) interface{}
 	VisitArrayLiteral(*ArrayLiteral) interface{}
 	VisitMapLiteral(*MapLiteral) interface{}
+	VisitStructLiteral(*StructLiteral) interface{}
 	VisitIndexExpr(*IndexExpr) interface{}
 	VisitSelectorExpr(*SelectorExpr) interface{}
+	VisitFunctionLiteral(*FunctionLiteral) interface{}
+	VisitLambdaExpr(*LambdaExpr) interface{}
+	VisitInstantiationExpr(*InstantiationExpr) interface{}
+	VisitTypeExpr(*TypeExpr) interface{}
+	VisitTryStmt(*TryStmt) interface{}
+	VisitRaiseStmt(*RaiseStmt) interface{}
+	VisitAssertStmt(*AssertStmt) interface{}
+	VisitTupleExpr(*TupleExpr) interface{}
+	VisitPropagateExpr(*PropagateExpr) interface{}
+	VisitSliceExpr(*SliceExpr) interface{}
+	VisitFStringExpr(*FStringExpr) interface{}
+	VisitComprehensionExpr(*ComprehensionExpr) interface{}
 }
 
 // Program represents the root of the AST
 type Program struct {
 	Package    string
+	Doc        string // the comments above the package declaration
 	Imports    []*ImportDecl
 	Statements []Statement
 }
@@ -69,11 +87,119 @@ func (p *Program) Accept(visitor Visitor) interface{} {
 	return visitor.VisitProgram(p)
 }
 
+// ModuleName returns the value of __name__ in the program: "__main__" in
+// package main and the package name otherwise
+func (p *Program) ModuleName() string {
+	if p.Package == "main" {
+		return "__main__"
+	}
+	return p.Package
+}
+
+// IsDeclaration reports whether a top-level statement only declares
+// something: a function, a struct or a var with a type. Other top-level
+// statements run when the program starts.
+func IsDeclaration(stmt Statement) bool {
+	switch s := stmt.(type) {
+	case *FunctionDecl, *StructDecl:
+		return true
+	case *VarDecl:
+		return s.Type != nil
+	}
+	return false
+}
+
+// Line returns the line of the .gos file a statement starts on, or 0 for
+// statements the parser does not record lines for, such as blocks and
+// struct declarations
+func Line(stmt Statement) int {
+	switch s := stmt.(type) {
+	case *FunctionDecl:
+		return s.Line
+	case *VarDecl:
+		return s.Line
+	case *AssignStmt:
+		return s.Line
+	case *IfStmt:
+		return s.Line
+	case *ForStmt:
+		return s.Line
+	case *WhileStmt:
+		return s.Line
+	case *ReturnStmt:
+		return s.Line
+	case *ExpressionStmt:
+		return s.Line
+	case *TryStmt:
+		return s.Line
+	case *RaiseStmt:
+		return s.Line
+	case *AssertStmt:
+		return s.Line
+	}
+	return 0
+}
+
+// Script returns the top-level statements that run when the program starts,
+// in order. An if __name__ == "__main__": guard is resolved here, so only the
+// branch that applies to the program's package is kept.
+func (p *Program) Script() []Statement {
+	var script []Statement
+	var add func(stmt Statement)
+	add = func(stmt Statement) {
+		switch s := stmt.(type) {
+		case nil:
+		case *BlockStmt:
+			for _, inner := range s.Statements {
+				add(inner)
+			}
+		case *IfStmt:
+			if taken, ok := p.resolveGuard(s.Condition); ok {
+				if taken {
+					add(s.ThenBranch)
+				} else {
+					add(s.ElseBranch)
+				}
+				return
+			}
+			script = append(script, s)
+		default:
+			script = append(script, s)
+		}
+	}
+	for _, stmt := range p.Statements {
+		if stmt != nil && !IsDeclaration(stmt) && !isNilNode(stmt) {
+			add(stmt)
+		}
+	}
+	return script
+}
+
+// resolveGuard evaluates a condition of the form __name__ == "..." or
+// __name__ != "...", in either order
+func (p *Program) resolveGuard(cond Expression) (bool, bool) {
+	b, ok := cond.(*BinaryExpr)
+	if !ok || (b.Operator != "==" && b.Operator != "!=") {
+		return false, false
+	}
+	name, value := b.Left, b.Right
+	if _, ok := value.(*Identifier); ok {
+		name, value = value, name
+	}
+	ident, ok := name.(*Identifier)
+	lit, isLit := value.(*Literal)
+	if !ok || ident.Value != "__name__" || !isLit || lit.Type != "string" {
+		return false, false
+	}
+	return (lit.Value == p.ModuleName()) == (b.Operator == "=="), true
+}
+
 // ImportDecl represents an import declaration
 type ImportDecl struct {
 	Path  string
 	Alias string
 	Items []string // for "from X import Y, Z"
+	Line  int      // the line of the import or from keyword
 }
 
 func (i *ImportDecl) String() string {
@@ -86,13 +212,72 @@ func (i *ImportDecl) String() string {
 	return fmt.Sprintf("import %s", i.Path)
 }
 
+// ImportedPackage is one package an import declaration imports
+type ImportedPackage struct {
+	Name  string   // the name the program refers to the package by
+	Path  string   // the import path, without quotes
+	Alias bool     // whether the declaration names the package
+	Names []string // for from imports: the names the program uses unqualified
+}
+
+// Packages returns the packages the declaration imports. A package is
+// named after the last element of its path, without the .gos extension,
+// unless the declaration names it.
+func (i *ImportDecl) Packages() []ImportedPackage {
+	var packages []ImportedPackage
+	add := func(name, path string) {
+		path = strings.Trim(path, `"`)
+		pkg := ImportedPackage{Name: name, Path: path, Alias: name != ""}
+		if !pkg.Alias {
+			pkg.Name = strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], ".gos")
+		}
+		packages = append(packages, pkg)
+	}
+	switch {
+	case len(i.Items) > 0 && i.Path != "":
+		// from "path" import name1, name2
+		add("", i.Path)
+		packages[0].Names = i.Items
+	case len(i.Items) > 0:
+		// import ("os", "fmt") style
+		for _, item := range i.Items {
+			add("", item)
+		}
+	default:
+		add(i.Alias, i.Path)
+	}
+	return packages
+}
+
 // FunctionDecl represents a function declaration
 type FunctionDecl struct {
-	Name       string
-	Parameters []*Parameter
-	ReturnType *TypeSpec
-	Body       *BlockStmt
-	Receiver   *Parameter // for methods
+	Name        string
+	TypeParams  []*TypeParam // for generic functions
+	Parameters  []*Parameter
+	ReturnType  *TypeSpec
+	Body        *BlockStmt
+	Receiver    *Parameter // for methods
+	Public      bool       // declared with the pub modifier
+	Mutating    bool       // declared with "func mut", for pointer receivers
+	Annotations []string   // names of the @annotations before the func, such as "cli"
+	Line        int        // the line of the func keyword
+	Doc         string     // the comments above the declaration, without the #
+}
+
+// HasAnnotation reports whether the function is annotated with @name
+func (f *FunctionDecl) HasAnnotation(name string) bool {
+	for _, annotation := range f.Annotations {
+		if annotation == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTest reports whether the function is a test when it is declared in a
+// test file: a function, not a method, whose name starts with test_
+func (f *FunctionDecl) IsTest() bool {
+	return f.Receiver == nil && strings.HasPrefix(f.Name, "test_")
 }
 
 func (f *FunctionDecl) String() string {
@@ -108,7 +293,20 @@ func (f *FunctionDecl) String() string {
 	if f.ReturnType != nil {
 		returnType = " " + f.ReturnType.String()
 	}
-	return fmt.Sprintf("func %s%s(%s)%s:\n%s", receiver, f.Name, strings.Join(params, ", "), returnType, f.Body.String())
+	pub := ""
+	if f.Public {
+		pub = "pub "
+	}
+	mut := ""
+	if f.Mutating {
+		mut = "mut "
+	}
+	annotations := ""
+	for _, annotation := range f.Annotations {
+		annotations += "@" + annotation + "\n"
+	}
+	return fmt.Sprintf("%s%sfunc %s%s%s%s(%s)%s:\n%s", annotations, pub, receiver, mut, f.Name, typeParamsString(f.TypeParams),
+		strings.Join(params, ", "), returnType, f.Body.String())
 }
 
 func (f *FunctionDecl) statementNode() {}
@@ -118,15 +316,20 @@ func (f *FunctionDecl) Accept(visitor Visitor) interface{} {
 
 // Parameter represents a function parameter
 type Parameter struct {
-	Name string
-	Type *TypeSpec
+	Name    string
+	Type    *TypeSpec
+	Default Expression // only allowed on @cli functions
 }
 
 func (p *Parameter) String() string {
+	s := p.Name
 	if p.Type != nil {
-		return fmt.Sprintf("%s %s", p.Name, p.Type.String())
+		s += " " + p.Type.String()
 	}
-	return p.Name
+	if p.Default != nil {
+		s += " = " + p.Default.String()
+	}
+	return s
 }
 
 // TypeSpec represents a type specification
@@ -138,6 +341,11 @@ type TypeSpec struct {
 	ArraySize int
 	KeyType   *TypeSpec // for maps
 	ValueType *TypeSpec // for maps, slices, arrays
+	IsFunc    bool
+	Params    []*TypeSpec // for function types
+	Results   []*TypeSpec // for function types
+	TypeArgs  []*TypeSpec // for instantiated generic structs: Stack[int]
+	Tuple     []*TypeSpec // for multiple results: (int, error)
 }
 
 func (t *TypeSpec) String() string {
@@ -151,21 +359,155 @@ func (t *TypeSpec) String() string {
 	if t.IsArray {
 		result += fmt.Sprintf("[%d]", t.ArraySize)
 	}
-	if t.KeyType != nil && t.ValueType != nil {
+	if len(t.Tuple) > 0 {
+		result += "(" + typeList(t.Tuple) + ")"
+	} else if t.IsFunc {
+		result += t.funcString()
+	} else if t.KeyType != nil && t.ValueType != nil {
 		result += fmt.Sprintf("map[%s]%s", t.KeyType.String(), t.ValueType.String())
 	} else if t.ValueType != nil {
 		result += t.ValueType.String()
 	} else {
 		result += t.Name
+		if len(t.TypeArgs) > 0 {
+			result += "[" + typeList(t.TypeArgs) + "]"
+		}
+	}
+	return result
+}
+
+func typeList(types []*TypeSpec) string {
+	var parts []string
+	for _, t := range types {
+		parts = append(parts, t.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IntValue returns the value of an integer literal, which may be negated as
+// in -1
+func IntValue(expr Expression) (int64, bool) {
+	if u, ok := expr.(*UnaryExpr); ok && u.Operator == "-" {
+		v, ok := IntValue(u.Operand)
+		return -v, ok
+	}
+	if lit, ok := expr.(*Literal); ok && lit.Type == "int" {
+		v, ok := lit.Value.(int64)
+		return v, ok
+	}
+	return 0, false
+}
+
+// TypeFromExpr converts an expression that names a type, such as int,
+// time.Time or Stack[int], to a TypeSpec. It returns nil for any other
+// expression.
+func TypeFromExpr(expr Expression) *TypeSpec {
+	switch e := expr.(type) {
+	case *Identifier:
+		return &TypeSpec{Name: e.Value}
+	case *SelectorExpr:
+		if pkg, ok := e.Object.(*Identifier); ok {
+			return &TypeSpec{Name: pkg.Value + "." + e.Selector}
+		}
+	case *IndexExpr:
+		base, arg := TypeFromExpr(e.Object), TypeFromExpr(e.Index)
+		if base != nil && arg != nil && base.IsNamed() {
+			base.TypeArgs = []*TypeSpec{arg}
+			return base
+		}
+	case *InstantiationExpr:
+		if base := TypeFromExpr(e.Object); base != nil && base.IsNamed() {
+			base.TypeArgs = e.TypeArgs
+			return base
+		}
+	}
+	return nil
+}
+
+// ResultTypes returns the types of a function result: the elements of a
+// tuple, the type itself or nothing for a nil result
+func (t *TypeSpec) ResultTypes() []*TypeSpec {
+	if t == nil {
+		return nil
+	}
+	if len(t.Tuple) > 0 {
+		return t.Tuple
+	}
+	return []*TypeSpec{t}
+}
+
+// IsNamed reports whether t is a plain named type without type arguments
+func (t *TypeSpec) IsNamed() bool {
+	return t.Name != "" && !t.IsPointer && !t.IsSlice && !t.IsArray && !t.IsFunc &&
+		t.ValueType == nil && len(t.TypeArgs) == 0
+}
+
+// TypeParam is a type parameter of a generic function or struct, such as
+// T comparable or N ~int | ~float64
+type TypeParam struct {
+	Name       string
+	Constraint []*ConstraintTerm // union of terms; empty means any
+}
+
+// ConstraintTerm is one term of a type parameter constraint
+type ConstraintTerm struct {
+	Tilde bool // ~T: any type whose underlying type is T
+	Type  *TypeSpec
+}
+
+func (t *TypeParam) String() string {
+	if len(t.Constraint) == 0 {
+		return t.Name + " any"
+	}
+	var terms []string
+	for _, term := range t.Constraint {
+		if term.Tilde {
+			terms = append(terms, "~"+term.Type.String())
+		} else {
+			terms = append(terms, term.Type.String())
+		}
+	}
+	return t.Name + " " + strings.Join(terms, " | ")
+}
+
+func typeParamsString(params []*TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, param := range params {
+		parts = append(parts, param.String())
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func (t *TypeSpec) funcString() string {
+	var params, results []string
+	for _, param := range t.Params {
+		params = append(params, param.String())
+	}
+	for _, r := range t.Results {
+		results = append(results, r.String())
+	}
+	result := fmt.Sprintf("func(%s)", strings.Join(params, ", "))
+	if len(results) == 1 {
+		result += " " + results[0]
+	} else if len(results) > 1 {
+		result += fmt.Sprintf(" (%s)", strings.Join(results, ", "))
 	}
 	return result
 }
 
 // StructDecl represents a struct declaration
 type StructDecl struct {
-	Name    string
-	Fields  []*Field
-	Methods []*FunctionDecl
+	Name        string
+	TypeParams  []*TypeParam // for generic structs
+	Fields      []*Field
+	Methods     []*FunctionDecl
+	Constructor *FunctionDecl // optional "func init(self, ...)" constructor
+	Public      bool          // declared with the pub modifier
+	Doc         string        // the comments above the declaration, without the #
+	Line        int           // the line of the struct keyword
 }
 
 func (s *StructDecl) String() string {
@@ -173,7 +515,11 @@ func (s *StructDecl) String() string {
 	for _, f := range s.Fields {
 		fields = append(fields, f.String())
 	}
-	return fmt.Sprintf("struct %s:\n    %s", s.Name, strings.Join(fields, "\n    "))
+	pub := ""
+	if s.Public {
+		pub = "pub "
+	}
+	return fmt.Sprintf("%sstruct %s%s:\n    %s", pub, s.Name, typeParamsString(s.TypeParams), strings.Join(fields, "\n    "))
 }
 
 func (s *StructDecl) statementNode() {}
@@ -183,9 +529,13 @@ func (s *StructDecl) Accept(visitor Visitor) interface{} {
 
 // Field represents a struct field
 type Field struct {
-	Name string
-	Type *TypeSpec
-	Tag  string
+	Name     string
+	Type     *TypeSpec
+	Tag      string
+	Embedded bool   // true for embedded fields, where Name is the type name
+	Public   bool   // declared with the pub modifier
+	Doc      string // the comments above the field, without the #
+	Line     int
 }
 
 func (f *Field) String() string {
@@ -193,7 +543,22 @@ func (f *Field) String() string {
 	if f.Tag != "" {
 		tag = fmt.Sprintf(" `%s`", f.Tag)
 	}
-	return fmt.Sprintf("%s %s%s", f.Name, f.Type.String(), tag)
+	if f.Embedded {
+		return f.Type.String() + tag
+	}
+	pub := ""
+	if f.Public {
+		pub = "pub "
+	}
+	return fmt.Sprintf("%s%s %s%s", pub, f.Name, f.Type.String(), tag)
+}
+
+// ExportName returns the Go name a pub declaration or member is generated
+// with: the name capitalized, so Go exports it. The checker and the code
+// generator both use it, so they agree on the names.
+func ExportName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
 }
 
 // VarDecl represents a variable declaration
@@ -202,6 +567,8 @@ type VarDecl struct {
 	Type     *TypeSpec
 	Value    Expression
 	IsWalrus bool // true for :=, false for =
+	Line     int
+	Doc      string // the comments above a top-level var with a type
 }
 
 func (v *VarDecl) String() string {
@@ -216,6 +583,48 @@ func (v *VarDecl) Accept(visitor Visitor) interface{} {
 	return visitor.VisitVarDecl(v)
 }
 
+// AssignStmt represents an assignment to an arbitrary target
+// (self.name = value, items[0] += 1, count++)
+type AssignStmt struct {
+	Target   Expression // a TupleExpr for a, b = b, a and x, err := f()
+	Operator string     // "=", ":=", "+=", "-=", "*=", "/=", "%=", "++" or "--"
+	Value    Expression // nil for "++" and "--"
+	Line     int
+}
+
+func (a *AssignStmt) String() string {
+	if a.Value == nil {
+		return fmt.Sprintf("%s%s", a.Target.String(), a.Operator)
+	}
+	return fmt.Sprintf("%s %s %s", a.Target.String(), a.Operator, a.Value.String())
+}
+
+// IsSelfField reports whether target is a field of self, such as self.age
+// or self.address.city, which a method with a value receiver only assigns
+// in its copy. Index expressions are left out because slices and maps
+// share their contents with the copy.
+func IsSelfField(target Expression) bool {
+	sel, ok := target.(*SelectorExpr)
+	if !ok {
+		return false
+	}
+	for {
+		switch x := sel.Object.(type) {
+		case *Identifier:
+			return x.Value == "self"
+		case *SelectorExpr:
+			sel = x
+		default:
+			return false
+		}
+	}
+}
+
+func (a *AssignStmt) statementNode() {}
+func (a *AssignStmt) Accept(visitor Visitor) interface{} {
+	return visitor.VisitAssignStmt(a)
+}
+
 // BlockStmt represents a block of statements
 type BlockStmt struct {
 	Statements []Statement
@@ -239,6 +648,7 @@ type IfStmt struct {
 	Condition  Expression
 	ThenBranch Statement
 	ElseBranch Statement
+	Line       int // the line of the if, or of the elif of an else branch
 }
 
 func (i *IfStmt) String() string {
@@ -254,7 +664,8 @@ func (i *IfStmt) Accept(visitor Visitor) interface{} {
 	return visitor.VisitIfStmt(i)
 }
 
-// ForStmt represents a for loop
+// ForStmt represents a for loop. A range loop binds one variable, or two
+// in "for i, v in xs", where ValueVar is the second.
 type ForStmt struct {
 	Init      Statement
 	Condition Expression
@@ -262,12 +673,18 @@ type ForStmt struct {
 	Body      *BlockStmt
 	IsRange   bool
 	RangeVar  string
+	ValueVar  string
 	RangeExpr Expression
+	Line      int
 }
 
 func (f *ForStmt) String() string {
 	if f.IsRange {
-		return fmt.Sprintf("for %s in %s:\n%s", f.RangeVar, f.RangeExpr.String(), f.Body.String())
+		vars := f.RangeVar
+		if f.ValueVar != "" {
+			vars += ", " + f.ValueVar
+		}
+		return fmt.Sprintf("for %s in %s:\n%s", vars, f.RangeExpr.String(), f.Body.String())
 	}
 	return fmt.Sprintf("for %s; %s; %s:\n%s", f.Init.String(), f.Condition.String(), f.Update.String(), f.Body.String())
 }
@@ -281,6 +698,7 @@ func (f *ForStmt) Accept(visitor Visitor) interface{} {
 type WhileStmt struct {
 	Condition Expression
 	Body      *BlockStmt
+	Line      int
 }
 
 func (w *WhileStmt) String() string {
@@ -295,6 +713,7 @@ func (w *WhileStmt) Accept(visitor Visitor) interface{} {
 // ReturnStmt represents a return statement
 type ReturnStmt struct {
 	Value Expression
+	Line  int
 }
 
 func (r *ReturnStmt) String() string {
@@ -312,6 +731,7 @@ func (r *ReturnStmt) Accept(visitor Visitor) interface{} {
 // ExpressionStmt represents an expression used as a statement
 type ExpressionStmt struct {
 	Expression Expression
+	Line       int // the line of the statement, which calls such as t.Error report
 }
 
 func (e *ExpressionStmt) String() string {
@@ -398,7 +818,7 @@ type Literal struct {
 func (l *Literal) String() string {
 	switch l.Type {
 	case "string":
-		return fmt.Sprintf(`"%v"`, l.Value)
+		return strconv.Quote(fmt.Sprint(l.Value))
 	default:
 		return fmt.Sprintf("%v", l.Value)
 	}
@@ -450,6 +870,36 @@ func (m *MapLiteral) Accept(visitor Visitor) interface{} {
 	return visitor.VisitMapLiteral(m)
 }
 
+// StructLiteral represents a struct composite literal, either with named
+// fields (Person{name: "Alice"}) or positional values (Person{"Alice", 30})
+type StructLiteral struct {
+	Type   Expression // Identifier or SelectorExpr naming the struct type
+	Fields []FieldValue
+	Values []Expression
+}
+
+// FieldValue is a named field initializer inside a struct literal
+type FieldValue struct {
+	Name  string
+	Value Expression
+}
+
+func (s *StructLiteral) String() string {
+	var parts []string
+	for _, field := range s.Fields {
+		parts = append(parts, fmt.Sprintf("%s: %s", field.Name, field.Value.String()))
+	}
+	for _, value := range s.Values {
+		parts = append(parts, value.String())
+	}
+	return fmt.Sprintf("%s{%s}", s.Type.String(), strings.Join(parts, ", "))
+}
+
+func (s *StructLiteral) expressionNode() {}
+func (s *StructLiteral) Accept(visitor Visitor) interface{} {
+	return visitor.VisitStructLiteral(s)
+}
+
 // IndexExpr represents an index expression (array[index])
 type IndexExpr struct {
 	Object Expression
@@ -465,6 +915,145 @@ func (i *IndexExpr) Accept(visitor Visitor) interface{} {
 	return visitor.VisitIndexExpr(i)
 }
 
+// ComprehensionExpr represents a list, map or set comprehension:
+// [x * 2 for x in xs if x > 0], {k: v for k, v in m} or {x for x in xs}
+type ComprehensionExpr struct {
+	Kind    string     // "list", "map" or "set"
+	Key     Expression // the key of a map comprehension
+	Value   Expression
+	Clauses []*ComprehensionClause
+}
+
+// ComprehensionClause is a "for ... in ..." of a comprehension with the
+// conditions that follow it
+type ComprehensionClause struct {
+	RangeVar   string
+	ValueVar   string
+	Iterable   Expression
+	Conditions []Expression
+}
+
+func (c *ComprehensionExpr) String() string {
+	var b strings.Builder
+	if c.Key != nil {
+		b.WriteString(c.Key.String() + ": ")
+	}
+	b.WriteString(c.Value.String())
+	for _, clause := range c.Clauses {
+		vars := clause.RangeVar
+		if clause.ValueVar != "" {
+			vars += ", " + clause.ValueVar
+		}
+		b.WriteString(fmt.Sprintf(" for %s in %s", vars, clause.Iterable.String()))
+		for _, cond := range clause.Conditions {
+			b.WriteString(" if " + cond.String())
+		}
+	}
+	if c.Kind == "list" {
+		return "[" + b.String() + "]"
+	}
+	return "{" + b.String() + "}"
+}
+
+func (c *ComprehensionExpr) expressionNode() {}
+func (c *ComprehensionExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitComprehensionExpr(c)
+}
+
+// FStringExpr represents an f-string, such as f"Hello {name}, {x:.2f}",
+// as its text and replacement fields in order
+type FStringExpr struct {
+	Parts []*FStringPart
+}
+
+// FStringPart is either text or a replacement field, which has a Value, an
+// optional conversion ("r", "s" or "a", written !r) and an optional format
+// spec (written after a colon)
+type FStringPart struct {
+	Text       string
+	Value      Expression
+	Conversion string
+	Spec       *FormatSpec
+}
+
+// FormatSpec is a parsed format spec of the form
+// [[fill]align][sign][#][0][width][grouping][.precision][type]. Fill,
+// Align, Sign, Grouping and Type are 0 and Width and Precision are -1 when
+// they are not given.
+type FormatSpec struct {
+	Text      string // the spec as written
+	Fill      rune
+	Align     byte // '<', '>', '^' or '='
+	Sign      byte // '+', '-' or ' '
+	Alternate bool // #
+	Zero      bool // 0 before the width
+	Width     int
+	Grouping  byte // ',' or '_'
+	Precision int
+	Type      byte // one of "bcdeEfFgGnosxX%"
+}
+
+// FormatCodes are the format spec types each kind of value takes: strings,
+// integers, floating point numbers and bools, which take none
+var FormatCodes = map[string]string{
+	"string": "s",
+	"int":    "bcdeEfFgGnoxX%",
+	"float":  "eEfFgGn%",
+	"bool":   "",
+}
+
+func (f *FStringExpr) String() string {
+	var body strings.Builder
+	for _, part := range f.Parts {
+		if part.Value == nil {
+			body.WriteString(strings.NewReplacer("{", "{{", "}", "}}").Replace(part.Text))
+			continue
+		}
+		body.WriteString("{" + part.Value.String())
+		if part.Conversion != "" {
+			body.WriteString("!" + part.Conversion)
+		}
+		if part.Spec != nil {
+			body.WriteString(":" + part.Spec.Text)
+		}
+		body.WriteString("}")
+	}
+	return "f" + strconv.Quote(body.String())
+}
+
+func (f *FStringExpr) expressionNode() {}
+func (f *FStringExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitFStringExpr(f)
+}
+
+// SliceExpr represents a slice expression (object[low:high:step]); omitted
+// bounds are nil
+type SliceExpr struct {
+	Object Expression
+	Low    Expression
+	High   Expression
+	Step   Expression
+}
+
+func (s *SliceExpr) String() string {
+	bound := func(e Expression) string {
+		if e == nil {
+			return ""
+		}
+		return e.String()
+	}
+	result := fmt.Sprintf("%s[%s:%s", s.Object.String(), bound(s.Low), bound(s.High))
+	if s.Step != nil {
+		result += ":" + s.Step.String()
+	}
+	return result + "]"
+}
+
+func (s *SliceExpr) expressionNode() {}
+func (s *SliceExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitSliceExpr(s)
+}
+
 // SelectorExpr represents a selector expression (object.field)
 type SelectorExpr struct {
 	Object   Expression
@@ -479,3 +1068,206 @@ func (s *SelectorExpr) expressionNode() {}
 func (s *SelectorExpr) Accept(visitor Visitor) interface{} {
 	return visitor.VisitSelectorExpr(s)
 }
+
+// FunctionLiteral represents an anonymous function with a block body
+// (func(x int) int: ...)
+type FunctionLiteral struct {
+	Parameters []*Parameter
+	ReturnType *TypeSpec
+	Body       *BlockStmt
+}
+
+func (f *FunctionLiteral) String() string {
+	var params []string
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	returnType := ""
+	if f.ReturnType != nil {
+		returnType = " " + f.ReturnType.String()
+	}
+	return fmt.Sprintf("func(%s)%s:\n%s", strings.Join(params, ", "), returnType, f.Body.String())
+}
+
+func (f *FunctionLiteral) expressionNode() {}
+func (f *FunctionLiteral) Accept(visitor Visitor) interface{} {
+	return visitor.VisitFunctionLiteral(f)
+}
+
+// LambdaExpr represents a single-expression anonymous function
+// (lambda x, y: x + y). Its parameter and result types come from the
+// function type expected where it is used.
+type LambdaExpr struct {
+	Parameters []*Parameter
+	Body       Expression
+	Type       *TypeSpec // function type, filled in by the checker
+}
+
+func (l *LambdaExpr) String() string {
+	var params []string
+	for _, p := range l.Parameters {
+		params = append(params, p.String())
+	}
+	if len(params) == 0 {
+		return "lambda: " + l.Body.String()
+	}
+	return fmt.Sprintf("lambda %s: %s", strings.Join(params, ", "), l.Body.String())
+}
+
+func (l *LambdaExpr) expressionNode() {}
+func (l *LambdaExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitLambdaExpr(l)
+}
+
+// InstantiationExpr represents a generic function or struct with explicit
+// type arguments that cannot be read as an index expression, such as
+// Pair[string, int] or make_list[[]int]
+type InstantiationExpr struct {
+	Object   Expression
+	TypeArgs []*TypeSpec
+}
+
+func (i *InstantiationExpr) String() string {
+	return fmt.Sprintf("%s[%s]", i.Object.String(), typeList(i.TypeArgs))
+}
+
+func (i *InstantiationExpr) expressionNode() {}
+func (i *InstantiationExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitInstantiationExpr(i)
+}
+
+// TypeExpr represents a type passed where an expression is expected, the
+// first argument of make([]int, n) or new(*T), when it cannot be read as an
+// expression
+type TypeExpr struct {
+	Type *TypeSpec
+}
+
+func (t *TypeExpr) String() string {
+	return t.Type.String()
+}
+
+func (t *TypeExpr) expressionNode() {}
+func (t *TypeExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitTypeExpr(t)
+}
+
+// TryStmt represents try/except/finally
+type TryStmt struct {
+	Body     *BlockStmt
+	Handlers []*ExceptClause
+	Finally  *BlockStmt // optional
+	Line     int        // the line of the try
+}
+
+// ExceptClause is one except clause of a try statement. Type is nil for a
+// bare except, which catches every error.
+type ExceptClause struct {
+	Type *TypeSpec // error type or sentinel error value
+	Name string    // "e" in except ErrType as e
+	Body *BlockStmt
+}
+
+func (t *TryStmt) String() string {
+	result := fmt.Sprintf("try:\n%s", t.Body.String())
+	for _, h := range t.Handlers {
+		result += "\nexcept"
+		if h.Type != nil {
+			result += " " + h.Type.String()
+		}
+		if h.Name != "" {
+			result += " as " + h.Name
+		}
+		result += ":\n" + h.Body.String()
+	}
+	if t.Finally != nil {
+		result += "\nfinally:\n" + t.Finally.String()
+	}
+	return result
+}
+
+func (t *TryStmt) statementNode() {}
+func (t *TryStmt) Accept(visitor Visitor) interface{} {
+	return visitor.VisitTryStmt(t)
+}
+
+// RaiseStmt represents raise err. A bare raise re-raises the error handled
+// by the enclosing except clause.
+type RaiseStmt struct {
+	Value Expression // nil for a bare raise
+	Line  int
+}
+
+func (r *RaiseStmt) String() string {
+	if r.Value != nil {
+		return "raise " + r.Value.String()
+	}
+	return "raise"
+}
+
+func (r *RaiseStmt) statementNode() {}
+func (r *RaiseStmt) Accept(visitor Visitor) interface{} {
+	return visitor.VisitRaiseStmt(r)
+}
+
+// AssertStmt represents assert cond or assert cond, message. It fails the
+// test it is in, or panics outside a test, when the condition is false.
+type AssertStmt struct {
+	Condition Expression
+	Message   Expression // nil without a message
+	Line      int        // the line of the assert, which a failure reports
+
+	// The condition and the operands of a comparison as written, which a
+	// failure reports; Operands is empty for other conditions
+	Source   string
+	Operands []string
+}
+
+func (a *AssertStmt) String() string {
+	if a.Message != nil {
+		return fmt.Sprintf("assert %s, %s", a.Condition.String(), a.Message.String())
+	}
+	return "assert " + a.Condition.String()
+}
+
+func (a *AssertStmt) statementNode() {}
+func (a *AssertStmt) Accept(visitor Visitor) interface{} {
+	return visitor.VisitAssertStmt(a)
+}
+
+// TupleExpr represents a comma-separated list of expressions, used for
+// multiple return values and multiple assignment (return x, nil)
+type TupleExpr struct {
+	Elements []Expression
+}
+
+func (t *TupleExpr) String() string {
+	var elements []string
+	for _, e := range t.Elements {
+		elements = append(elements, e.String())
+	}
+	return strings.Join(elements, ", ")
+}
+
+func (t *TupleExpr) expressionNode() {}
+func (t *TupleExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitTupleExpr(t)
+}
+
+// PropagateExpr represents a call followed by ?, which returns the call's
+// error from the enclosing function, or raises it inside a try body
+type PropagateExpr struct {
+	Call Expression
+	// The number of results a call of a Go function returns before its
+	// error, filled in by the checker
+	Values int
+}
+
+func (p *PropagateExpr) String() string {
+	return p.Call.String() + "?"
+}
+
+func (p *PropagateExpr) expressionNode() {}
+func (p *PropagateExpr) Accept(visitor Visitor) interface{} {
+	return visitor.VisitPropagateExpr(p)
+}
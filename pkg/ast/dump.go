@@ -0,0 +1,60 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Dump returns the tree of node as indented text, with the type of each
+// node and its fields. Fields with zero values are left out, so the dump
+// of a program only shows what its source says. The format is stable, so
+// dumps can be compared against expected ones.
+//
+//	Program {
+//	  Package: "main"
+//	  Statements: [
+//	    FunctionDecl {
+//	      Name: "main"
+//	      ...
+func Dump(node Node) string {
+	var out strings.Builder
+	dumpValue(&out, reflect.ValueOf(node), 0)
+	out.WriteString("\n")
+	return out.String()
+}
+
+func dumpValue(out *strings.Builder, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			out.WriteString("nil")
+			return
+		}
+		dumpValue(out, v.Elem(), depth)
+	case reflect.Struct:
+		out.WriteString(v.Type().Name() + " {\n")
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !v.Type().Field(i).IsExported() || field.IsZero() ||
+				field.Kind() == reflect.Slice && field.Len() == 0 {
+				continue
+			}
+			out.WriteString(indent + "  " + v.Type().Field(i).Name + ": ")
+			dumpValue(out, field, depth+1)
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "}")
+	case reflect.Slice:
+		out.WriteString("[\n")
+		for i := 0; i < v.Len(); i++ {
+			out.WriteString(indent + "  ")
+			dumpValue(out, v.Index(i), depth+1)
+			out.WriteString("\n")
+		}
+		out.WriteString(indent + "]")
+	default:
+		out.WriteString(fmt.Sprintf("%#v", v.Interface()))
+	}
+}
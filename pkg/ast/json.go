@@ -0,0 +1,456 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSON returns the tree of node as a value that encoding/json encodes as
+// nested objects, for tools that read the AST. Each node is an object whose
+// "node" member names its type, such as "FunctionDecl", followed by its
+// fields in the order they are declared, with lower-case names. Types are
+// written as in the source, such as "map[string]int", and fields with zero
+// values are left out, so the output only changes when the tree does.
+func JSON(node Node) interface{} {
+	if node == nil || isNilNode(node) {
+		return nil
+	}
+	return node.Accept(jsonEncoder{})
+}
+
+// object is a JSON object whose members keep the order they were added in
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newObject(node string) *object {
+	o := &object{values: make(map[string]interface{})}
+	return o.set("node", node)
+}
+
+// set adds a member to the object, unless value is a zero value
+func (o *object) set(key string, value interface{}) *object {
+	switch v := value.(type) {
+	case nil:
+		return o
+	case string:
+		if v == "" {
+			return o
+		}
+	case bool:
+		if !v {
+			return o
+		}
+	case int:
+		if v == 0 {
+			return o
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return o
+		}
+	case *object:
+		if v == nil {
+			return o
+		}
+	}
+	o.keys = append(o.keys, key)
+	o.values[key] = value
+	return o
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// jsonEncoder builds the JSON value of each node it visits
+type jsonEncoder struct{}
+
+func (v jsonEncoder) node(n Node) interface{} {
+	if n == nil || isNilNode(n) {
+		return nil
+	}
+	return n.Accept(v)
+}
+
+func (v jsonEncoder) statements(stmts []Statement) []interface{} {
+	var values []interface{}
+	for _, stmt := range stmts {
+		values = append(values, v.node(stmt))
+	}
+	return values
+}
+
+func (v jsonEncoder) expressions(exprs []Expression) []interface{} {
+	var values []interface{}
+	for _, expr := range exprs {
+		values = append(values, v.node(expr))
+	}
+	return values
+}
+
+func (v jsonEncoder) parameters(params []*Parameter) []interface{} {
+	var values []interface{}
+	for _, p := range params {
+		if p == nil {
+			continue
+		}
+		values = append(values, newObject("Parameter").
+			set("name", p.Name).
+			set("type", typeString(p.Type)).
+			set("default", v.node(p.Default)))
+	}
+	return values
+}
+
+func (v jsonEncoder) typeParams(params []*TypeParam) []interface{} {
+	var values []interface{}
+	for _, p := range params {
+		values = append(values, p.String())
+	}
+	return values
+}
+
+func (v jsonEncoder) block(b *BlockStmt) interface{} {
+	if b == nil {
+		return nil
+	}
+	return v.VisitBlockStmt(b)
+}
+
+// typeString returns a type as written in the source, or "" for none
+func typeString(t *TypeSpec) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+func typeStrings(types []*TypeSpec) []interface{} {
+	var values []interface{}
+	for _, t := range types {
+		values = append(values, typeString(t))
+	}
+	return values
+}
+
+func stringList(values []string) []interface{} {
+	var list []interface{}
+	for _, s := range values {
+		list = append(list, s)
+	}
+	return list
+}
+
+func (v jsonEncoder) VisitProgram(p *Program) interface{} {
+	var imports []interface{}
+	for _, imp := range p.Imports {
+		imports = append(imports, newObject("ImportDecl").
+			set("path", imp.Path).
+			set("alias", imp.Alias).
+			set("items", stringList(imp.Items)).
+			set("line", imp.Line))
+	}
+	return newObject("Program").
+		set("package", p.Package).
+		set("doc", p.Doc).
+		set("imports", imports).
+		set("statements", v.statements(p.Statements))
+}
+
+func (v jsonEncoder) VisitFunctionDecl(fn *FunctionDecl) interface{} {
+	o := newObject("FunctionDecl").
+		set("name", fn.Name).
+		set("typeParams", v.typeParams(fn.TypeParams)).
+		set("parameters", v.parameters(fn.Parameters)).
+		set("returnType", typeString(fn.ReturnType)).
+		set("body", v.block(fn.Body))
+	if fn.Receiver != nil {
+		o.set("receiver", v.parameters([]*Parameter{fn.Receiver})[0])
+	}
+	return o.set("public", fn.Public).
+		set("mutating", fn.Mutating).
+		set("annotations", stringList(fn.Annotations)).
+		set("line", fn.Line).
+		set("doc", fn.Doc)
+}
+
+func (v jsonEncoder) VisitStructDecl(s *StructDecl) interface{} {
+	var fields, methods []interface{}
+	for _, f := range s.Fields {
+		fields = append(fields, newObject("Field").
+			set("name", f.Name).
+			set("type", typeString(f.Type)).
+			set("tag", f.Tag).
+			set("embedded", f.Embedded).
+			set("public", f.Public).
+			set("doc", f.Doc))
+	}
+	for _, m := range s.Methods {
+		methods = append(methods, v.node(m))
+	}
+	o := newObject("StructDecl").
+		set("name", s.Name).
+		set("typeParams", v.typeParams(s.TypeParams)).
+		set("fields", fields).
+		set("methods", methods)
+	if s.Constructor != nil {
+		o.set("constructor", v.node(s.Constructor))
+	}
+	return o.set("public", s.Public).
+		set("doc", s.Doc)
+}
+
+func (v jsonEncoder) VisitVarDecl(d *VarDecl) interface{} {
+	return newObject("VarDecl").
+		set("name", d.Name).
+		set("type", typeString(d.Type)).
+		set("value", v.node(d.Value)).
+		set("isWalrus", d.IsWalrus).
+		set("line", d.Line).
+		set("doc", d.Doc)
+}
+
+func (v jsonEncoder) VisitAssignStmt(a *AssignStmt) interface{} {
+	return newObject("AssignStmt").
+		set("target", v.node(a.Target)).
+		set("operator", a.Operator).
+		set("value", v.node(a.Value)).
+		set("line", a.Line)
+}
+
+func (v jsonEncoder) VisitIfStmt(i *IfStmt) interface{} {
+	return newObject("IfStmt").
+		set("condition", v.node(i.Condition)).
+		set("thenBranch", v.node(i.ThenBranch)).
+		set("elseBranch", v.node(i.ElseBranch)).
+		set("line", i.Line)
+}
+
+func (v jsonEncoder) VisitForStmt(s *ForStmt) interface{} {
+	return newObject("ForStmt").
+		set("init", v.node(s.Init)).
+		set("condition", v.node(s.Condition)).
+		set("update", v.node(s.Update)).
+		set("body", v.block(s.Body)).
+		set("isRange", s.IsRange).
+		set("rangeVar", s.RangeVar).
+		set("valueVar", s.ValueVar).
+		set("rangeExpr", v.node(s.RangeExpr)).
+		set("line", s.Line)
+}
+
+func (v jsonEncoder) VisitWhileStmt(w *WhileStmt) interface{} {
+	return newObject("WhileStmt").
+		set("condition", v.node(w.Condition)).
+		set("body", v.block(w.Body)).
+		set("line", w.Line)
+}
+
+func (v jsonEncoder) VisitReturnStmt(r *ReturnStmt) interface{} {
+	return newObject("ReturnStmt").
+		set("value", v.node(r.Value)).
+		set("line", r.Line)
+}
+
+func (v jsonEncoder) VisitExpressionStmt(e *ExpressionStmt) interface{} {
+	return newObject("ExpressionStmt").
+		set("expression", v.node(e.Expression)).
+		set("line", e.Line)
+}
+
+func (v jsonEncoder) VisitBlockStmt(b *BlockStmt) interface{} {
+	return newObject("BlockStmt").set("statements", v.statements(b.Statements))
+}
+
+func (v jsonEncoder) VisitBinaryExpr(b *BinaryExpr) interface{} {
+	return newObject("BinaryExpr").
+		set("left", v.node(b.Left)).
+		set("operator", b.Operator).
+		set("right", v.node(b.Right))
+}
+
+func (v jsonEncoder) VisitUnaryExpr(u *UnaryExpr) interface{} {
+	return newObject("UnaryExpr").
+		set("operator", u.Operator).
+		set("operand", v.node(u.Operand))
+}
+
+func (v jsonEncoder) VisitCallExpr(c *CallExpr) interface{} {
+	return newObject("CallExpr").
+		set("function", v.node(c.Function)).
+		set("arguments", v.expressions(c.Arguments))
+}
+
+func (v jsonEncoder) VisitIdentifier(i *Identifier) interface{} {
+	return newObject("Identifier").set("value", i.Value)
+}
+
+func (v jsonEncoder) VisitLiteral(l *Literal) interface{} {
+	// The value of a literal is kept even when it is a zero value
+	o := newObject("Literal").set("type", l.Type)
+	o.keys = append(o.keys, "value")
+	o.values["value"] = l.Value
+	return o
+}
+
+func (v jsonEncoder) VisitArrayLiteral(a *ArrayLiteral) interface{} {
+	return newObject("ArrayLiteral").set("elements", v.expressions(a.Elements))
+}
+
+func (v jsonEncoder) VisitMapLiteral(m *MapLiteral) interface{} {
+	var pairs []interface{}
+	for _, pair := range m.Pairs {
+		pairs = append(pairs, newObject("MapPair").
+			set("key", v.node(pair.Key)).
+			set("value", v.node(pair.Value)))
+	}
+	return newObject("MapLiteral").set("pairs", pairs)
+}
+
+func (v jsonEncoder) VisitStructLiteral(s *StructLiteral) interface{} {
+	var fields []interface{}
+	for _, f := range s.Fields {
+		fields = append(fields, newObject("FieldValue").
+			set("name", f.Name).
+			set("value", v.node(f.Value)))
+	}
+	return newObject("StructLiteral").
+		set("type", v.node(s.Type)).
+		set("fields", fields).
+		set("values", v.expressions(s.Values))
+}
+
+func (v jsonEncoder) VisitIndexExpr(i *IndexExpr) interface{} {
+	return newObject("IndexExpr").
+		set("object", v.node(i.Object)).
+		set("index", v.node(i.Index))
+}
+
+func (v jsonEncoder) VisitSelectorExpr(s *SelectorExpr) interface{} {
+	return newObject("SelectorExpr").
+		set("object", v.node(s.Object)).
+		set("selector", s.Selector)
+}
+
+func (v jsonEncoder) VisitFunctionLiteral(f *FunctionLiteral) interface{} {
+	return newObject("FunctionLiteral").
+		set("parameters", v.parameters(f.Parameters)).
+		set("returnType", typeString(f.ReturnType)).
+		set("body", v.block(f.Body))
+}
+
+func (v jsonEncoder) VisitLambdaExpr(l *LambdaExpr) interface{} {
+	return newObject("LambdaExpr").
+		set("parameters", v.parameters(l.Parameters)).
+		set("body", v.node(l.Body)).
+		set("type", typeString(l.Type))
+}
+
+func (v jsonEncoder) VisitInstantiationExpr(i *InstantiationExpr) interface{} {
+	return newObject("InstantiationExpr").
+		set("object", v.node(i.Object)).
+		set("typeArgs", typeStrings(i.TypeArgs))
+}
+
+func (v jsonEncoder) VisitTypeExpr(t *TypeExpr) interface{} {
+	return newObject("TypeExpr").
+		set("type", typeString(t.Type))
+}
+
+func (v jsonEncoder) VisitTryStmt(t *TryStmt) interface{} {
+	var handlers []interface{}
+	for _, h := range t.Handlers {
+		handlers = append(handlers, newObject("ExceptClause").
+			set("type", typeString(h.Type)).
+			set("name", h.Name).
+			set("body", v.block(h.Body)))
+	}
+	return newObject("TryStmt").
+		set("body", v.block(t.Body)).
+		set("handlers", handlers).
+		set("finally", v.block(t.Finally)).
+		set("line", t.Line)
+}
+
+func (v jsonEncoder) VisitRaiseStmt(r *RaiseStmt) interface{} {
+	return newObject("RaiseStmt").
+		set("value", v.node(r.Value)).
+		set("line", r.Line)
+}
+
+func (v jsonEncoder) VisitAssertStmt(a *AssertStmt) interface{} {
+	return newObject("AssertStmt").
+		set("condition", v.node(a.Condition)).
+		set("message", v.node(a.Message)).
+		set("line", a.Line).
+		set("source", a.Source).
+		set("operands", stringList(a.Operands))
+}
+
+func (v jsonEncoder) VisitTupleExpr(t *TupleExpr) interface{} {
+	return newObject("TupleExpr").set("elements", v.expressions(t.Elements))
+}
+
+func (v jsonEncoder) VisitPropagateExpr(p *PropagateExpr) interface{} {
+	return newObject("PropagateExpr").set("call", v.node(p.Call))
+}
+
+func (v jsonEncoder) VisitSliceExpr(s *SliceExpr) interface{} {
+	return newObject("SliceExpr").
+		set("object", v.node(s.Object)).
+		set("low", v.node(s.Low)).
+		set("high", v.node(s.High)).
+		set("step", v.node(s.Step))
+}
+
+func (v jsonEncoder) VisitFStringExpr(f *FStringExpr) interface{} {
+	var parts []interface{}
+	for _, part := range f.Parts {
+		p := newObject("FStringPart").
+			set("text", part.Text).
+			set("value", v.node(part.Value)).
+			set("conversion", part.Conversion)
+		if part.Spec != nil {
+			p.set("spec", part.Spec.Text)
+		}
+		parts = append(parts, p)
+	}
+	return newObject("FStringExpr").set("parts", parts)
+}
+
+func (v jsonEncoder) VisitComprehensionExpr(c *ComprehensionExpr) interface{} {
+	var clauses []interface{}
+	for _, clause := range c.Clauses {
+		clauses = append(clauses, newObject("ComprehensionClause").
+			set("rangeVar", clause.RangeVar).
+			set("valueVar", clause.ValueVar).
+			set("iterable", v.node(clause.Iterable)).
+			set("conditions", v.expressions(clause.Conditions)))
+	}
+	return newObject("ComprehensionExpr").
+		set("kind", c.Kind).
+		set("key", v.node(c.Key)).
+		set("value", v.node(c.Value)).
+		set("clauses", clauses)
+}
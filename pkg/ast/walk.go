@@ -0,0 +1,542 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Inspect traverses the AST rooted at node in depth-first order, calling f
+// for every node. If f returns false, the children of that node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || isNilNode(node) {
+		return
+	}
+	node.Accept(inspector(f))
+}
+
+// InspectLines traverses the AST rooted at node like Inspect, calling f
+// with each node and the line of the statement it is in, or 0 if that
+// statement has no line
+func InspectLines(node Node, f func(node Node, line int) bool) {
+	line := 0
+	if stmt, ok := node.(Statement); ok {
+		line = Line(stmt)
+	}
+	Inspect(node, func(n Node) bool {
+		if stmt, ok := n.(Statement); ok && n != node && Line(stmt) > 0 {
+			InspectLines(n, f)
+			return false
+		}
+		return f(n, line)
+	})
+}
+
+// ShiftLines adds offset to the lines recorded in the AST rooted at node
+// and in the imports of a program, so that the lines of files compiled as
+// one program follow each other
+func ShiftLines(node Node, offset int) {
+	shift := func(line *int) {
+		if *line > 0 {
+			*line += offset
+		}
+	}
+	if p, ok := node.(*Program); ok {
+		for _, imp := range p.Imports {
+			shift(&imp.Line)
+		}
+	}
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *FunctionDecl:
+			shift(&n.Line)
+		case *StructDecl:
+			shift(&n.Line)
+			for _, field := range n.Fields {
+				shift(&field.Line)
+			}
+		case *VarDecl:
+			shift(&n.Line)
+		case *AssignStmt:
+			shift(&n.Line)
+		case *IfStmt:
+			shift(&n.Line)
+		case *ForStmt:
+			shift(&n.Line)
+		case *WhileStmt:
+			shift(&n.Line)
+		case *ReturnStmt:
+			shift(&n.Line)
+		case *ExpressionStmt:
+			shift(&n.Line)
+		case *TryStmt:
+			shift(&n.Line)
+		case *RaiseStmt:
+			shift(&n.Line)
+		case *AssertStmt:
+			shift(&n.Line)
+		}
+		return true
+	})
+}
+
+// isNilNode reports whether node is a typed nil, which the parser produces
+// for statements it failed to parse
+func isNilNode(node Node) bool {
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// inspector adapts an Inspect callback to the Visitor interface
+type inspector func(Node) bool
+
+func (f inspector) walk(nodes ...Node) {
+	for _, node := range nodes {
+		Inspect(node, f)
+	}
+}
+
+func (f inspector) VisitProgram(p *Program) interface{} {
+	if f(p) {
+		for _, stmt := range p.Statements {
+			f.walk(stmt)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitFunctionDecl(fn *FunctionDecl) interface{} {
+	if f(fn) && fn.Body != nil {
+		f.walk(fn.Body)
+	}
+	return nil
+}
+
+func (f inspector) VisitStructDecl(s *StructDecl) interface{} {
+	if f(s) {
+		if s.Constructor != nil {
+			f.walk(s.Constructor)
+		}
+		for _, method := range s.Methods {
+			f.walk(method)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitVarDecl(v *VarDecl) interface{} {
+	if f(v) && v.Value != nil {
+		f.walk(v.Value)
+	}
+	return nil
+}
+
+func (f inspector) VisitAssignStmt(a *AssignStmt) interface{} {
+	if f(a) {
+		f.walk(a.Target)
+		if a.Value != nil {
+			f.walk(a.Value)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitIfStmt(i *IfStmt) interface{} {
+	if f(i) {
+		f.walk(i.Condition, i.ThenBranch)
+		if i.ElseBranch != nil {
+			f.walk(i.ElseBranch)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitForStmt(s *ForStmt) interface{} {
+	if f(s) {
+		for _, node := range []Node{s.Init, s.Condition, s.Update, s.RangeExpr} {
+			if node != nil {
+				f.walk(node)
+			}
+		}
+		if s.Body != nil {
+			f.walk(s.Body)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitWhileStmt(w *WhileStmt) interface{} {
+	if f(w) {
+		f.walk(w.Condition)
+		if w.Body != nil {
+			f.walk(w.Body)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitReturnStmt(r *ReturnStmt) interface{} {
+	if f(r) && r.Value != nil {
+		f.walk(r.Value)
+	}
+	return nil
+}
+
+func (f inspector) VisitExpressionStmt(e *ExpressionStmt) interface{} {
+	if f(e) {
+		f.walk(e.Expression)
+	}
+	return nil
+}
+
+func (f inspector) VisitBlockStmt(b *BlockStmt) interface{} {
+	if f(b) {
+		for _, stmt := range b.Statements {
+			f.walk(stmt)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitBinaryExpr(b *BinaryExpr) interface{} {
+	if f(b) {
+		f.walk(b.Left, b.Right)
+	}
+	return nil
+}
+
+func (f inspector) VisitUnaryExpr(u *UnaryExpr) interface{} {
+	if f(u) {
+		f.walk(u.Operand)
+	}
+	return nil
+}
+
+func (f inspector) VisitCallExpr(c *CallExpr) interface{} {
+	if f(c) {
+		f.walk(c.Function)
+		for _, arg := range c.Arguments {
+			f.walk(arg)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitIdentifier(i *Identifier) interface{} {
+	f(i)
+	return nil
+}
+
+func (f inspector) VisitLiteral(l *Literal) interface{} {
+	f(l)
+	return nil
+}
+
+func (f inspector) VisitArrayLiteral(a *ArrayLiteral) interface{} {
+	if f(a) {
+		for _, elem := range a.Elements {
+			f.walk(elem)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitMapLiteral(m *MapLiteral) interface{} {
+	if f(m) {
+		for _, pair := range m.Pairs {
+			f.walk(pair.Key, pair.Value)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitStructLiteral(s *StructLiteral) interface{} {
+	if f(s) {
+		f.walk(s.Type)
+		for _, field := range s.Fields {
+			f.walk(field.Value)
+		}
+		for _, value := range s.Values {
+			f.walk(value)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitIndexExpr(i *IndexExpr) interface{} {
+	if f(i) {
+		f.walk(i.Object, i.Index)
+	}
+	return nil
+}
+
+func (f inspector) VisitComprehensionExpr(c *ComprehensionExpr) interface{} {
+	if f(c) {
+		if c.Key != nil {
+			f.walk(c.Key)
+		}
+		f.walk(c.Value)
+		for _, clause := range c.Clauses {
+			f.walk(clause.Iterable)
+			for _, cond := range clause.Conditions {
+				f.walk(cond)
+			}
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitFStringExpr(s *FStringExpr) interface{} {
+	if f(s) {
+		for _, part := range s.Parts {
+			if part.Value != nil {
+				f.walk(part.Value)
+			}
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitSliceExpr(s *SliceExpr) interface{} {
+	if f(s) {
+		for _, node := range []Node{s.Object, s.Low, s.High, s.Step} {
+			if node != nil {
+				f.walk(node)
+			}
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitSelectorExpr(s *SelectorExpr) interface{} {
+	if f(s) {
+		f.walk(s.Object)
+	}
+	return nil
+}
+
+func (f inspector) VisitFunctionLiteral(fn *FunctionLiteral) interface{} {
+	if f(fn) && fn.Body != nil {
+		f.walk(fn.Body)
+	}
+	return nil
+}
+
+func (f inspector) VisitLambdaExpr(l *LambdaExpr) interface{} {
+	if f(l) {
+		f.walk(l.Body)
+	}
+	return nil
+}
+
+func (f inspector) VisitInstantiationExpr(i *InstantiationExpr) interface{} {
+	if f(i) {
+		f.walk(i.Object)
+	}
+	return nil
+}
+
+func (f inspector) VisitTypeExpr(t *TypeExpr) interface{} {
+	f(t)
+	return nil
+}
+
+func (f inspector) VisitTryStmt(t *TryStmt) interface{} {
+	if f(t) {
+		f.walk(t.Body)
+		for _, h := range t.Handlers {
+			f.walk(h.Body)
+		}
+		if t.Finally != nil {
+			f.walk(t.Finally)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitRaiseStmt(r *RaiseStmt) interface{} {
+	if f(r) && r.Value != nil {
+		f.walk(r.Value)
+	}
+	return nil
+}
+
+func (f inspector) VisitAssertStmt(a *AssertStmt) interface{} {
+	if f(a) {
+		f.walk(a.Condition)
+		if a.Message != nil {
+			f.walk(a.Message)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitTupleExpr(t *TupleExpr) interface{} {
+	if f(t) {
+		for _, e := range t.Elements {
+			f.walk(e)
+		}
+	}
+	return nil
+}
+
+func (f inspector) VisitPropagateExpr(p *PropagateExpr) interface{} {
+	if f(p) {
+		f.walk(p.Call)
+	}
+	return nil
+}
+
+// InspectTypes calls f for every type written in the AST rooted at node,
+// and for the types nested in it, such as the element type of a slice, with
+// the line of the statement the type is written in
+func InspectTypes(node Node, f func(t *TypeSpec, line int)) {
+	line := 0
+	var visit func(types ...*TypeSpec)
+	visit = func(types ...*TypeSpec) {
+		for _, t := range types {
+			if t == nil {
+				continue
+			}
+			f(t, line)
+			visit(t.KeyType, t.ValueType)
+			for _, list := range [][]*TypeSpec{t.Params, t.Results, t.TypeArgs, t.Tuple} {
+				visit(list...)
+			}
+		}
+	}
+	params := func(params ...*Parameter) {
+		for _, p := range params {
+			if p != nil {
+				visit(p.Type)
+			}
+		}
+	}
+	typeParams := func(params []*TypeParam) {
+		for _, p := range params {
+			for _, term := range p.Constraint {
+				visit(term.Type)
+			}
+		}
+	}
+
+	InspectLines(node, func(n Node, at int) bool {
+		line = at
+		switch n := n.(type) {
+		case *FunctionDecl:
+			typeParams(n.TypeParams)
+			params(n.Receiver)
+			params(n.Parameters...)
+			visit(n.ReturnType)
+		case *StructDecl:
+			typeParams(n.TypeParams)
+			for _, field := range n.Fields {
+				visit(field.Type)
+			}
+		case *VarDecl:
+			visit(n.Type)
+		case *FunctionLiteral:
+			params(n.Parameters...)
+			visit(n.ReturnType)
+		case *LambdaExpr:
+			params(n.Parameters...)
+			// The type the checker infers for the lambda
+			visit(n.Type)
+		case *InstantiationExpr:
+			visit(n.TypeArgs...)
+		case *TypeExpr:
+			visit(n.Type)
+		case *TryStmt:
+			for _, h := range n.Handlers {
+				visit(h.Type)
+			}
+		}
+		return true
+	})
+}
+
+// UsedNames returns the names the AST rooted at node refers to: the
+// identifiers, the left side of selectors and the package of qualified type
+// names, which tells which imports a program uses
+func UsedNames(node Node) map[string]bool {
+	used := make(map[string]bool)
+	Inspect(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *SelectorExpr:
+			if ident, ok := n.Object.(*Identifier); ok {
+				used[ident.Value] = true
+			}
+		case *Identifier:
+			used[n.Value] = true
+		}
+		return true
+	})
+	InspectTypes(node, func(t *TypeSpec, _ int) {
+		pkg, _, _ := strings.Cut(t.Name, ".")
+		used[pkg] = true
+	})
+	return used
+}
+
+// DeclaredNames returns the names the AST rooted at node declares or
+// refers to other than as the package of a selector, such as os in
+// os.Args. A package of the same name is hidden by them.
+func DeclaredNames(node Node) map[string]bool {
+	declared := make(map[string]bool)
+	selected := make(map[*Identifier]bool)
+	params := func(params []*Parameter) {
+		for _, p := range params {
+			if p != nil {
+				declared[p.Name] = true
+			}
+		}
+	}
+	typeParams := func(params []*TypeParam) {
+		for _, p := range params {
+			declared[p.Name] = true
+		}
+	}
+
+	Inspect(node, func(node Node) bool {
+		switch n := node.(type) {
+		case *SelectorExpr:
+			if ident, ok := n.Object.(*Identifier); ok {
+				selected[ident] = true
+			}
+		case *Identifier:
+			if !selected[n] {
+				declared[n.Value] = true
+			}
+		case *FunctionDecl:
+			declared[n.Name] = true
+			typeParams(n.TypeParams)
+			params(n.Parameters)
+			if n.Receiver != nil {
+				params([]*Parameter{n.Receiver})
+			}
+		case *StructDecl:
+			declared[n.Name] = true
+			typeParams(n.TypeParams)
+		case *VarDecl:
+			declared[n.Name] = true
+		case *ForStmt:
+			declared[n.RangeVar] = true
+			declared[n.ValueVar] = true
+		case *ComprehensionExpr:
+			for _, clause := range n.Clauses {
+				declared[clause.RangeVar] = true
+				declared[clause.ValueVar] = true
+			}
+		case *FunctionLiteral:
+			params(n.Parameters)
+		case *LambdaExpr:
+			params(n.Parameters)
+		case *TryStmt:
+			for _, h := range n.Handlers {
+				declared[h.Name] = true
+			}
+		}
+		return true
+	})
+	delete(declared, "")
+	return declared
+}
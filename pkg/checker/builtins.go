@@ -0,0 +1,49 @@
+package checker
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// builtinArgs gives the least and most arguments of the builtins whose
+// calls the code generator turns into loops and runtime calls of a fixed
+// arity
+var builtinArgs = map[string][2]int{
+	"range":     {1, 3},
+	"enumerate": {1, 2},
+	"zip":       {2, 2},
+	"args":      {0, 0},
+	"exit":      {0, 1},
+}
+
+// checkBuiltinCall checks the arguments of a call to a builtin listed in
+// builtinArgs, unless the program declares a function of the same name
+func (c *Checker) checkBuiltinCall(call *ast.CallExpr, line int) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	limits, ok := builtinArgs[ident.Value]
+	if _, declared := c.funcs[ident.Value]; !ok || declared {
+		return
+	}
+
+	switch n := len(call.Arguments); {
+	case n < limits[0] || n > limits[1]:
+		if limits[0] == limits[1] {
+			c.errorAt(line, "%s() takes %d arguments, got %d", ident.Value, limits[0], n)
+		} else {
+			c.errorAt(line, "%s() takes %d to %d arguments, got %d", ident.Value, limits[0], limits[1], n)
+		}
+	case ident.Value == "range" && n == 3:
+		if step, ok := ast.IntValue(call.Arguments[2]); ok && step == 0 {
+			c.errorAt(line, "range() step must not be zero")
+		}
+	}
+}
+
+// checkSliceExpr rejects a literal zero step, as in xs[::0]
+func (c *Checker) checkSliceExpr(s *ast.SliceExpr, line int) {
+	if step, ok := ast.IntValue(s.Step); ok && step == 0 {
+		c.errorAt(line, "slice step must not be zero in %s", s.String())
+	}
+}
@@ -0,0 +1,313 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/gopkg"
+)
+
+// Checker performs the semantic checks that need the whole program, such as
+// validating struct literals against struct declarations
+type Checker struct {
+	structs  map[string]*ast.StructDecl
+	funcs    map[string]*ast.FunctionDecl
+	errors   []string
+	warnings []string
+	loader   *gopkg.Loader // for the Go packages the program uses, or nil
+
+	// The Go packages the program refers to, see gopackages.go
+	goPackages    map[string]*goPackage // by the name of the package
+	goFromImports map[string]*goPackage // by the name imported from them
+}
+
+// New creates a new checker instance
+func New() *Checker {
+	return &Checker{
+		structs:  make(map[string]*ast.StructDecl),
+		funcs:    make(map[string]*ast.FunctionDecl),
+		errors:   []string{},
+		warnings: []string{},
+	}
+}
+
+// Errors returns the errors found by Check
+func (c *Checker) Errors() []string {
+	return c.errors
+}
+
+// Warnings returns problems found by Check that do not stop compilation
+func (c *Checker) Warnings() []string {
+	return c.warnings
+}
+
+// errorAt records an error about the code at a line of the .gos file, as
+// line 3: message
+func (c *Checker) errorAt(line int, format string, args ...interface{}) {
+	if line > 0 {
+		format = fmt.Sprintf("line %d: %s", line, format)
+	}
+	c.errors = append(c.errors, fmt.Sprintf(format, args...))
+}
+
+func (c *Checker) warnf(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// warnAt records a warning about the code at a line of the .gos file, as
+// line 3: message
+func (c *Checker) warnAt(line int, format string, args ...interface{}) {
+	if line > 0 {
+		format = fmt.Sprintf("line %d: %s", line, format)
+	}
+	c.warnf(format, args...)
+}
+
+// Check runs all checks over the program
+func (c *Checker) Check(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.StructDecl:
+			if s != nil {
+				c.structs[s.Name] = s
+			}
+		case *ast.FunctionDecl:
+			if s != nil {
+				c.funcs[s.Name] = s
+			}
+		}
+	}
+	c.checkExports(program)
+	c.resolveGoPackages(program)
+	c.inferLambdas(program)
+
+	ast.InspectLines(program, func(node ast.Node, line int) bool {
+		switch n := node.(type) {
+		case *ast.StructLiteral:
+			c.checkStructLiteral(n, line)
+		case *ast.CallExpr:
+			c.checkConstructorCall(n, line)
+			c.checkBuiltinCall(n, line)
+		case *ast.SliceExpr:
+			c.checkSliceExpr(n, line)
+		case *ast.FStringExpr:
+			c.checkFString(n, line)
+		case *ast.FunctionDecl:
+			c.checkReceiver(n)
+			c.checkErrorFlow("func "+n.Name, n.ReturnType, n.Body)
+		case *ast.FunctionLiteral:
+			c.checkErrorFlow("the func literal", n.ReturnType, n.Body)
+		case *ast.ExpressionStmt:
+			if p, ok := n.Expression.(*ast.PropagateExpr); ok {
+				c.countValues(p)
+			}
+		case *ast.LambdaExpr:
+			// A lambda has no error result to propagate to
+			c.disallowPropagation(n.Body, "a lambda", line)
+		case *ast.ComprehensionExpr:
+			// A comprehension runs in a func literal of its own
+			c.disallowPropagation(n.Key, "a comprehension", line)
+			c.disallowPropagation(n.Value, "a comprehension", line)
+			for _, clause := range n.Clauses {
+				c.disallowPropagation(clause.Iterable, "a comprehension", line)
+				for _, cond := range clause.Conditions {
+					c.disallowPropagation(cond, "a comprehension", line)
+				}
+			}
+		}
+		c.checkGenerics(node, line)
+		return true
+	})
+	c.checkScript(program)
+	c.checkAnnotations(program)
+	c.checkImports(program)
+	c.checkGoPackages(program)
+}
+
+// checkReceiver rejects mut and *self outside struct methods and warns when
+// a method with a value receiver assigns to a field of self, since the
+// assignment only changes the method's copy
+func (c *Checker) checkReceiver(fn *ast.FunctionDecl) {
+	if fn.Mutating && fn.Receiver == nil {
+		c.errorAt(fn.Line, "func mut %s: mut is only allowed on struct methods", fn.Name)
+	}
+	for _, param := range fn.Parameters {
+		if param.Name == "self" && param.Type != nil && param.Type.IsPointer && param.Type.Name == "" {
+			c.errorAt(fn.Line, "func %s: *self is only allowed as the first parameter of a struct method", fn.Name)
+		}
+	}
+
+	ValueReceiverAssignments(fn, func(line int, msg string) {
+		c.warnAt(line, "%s", msg)
+	})
+}
+
+// ValueReceiverAssignments calls report with the line and a description of
+// the first assignment to each field of self in a method with a value
+// receiver, which only changes the method's copy. gos vet reports them as
+// well.
+func ValueReceiverAssignments(fn *ast.FunctionDecl, report func(line int, msg string)) {
+	if fn.Receiver == nil || fn.Receiver.Type.IsPointer || fn.Body == nil {
+		return
+	}
+	reported := make(map[string]bool)
+	ast.InspectLines(fn.Body, func(node ast.Node, line int) bool {
+		assign, ok := node.(*ast.AssignStmt)
+		if !ok {
+			return true
+		}
+		target := assign.Target.String()
+		if !ast.IsSelfField(assign.Target) || reported[target] {
+			return true
+		}
+		reported[target] = true
+		report(line, fmt.Sprintf("method %s.%s assigns to %s but has a value receiver, so the change is lost; declare it as func mut %s(self) or func %s(*self)",
+			fn.Receiver.Type.Name, fn.Name, target, fn.Name, fn.Name))
+		return true
+	})
+}
+
+// checkExports reports pub declarations whose capitalized Go name collides
+// with another declaration in the same scope
+func (c *Checker) checkExports(program *ast.Program) {
+	topLevel := make(map[string]bool)
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionDecl:
+			if s != nil {
+				topLevel[s.Name] = true
+			}
+		case *ast.StructDecl:
+			if s != nil {
+				topLevel[s.Name] = true
+			}
+		}
+	}
+
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionDecl:
+			if s != nil && s.Public {
+				c.checkExportCollision("func "+s.Name, s.Name, topLevel, s.Line)
+			}
+		case *ast.StructDecl:
+			if s == nil {
+				continue
+			}
+			if s.Public {
+				c.checkExportCollision("struct "+s.Name, s.Name, topLevel, s.Line)
+			}
+			members := make(map[string]bool)
+			for _, field := range s.Fields {
+				members[field.Name] = true
+			}
+			for _, method := range s.Methods {
+				members[method.Name] = true
+			}
+			for _, field := range s.Fields {
+				if field.Public {
+					c.checkExportCollision("field "+s.Name+"."+field.Name, field.Name, members, field.Line)
+				}
+			}
+			for _, method := range s.Methods {
+				if method.Public {
+					c.checkExportCollision("method "+s.Name+"."+method.Name, method.Name, members, method.Line)
+				}
+			}
+		}
+	}
+}
+
+func (c *Checker) checkExportCollision(decl, name string, scope map[string]bool, line int) {
+	exported := ast.ExportName(name)
+	if exported != name && scope[exported] {
+		c.errorAt(line, "pub %s conflicts with %s once exported", decl, exported)
+	}
+}
+
+// checkStructLiteral reports unknown, duplicate and promoted field names in
+// keyed literals and a wrong value count in positional literals, at the
+// line of the literal
+func (c *Checker) checkStructLiteral(lit *ast.StructLiteral, line int) {
+	t := ast.TypeFromExpr(lit.Type)
+	if t == nil {
+		return
+	}
+	decl, ok := c.structs[t.Name]
+	if !ok {
+		return // types from Go packages are checked by the Go compiler
+	}
+
+	if len(lit.Values) > 0 {
+		if len(lit.Values) < len(decl.Fields) {
+			c.errorAt(line, "too few values in %s literal: expected %d, got %d", decl.Name, len(decl.Fields), len(lit.Values))
+		} else if len(lit.Values) > len(decl.Fields) {
+			c.errorAt(line, "too many values in %s literal: expected %d, got %d", decl.Name, len(decl.Fields), len(lit.Values))
+		}
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range lit.Fields {
+		if seen[field.Name] {
+			c.errorAt(line, "duplicate field %s in %s literal", field.Name, decl.Name)
+			continue
+		}
+		seen[field.Name] = true
+
+		if findField(decl, field.Name) != nil {
+			continue
+		}
+		if via := c.promotedFrom(decl, field.Name, map[string]bool{}); via != "" {
+			c.errorAt(line, "cannot set promoted field %s in %s literal; use %s: %s{%s: ...}",
+				field.Name, decl.Name, via, via, field.Name)
+			continue
+		}
+		c.errorAt(line, "unknown field %s in %s literal", field.Name, decl.Name)
+	}
+}
+
+// checkConstructorCall validates the argument count of Person(...) calls
+// on structs that declare a func init(self, ...) constructor
+func (c *Checker) checkConstructorCall(call *ast.CallExpr, line int) {
+	t := ast.TypeFromExpr(call.Function)
+	if t == nil {
+		return
+	}
+	decl, ok := c.structs[t.Name]
+	if !ok || decl.Constructor == nil {
+		return
+	}
+	if want := len(decl.Constructor.Parameters); want != len(call.Arguments) {
+		c.errorAt(line, "wrong number of arguments to %s constructor: expected %d, got %d",
+			decl.Name, want, len(call.Arguments))
+	}
+}
+
+// promotedFrom returns the name of the embedded field through which name is
+// promoted into decl, or "" if it is not a promoted field
+func (c *Checker) promotedFrom(decl *ast.StructDecl, name string, visited map[string]bool) string {
+	visited[decl.Name] = true
+	for _, field := range decl.Fields {
+		if !field.Embedded {
+			continue
+		}
+		embedded, ok := c.structs[field.Type.Name]
+		if !ok || visited[embedded.Name] {
+			continue
+		}
+		if findField(embedded, name) != nil || c.promotedFrom(embedded, name, visited) != "" {
+			return field.Name
+		}
+	}
+	return ""
+}
+
+func findField(decl *ast.StructDecl, name string) *ast.Field {
+	for _, field := range decl.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
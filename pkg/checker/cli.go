@@ -0,0 +1,115 @@
+package checker
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// cliTypes are the parameter types a @cli function can take as flags, with
+// the literal type of their default values
+var cliTypes = map[string]string{
+	"string":  "string",
+	"int":     "int",
+	"int64":   "int",
+	"uint":    "int",
+	"uint64":  "int",
+	"float64": "float",
+	"bool":    "bool",
+}
+
+// checkAnnotations checks the @annotations of the program's functions and
+// the default parameter values, which only @cli functions may have
+func (c *Checker) checkAnnotations(program *ast.Program) {
+	var cli []*ast.FunctionDecl
+	ast.Inspect(program, func(node ast.Node) bool {
+		fn, ok := node.(*ast.FunctionDecl)
+		if !ok {
+			return true
+		}
+		for _, annotation := range fn.Annotations {
+			if annotation != "cli" {
+				c.errorAt(fn.Line, "func %s: unknown annotation @%s", fn.Name, annotation)
+			}
+		}
+		if fn.HasAnnotation("cli") {
+			cli = append(cli, fn)
+			return true
+		}
+		for _, param := range fn.Parameters {
+			if param.Default != nil {
+				c.errorAt(fn.Line, "func %s: parameter %s has a default value, which only the parameters of a @cli function may have",
+					fn.Name, param.Name)
+			}
+		}
+		return true
+	})
+
+	for i, fn := range cli {
+		if i > 0 {
+			c.errorAt(fn.Line, "func %s: only one function can be annotated with @cli, and %s already is", fn.Name, cli[0].Name)
+			continue
+		}
+		c.checkCLIFunc(program, fn)
+	}
+}
+
+// checkCLIFunc checks that a @cli function can be the program's entry point
+// and that its parameters can be parsed from flags
+func (c *Checker) checkCLIFunc(program *ast.Program, fn *ast.FunctionDecl) {
+	switch {
+	case program.Package != "main":
+		c.errorAt(fn.Line, "func %s: @cli is only allowed in package main", fn.Name)
+	case fn.Receiver != nil || len(fn.TypeParams) > 0:
+		c.errorAt(fn.Line, "func %s: @cli is only allowed on a plain top-level function", fn.Name)
+	case fn.Name != "main" && c.funcs["main"] != nil:
+		c.errorAt(fn.Line, "func %s: a @cli function is the program's entry point, so the program cannot also declare func main", fn.Name)
+	case len(program.Script()) > 0:
+		c.errorAt(fn.Line, "func %s: a @cli function is the program's entry point, so the program cannot also have top-level statements", fn.Name)
+	}
+
+	results := fn.ReturnType.ResultTypes()
+	if len(results) > 1 || len(results) == 1 && !isNamed(results[0], "error") && !isNamed(results[0], "int") {
+		c.errorAt(fn.Line, "func %s: a @cli function may return nothing, an error or an int exit code, not %s", fn.Name, fn.ReturnType.String())
+	}
+
+	for i, param := range fn.Parameters {
+		t := param.Type
+		if t != nil && t.IsSlice && isNamed(t.ValueType, "string") && i == len(fn.Parameters)-1 {
+			// The last parameter may take the positional arguments
+			if param.Default != nil {
+				c.errorAt(fn.Line, "func %s: parameter %s takes the positional arguments and cannot have a default value", fn.Name, param.Name)
+			}
+			continue
+		}
+		literal, ok := "", false
+		if t != nil && t.IsNamed() {
+			literal, ok = cliTypes[t.Name]
+		}
+		if !ok {
+			typeName := "no type"
+			if t != nil {
+				typeName = t.String()
+			}
+			c.errorAt(fn.Line, "func %s: parameter %s has %s; @cli parameters must be string, int, int64, uint, uint64, float64 or bool, or a final []string for the positional arguments",
+				fn.Name, param.Name, typeName)
+			continue
+		}
+		if param.Default == nil {
+			continue
+		}
+		value, negated := param.Default, false
+		if u, ok := value.(*ast.UnaryExpr); ok && u.Operator == "-" {
+			value, negated = u.Operand, true
+		}
+		lit, isLiteral := value.(*ast.Literal)
+		if !isLiteral || lit.Type != literal && !(literal == "float" && lit.Type == "int") ||
+			negated && lit.Type != "int" && lit.Type != "float" {
+			c.errorAt(fn.Line, "func %s: the default value of parameter %s must be a %s literal, got %s",
+				fn.Name, param.Name, t.Name, param.Default.String())
+		}
+	}
+}
+
+// isNamed reports whether t is the plain named type name
+func isNamed(t *ast.TypeSpec, name string) bool {
+	return t != nil && t.IsNamed() && t.Name == name
+}
@@ -0,0 +1,133 @@
+package checker
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// errorScope describes where a statement sits for the error handling
+// checks: which function it belongs to and how many try bodies and except
+// clauses enclose it
+type errorScope struct {
+	fn          string // "func name" or "the func literal", for messages
+	errorResult bool   // the function's last result is an error
+	tries       int
+	excepts     int
+}
+
+// checkErrorFlow checks the use of ? and raise in a function body. The
+// body of nested func literals is checked separately, when Check visits
+// them.
+func (c *Checker) checkErrorFlow(name string, result *ast.TypeSpec, body *ast.BlockStmt) {
+	if body == nil {
+		return
+	}
+	scope := errorScope{fn: name, errorResult: hasErrorResult(result)}
+	c.checkErrorBlock(body, scope)
+}
+
+// hasErrorResult reports whether a function with this result type returns
+// an error as its last result
+func hasErrorResult(result *ast.TypeSpec) bool {
+	results := result.ResultTypes()
+	return len(results) > 0 && results[len(results)-1].Name == "error"
+}
+
+func (c *Checker) checkErrorBlock(block *ast.BlockStmt, scope errorScope) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		c.checkErrorStmt(stmt, scope)
+	}
+}
+
+func (c *Checker) checkErrorStmt(stmt ast.Statement, scope errorScope) {
+	line := ast.Line(stmt)
+	switch s := stmt.(type) {
+	case *ast.BlockStmt:
+		c.checkErrorBlock(s, scope)
+	case *ast.TryStmt:
+		body := scope
+		body.tries++
+		c.checkErrorBlock(s.Body, body)
+		handler := scope
+		handler.excepts++
+		for _, h := range s.Handlers {
+			c.checkErrorBlock(h.Body, handler)
+		}
+		c.checkErrorBlock(s.Finally, scope)
+	case *ast.RaiseStmt:
+		if s.Value == nil && scope.excepts == 0 {
+			c.errorAt(line, "bare raise in %s is only allowed in an except clause", scope.fn)
+		}
+		c.checkPropagation(s.Value, scope, line)
+	case *ast.IfStmt:
+		c.checkPropagation(s.Condition, scope, line)
+		c.checkErrorStmt(s.ThenBranch, scope)
+		if s.ElseBranch != nil {
+			c.checkErrorStmt(s.ElseBranch, scope)
+		}
+	case *ast.WhileStmt:
+		c.disallowPropagation(s.Condition, "a while condition", line)
+		c.checkErrorBlock(s.Body, scope)
+	case *ast.ForStmt:
+		for _, node := range []ast.Node{s.Init, s.Condition, s.Update} {
+			c.disallowPropagation(node, "a for loop header", line)
+		}
+		c.checkPropagation(s.RangeExpr, scope, line)
+		c.checkErrorBlock(s.Body, scope)
+	case *ast.VarDecl:
+		c.checkPropagation(s.Value, scope, line)
+	case *ast.AssignStmt:
+		c.checkPropagation(s.Value, scope, line)
+	case *ast.ReturnStmt:
+		c.checkPropagation(s.Value, scope, line)
+	case *ast.ExpressionStmt:
+		c.checkPropagation(s.Expression, scope, line)
+	}
+}
+
+// checkPropagation reports a ? that has nowhere to send its error: outside
+// any try body in a function without an error result
+func (c *Checker) checkPropagation(node ast.Node, scope errorScope, line int) {
+	forEachPropagation(node, func(p *ast.PropagateExpr) {
+		if scope.tries == 0 && !scope.errorResult {
+			c.errorAt(line, "%s needs %s to return an error, or an enclosing try", p.String(), scope.fn)
+		}
+	})
+}
+
+// countValues fills in the number of results a call of a Go function
+// marked with ? returns before its error, which f()? on its own discards
+func (c *Checker) countValues(p *ast.PropagateExpr) {
+	call, ok := p.Call.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	if _, m := c.goCallee(call.Function); m != nil && m.Kind == "func" && len(m.Results) > 0 {
+		p.Values = len(m.Results) - 1
+	}
+}
+
+// disallowPropagation reports a ? in a position that is evaluated more than
+// once or only conditionally, where the call cannot be moved in front of
+// the statement
+func (c *Checker) disallowPropagation(node ast.Node, where string, line int) {
+	forEachPropagation(node, func(p *ast.PropagateExpr) {
+		c.errorAt(line, "%s cannot be used in %s", p.String(), where)
+	})
+}
+
+// forEachPropagation calls f for each ? in node, leaving out func literals,
+// lambdas and comprehensions, which are checked on their own
+func forEachPropagation(node ast.Node, f func(*ast.PropagateExpr)) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.FunctionLiteral, *ast.LambdaExpr, *ast.ComprehensionExpr:
+			return false
+		case *ast.PropagateExpr:
+			f(e)
+		}
+		return true
+	})
+}
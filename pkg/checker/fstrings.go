@@ -0,0 +1,23 @@
+package checker
+
+import (
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// checkFString rejects a format spec type that the literal in a replacement
+// field cannot take, as in f"{'text':d}". The syntax of the specs is checked
+// by the parser, and the code generator checks the values whose type it
+// knows.
+func (c *Checker) checkFString(f *ast.FStringExpr, line int) {
+	for _, part := range f.Parts {
+		lit, ok := part.Value.(*ast.Literal)
+		if !ok || part.Spec == nil || part.Spec.Type == 0 || part.Conversion != "" {
+			continue
+		}
+		if codes, known := ast.FormatCodes[lit.Type]; known && !strings.ContainsRune(codes, rune(part.Spec.Type)) {
+			c.errorAt(line, "format code '%c' is not valid for the %s %s in %s", part.Spec.Type, lit.Type, lit.String(), f.String())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package checker
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// checkGenerics checks the type arguments given to generic structs and
+// functions. Whether the arguments satisfy the constraints is left to the Go
+// compiler. Errors are reported at line.
+func (c *Checker) checkGenerics(node ast.Node, line int) {
+	switch n := node.(type) {
+	case *ast.FunctionDecl:
+		for _, param := range n.Parameters {
+			c.checkTypeSpec(param.Type, line)
+		}
+		c.checkTypeSpec(n.ReturnType, line)
+	case *ast.FunctionLiteral:
+		for _, param := range n.Parameters {
+			c.checkTypeSpec(param.Type, line)
+		}
+		c.checkTypeSpec(n.ReturnType, line)
+	case *ast.StructDecl:
+		for _, field := range n.Fields {
+			c.checkTypeSpec(field.Type, field.Line)
+		}
+	case *ast.VarDecl:
+		c.checkTypeSpec(n.Type, line)
+	case *ast.StructLiteral:
+		if t := ast.TypeFromExpr(n.Type); t != nil {
+			if decl, ok := c.structs[t.Name]; ok && len(decl.TypeParams) > 0 && len(t.TypeArgs) == 0 {
+				c.errorAt(line, "cannot use generic struct %s without type arguments in a literal; write %s[...]{...}",
+					decl.Name, decl.Name)
+			}
+		}
+	case *ast.InstantiationExpr:
+		c.checkInstantiation(ast.TypeFromExpr(n), line)
+	case *ast.IndexExpr:
+		// Only an index on a generic name is an instantiation
+		if ident, ok := n.Object.(*ast.Identifier); ok && c.typeParams(ident.Value) != nil {
+			c.checkInstantiation(ast.TypeFromExpr(n), line)
+		}
+	}
+}
+
+// checkTypeSpec checks the generic structs named in a type, which must be
+// given all their type arguments
+func (c *Checker) checkTypeSpec(t *ast.TypeSpec, line int) {
+	if t == nil {
+		return
+	}
+	if decl, ok := c.structs[t.Name]; ok {
+		if len(decl.TypeParams) > 0 && len(t.TypeArgs) == 0 {
+			c.errorAt(line, "cannot use generic struct %s without type arguments", decl.Name)
+		} else {
+			c.checkInstantiation(t, line)
+		}
+	}
+	c.checkTypeSpec(t.KeyType, line)
+	c.checkTypeSpec(t.ValueType, line)
+	for _, list := range [][]*ast.TypeSpec{t.Params, t.Results, t.TypeArgs} {
+		for _, arg := range list {
+			c.checkTypeSpec(arg, line)
+		}
+	}
+}
+
+// checkInstantiation checks the number of type arguments given to a
+// generic struct or function declared in the program
+func (c *Checker) checkInstantiation(t *ast.TypeSpec, line int) {
+	if t == nil || len(t.TypeArgs) == 0 {
+		return
+	}
+	_, isStruct := c.structs[t.Name]
+	_, isFunc := c.funcs[t.Name]
+	if !isStruct && !isFunc {
+		return
+	}
+	params := c.typeParams(t.Name)
+	if params == nil {
+		c.errorAt(line, "%s is not generic but is given type arguments", t.Name)
+		return
+	}
+	if len(params) != len(t.TypeArgs) {
+		c.errorAt(line, "wrong number of type arguments to %s: expected %d, got %d", t.Name, len(params), len(t.TypeArgs))
+	}
+}
+
+// typeParams returns the type parameters of a struct or function declared
+// in the program, or nil if it is not generic
+func (c *Checker) typeParams(name string) []*ast.TypeParam {
+	if decl, ok := c.structs[name]; ok && len(decl.TypeParams) > 0 {
+		return decl.TypeParams
+	}
+	if decl, ok := c.funcs[name]; ok && len(decl.TypeParams) > 0 {
+		return decl.TypeParams
+	}
+	return nil
+}
+
+// substitute replaces type parameters in t with the matching type
+// arguments. It returns nil if t mentions a type parameter that has no
+// argument, since its type is then only known to the Go compiler.
+func substitute(t *ast.TypeSpec, args map[string]*ast.TypeSpec, params map[string]bool) *ast.TypeSpec {
+	if t == nil {
+		return nil
+	}
+	if params[t.Name] {
+		if arg, ok := args[t.Name]; ok {
+			return arg
+		}
+		return nil
+	}
+
+	result := *t
+	ok := true
+	replace := func(t *ast.TypeSpec) *ast.TypeSpec {
+		if t == nil {
+			return nil
+		}
+		r := substitute(t, args, params)
+		if r == nil {
+			ok = false
+		}
+		return r
+	}
+	replaceAll := func(types []*ast.TypeSpec) []*ast.TypeSpec {
+		var out []*ast.TypeSpec
+		for _, t := range types {
+			out = append(out, replace(t))
+		}
+		return out
+	}
+	result.KeyType = replace(t.KeyType)
+	result.ValueType = replace(t.ValueType)
+	result.Params = replaceAll(t.Params)
+	result.Results = replaceAll(t.Results)
+	result.TypeArgs = replaceAll(t.TypeArgs)
+	if !ok {
+		return nil
+	}
+	return &result
+}
@@ -0,0 +1,252 @@
+package checker
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/gopkg"
+	"github.com/GrandpaEJ/go-script/pkg/stdlib"
+)
+
+// With a gopkg.Loader, the checker checks what a program uses of the Go
+// packages it imports, and of those gos imports for it such as fmt: that
+// the names exist, that funcs get as many arguments as they take, and
+// that literal arguments fit parameters of basic types. A package the
+// loader cannot load is left to the Go compiler, as are lowercase names
+// such as strings.upper, which may be functions of the gos modules.
+
+// UsePackages makes Check load the Go packages a program refers to with
+// loader and check their use
+func (c *Checker) UsePackages(loader *gopkg.Loader) {
+	c.loader = loader
+}
+
+// goPackage is a Go package as the program refers to it
+type goPackage struct {
+	name string // the name the program refers to it by
+	pkg  *gopkg.Package
+}
+
+// member returns the exported member called name, and reports it at line
+// when the package has none
+func (c *Checker) member(p *goPackage, name string, line int) *gopkg.Member {
+	if m := p.pkg.Lookup(name); m != nil {
+		return m
+	}
+	msg := fmt.Sprintf("%s.%s is not declared by package %q", p.name, name, p.pkg.Path)
+	if suggestion := p.pkg.Suggest(name); suggestion != "" {
+		msg += fmt.Sprintf("; did you mean %s.%s?", p.name, suggestion)
+	}
+	c.errorAt(line, "%s", msg)
+	return nil
+}
+
+// goCallee returns the Go package and member a call of fn calls, as in
+// os.ReadFile(p), or ReadFile(p) after from os import ReadFile
+func (c *Checker) goCallee(fn ast.Expression) (*goPackage, *gopkg.Member) {
+	switch f := fn.(type) {
+	case *ast.SelectorExpr:
+		if ident, ok := f.Object.(*ast.Identifier); ok && c.goPackages[ident.Value] != nil {
+			p := c.goPackages[ident.Value]
+			return p, p.pkg.Lookup(f.Selector)
+		}
+	case *ast.Identifier:
+		if p := c.goFromImports[f.Value]; p != nil {
+			return p, p.pkg.Lookup(f.Value)
+		}
+	}
+	return nil, nil
+}
+
+// resolveGoPackages loads the Go packages a program refers to, by the names
+// it refers to them by, and reports names imported from them that they do
+// not declare
+func (c *Checker) resolveGoPackages(program *ast.Program) {
+	if c.loader == nil {
+		return
+	}
+	declared := ast.DeclaredNames(program)
+	packages := make(map[string]*goPackage)    // by the name of the package
+	fromImports := make(map[string]*goPackage) // by the name imported
+	load := func(name, path string) *goPackage {
+		if strings.HasSuffix(path, ".gos") {
+			return nil
+		}
+		pkg, err := c.loader.Load(path)
+		if err != nil {
+			return nil
+		}
+		return &goPackage{name: name, pkg: pkg}
+	}
+
+	for _, imp := range program.Imports {
+		for _, pkg := range imp.Packages() {
+			p := load(pkg.Name, pkg.Path)
+			if p == nil {
+				continue
+			}
+			if len(pkg.Names) == 0 {
+				// A second import of the name is reported by checkImports
+				if packages[pkg.Name] == nil {
+					packages[pkg.Name] = p
+				}
+				continue
+			}
+			for _, name := range pkg.Names {
+				if p.pkg.Lookup(name) == nil {
+					msg := fmt.Sprintf("%s imported from %q is not declared by the package", name, pkg.Path)
+					if suggestion := p.pkg.Suggest(name); suggestion != "" {
+						msg += fmt.Sprintf("; did you mean %s?", suggestion)
+					}
+					c.errorAt(imp.Line, "%s", msg)
+					continue
+				}
+				fromImports[name] = p
+			}
+		}
+	}
+	used := ast.UsedNames(program)
+	for name, path := range stdlib.AutoImports {
+		if used[name] && packages[name] == nil && !declared[name] {
+			if p := load(name, path); p != nil {
+				packages[name] = p
+			}
+		}
+	}
+	// A variable, function or struct of the same name hides a package
+	for name := range packages {
+		if declared[name] {
+			delete(packages, name)
+		}
+	}
+	for name := range fromImports {
+		if c.funcs[name] != nil || c.structs[name] != nil {
+			delete(fromImports, name)
+		}
+	}
+	c.goPackages, c.goFromImports = packages, fromImports
+}
+
+// checkGoPackages checks the references of a program to Go packages
+func (c *Checker) checkGoPackages(program *ast.Program) {
+	if c.loader == nil {
+		return
+	}
+	packages, fromImports := c.goPackages, c.goFromImports
+
+	// ref returns the package and name a selector such as http.Get refers
+	// to, or nil
+	ref := func(expr ast.Expression) (*goPackage, string) {
+		sel, ok := expr.(*ast.SelectorExpr)
+		if !ok || !token.IsExported(sel.Selector) {
+			return nil, ""
+		}
+		ident, ok := sel.Object.(*ast.Identifier)
+		if !ok {
+			return nil, ""
+		}
+		return packages[ident.Value], sel.Selector
+	}
+
+	calls := make(map[ast.Expression]bool) // the selectors that are called
+	ast.InspectLines(program, func(node ast.Node, line int) bool {
+		switch n := node.(type) {
+		case *ast.CallExpr:
+			if p, name := ref(n.Function); p != nil {
+				calls[n.Function] = true
+				if m := c.member(p, name, line); m != nil {
+					c.checkGoCall(p.name+"."+name, m, n.Arguments, line)
+				}
+			} else if ident, ok := n.Function.(*ast.Identifier); ok && fromImports[ident.Value] != nil {
+				c.checkGoCall(ident.Value, fromImports[ident.Value].pkg.Lookup(ident.Value), n.Arguments, line)
+			}
+		case *ast.SelectorExpr:
+			if p, name := ref(n); p != nil && !calls[n] {
+				c.member(p, name, line)
+			}
+		}
+		return true
+	})
+	ast.InspectTypes(program, func(t *ast.TypeSpec, line int) {
+		pkgName, name, ok := strings.Cut(t.Name, ".")
+		p := packages[pkgName]
+		if !ok || p == nil || !token.IsExported(name) {
+			return
+		}
+		if m := c.member(p, name, line); m != nil && m.Kind != "type" {
+			c.errorAt(line, "%s is a %s, not a type", t.Name, m.Kind)
+		}
+	})
+}
+
+// checkGoCall checks a call at line to a member of a Go package, called
+// name in messages
+func (c *Checker) checkGoCall(name string, m *gopkg.Member, args []ast.Expression, line int) {
+	switch m.Kind {
+	case "type":
+		if len(args) != 1 {
+			c.errorAt(line, "converting to %s takes 1 argument, got %d", name, len(args))
+		}
+		return
+	case "func":
+	default:
+		if !strings.HasPrefix(m.Type, "func(") {
+			c.errorAt(line, "%s is a %s of type %s, not a func", name, m.Kind, m.Type)
+		}
+		return
+	}
+
+	// f(g()) passes all the results of g, however many
+	if len(args) == 1 {
+		if _, ok := args[0].(*ast.CallExpr); ok && len(m.Params) != 1 {
+			return
+		}
+	}
+	least, more := m.Arity()
+	switch n := len(args); {
+	case more && n < least:
+		c.errorAt(line, "%s takes at least %s, got %d: %s", name, arguments(least), n, m.Type)
+		return
+	case !more && n != least:
+		c.errorAt(line, "%s takes %s, got %d: %s", name, arguments(least), n, m.Type)
+		return
+	}
+
+	// The arguments for ...T are not checked
+	for i, arg := range args[:least] {
+		param := m.Params[i]
+		if lit, ok := arg.(*ast.Literal); ok && param.Basic != "" && !fitsBasic(lit, param.Basic) {
+			c.errorAt(line, "cannot use %s as %s in argument %d to %s", lit, param.Type, i+1, name)
+		}
+	}
+}
+
+// fitsBasic reports whether a literal is a constant Go lets a parameter of
+// a basic kind of type take: an integer is a valid float, and a float
+// without a fraction a valid integer
+func fitsBasic(lit *ast.Literal, basic string) bool {
+	switch lit.Type {
+	case "string":
+		return basic == "string"
+	case "bool":
+		return basic == "bool"
+	case "int":
+		return basic == "int" || basic == "float" || basic == "complex"
+	case "float":
+		if basic == "int" {
+			f, ok := lit.Value.(float64)
+			return ok && f == float64(int64(f))
+		}
+		return basic == "float" || basic == "complex"
+	}
+	return false
+}
+
+func arguments(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
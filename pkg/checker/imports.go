@@ -0,0 +1,98 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// checkImports reports imports that give two packages the same name and
+// warns about imports the program never refers to. Go rejects an unused
+// import, so the generated code leaves them out.
+func (c *Checker) checkImports(program *ast.Program) {
+	c.checkImportNames(program)
+	UnusedImports(program, func(line int, msg string) {
+		c.warnAt(line, "%s", msg)
+	})
+}
+
+// UnusedImports calls report with the line and a description of each
+// import the program never refers to. gos vet reports them as well.
+func UnusedImports(program *ast.Program, report func(line int, msg string)) {
+	used := ast.UsedNames(program)
+	for _, imp := range program.Imports {
+		for _, pkg := range imp.Packages() {
+			if len(pkg.Names) > 0 {
+				for _, name := range pkg.Names {
+					if !used[name] {
+						report(imp.Line, fmt.Sprintf("%s imported from %q is not used", name, pkg.Path))
+					}
+				}
+				continue
+			}
+			if used[pkg.Name] {
+				continue
+			}
+			spec := fmt.Sprintf("%q", pkg.Path)
+			if pkg.Alias {
+				spec += " as " + pkg.Name
+			}
+			report(imp.Line, fmt.Sprintf("import %s is not used", spec))
+		}
+	}
+}
+
+// checkImportNames reports a package or from-imported name that an earlier
+// import already gives to something else, since the program could only
+// refer to one of them
+func (c *Checker) checkImportNames(program *ast.Program) {
+	type named struct {
+		path string
+		line int
+	}
+	packages := make(map[string]named)
+	fromImports := make(map[string]named)
+	for _, imp := range program.Imports {
+		for _, pkg := range imp.Packages() {
+			for _, name := range pkg.Names {
+				if first, ok := fromImports[name]; ok {
+					c.errorAt(imp.Line, "%s is imported from %q and, at line %d, from %q; import it from one package",
+						name, pkg.Path, first.line, first.path)
+					continue
+				}
+				fromImports[name] = named{pkg.Path, imp.Line}
+			}
+			if len(pkg.Names) > 0 {
+				continue
+			}
+			first, ok := packages[pkg.Name]
+			switch {
+			case !ok:
+				packages[pkg.Name] = named{pkg.Path, imp.Line}
+			case first.path == pkg.Path:
+				c.errorAt(imp.Line, "%q is already imported as %s at line %d", pkg.Path, pkg.Name, first.line)
+			default:
+				c.errorAt(imp.Line, "import %q: %s is already the name of %q, imported at line %d; name one of them with as, as in import %q as %s",
+					pkg.Path, pkg.Name, first.path, first.line, pkg.Path, importAlias(pkg.Path))
+			}
+		}
+	}
+}
+
+// importAlias suggests a name for the package at path that tells it apart
+// from another package of the same name: cryptorand for crypto/rand
+func importAlias(path string) string {
+	elems := strings.Split(strings.TrimSuffix(path, ".gos"), "/")
+	if len(elems) < 2 {
+		return elems[0] + "pkg"
+	}
+	parent := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, elems[len(elems)-2])
+	return parent + elems[len(elems)-1]
+}
@@ -0,0 +1,314 @@
+package checker
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/gopkg"
+	"github.com/GrandpaEJ/go-script/pkg/stdlib"
+)
+
+// goParamTypes returns the parameter types of a func of a Go package, as
+// the loader reads them, so lambdas passed to it can be typed. A parameter
+// of a named func type of the package, such as filepath.WalkFunc, takes a
+// lambda of the func type it names, as does a conversion to the type, such
+// as http.HandlerFunc(...). Types .gos cannot write are nil.
+func (c *Checker) goParamTypes(p *goPackage, m *gopkg.Member) []*ast.TypeSpec {
+	if m != nil && m.Kind == "type" {
+		if t := c.goType(p, m, m.Type); t != nil && t.IsFunc {
+			return []*ast.TypeSpec{t}
+		}
+	}
+	if m == nil || m.Kind != "func" {
+		return nil
+	}
+	types := make([]*ast.TypeSpec, len(m.Params))
+	for i, param := range m.Params {
+		types[i] = c.goType(p, m, param.Type)
+		if t := types[i]; t != nil && t.IsNamed() && !t.IsPointer && !strings.Contains(param.Type, ".") {
+			if named := p.pkg.Lookup(param.Type); named != nil && named.Kind == "type" {
+				types[i] = c.goType(p, named, named.Type)
+			}
+		}
+	}
+	return types
+}
+
+// goType converts a type of member m of a Go package, as the loader writes
+// it, such as func(w ResponseWriter, r *Request), to a .gos type, with the
+// types of packages by the names the program refers to them by:
+// func(web.ResponseWriter, *web.Request) for import "net/http" as web. It
+// returns nil for types .gos cannot write, such as channels, and for types
+// of packages the program cannot refer to.
+func (c *Checker) goType(p *goPackage, m *gopkg.Member, text string) *ast.TypeSpec {
+	expr, err := goparser.ParseExpr(text)
+	if err != nil {
+		return nil
+	}
+	return c.convertGoType(p, m, expr)
+}
+
+func (c *Checker) convertGoType(p *goPackage, m *gopkg.Member, expr goast.Expr) *ast.TypeSpec {
+	switch e := expr.(type) {
+	case *goast.Ident:
+		if types.Universe.Lookup(e.Name) != nil {
+			return &ast.TypeSpec{Name: e.Name}
+		}
+		// Other names are types of the package, or type parameters
+		if named := p.pkg.Lookup(e.Name); named != nil && named.Kind == "type" {
+			return &ast.TypeSpec{Name: p.name + "." + e.Name}
+		}
+	case *goast.SelectorExpr:
+		if pkg, ok := e.X.(*goast.Ident); ok {
+			if name := c.goPackageName(m.Imports[pkg.Name]); name != "" {
+				return &ast.TypeSpec{Name: name + "." + e.Sel.Name}
+			}
+		}
+	case *goast.StarExpr:
+		t := c.convertGoType(p, m, e.X)
+		if t == nil || t.IsPointer {
+			return nil
+		}
+		t.IsPointer = true
+		return t
+	case *goast.ArrayType:
+		elem := c.convertGoType(p, m, e.Elt)
+		if elem == nil {
+			return nil
+		}
+		if e.Len == nil {
+			return &ast.TypeSpec{IsSlice: true, ValueType: elem}
+		}
+		size, ok := e.Len.(*goast.BasicLit)
+		if !ok {
+			return nil
+		}
+		n, err := strconv.Atoi(size.Value)
+		if err != nil {
+			return nil
+		}
+		return &ast.TypeSpec{IsArray: true, ArraySize: n, ValueType: elem}
+	case *goast.MapType:
+		key, value := c.convertGoType(p, m, e.Key), c.convertGoType(p, m, e.Value)
+		if key == nil || value == nil {
+			return nil
+		}
+		return &ast.TypeSpec{KeyType: key, ValueType: value}
+	case *goast.InterfaceType:
+		if len(e.Methods.List) == 0 {
+			return &ast.TypeSpec{Name: "interface{}"}
+		}
+	case *goast.FuncType:
+		t := &ast.TypeSpec{IsFunc: true}
+		var ok bool
+		if t.Params, ok = c.convertGoFields(p, m, e.Params); !ok {
+			return nil
+		}
+		if t.Results, ok = c.convertGoFields(p, m, e.Results); !ok {
+			return nil
+		}
+		return t
+	}
+	return nil
+}
+
+// convertGoFields converts the types of the parameters or results of a
+// func type, one for each name
+func (c *Checker) convertGoFields(p *goPackage, m *gopkg.Member, fields *goast.FieldList) ([]*ast.TypeSpec, bool) {
+	if fields == nil {
+		return nil, true
+	}
+	var types []*ast.TypeSpec
+	for _, field := range fields.List {
+		if _, variadic := field.Type.(*goast.Ellipsis); variadic {
+			return nil, false
+		}
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			t := c.convertGoType(p, m, field.Type)
+			if t == nil {
+				return nil, false
+			}
+			types = append(types, t)
+		}
+	}
+	return types, true
+}
+
+// goPackageName returns the name the program refers to the Go package at
+// path by: that of its import, or the name of a package gos imports for it,
+// or "" if it cannot refer to the package
+func (c *Checker) goPackageName(path string) string {
+	if path == "" {
+		return ""
+	}
+	for name, p := range c.goPackages {
+		if p.pkg.Path == path {
+			return name
+		}
+	}
+	for name, auto := range stdlib.AutoImports {
+		if auto == path && c.funcs[name] == nil && c.structs[name] == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// inferLambdas gives every lambda the function type expected where it is
+// used: a typed variable, a function argument, a return value or a struct
+// field. Lambdas used anywhere else are reported, since Go func literals
+// need explicit types.
+func (c *Checker) inferLambdas(program *ast.Program) {
+	ast.InspectLines(program, func(node ast.Node, line int) bool {
+		switch n := node.(type) {
+		case *ast.VarDecl:
+			c.expectFunc(n.Value, n.Type, line)
+		case *ast.CallExpr:
+			params := c.paramTypes(n.Function)
+			for i, arg := range n.Arguments {
+				if i < len(params) {
+					c.expectFunc(arg, params[i], line)
+				}
+			}
+		case *ast.StructLiteral:
+			c.inferFieldValues(n, line)
+		case *ast.FunctionDecl:
+			c.inferReturns(n.Body, n.ReturnType)
+		case *ast.FunctionLiteral:
+			c.inferReturns(n.Body, n.ReturnType)
+		}
+		return true
+	})
+
+	ast.InspectLines(program, func(node ast.Node, line int) bool {
+		if lambda, ok := node.(*ast.LambdaExpr); ok && lambda.Type == nil {
+			c.errorAt(line, "cannot infer the type of %s; pass it where a function type is expected or use a func literal",
+				lambda.String())
+		}
+		return true
+	})
+}
+
+// expectFunc types expr from t if expr is a lambda and t a function type.
+// A lambda returning a lambda passes the result type on. A mismatch is
+// reported at line.
+func (c *Checker) expectFunc(expr ast.Expression, t *ast.TypeSpec, line int) {
+	lambda, ok := expr.(*ast.LambdaExpr)
+	if !ok || t == nil || !t.IsFunc {
+		return
+	}
+	// The type is kept even on a mismatch so the lambda is reported once
+	lambda.Type = t
+	if len(lambda.Parameters) != len(t.Params) {
+		c.errorAt(line, "%s has %d parameters but %s expects %d",
+			lambda.String(), len(lambda.Parameters), t.String(), len(t.Params))
+		return
+	}
+	if len(t.Results) == 1 {
+		c.expectFunc(lambda.Body, t.Results[0], line)
+	}
+}
+
+// paramTypes returns the parameter types of the called function, if known.
+// For generic functions the explicit type arguments are substituted;
+// parameters that still mention a type parameter are left unknown.
+func (c *Checker) paramTypes(fn ast.Expression) []*ast.TypeSpec {
+	if p, m := c.goCallee(fn); p != nil {
+		return c.goParamTypes(p, m)
+	}
+	if _, ok := fn.(*ast.SelectorExpr); ok {
+		return nil
+	}
+
+	t := ast.TypeFromExpr(fn)
+	if t == nil {
+		return nil
+	}
+	var params []*ast.Parameter
+	var typeParams []*ast.TypeParam
+	if decl, ok := c.funcs[t.Name]; ok {
+		params, typeParams = decl.Parameters, decl.TypeParams
+	} else if decl, ok := c.structs[t.Name]; ok && decl.Constructor != nil {
+		params, typeParams = decl.Constructor.Parameters, decl.TypeParams
+	} else {
+		return nil
+	}
+
+	types := parameterTypes(params)
+	if len(typeParams) == 0 {
+		return types
+	}
+	args := make(map[string]*ast.TypeSpec)
+	names := make(map[string]bool)
+	for i, param := range typeParams {
+		names[param.Name] = true
+		if i < len(t.TypeArgs) {
+			args[param.Name] = t.TypeArgs[i]
+		}
+	}
+	for i := range types {
+		types[i] = substitute(types[i], args, names)
+	}
+	return types
+}
+
+// parameterTypes resolves grouped parameters such as (a, b int), where only
+// the last name of the group carries the type
+func parameterTypes(params []*ast.Parameter) []*ast.TypeSpec {
+	types := make([]*ast.TypeSpec, len(params))
+	var next *ast.TypeSpec
+	for i := len(params) - 1; i >= 0; i-- {
+		if params[i].Type != nil {
+			next = params[i].Type
+		}
+		types[i] = next
+	}
+	return types
+}
+
+func (c *Checker) inferFieldValues(lit *ast.StructLiteral, line int) {
+	ident, ok := lit.Type.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	decl, ok := c.structs[ident.Value]
+	if !ok {
+		return
+	}
+	for _, value := range lit.Fields {
+		if field := findField(decl, value.Name); field != nil {
+			c.expectFunc(value.Value, field.Type, line)
+		}
+	}
+	for i, value := range lit.Values {
+		if i < len(decl.Fields) {
+			c.expectFunc(value, decl.Fields[i].Type, line)
+		}
+	}
+}
+
+// inferReturns types lambdas returned from a function with a function
+// result type. Nested func literals have their own result type and are
+// handled when they are visited.
+func (c *Checker) inferReturns(body *ast.BlockStmt, result *ast.TypeSpec) {
+	if body == nil || result == nil || !result.IsFunc {
+		return
+	}
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ReturnStmt:
+			c.expectFunc(n.Value, result, n.Line)
+		}
+		return true
+	})
+}
@@ -0,0 +1,187 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// checkScript checks the top-level statements that run when the program
+// starts. They have no error result for ? to return to, and in package main
+// they replace func main, which then only runs if they call it.
+func (c *Checker) checkScript(program *ast.Program) {
+	script := program.Script()
+	if len(script) == 0 {
+		return
+	}
+	c.checkErrorFlow("the top-level code", nil, &ast.BlockStmt{Statements: script})
+	c.checkScriptLocals(program, script)
+
+	main, ok := c.funcs["main"]
+	if !ok || program.Package != "main" {
+		return
+	}
+	calls := false
+	for _, stmt := range script {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpr); ok {
+				if ident, ok := call.Function.(*ast.Identifier); ok && ident.Value == "main" {
+					calls = true
+				}
+			}
+			return !calls
+		})
+	}
+	if !calls {
+		c.warnAt(main.Line, "func main does not run, because the top-level statements are the program's entry point; call main() from them, for example in an if __name__ == \"__main__\": block")
+	}
+}
+
+// scriptLocal is a variable that a top-level statement declares with := or
+// an untyped var, which makes it local to the function that runs the script
+type scriptLocal struct {
+	line  int
+	value ast.Expression // the value a single variable is declared with
+}
+
+// checkScriptLocals reports functions that use a variable declared with :=
+// in the top-level code. The variable is local to the code that runs the
+// program, so functions cannot see it; a var with a type declares it at
+// the package level instead.
+func (c *Checker) checkScriptLocals(program *ast.Program, script []ast.Statement) {
+	locals := make(map[string]scriptLocal)
+	for _, stmt := range script {
+		switch s := stmt.(type) {
+		case *ast.VarDecl:
+			locals[s.Name] = scriptLocal{line: s.Line, value: s.Value}
+		case *ast.AssignStmt:
+			if s.Operator != ":=" {
+				continue
+			}
+			targets := []ast.Expression{s.Target}
+			if tuple, ok := s.Target.(*ast.TupleExpr); ok {
+				targets = tuple.Elements
+			}
+			for _, target := range targets {
+				if ident, ok := target.(*ast.Identifier); ok && ident.Value != "_" {
+					locals[ident.Value] = scriptLocal{line: s.Line}
+				}
+			}
+		}
+	}
+	for name := range locals {
+		if c.funcs[name] != nil || c.structs[name] != nil {
+			delete(locals, name)
+		}
+	}
+	if len(locals) == 0 {
+		return
+	}
+
+	var functions []*ast.FunctionDecl
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionDecl:
+			if s != nil {
+				functions = append(functions, s)
+			}
+		case *ast.StructDecl:
+			if s != nil {
+				functions = append(functions, s.Methods...)
+				if s.Constructor != nil {
+					functions = append(functions, s.Constructor)
+				}
+			}
+		}
+	}
+	for _, fn := range functions {
+		if fn.Body == nil {
+			continue
+		}
+		// A name the function declares itself anywhere is left alone
+		own := functionLocals(fn)
+		reported := make(map[string]bool)
+		ast.InspectLines(fn.Body, func(node ast.Node, line int) bool {
+			ident, ok := node.(*ast.Identifier)
+			if !ok || own[ident.Value] || reported[ident.Value] {
+				return true
+			}
+			local, ok := locals[ident.Value]
+			if !ok {
+				return true
+			}
+			reported[ident.Value] = true
+			name := fn.Name
+			if fn.Receiver != nil {
+				name = fn.Receiver.Type.Name + "." + name
+			}
+			c.errorAt(line, "func %s uses %s, but %s is declared at line %d in the top-level code, where only that code can see it; declare it at the package level with var and a type, as in %s",
+				name, ident.Value, ident.Value, local.line, typedVar(ident.Value, local.value))
+			return true
+		})
+	}
+}
+
+// functionLocals returns the names a function declares: its parameters and
+// the variables declared anywhere in its body
+func functionLocals(fn *ast.FunctionDecl) map[string]bool {
+	names := make(map[string]bool)
+	params := func(params []*ast.Parameter) {
+		for _, p := range params {
+			if p != nil {
+				names[p.Name] = true
+			}
+		}
+	}
+	params(fn.Parameters)
+	if fn.Receiver != nil {
+		params([]*ast.Parameter{fn.Receiver})
+	}
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.VarDecl:
+			names[n.Name] = true
+		case *ast.AssignStmt:
+			if n.Operator != ":=" {
+				break
+			}
+			targets := []ast.Expression{n.Target}
+			if tuple, ok := n.Target.(*ast.TupleExpr); ok {
+				targets = tuple.Elements
+			}
+			for _, target := range targets {
+				if ident, ok := target.(*ast.Identifier); ok {
+					names[ident.Value] = true
+				}
+			}
+		case *ast.ForStmt:
+			names[n.RangeVar] = true
+			names[n.ValueVar] = true
+		case *ast.ComprehensionExpr:
+			for _, clause := range n.Clauses {
+				names[clause.RangeVar] = true
+				names[clause.ValueVar] = true
+			}
+		case *ast.FunctionLiteral:
+			params(n.Parameters)
+		case *ast.LambdaExpr:
+			params(n.Parameters)
+		case *ast.TryStmt:
+			for _, h := range n.Handlers {
+				names[h.Name] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// typedVar returns the package-level var that declares name with value,
+// with the type of a literal value: var x int = 5
+func typedVar(name string, value ast.Expression) string {
+	goTypes := map[string]string{"int": "int", "float": "float64", "string": "string", "bool": "bool"}
+	if lit, ok := value.(*ast.Literal); ok && goTypes[lit.Type] != "" {
+		return fmt.Sprintf("var %s %s = %s", name, goTypes[lit.Type], lit.String())
+	}
+	return fmt.Sprintf("var %s T = ...", name)
+}
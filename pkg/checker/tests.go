@@ -0,0 +1,52 @@
+package checker
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// CheckTests runs all checks over a test file. The tests can use the
+// functions and structs of code, the program they test, which is nil when
+// the test file stands alone.
+func (c *Checker) CheckTests(tests, code *ast.Program) {
+	if code != nil {
+		for _, stmt := range code.Statements {
+			switch s := stmt.(type) {
+			case *ast.StructDecl:
+				if s != nil {
+					c.structs[s.Name] = s
+				}
+			case *ast.FunctionDecl:
+				if s != nil {
+					c.funcs[s.Name] = s
+				}
+			}
+		}
+	}
+	c.Check(tests)
+	c.checkTests(tests)
+}
+
+// checkTests checks the rules of test files. A test is a function that
+// takes the test it runs as its only parameter, such as func test_add(t):,
+// and returns nothing. A test file only declares things, since it has no
+// startup code to run.
+func (c *Checker) checkTests(tests *ast.Program) {
+	if script := tests.Script(); len(script) > 0 {
+		c.errorAt(ast.Line(script[0]), "a test file can only declare functions, structs and typed vars; put the top-level statements in a test or a function")
+	}
+	for _, stmt := range tests.Statements {
+		fn, ok := stmt.(*ast.FunctionDecl)
+		if !ok || fn == nil || !fn.IsTest() {
+			continue
+		}
+		if len(fn.Parameters) != 1 || fn.Parameters[0].Type != nil || fn.Parameters[0].Default != nil {
+			c.errorAt(fn.Line, "func %s: a test takes one parameter without a type, the test, as in func %s(t):", fn.Name, fn.Name)
+		}
+		if fn.ReturnType != nil {
+			c.errorAt(fn.Line, "func %s: a test cannot return a value; use assert to check results", fn.Name)
+		}
+		if len(fn.TypeParams) > 0 {
+			c.errorAt(fn.Line, "func %s: a test cannot have type parameters", fn.Name)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// RuntimePath is the import path of the package that implements the builtins
+// in generated code, where it is imported as RuntimeName
+const (
+	RuntimePath = "github.com/GrandpaEJ/go-script/runtime"
+	RuntimeName = "gosrt"
+)
+
+// builtin describes how a call to a builtin or module function is generated
+type builtin struct {
+	generate func(g *Generator, args []ast.Expression) string
+	result   func(g *Generator, args []ast.Expression) *ast.TypeSpec
+}
+
+// call generates a call to the Go function fn with the arguments unchanged
+func call(fn string) func(*Generator, []ast.Expression) string {
+	return func(g *Generator, args []ast.Expression) string {
+		return fmt.Sprintf("%s(%s)", fn, g.generateArguments(args))
+	}
+}
+
+// pkgCall generates a call to the function fn of the Go package at path
+func pkgCall(path, fn string) func(*Generator, []ast.Expression) string {
+	return func(g *Generator, args []ast.Expression) string {
+		return fmt.Sprintf("%s(%s)", g.qualified(path, fn), g.generateArguments(args))
+	}
+}
+
+// runtimeCall generates a call to a function of the runtime package
+func runtimeCall(fn string) func(*Generator, []ast.Expression) string {
+	return pkgCall(RuntimePath, fn)
+}
+
+// returns gives a call the result type name
+func returns(name string) func(*Generator, []ast.Expression) *ast.TypeSpec {
+	t := named(name)
+	return func(*Generator, []ast.Expression) *ast.TypeSpec { return t }
+}
+
+// returnsSlice gives a call the result type []elem
+func returnsSlice(elem string) func(*Generator, []ast.Expression) *ast.TypeSpec {
+	t := &ast.TypeSpec{IsSlice: true, ValueType: named(elem)}
+	return func(*Generator, []ast.Expression) *ast.TypeSpec { return t }
+}
+
+// returnsFirstArg gives a call the type of its first argument
+func returnsFirstArg(g *Generator, args []ast.Expression) *ast.TypeSpec {
+	if len(args) == 0 {
+		return nil
+	}
+	return g.exprType(args[0])
+}
+
+// typeArg returns the type make and new take as their first argument
+func typeArg(args []ast.Expression) *ast.TypeSpec {
+	if len(args) == 0 {
+		return nil
+	}
+	if t, ok := args[0].(*ast.TypeExpr); ok {
+		return t.Type
+	}
+	return ast.TypeFromExpr(args[0])
+}
+
+// returnsTypeArg gives a call of make the type it makes
+func returnsTypeArg(_ *Generator, args []ast.Expression) *ast.TypeSpec {
+	return typeArg(args)
+}
+
+// returnsPointer gives a call of new a pointer to the type it allocates,
+// unless that is a pointer already, which a TypeSpec cannot point to
+func returnsPointer(_ *Generator, args []ast.Expression) *ast.TypeSpec {
+	t := typeArg(args)
+	if t == nil || t.IsPointer {
+		return nil
+	}
+	pointer := *t
+	pointer.IsPointer = true
+	return &pointer
+}
+
+func noResult(*Generator, []ast.Expression) *ast.TypeSpec { return nil }
+
+// builtins are the functions available without an import, as listed in
+// stdlib/core. modules are the functions of the strings and math modules,
+// called as strings.upper(s); their names are lower case, so they never
+// hide a function of the Go package with the same name. Both are filled in
+// by init, since the generators refer back to the tables.
+var (
+	builtins map[string]builtin
+	modules  map[string]map[string]builtin
+)
+
+func init() {
+	builtins = map[string]builtin{
+		"print":       {pkgCall("fmt", "Println"), noResult},
+		"println":     {pkgCall("fmt", "Println"), noResult},
+		"printf":      {pkgCall("fmt", "Printf"), noResult},
+		"input":       {runtimeCall("Input"), returns("string")},
+		"args":        {runtimeCall("Args"), returnsSlice("string")},
+		"exit":        {generateExit, noResult},
+		"len":         {call("len"), returns("int")},
+		"range":       {runtimeCall("Range"), returnsSlice("int")},
+		"enumerate":   {runtimeCall("Enumerate"), noResult},
+		"zip":         {runtimeCall("Zip"), noResult},
+		"str":         {generateStr, returns("string")},
+		"int":         {generateInt, returns("int")},
+		"float":       {generateFloat, returns("float64")},
+		"bool":        {generateBool, returns("bool")},
+		"type":        {runtimeCall("Type"), returns("string")},
+		"append":      {call("append"), returnsFirstArg},
+		"make":        {call("make"), returnsTypeArg},
+		"new":         {call("new"), returnsPointer},
+		"now":         {pkgCall("time", "Now"), returns("time.Time")},
+		"format_time": {runtimeCall("FormatTime"), returns("string")},
+	}
+
+	modules = map[string]map[string]builtin{
+		"strings": {
+			"upper":      {runtimeCall("Upper"), returns("string")},
+			"lower":      {runtimeCall("Lower"), returns("string")},
+			"title":      {runtimeCall("Title"), returns("string")},
+			"strip":      {runtimeCall("Strip"), returns("string")},
+			"lstrip":     {runtimeCall("LStrip"), returns("string")},
+			"rstrip":     {runtimeCall("RStrip"), returns("string")},
+			"split":      {runtimeCall("Split"), returnsSlice("string")},
+			"join":       {runtimeCall("Join"), returns("string")},
+			"replace":    {runtimeCall("Replace"), returns("string")},
+			"contains":   {runtimeCall("Contains"), returns("bool")},
+			"startswith": {runtimeCall("StartsWith"), returns("bool")},
+			"endswith":   {runtimeCall("EndsWith"), returns("bool")},
+			"find":       {runtimeCall("Find"), returns("int")},
+			"count":      {runtimeCall("Count"), returns("int")},
+		},
+		"math": {
+			"abs":   {runtimeCall("Abs"), returnsFirstArg},
+			"ceil":  {runtimeCall("Ceil"), returns("float64")},
+			"floor": {runtimeCall("Floor"), returns("float64")},
+			"round": {runtimeCall("Round"), returns("float64")},
+			"sqrt":  {runtimeCall("Sqrt"), returns("float64")},
+			"pow":   {runtimeCall("Pow"), returns("float64")},
+			"sin":   {runtimeCall("Sin"), returns("float64")},
+			"cos":   {runtimeCall("Cos"), returns("float64")},
+			"tan":   {runtimeCall("Tan"), returns("float64")},
+			"log":   {runtimeCall("Log"), returns("float64")},
+			"log10": {runtimeCall("Log10"), returns("float64")},
+			"exp":   {runtimeCall("Exp"), returns("float64")},
+			"min":   {runtimeCall("Min"), returnsFirstArg},
+			"max":   {runtimeCall("Max"), returnsFirstArg},
+		},
+	}
+}
+
+// mathConstants are the constants of the math module: math.pi
+var mathConstants = map[string]string{
+	"pi": "Pi",
+	"e":  "E",
+}
+
+// argvName is the builtin variable holding the program name and its
+// arguments, like Python's sys.argv
+const argvName = "argv"
+
+// builtinFunc returns the builtin called by name, unless a function or
+// variable of the program hides it
+func (g *Generator) builtinFunc(name string) (builtin, bool) {
+	if _, ok := g.funcs[name]; ok {
+		return builtin{}, false
+	}
+	if _, ok := g.lookup(name); ok {
+		return builtin{}, false
+	}
+	b, ok := builtins[name]
+	return b, ok
+}
+
+// moduleFunc returns the module function called by sel, such as
+// strings.upper
+func (g *Generator) moduleFunc(sel *ast.SelectorExpr) (builtin, bool) {
+	module, ok := g.moduleName(sel.Object)
+	if !ok {
+		return builtin{}, false
+	}
+	b, ok := modules[module][sel.Selector]
+	return b, ok
+}
+
+// moduleName returns the module an expression refers to, unless a variable
+// or .gos package of the same name hides it
+func (g *Generator) moduleName(expr ast.Expression) (string, bool) {
+	ident, ok := expr.(*ast.Identifier)
+	if !ok || modules[ident.Value] == nil || g.gosPackages[ident.Value] != "" {
+		return "", false
+	}
+	if _, ok := g.lookup(ident.Value); ok {
+		return "", false
+	}
+	return ident.Value, true
+}
+
+func (g *Generator) generateArguments(args []ast.Expression) string {
+	var parts []string
+	for _, arg := range args {
+		parts = append(parts, g.generateExpression(arg))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// The conversions are Go conversions or strconv calls where the type of the
+// argument is known. Constants go through the runtime package, since Go
+// rejects conversions such as int(2.5).
+
+// generateExit ends the program with the exit code, which defaults to 0
+func generateExit(g *Generator, args []ast.Expression) string {
+	if len(args) == 0 {
+		return g.qualified("os", "Exit") + "(0)"
+	}
+	return pkgCall("os", "Exit")(g, args)
+}
+
+func generateStr(g *Generator, args []ast.Expression) string {
+	if len(args) == 1 {
+		switch t := g.exprType(args[0]); {
+		case isType(t, "string"):
+			return g.generateExpression(args[0])
+		case isType(t, "int"):
+			return pkgCall("strconv", "Itoa")(g, args)
+		}
+	}
+	return runtimeCall("Str")(g, args)
+}
+
+func generateInt(g *Generator, args []ast.Expression) string {
+	if len(args) == 1 {
+		switch t := g.exprType(args[0]); {
+		case isType(t, "int"):
+			return g.generateExpression(args[0])
+		case isType(t, "string"):
+			return runtimeCall("Atoi")(g, args)
+		case isNumeric(t) && !isLiteral(args[0]):
+			return call("int")(g, args)
+		}
+	}
+	return runtimeCall("Int")(g, args)
+}
+
+func generateFloat(g *Generator, args []ast.Expression) string {
+	if len(args) == 1 {
+		switch t := g.exprType(args[0]); {
+		case isType(t, "float64"):
+			return g.generateExpression(args[0])
+		case isType(t, "string"):
+			return runtimeCall("ParseFloat")(g, args)
+		case isNumeric(t):
+			return call("float64")(g, args)
+		}
+	}
+	return runtimeCall("Float")(g, args)
+}
+
+func generateBool(g *Generator, args []ast.Expression) string {
+	if len(args) == 1 && isType(g.exprType(args[0]), "bool") {
+		return g.generateExpression(args[0])
+	}
+	return runtimeCall("Bool")(g, args)
+}
+
+func isLiteral(expr ast.Expression) bool {
+	_, ok := expr.(*ast.Literal)
+	return ok
+}
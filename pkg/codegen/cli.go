@@ -0,0 +1,108 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// A function annotated with @cli is the program's entry point. The generated
+// main declares a flag for each parameter, named after it with dashes for
+// underscores and defaulting to the parameter's default value, passes the
+// positional arguments to a final []string parameter, and turns an error or
+// int result into the exit code.
+
+// cliFlagFuncs are the flag package functions for the parameter types
+var cliFlagFuncs = map[string]string{
+	"string":  "String",
+	"int":     "Int",
+	"int64":   "Int64",
+	"uint":    "Uint",
+	"uint64":  "Uint64",
+	"float64": "Float64",
+	"bool":    "Bool",
+}
+
+// cliZeroValues are the defaults of parameters without a default value
+var cliZeroValues = map[string]string{
+	"string": `""`,
+	"bool":   "false",
+}
+
+// findCLI returns the top-level function annotated with @cli, or nil
+func findCLI(program *ast.Program) *ast.FunctionDecl {
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*ast.FunctionDecl); ok && fn.HasAnnotation("cli") {
+			return fn
+		}
+	}
+	return nil
+}
+
+// generateCLIMain writes the main function that parses the flags of the
+// @cli function and calls it
+func (g *Generator) generateCLIMain(fn *ast.FunctionDecl) {
+	g.writeLine("func main() {")
+	g.indentLevel++
+
+	if doc := docstring(fn.Body); doc != "" {
+		g.writeLine(g.qualified("flag", "Usage") + " = func() {")
+		g.indentLevel++
+		g.writeLine(fmt.Sprintf("%s(%s.Output(), \"%%s\\n\\n\", %s)",
+			g.qualified("fmt", "Fprintf"), g.qualified("flag", "CommandLine"), quoteString(doc)))
+		g.writeLine(g.qualified("flag", "PrintDefaults") + "()")
+		g.indentLevel--
+		g.writeLine("}")
+	}
+
+	var args []string
+	for i, param := range fn.Parameters {
+		if param.Type.IsSlice && i == len(fn.Parameters)-1 {
+			args = append(args, g.qualified("flag", "Args")+"()")
+			continue
+		}
+		value, ok := cliZeroValues[param.Type.Name]
+		if !ok {
+			value = "0"
+		}
+		if param.Default != nil {
+			value = g.generateExpression(param.Default)
+		}
+		name := strings.ReplaceAll(param.Name, "_", "-")
+		g.writeLine(fmt.Sprintf("_%s := %s(%q, %s, \"\")", param.Name, g.qualified("flag", cliFlagFuncs[param.Type.Name]), name, value))
+		args = append(args, "*_"+param.Name)
+	}
+	g.writeLine(g.qualified("flag", "Parse") + "()")
+
+	call := fmt.Sprintf("%s(%s)", g.topLevelName(fn.Name), strings.Join(args, ", "))
+	switch results := fn.ReturnType.ResultTypes(); {
+	case len(results) == 1 && isType(results[0], "error"):
+		g.writeLine(fmt.Sprintf("if err := %s; err != nil {", call))
+		g.indentLevel++
+		g.writeLine(fmt.Sprintf(`%s(%s, "error:", err)`, g.qualified("fmt", "Fprintln"), g.qualified("os", "Stderr")))
+		g.writeLine(g.qualified("os", "Exit") + "(1)")
+		g.indentLevel--
+		g.writeLine("}")
+	case len(results) == 1:
+		g.writeLine(fmt.Sprintf("%s(%s)", g.qualified("os", "Exit"), call))
+	default:
+		g.writeLine(call)
+	}
+
+	g.indentLevel--
+	g.writeLine("}")
+}
+
+// docstring returns the string a function body starts with, if any
+func docstring(body *ast.BlockStmt) string {
+	if body == nil || len(body.Statements) == 0 {
+		return ""
+	}
+	if stmt, ok := body.Statements[0].(*ast.ExpressionStmt); ok {
+		if lit, ok := stmt.Expression.(*ast.Literal); ok && lit.Type == "string" {
+			return strings.TrimSpace(fmt.Sprint(lit.Value))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// Comprehensions are generated as func literals that are called in place.
+// The loops are the ones a for ... in statement generates, and a single loop
+// over a collection preallocates the result for its length.
+
+func (g *Generator) generateComprehensionExpr(c *ast.ComprehensionExpr) string {
+	t := g.exprType(c)
+	typ := g.generateTypeSpec(t)
+	result := fmt.Sprintf("_c%d", g.nextTemp())
+
+	outer := g.output
+	g.output = strings.Builder{}
+	g.indentLevel++
+	g.pushScope()
+	defer g.popScope()
+
+	clauses := c.Clauses
+	initial := typ + "{}"
+	if first := clauses[0]; len(clauses) == 1 && !g.isLoopBuiltin(first.Iterable) && isCollection(g.exprType(first.Iterable)) {
+		iterable := g.evalOnce(first.Iterable)
+		if !isSimple(first.Iterable) {
+			g.declare(iterable, g.exprType(first.Iterable))
+			clauses = []*ast.ComprehensionClause{{
+				RangeVar:   first.RangeVar,
+				ValueVar:   first.ValueVar,
+				Iterable:   &ast.Identifier{Value: iterable},
+				Conditions: first.Conditions,
+			}}
+		}
+		if c.Kind == "list" {
+			initial = fmt.Sprintf("make(%s, 0, len(%s))", typ, iterable)
+		} else {
+			initial = fmt.Sprintf("make(%s, len(%s))", typ, iterable)
+		}
+	}
+	g.writeLine(fmt.Sprintf("%s := %s", result, initial))
+
+	depth := 0
+	for _, clause := range clauses {
+		prologue := g.generateRangeLoop(&ast.ForStmt{
+			IsRange:   true,
+			RangeVar:  clause.RangeVar,
+			ValueVar:  clause.ValueVar,
+			RangeExpr: clause.Iterable,
+		})
+		g.indentLevel++
+		depth++
+		for _, line := range prologue {
+			g.writeLine(line)
+		}
+		if len(clause.Conditions) > 0 {
+			var conditions []string
+			for _, cond := range clause.Conditions {
+				conditions = append(conditions, g.generateExpression(cond))
+			}
+			g.writeLine(fmt.Sprintf("if %s {", strings.Join(conditions, " && ")))
+			g.indentLevel++
+			depth++
+		}
+	}
+
+	value := g.generateExpression(c.Value)
+	switch c.Kind {
+	case "list":
+		g.writeLine(fmt.Sprintf("%s = append(%s, %s)", result, result, value))
+	case "map":
+		g.writeLine(fmt.Sprintf("%s[%s] = %s", result, g.generateExpression(c.Key), value))
+	case "set":
+		g.writeLine(fmt.Sprintf("%s[%s] = struct{}{}", result, value))
+	}
+	for ; depth > 0; depth-- {
+		g.indentLevel--
+		g.writeLine("}")
+	}
+	g.writeLine("return " + result)
+
+	g.indentLevel--
+	body := g.output.String()
+	g.output = outer
+	return fmt.Sprintf("func() %s {\n%s%s}()", typ, body, strings.Repeat("\t", g.indentLevel))
+}
+
+// comprehensionType returns the type of the collection a comprehension
+// builds. Elements of unknown type are interface{}.
+func (g *Generator) comprehensionType(c *ast.ComprehensionExpr) *ast.TypeSpec {
+	g.pushScope()
+	defer g.popScope()
+	for _, clause := range c.Clauses {
+		first, second := g.rangeVarTypes(&ast.ForStmt{
+			IsRange:   true,
+			RangeVar:  clause.RangeVar,
+			ValueVar:  clause.ValueVar,
+			RangeExpr: clause.Iterable,
+		})
+		g.declare(clause.RangeVar, first)
+		if clause.ValueVar != "" {
+			g.declare(clause.ValueVar, second)
+		}
+	}
+
+	elem := func(e ast.Expression) *ast.TypeSpec {
+		if t := g.exprType(e); t != nil {
+			return t
+		}
+		return named("interface{}")
+	}
+	switch c.Kind {
+	case "map":
+		return &ast.TypeSpec{KeyType: elem(c.Key), ValueType: elem(c.Value)}
+	case "set":
+		return &ast.TypeSpec{KeyType: elem(c.Value), ValueType: named("struct{}")}
+	}
+	return &ast.TypeSpec{IsSlice: true, ValueType: elem(c.Value)}
+}
+
+// isLoopBuiltin reports whether expr is a call of range, enumerate or zip,
+// which a for ... in loop inlines
+func (g *Generator) isLoopBuiltin(expr ast.Expression) bool {
+	if c, ok := expr.(*ast.CallExpr); ok {
+		if ident, ok := c.Function.(*ast.Identifier); ok {
+			if _, ok := g.builtinFunc(ident.Value); ok {
+				return ident.Value == "range" || ident.Value == "enumerate" || ident.Value == "zip"
+			}
+		}
+	}
+	return false
+}
+
+// isCollection reports whether len() applies to a value of type t
+func isCollection(t *ast.TypeSpec) bool {
+	return t != nil && !t.IsPointer && (t.IsSlice || t.IsArray || t.KeyType != nil || isType(t, "string"))
+}
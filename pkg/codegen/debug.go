@@ -0,0 +1,76 @@
+package codegen
+
+import (
+	"regexp"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// For debugging, Options.LineDirectives marks the code of every statement
+// with its .gos line, and Names tells a debugger, which shows the names of
+// the generated Go code, the .gos names they stand for.
+
+// markLine makes the lines written until the returned function is called
+// the code of the given .gos line, when Options asks for line directives on
+// every statement. The function restores the line of the enclosing
+// statement, which the rest of its code, such as a closing brace, is
+// marked with. Errors are reported at the line either way.
+func (g *Generator) markLine(line int) func() {
+	outer, outerPos := g.line, g.pos
+	if line > 0 {
+		g.pos = line
+	}
+	if g.options.LineDirectives && g.options.SourceFile != "" && g.options.OutputFile != "" && line > 0 {
+		g.line = line
+	}
+	return func() {
+		g.line, g.pos = outer, outerPos
+	}
+}
+
+// Names are the .gos names that the generated Go code renames
+type Names struct {
+	TopLevel     map[string]string // functions and types to their Go names
+	Members      map[string]string // fields and methods to their Go names
+	Constructors map[string]string // structs with an init method to the Go names of their constructors
+}
+
+// Names returns the names the code generated last renames: exported names
+// are capitalized, the main function of a script is renamed, and the init
+// method of a struct becomes a constructor function
+func (g *Generator) Names() Names {
+	names := Names{
+		TopLevel:     make(map[string]string),
+		Members:      make(map[string]string),
+		Constructors: make(map[string]string),
+	}
+	for name := range g.funcs {
+		if goName := g.topLevelName(name); goName != name {
+			names.TopLevel[name] = goName
+		}
+	}
+	for name, s := range g.structs {
+		if goName := g.topLevelName(name); goName != name {
+			names.TopLevel[name] = goName
+		}
+		if s.Constructor != nil {
+			names.Constructors[name] = constructorName(g.topLevelName(name))
+		}
+	}
+	for _, members := range g.exportedMembers {
+		for name := range members {
+			names.Members[name] = ast.ExportName(name)
+		}
+	}
+	return names
+}
+
+// temporary matches the names the generated code declares for its own use
+var temporary = regexp.MustCompile(`^_(c|done|e|err|i|l|n|r|s|v)[0-9]+(_[0-9]+)?$`)
+
+// IsTemporary reports whether a Go name is one the generated code declares
+// for its own use, such as the error of a call marked with ?, rather than a
+// name of the .gos program
+func IsTemporary(name string) bool {
+	return temporary.MatchString(name)
+}
@@ -0,0 +1,462 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// Error handling is lowered to Go error values:
+//
+//   - The body of a try statement runs in a func literal that returns the
+//     raised error, and recovers panics as errors. A return inside the body
+//     stores the results and makes the literal report that it is done.
+//   - The except clauses test the error with errors.Is for sentinel values
+//     such as io.EOF and errors.As for error types such as *os.PathError.
+//   - raise and ? return the error from the enclosing try body or function,
+//     and panic in functions without an error result.
+//   - finally blocks are generated on every path out of the try statement.
+
+// tryFrame is a try statement enclosing the code being generated
+type tryFrame struct {
+	inBody  bool           // generating the body, inside the func literal
+	hasDone bool           // the func literal returns (done, err)
+	errVar  string         // the error being handled, in except clauses
+	finally *ast.BlockStmt // may be nil
+}
+
+// funcState is the error handling state of the function being generated
+type funcState struct {
+	results []*ast.TypeSpec
+	tries   []*tryFrame
+	retVars []string // hold the results of a return inside a try
+}
+
+func (g *Generator) nextTemp() int {
+	g.temps++
+	return g.temps
+}
+
+// enterFunction starts generating the body of a function with the given
+// result type and returns the state to restore afterwards
+func (g *Generator) enterFunction(result *ast.TypeSpec) funcState {
+	outer := g.fn
+	g.fn = funcState{results: result.ResultTypes()}
+	return outer
+}
+
+// endFunction finishes the body of a function and restores the state of
+// the enclosing one. Go does not see that a try statement at the end of the
+// body always returns, so a function with results gets a final panic.
+func (g *Generator) endFunction(body *ast.BlockStmt, outer funcState) {
+	if len(g.fn.results) > 0 && body != nil && len(body.Statements) > 0 {
+		if _, ok := body.Statements[len(body.Statements)-1].(*ast.TryStmt); ok {
+			g.writeLine(`panic("unreachable")`)
+		}
+	}
+	g.fn = outer
+}
+
+func (g *Generator) hasErrorResult() bool {
+	results := g.fn.results
+	return len(results) > 0 && results[len(results)-1].Name == "error"
+}
+
+func (g *Generator) generateTryStmt(t *ast.TryStmt) {
+	n := g.nextTemp()
+	errVar := fmt.Sprintf("_err%d", n)
+	doneVar := fmt.Sprintf("_done%d", n)
+
+	// Results of a return inside the statement are kept in variables that
+	// outlive the func literal
+	outermost := g.fn.retVars == nil
+	if outermost && containsReturn(t) && len(g.fn.results) > 0 {
+		for i, result := range g.fn.results {
+			name := fmt.Sprintf("_r%d_%d", n, i)
+			g.writeLine(fmt.Sprintf("var %s %s", name, g.generateTypeSpec(result)))
+			g.fn.retVars = append(g.fn.retVars, name)
+		}
+	}
+	if outermost {
+		defer func() { g.fn.retVars = nil }()
+	}
+
+	frame := &tryFrame{inBody: true, hasDone: containsReturn(t.Body), finally: t.Finally}
+	g.fn.tries = append(g.fn.tries, frame)
+
+	if frame.hasDone {
+		g.writeLine(fmt.Sprintf("%s, %s := func() (_done bool, _err error) {", doneVar, errVar))
+	} else {
+		g.writeLine(fmt.Sprintf("%s := func() (_err error) {", errVar))
+	}
+	g.indentLevel++
+	g.writeLine("defer func() {")
+	g.indentLevel++
+	g.writeLine("if r := recover(); r != nil {")
+	g.indentLevel++
+	g.writeLine("if e, ok := r.(error); ok {")
+	g.writeLine("\t_err = e")
+	g.writeLine("} else {")
+	g.writeLine(fmt.Sprintf("\t_err = %s(\"%%v\", r)", g.qualified("fmt", "Errorf")))
+	g.writeLine("}")
+	g.indentLevel--
+	g.writeLine("}")
+	g.indentLevel--
+	g.writeLine("}()")
+	g.generateBlockStmt(t.Body)
+	if !terminates(t.Body) {
+		if frame.hasDone {
+			g.writeLine("return false, nil")
+		} else {
+			g.writeLine("return nil")
+		}
+	}
+	g.indentLevel--
+	g.writeLine("}()")
+
+	// The except clauses run outside the func literal
+	frame.inBody = false
+	frame.errVar = errVar
+
+	if frame.hasDone {
+		g.writeLine(fmt.Sprintf("if %s {", doneVar))
+		g.indentLevel++
+		g.finishReturn()
+		g.indentLevel--
+		g.writeLine("}")
+	}
+
+	g.writeLine(fmt.Sprintf("if %s != nil {", errVar))
+	g.indentLevel++
+	g.generateHandlers(t.Handlers, errVar)
+	g.indentLevel--
+	g.writeLine("}")
+
+	g.fn.tries = g.fn.tries[:len(g.fn.tries)-1]
+	if t.Finally != nil {
+		g.generateBlockStmt(t.Finally)
+	}
+}
+
+// generateHandlers generates the except clauses as an if/else chain. An
+// error that no clause handles is raised again.
+func (g *Generator) generateHandlers(handlers []*ast.ExceptClause, errVar string) {
+	if len(handlers) == 0 {
+		g.raise(errVar)
+		return
+	}
+
+	for i, h := range handlers {
+		keyword := "if"
+		if i > 0 {
+			keyword = "} else if"
+		}
+
+		switch {
+		case h.Type == nil || h.Type.Name == "error":
+			// Catches every error
+			if i > 0 {
+				g.writeLine("} else {")
+				g.indentLevel++
+			}
+			if h.Name != "" {
+				g.writeLine(fmt.Sprintf("%s := %s", h.Name, errVar))
+				g.writeLine("_ = " + h.Name)
+			}
+			g.generateHandlerBody(h, named("error"))
+			if i > 0 {
+				g.indentLevel--
+				g.writeLine("}")
+			}
+			return
+		case g.isErrorType(h.Type):
+			name := h.Name
+			if name == "" {
+				name = fmt.Sprintf("_e%d", g.nextTemp())
+			}
+			g.writeLine(fmt.Sprintf("%s %s := *new(%s); %s(%s, &%s) {",
+				keyword, name, g.generateTypeSpec(h.Type), g.qualified("errors", "As"), errVar, name))
+			g.indentLevel++
+			g.generateHandlerBody(h, h.Type)
+		default:
+			g.writeLine(fmt.Sprintf("%s %s(%s, %s) {", keyword, g.qualified("errors", "Is"), errVar, g.generateTypeSpec(h.Type)))
+			g.indentLevel++
+			if h.Name != "" {
+				g.writeLine(fmt.Sprintf("%s := %s", h.Name, errVar))
+				g.writeLine("_ = " + h.Name)
+			}
+			g.generateHandlerBody(h, named("error"))
+		}
+		g.indentLevel--
+	}
+
+	g.writeLine("} else {")
+	g.indentLevel++
+	g.raise(errVar)
+	g.indentLevel--
+	g.writeLine("}")
+}
+
+// generateHandlerBody generates the body of an except clause whose error
+// variable, if any, has type t
+func (g *Generator) generateHandlerBody(h *ast.ExceptClause, t *ast.TypeSpec) {
+	g.pushScope()
+	if h.Name != "" {
+		g.declare(h.Name, t)
+	}
+	g.generateBlockStmt(h.Body)
+	g.popScope()
+}
+
+// isErrorType reports whether an except clause names an error type, matched
+// with errors.As, rather than a sentinel error value matched with errors.Is.
+// Pointers, structs of this program and names ending in Error are types.
+func (g *Generator) isErrorType(t *ast.TypeSpec) bool {
+	if t.IsPointer {
+		return true
+	}
+	if _, ok := g.structs[t.Name]; ok {
+		return true
+	}
+	name := t.Name[strings.LastIndex(t.Name, ".")+1:]
+	return strings.HasSuffix(name, "Error")
+}
+
+func (g *Generator) generateRaiseStmt(r *ast.RaiseStmt) {
+	if r.Value == nil {
+		// Re-raise the error handled by the enclosing except clause
+		for i := len(g.fn.tries) - 1; i >= 0; i-- {
+			if errVar := g.fn.tries[i].errVar; errVar != "" {
+				g.raise(errVar)
+				return
+			}
+		}
+		return
+	}
+
+	g.hoistPropagations(r.Value)
+	value := g.generateExpression(r.Value)
+	if lit, ok := r.Value.(*ast.Literal); ok && lit.Type == "string" {
+		value = fmt.Sprintf("%s(%s)", g.qualified("errors", "New"), value)
+	}
+
+	// The error is evaluated before any finally block runs
+	if g.finallyPending() {
+		temp := fmt.Sprintf("_e%d", g.nextTemp())
+		g.writeLine(fmt.Sprintf("%s := %s", temp, value))
+		value = temp
+	}
+	g.raise(value)
+}
+
+// finallyPending reports whether leaving the current position runs a
+// finally block before reaching the innermost try body or the function
+func (g *Generator) finallyPending() bool {
+	for i := len(g.fn.tries) - 1; i >= 0; i-- {
+		frame := g.fn.tries[i]
+		if frame.inBody {
+			return false
+		}
+		if frame.finally != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// raise sends err to the innermost try body, running the finally blocks of
+// the except clauses it leaves, or out of the function
+func (g *Generator) raise(err string) {
+	for i := len(g.fn.tries) - 1; i >= 0; i-- {
+		frame := g.fn.tries[i]
+		if frame.inBody {
+			if frame.hasDone {
+				g.writeLine(fmt.Sprintf("return false, %s", err))
+			} else {
+				g.writeLine(fmt.Sprintf("return %s", err))
+			}
+			return
+		}
+		g.generateFinally(i)
+	}
+
+	if !g.hasErrorResult() {
+		g.writeLine(fmt.Sprintf("panic(%s)", err))
+		return
+	}
+	var values []string
+	for _, result := range g.fn.results[:len(g.fn.results)-1] {
+		values = append(values, g.zeroValue(result))
+	}
+	values = append(values, err)
+	g.writeLine("return " + strings.Join(values, ", "))
+}
+
+// generateFinally generates the finally block of the try statement at index
+// i, as seen from outside that statement
+func (g *Generator) generateFinally(i int) {
+	frame := g.fn.tries[i]
+	if frame.finally == nil {
+		return
+	}
+	tries := g.fn.tries
+	g.fn.tries = tries[:i]
+	g.generateBlockStmt(frame.finally)
+	g.fn.tries = tries
+}
+
+// generateReturn generates a return statement inside a try statement: the
+// results are stored, then the finally blocks run on the way out
+func (g *Generator) generateReturnInTry(r *ast.ReturnStmt) {
+	if r.Value != nil && len(g.fn.retVars) > 0 {
+		g.writeLine(fmt.Sprintf("%s = %s", strings.Join(g.fn.retVars, ", "), g.generateResult(r.Value)))
+	}
+	g.finishReturn()
+}
+
+// finishReturn continues a return whose results are stored in retVars
+func (g *Generator) finishReturn() {
+	for i := len(g.fn.tries) - 1; i >= 0; i-- {
+		frame := g.fn.tries[i]
+		if frame.inBody {
+			g.writeLine("return true, nil")
+			return
+		}
+		g.generateFinally(i)
+	}
+	if len(g.fn.retVars) == 0 {
+		g.writeLine("return")
+		return
+	}
+	g.writeLine("return " + strings.Join(g.fn.retVars, ", "))
+}
+
+// zeroValue returns the Go zero value of a type
+func (g *Generator) zeroValue(t *ast.TypeSpec) string {
+	if t.IsPointer || t.IsSlice || t.IsFunc || t.KeyType != nil {
+		return "nil"
+	}
+	switch t.Name {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+		"uintptr", "float32", "float64", "complex64", "complex128", "byte", "rune":
+		return "0"
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	case "error", "any", "interface{}":
+		return "nil"
+	}
+	return fmt.Sprintf("*new(%s)", g.generateTypeSpec(t))
+}
+
+// terminates reports whether a block ends in a statement that leaves it
+func terminates(b *ast.BlockStmt) bool {
+	if len(b.Statements) == 0 {
+		return false
+	}
+	switch s := b.Statements[len(b.Statements)-1].(type) {
+	case *ast.ReturnStmt, *ast.RaiseStmt:
+		return true
+	case *ast.ExpressionStmt:
+		call, ok := s.Expression.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		return ok && ident.Value == "panic"
+	}
+	return false
+}
+
+// containsReturn reports whether a return statement appears in node,
+// outside any nested func literal
+func containsReturn(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.ReturnStmt:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// hoistPropagations generates the calls marked with ? in node as separate
+// statements that check the error, so the expression can use their
+// results. Calls are generated in evaluation order, inner calls first.
+func (g *Generator) hoistPropagations(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.FunctionLiteral, *ast.LambdaExpr, *ast.ComprehensionExpr:
+			return false
+		case *ast.PropagateExpr:
+			g.hoistPropagations(e.Call)
+			g.hoistPropagation(e, 1)
+			return false
+		}
+		return true
+	})
+}
+
+// hoistAssignment hoists the calls marked with ? in an assignment. In
+// a, b = f()? the call returns one value for each target.
+func (g *Generator) hoistAssignment(a *ast.AssignStmt) {
+	tuple, ok := a.Target.(*ast.TupleExpr)
+	p, isCall := a.Value.(*ast.PropagateExpr)
+	if !ok || !isCall {
+		g.hoistPropagations(a.Value)
+		return
+	}
+	g.hoistPropagations(p.Call)
+	g.hoistPropagation(p, len(tuple.Elements))
+}
+
+// propagatedValues returns the number of results the call of f()? on its
+// own returns before its error: from the declaration of a function or
+// method of the program, or as the checker found for a Go function
+func (g *Generator) propagatedValues(p *ast.PropagateExpr) int {
+	if results := g.resultTypes(p); len(results) > 0 {
+		return len(results)
+	}
+	return p.Values
+}
+
+// hoistPropagation generates one call marked with ?, which returns values
+// results before its error
+func (g *Generator) hoistPropagation(p *ast.PropagateExpr, values int) {
+	n := g.nextTemp()
+	var names []string
+	for i := 0; i < values; i++ {
+		names = append(names, fmt.Sprintf("_v%d_%d", n, i))
+	}
+	g.generatePropagation(p, n, names)
+	g.hoisted[p] = strings.Join(names, ", ")
+}
+
+// discardPropagation generates f()? on its own, whose call returns values
+// results before its error; they go to _
+func (g *Generator) discardPropagation(p *ast.PropagateExpr, values int) {
+	names := make([]string, values)
+	for i := range names {
+		names[i] = "_"
+	}
+	g.generatePropagation(p, g.nextTemp(), names)
+}
+
+// generatePropagation generates the call of p, assigning its results to
+// names and its error to the error variable numbered n, which is raised
+func (g *Generator) generatePropagation(p *ast.PropagateExpr, n int, names []string) {
+	errVar := fmt.Sprintf("_err%d", n)
+	call := g.generateExpression(p.Call)
+	g.writeLine(fmt.Sprintf("%s := %s", strings.Join(append(names, errVar), ", "), call))
+	g.writeLine(fmt.Sprintf("if %s != nil {", errVar))
+	g.indentLevel++
+	g.raise(errVar)
+	g.indentLevel--
+	g.writeLine("}")
+}
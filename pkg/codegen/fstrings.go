@@ -0,0 +1,196 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// Strings are generated from their decoded text, so any character survives
+// the trip to Go. F-strings become fmt.Sprintf calls: each format spec is
+// translated to a fmt verb where fmt can express it, and otherwise to a call
+// of the runtime's Pad and Group.
+
+// quoteString returns a Go literal for s: a raw string for text that spans
+// lines, where that keeps it readable, and an interpreted string otherwise
+func quoteString(s string) string {
+	if !strings.Contains(s, "\n") {
+		return strconv.Quote(s)
+	}
+	// Each line on its own, as joining them can make a valid character of
+	// the bytes either side of a newline
+	for _, line := range strings.Split(s, "\n") {
+		if !strconv.CanBackquote(line) {
+			return strconv.Quote(s)
+		}
+	}
+	return "`" + s + "`"
+}
+
+func (g *Generator) generateFStringExpr(f *ast.FStringExpr) string {
+	var format, text strings.Builder
+	var args []string
+	for _, part := range f.Parts {
+		if part.Value == nil {
+			format.WriteString(strings.ReplaceAll(part.Text, "%", "%%"))
+			text.WriteString(part.Text)
+			continue
+		}
+		verb, arg := g.formatField(f, part)
+		format.WriteString(verb)
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return quoteString(text.String())
+	}
+	return fmt.Sprintf("%s(%s, %s)", g.qualified("fmt", "Sprintf"), quoteString(format.String()), strings.Join(args, ", "))
+}
+
+// formatField returns the fmt verb and the argument for a replacement field
+// of f, and reports a spec type that the type of the value cannot take
+func (g *Generator) formatField(f *ast.FStringExpr, part *ast.FStringPart) (string, string) {
+	value := g.generateExpression(part.Value)
+	t := g.exprType(part.Value)
+
+	// !r and !s format the value first, and the spec applies to the string
+	if part.Conversion != "" {
+		conversion := "%#v"
+		if part.Conversion == "s" {
+			conversion = "%v"
+		}
+		if part.Spec == nil {
+			return conversion, value
+		}
+		value, t = fmt.Sprintf("%s(%q, %s)", g.qualified("fmt", "Sprintf"), conversion, value), named("string")
+	}
+
+	spec := part.Spec
+	if spec == nil {
+		spec = &ast.FormatSpec{Width: -1, Precision: -1}
+	}
+
+	if kind := formatKind(t); kind != "" && spec.Type != 0 && !strings.ContainsRune(ast.FormatCodes[kind], rune(spec.Type)) {
+		what := "the " + t.String() + " " + part.Value.String()
+		if part.Conversion != "" {
+			what = "the string that !" + part.Conversion + " makes of " + part.Value.String()
+		}
+		g.errorf("format code '%c' is not valid for %s in %s", spec.Type, what, f.String())
+	}
+
+	verb, precision, suffix := spec.Type, spec.Precision, ""
+	switch verb {
+	case 0:
+		switch {
+		case precision < 0:
+			verb = 'v'
+		case isType(t, "string"):
+			verb = 's'
+		default:
+			verb = 'g'
+		}
+	case 'n':
+		verb = 'd'
+		if isType(t, "float64") || isType(t, "float32") {
+			verb = 'g'
+		}
+	case 'g', 'G':
+		if precision < 0 {
+			precision = 6
+		}
+	case '%':
+		verb, suffix = 'f', "%%"
+		value = g.floatArg(value, t) + " * 100"
+	}
+	if strings.ContainsRune("eEfFgG", rune(verb)) && suffix == "" {
+		value = g.floatArg(value, t)
+	}
+
+	flags := ""
+	if spec.Sign == '+' || spec.Sign == ' ' {
+		flags += string(spec.Sign)
+	}
+	if spec.Alternate {
+		flags += "#"
+	}
+	if precision >= 0 {
+		suffix = fmt.Sprintf(".%d%c", precision, verb) + suffix
+	} else {
+		suffix = string(verb) + suffix
+	}
+
+	// Strings are left aligned unless the spec says otherwise, and the 0
+	// flag pads numbers after the sign
+	left := verb == 's' || verb == 'v' && isType(t, "string")
+	fill, align := spec.Fill, spec.Align
+	if spec.Zero && fill == 0 {
+		fill = '0'
+		if align == 0 && !left {
+			align = '='
+		}
+	}
+	if fill == 0 {
+		fill = ' '
+	}
+	if align == 0 {
+		align = '>'
+		if left {
+			align = '<'
+		}
+	}
+
+	if spec.Grouping == 0 && (fill == ' ' && (align == '<' || align == '>') || fill == '0' && align == '=') {
+		width := ""
+		if spec.Width >= 0 {
+			width = strconv.Itoa(spec.Width)
+			if align == '<' {
+				flags += "-"
+			} else if fill == '0' {
+				flags += "0"
+			}
+		}
+		return "%" + flags + width + suffix, value
+	}
+
+	formatted := fmt.Sprintf("%s(%q, %s)", g.qualified("fmt", "Sprintf"), "%"+flags+suffix, value)
+	if spec.Grouping != 0 {
+		size := 3
+		if strings.ContainsRune("bxXo", rune(verb)) {
+			size = 4
+		}
+		formatted = fmt.Sprintf("%s(%s, '%c', %d)", g.rt("Group"), formatted, spec.Grouping, size)
+	}
+	if spec.Width >= 0 {
+		formatted = fmt.Sprintf("%s(%s, %d, '%c', %s)", g.rt("Pad"), formatted, spec.Width, align, strconv.QuoteRune(fill))
+	}
+	return "%s", formatted
+}
+
+// formatKind returns the kind of value in ast.FormatCodes that a value of
+// type t is, or "" if the type is not known to be one
+func formatKind(t *ast.TypeSpec) string {
+	switch {
+	case isType(t, "string"):
+		return "string"
+	case isType(t, "bool"):
+		return "bool"
+	case isType(t, "float64") || isType(t, "float32"):
+		return "float"
+	case isNumeric(t):
+		return "int"
+	}
+	return ""
+}
+
+// floatArg converts the argument of a floating point verb, since fmt does
+// not format an int with %f
+func (g *Generator) floatArg(value string, t *ast.TypeSpec) string {
+	switch {
+	case isType(t, "float64") || isType(t, "float32"):
+		return value
+	case isNumeric(t):
+		return "float64(" + value + ")"
+	}
+	return g.rt("Float") + "(" + value + ")"
+}
@@ -2,15 +2,80 @@ package codegen
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/GrandpaEJ/go-script/pkg/ast"
 )
 
+// Options configures code generation
+type Options struct {
+	// AutoExport exports every struct, field, method and top-level function
+	// as if it had been declared with pub
+	AutoExport bool
+
+	// SourceFile and OutputFile are the names of the .gos file and of the
+	// generated Go file. When both are set, the code of a failed assert is
+	// marked with line directives, so Go reports the line of the assert in
+	// the .gos file.
+	SourceFile string
+	OutputFile string
+
+	// LineDirectives marks the Go code of every statement with a line
+	// directive giving its line in SourceFile, so debuggers and stack
+	// traces show the .gos lines. It needs SourceFile and OutputFile.
+	LineDirectives bool
+
+	// RuntimePath is the import path of the runtime package, when the
+	// generated code imports a copy of it rather than RuntimePath
+	RuntimePath string
+}
+
 // Generator represents the code generator
 type Generator struct {
 	output      strings.Builder
 	indentLevel int
+	options     Options
+	structs     map[string]*ast.StructDecl   // top-level structs by name
+	funcs       map[string]*ast.FunctionDecl // top-level functions by name
+	scopes      []map[string]*ast.TypeSpec   // variable types, see types.go
+
+	// Export model: .gos names that are capitalized in the generated Go
+	exported        map[string]bool            // top-level functions and types
+	exportedMembers map[string]map[string]bool // struct fields and methods by struct
+
+	// Imports, see imports.go
+	packages    map[string]string   // imported Go package names to their paths
+	gosPackages map[string]string   // imported .gos package names to their paths
+	aliases     map[string]bool     // package names given by the program's imports
+	fromImports map[string]string   // names imported with from ... import to their paths
+	declared    map[string]bool     // names the program declares
+	imports     map[string]goImport // the imports of the generated code by path
+
+	// Error handling, see errors.go
+	fn      funcState
+	temps   int                           // counter for generated names
+	hoisted map[*ast.PropagateExpr]string // results of calls marked with ?
+
+	// Script mode, see script.go
+	name   string            // the value of __name__
+	script []ast.Statement   // top-level statements that run at startup
+	cli    *ast.FunctionDecl // the @cli function, see cli.go
+
+	// Tests, see tests.go
+	testing    bool   // generating a test file
+	test       string // the parameter of the test being generated
+	directives bool   // whether line directives were written
+
+	// Debugging: the .gos line of the code being written, see markLine
+	line   int
+	marked bool // whether the last line written was marked with a line
+
+	// Errors the types of values show, see Errors
+	errors []string
+	pos    int // the .gos line of the statement being generated
 }
 
 // New creates a new code generator
@@ -18,75 +83,219 @@ func New() *Generator {
 	return &Generator{}
 }
 
+// NewWithOptions creates a new code generator with the given options
+func NewWithOptions(options Options) *Generator {
+	return &Generator{options: options}
+}
+
+// Errors returns the errors found while generating code last, which the
+// checker cannot see since they depend on the types of values, such as a
+// format spec that a variable's type cannot take. They are reported like
+// the checker's, as line 3: message.
+func (g *Generator) Errors() []string {
+	return g.errors
+}
+
+// errorf records an error about the statement being generated, once even
+// if the code of the statement is generated more than once
+func (g *Generator) errorf(format string, args ...interface{}) {
+	if g.pos > 0 {
+		format = fmt.Sprintf("line %d: %s", g.pos, format)
+	}
+	msg := fmt.Sprintf(format, args...)
+	for _, err := range g.errors {
+		if err == msg {
+			return
+		}
+	}
+	g.errors = append(g.errors, msg)
+}
+
 // Generate generates Go code from the AST
 func (g *Generator) Generate(program *ast.Program) string {
+	g.collect(program)
+	g.script = program.Script()
+	g.cli = findCLI(program)
+	return g.generateFile(program.Package, program.Doc, program.Statements)
+}
+
+// collect resets the generator and records what the code generated for the
+// program needs to know about all of it: its structs and functions, the
+// exported names and the imports
+func (g *Generator) collect(program *ast.Program) {
 	g.output.Reset()
 	g.indentLevel = 0
-
-	// Generate package declaration
-	g.writeLine(fmt.Sprintf("package %s", program.Package))
-	g.writeLine("")
-
-	// Generate imports
-	if len(program.Imports) > 0 {
-		g.writeLine("import (")
-		g.indentLevel++
-		for _, imp := range program.Imports {
-			g.generateImport(imp)
+	g.fn = funcState{}
+	g.temps = 0
+	g.hoisted = make(map[*ast.PropagateExpr]string)
+	g.structs = make(map[string]*ast.StructDecl)
+	g.funcs = make(map[string]*ast.FunctionDecl)
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.StructDecl:
+			g.structs[s.Name] = s
+		case *ast.FunctionDecl:
+			g.funcs[s.Name] = s
 		}
-		g.indentLevel--
-		g.writeLine(")")
-		g.writeLine("")
 	}
+	g.scopes = nil
+	g.pushScope()
+	g.collectExports(program)
+	g.collectImports(program)
+	g.name = program.ModuleName()
+	g.testing = false
+	g.test = ""
+	g.directives = false
+	g.line = 0
+	g.marked = false
+	g.errors = nil
+	g.pos = 0
+}
 
-	// Generate statements
-	for i, stmt := range program.Statements {
+// generateFile generates the Go file of package pkg with the declarations
+// among statements, then the statements that run at startup. The package
+// clause has doc for its doc comment.
+func (g *Generator) generateFile(pkg, doc string, statements []ast.Statement) string {
+	var decls []ast.Statement
+	for _, stmt := range statements {
+		if ast.IsDeclaration(stmt) {
+			decls = append(decls, stmt)
+		}
+	}
+	for i, stmt := range decls {
 		g.generateStatement(stmt)
 		// Add blank line between top-level statements, but not after the last one
-		if i < len(program.Statements)-1 {
+		if i < len(decls)-1 {
 			g.writeLine("")
 		}
 	}
+	if len(g.script) > 0 || g.cli != nil {
+		if len(decls) > 0 {
+			g.writeLine("")
+		}
+		if g.cli != nil {
+			g.generateCLIMain(g.cli)
+		} else {
+			g.generateScript()
+		}
+	}
 
-	return g.output.String()
+	// The imports are known once the code is generated
+	var file strings.Builder
+	if doc != "" {
+		for _, text := range strings.Split(doc, "\n") {
+			file.WriteString(strings.TrimRight("// "+text, " ") + "\n")
+		}
+	}
+	file.WriteString(fmt.Sprintf("package %s\n\n", pkg))
+	g.writeImports(&file)
+	file.WriteString(g.output.String())
+	if g.directives {
+		return g.resolveLineDirectives(file.String())
+	}
+	return file.String()
 }
 
-func (g *Generator) generateImport(imp *ast.ImportDecl) {
-	if len(imp.Items) > 0 {
-		if imp.Path != "" {
-			// Handle "from X import Y, Z" style imports
-			for _, item := range imp.Items {
-				g.writeLine(fmt.Sprintf(`%s "%s"`, item, imp.Path))
+// collectExports records which names are exported, either explicitly with
+// pub or through Options.AutoExport, so declarations and every reference to
+// them are capitalized consistently
+func (g *Generator) collectExports(program *ast.Program) {
+	g.exported = make(map[string]bool)
+	g.exportedMembers = make(map[string]map[string]bool)
+
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionDecl:
+			if s.Name != "main" && s.Name != "init" && (s.Public || g.options.AutoExport) {
+				g.exported[s.Name] = true
 			}
-		} else {
-			// Handle import ("os", "fmt", "time") style
-			for _, item := range imp.Items {
-				// Remove quotes if already present
-				cleanItem := strings.Trim(item, `"`)
-				g.writeLine(fmt.Sprintf(`"%s"`, cleanItem))
+		case *ast.StructDecl:
+			if s.Public || g.options.AutoExport {
+				g.exported[s.Name] = true
+			}
+			members := make(map[string]bool)
+			for _, field := range s.Fields {
+				if !field.Embedded && (field.Public || g.options.AutoExport) {
+					members[field.Name] = true
+				}
 			}
+			for _, method := range s.Methods {
+				if method.Public || g.options.AutoExport {
+					members[method.Name] = true
+				}
+			}
+			g.exportedMembers[s.Name] = members
 		}
-	} else if imp.Alias != "" {
-		g.writeLine(fmt.Sprintf(`%s "%s"`, imp.Alias, imp.Path))
-	} else {
-		// Handle both quoted and unquoted imports
-		path := imp.Path
-		if !strings.HasPrefix(path, `"`) && !strings.HasSuffix(path, `"`) {
-			// Add quotes if not present
-			path = fmt.Sprintf(`"%s"`, path)
+	}
+}
+
+// topLevelName returns the Go name of a top-level function or type
+func (g *Generator) topLevelName(name string) string {
+	if name == "main" && g.generatesMain() {
+		return scriptMainName
+	}
+	if g.exported[name] {
+		return ast.ExportName(name)
+	}
+	return name
+}
+
+// memberName returns the Go name of a field or method of a struct
+func (g *Generator) memberName(structName, name string) string {
+	if g.exportedMembers[structName][name] {
+		return ast.ExportName(name)
+	}
+	return name
+}
+
+// selectorName returns the Go name of the field or method called name of a
+// value of type t, in the struct that declares it, looking through embedded
+// structs as Go promotes their members. When the type is not known to be a
+// struct that has the member, the name is exported if a struct exports a
+// member so called.
+func (g *Generator) selectorName(t *ast.TypeSpec, name string) string {
+	for _, s := range g.embeddedStructs(t) {
+		if declaresMember(s, name) {
+			return g.memberName(s.Name, name)
+		}
+	}
+	for _, members := range g.exportedMembers {
+		if members[name] {
+			return ast.ExportName(name)
+		}
+	}
+	return name
+}
+
+// declaresMember reports whether a struct declares a field or method
+func declaresMember(s *ast.StructDecl, name string) bool {
+	for _, field := range s.Fields {
+		if field.Name == name && !field.Embedded {
+			return true
+		}
+	}
+	for _, method := range s.Methods {
+		if method.Name == name {
+			return true
 		}
-		g.writeLine(path)
 	}
+	return false
 }
 
 func (g *Generator) generateStatement(stmt ast.Statement) {
+	defer g.markLine(ast.Line(stmt))()
 	switch s := stmt.(type) {
 	case *ast.FunctionDecl:
 		g.generateFunctionDecl(s)
 	case *ast.StructDecl:
 		g.generateStructDecl(s)
 	case *ast.VarDecl:
+		g.hoistPropagations(s.Value)
 		g.generateVarDecl(s)
+	case *ast.AssignStmt:
+		g.hoistAssignment(s)
+		g.writeLine(g.generateAssignStmt(s))
+		g.declareAssignment(s)
 	case *ast.IfStmt:
 		g.generateIfStmt(s)
 	case *ast.ForStmt:
@@ -96,13 +305,23 @@ func (g *Generator) generateStatement(stmt ast.Statement) {
 	case *ast.ReturnStmt:
 		g.generateReturnStmt(s)
 	case *ast.ExpressionStmt:
-		g.generateExpressionStmt(s)
+		g.atLine(s.Line, func() {
+			g.generateExpressionStmt(s)
+		})
 	case *ast.BlockStmt:
 		g.generateBlockStmt(s)
+	case *ast.TryStmt:
+		g.generateTryStmt(s)
+	case *ast.RaiseStmt:
+		g.generateRaiseStmt(s)
+	case *ast.AssertStmt:
+		g.generateAssertStmt(s)
 	}
 }
 
 func (g *Generator) generateFunctionDecl(fn *ast.FunctionDecl) {
+	// Methods are not generated as statements
+	defer g.markLine(fn.Line)()
 	// Generate function signature
 	signature := "func "
 
@@ -111,11 +330,21 @@ func (g *Generator) generateFunctionDecl(fn *ast.FunctionDecl) {
 		signature += fmt.Sprintf("(%s) ", g.generateParameter(fn.Receiver))
 	}
 
-	signature += fn.Name + "("
+	if fn.Receiver != nil {
+		signature += g.memberName(fn.Receiver.Type.Name, fn.Name) + "("
+	} else {
+		signature += g.topLevelName(fn.Name) + g.generateTypeParams(fn.TypeParams) + "("
+	}
 
 	// Add parameters
+	test := g.testing && fn.IsTest()
 	var params []string
 	for _, param := range fn.Parameters {
+		if test {
+			// The parameter of a test is the *testing.T it runs with
+			params = append(params, param.Name+" *"+g.qualified("testing", "T"))
+			continue
+		}
 		params = append(params, g.generateParameter(param))
 	}
 	signature += strings.Join(params, ", ")
@@ -126,24 +355,47 @@ func (g *Generator) generateFunctionDecl(fn *ast.FunctionDecl) {
 		signature += " " + g.generateTypeSpec(fn.ReturnType)
 	}
 
+	if fn.Receiver != nil {
+		g.writeDoc(fn.Doc, fn.Name, g.memberName(fn.Receiver.Type.Name, fn.Name))
+	} else {
+		g.writeDoc(fn.Doc, fn.Name, g.topLevelName(fn.Name))
+	}
 	g.writeLine(signature + " {")
 	g.indentLevel++
+	outer := g.enterFunction(fn.ReturnType)
+	if test && len(fn.Parameters) > 0 {
+		g.test = fn.Parameters[0].Name
+	}
+	g.pushScope()
+	if fn.Receiver != nil {
+		g.declare(fn.Receiver.Name, fn.Receiver.Type)
+	}
+	g.declareParams(fn.Parameters)
 	g.generateBlockStmt(fn.Body)
+	g.popScope()
+	g.test = ""
+	g.endFunction(fn.Body, outer)
 	g.indentLevel--
 	g.writeLine("}")
 }
 
 func (g *Generator) generateStructDecl(s *ast.StructDecl) {
-	g.writeLine(fmt.Sprintf("type %s struct {", s.Name))
+	g.writeDoc(s.Doc, s.Name, g.topLevelName(s.Name))
+	g.writeLine(fmt.Sprintf("type %s%s struct {", g.topLevelName(s.Name), g.generateTypeParams(s.TypeParams)))
 	g.indentLevel++
 
 	for _, field := range s.Fields {
-		g.generateField(field)
+		g.generateField(s, field)
 	}
 
 	g.indentLevel--
 	g.writeLine("}")
 
+	if s.Constructor != nil {
+		g.writeLine("")
+		g.generateConstructor(s)
+	}
+
 	// Generate methods separately
 	for _, method := range s.Methods {
 		g.writeLine("")
@@ -151,23 +403,92 @@ func (g *Generator) generateStructDecl(s *ast.StructDecl) {
 	}
 }
 
-func (g *Generator) generateField(field *ast.Field) {
-	line := field.Name
-	if field.Type != nil {
-		line += " " + g.generateTypeSpec(field.Type)
+// generateConstructor turns "func init(self, ...)" into a NewName function
+// that allocates the struct, runs the body against it and returns it
+func (g *Generator) generateConstructor(s *ast.StructDecl) {
+	defer g.markLine(s.Constructor.Line)()
+	var params []string
+	for _, param := range s.Constructor.Parameters {
+		params = append(params, g.generateParameter(param))
+	}
+
+	name := g.topLevelName(s.Name)
+	typeName := name
+	var typeArgs []*ast.TypeSpec
+	if len(s.TypeParams) > 0 {
+		// Generic constructors take the struct's type parameters:
+		// func NewStack[T any]() *Stack[T]
+		var args []string
+		for _, param := range s.TypeParams {
+			args = append(args, param.Name)
+			typeArgs = append(typeArgs, named(param.Name))
+		}
+		typeName += "[" + strings.Join(args, ", ") + "]"
+	}
+	g.writeDoc(s.Constructor.Doc, "init", constructorName(name))
+	g.writeLine(fmt.Sprintf("func %s%s(%s) *%s {", constructorName(name), g.generateTypeParams(s.TypeParams),
+		strings.Join(params, ", "), typeName))
+	g.indentLevel++
+	g.writeLine(fmt.Sprintf("self := &%s{}", typeName))
+	outer := g.enterFunction(nil)
+	g.pushScope()
+	g.declare("self", &ast.TypeSpec{Name: s.Name, IsPointer: true, TypeArgs: typeArgs})
+	g.declareParams(s.Constructor.Parameters)
+	g.generateBlockStmt(s.Constructor.Body)
+	g.popScope()
+	g.fn = outer
+	g.writeLine("return self")
+	g.indentLevel--
+	g.writeLine("}")
+}
+
+// constructorName returns the Go constructor name for a struct: NewPerson
+// for exported structs and newPerson for unexported ones
+func constructorName(structName string) string {
+	if ast.ExportName(structName) == structName {
+		return "New" + structName
+	}
+	return "new" + ast.ExportName(structName)
+}
+
+func (g *Generator) generateField(s *ast.StructDecl, field *ast.Field) {
+	var line string
+	tag := field.Tag
+	if field.Embedded {
+		g.writeDoc(field.Doc, "", "")
+		line = g.generateTypeSpec(field.Type)
+	} else {
+		name := g.memberName(s.Name, field.Name)
+		line = name
+		if field.Type != nil {
+			line += " " + g.generateTypeSpec(field.Type)
+		}
+		// Keep the .gos spelling as the encoded name of capitalized fields
+		if tag == "" && name != field.Name {
+			tag = fmt.Sprintf(`json:"%s"`, field.Name)
+		}
+		g.writeDoc(field.Doc, field.Name, name)
 	}
-	if field.Tag != "" {
-		line += " `" + field.Tag + "`"
+	if tag != "" && strconv.CanBackquote(tag) {
+		line += " `" + tag + "`"
+	} else if tag != "" {
+		line += " " + strconv.Quote(tag)
 	}
 	g.writeLine(line)
 }
 
 func (g *Generator) generateVarDecl(v *ast.VarDecl) {
+	if v.Type != nil {
+		defer g.declare(v.Name, v.Type)
+	} else if v.IsWalrus {
+		defer g.declare(v.Name, g.exprType(v.Value))
+	}
 	if v.Type != nil {
 		// var name type = value
+		g.writeDoc(v.Doc, v.Name, v.Name)
 		line := fmt.Sprintf("var %s %s", v.Name, g.generateTypeSpec(v.Type))
 		if v.Value != nil {
-			line += " = " + g.generateExpression(v.Value)
+			line += " = " + g.generateValue(v.Value, v.Type)
 		}
 		g.writeLine(line)
 	} else if v.IsWalrus {
@@ -179,7 +500,38 @@ func (g *Generator) generateVarDecl(v *ast.VarDecl) {
 	}
 }
 
+func (g *Generator) generateAssignStmt(a *ast.AssignStmt) string {
+	if a.Value == nil {
+		return fmt.Sprintf("%s%s", g.generateExpression(a.Target), a.Operator)
+	}
+	target := g.generateExpression(a.Target)
+	if a.Operator == ":=" {
+		return fmt.Sprintf("%s := %s", g.generateDeclared(a.Target), g.generateExpression(a.Value))
+	}
+	if a.Operator == "=" {
+		return fmt.Sprintf("%s = %s", target, g.generateValue(a.Value, g.exprType(a.Target)))
+	}
+	return fmt.Sprintf("%s %s %s", target, a.Operator, g.generateExpression(a.Value))
+}
+
+// generateDeclared generates the variables a := declares, which keep their
+// names like those of var, even next to a pub func of the same name
+func (g *Generator) generateDeclared(target ast.Expression) string {
+	switch t := target.(type) {
+	case *ast.Identifier:
+		return t.Value
+	case *ast.TupleExpr:
+		var names []string
+		for _, elem := range t.Elements {
+			names = append(names, g.generateDeclared(elem))
+		}
+		return strings.Join(names, ", ")
+	}
+	return g.generateExpression(target)
+}
+
 func (g *Generator) generateIfStmt(i *ast.IfStmt) {
+	g.hoistPropagations(i.Condition)
 	g.writeLine(fmt.Sprintf("if %s {", g.generateExpression(i.Condition)))
 	g.indentLevel++
 	g.generateStatement(i.ThenBranch)
@@ -196,24 +548,20 @@ func (g *Generator) generateIfStmt(i *ast.IfStmt) {
 }
 
 func (g *Generator) generateForStmt(f *ast.ForStmt) {
+	g.pushScope()
+	defer g.popScope()
+
+	var prologue []string
 	if f.IsRange {
-		// Convert "for x in range(n)" to "for x := 0; x < n; x++"
-		if callExpr, ok := f.RangeExpr.(*ast.CallExpr); ok {
-			if ident, ok := callExpr.Function.(*ast.Identifier); ok && ident.Value == "range" {
-				if len(callExpr.Arguments) > 0 {
-					g.writeLine(fmt.Sprintf("for %s := 0; %s < %s; %s++ {",
-						f.RangeVar, f.RangeVar, g.generateExpression(callExpr.Arguments[0]), f.RangeVar))
-				}
-			}
-		} else {
-			// Regular range over slice/map
-			g.writeLine(fmt.Sprintf("for %s := range %s {", f.RangeVar, g.generateExpression(f.RangeExpr)))
-		}
+		prologue = g.generateRangeLoop(f)
 	} else {
 		// Traditional for loop
 		init := ""
 		if f.Init != nil {
 			init = g.generateStatementInline(f.Init)
+			if decl, ok := f.Init.(*ast.VarDecl); ok {
+				g.declare(decl.Name, g.exprType(decl.Value))
+			}
 		}
 		condition := ""
 		if f.Condition != nil {
@@ -227,6 +575,9 @@ func (g *Generator) generateForStmt(f *ast.ForStmt) {
 	}
 
 	g.indentLevel++
+	for _, line := range prologue {
+		g.writeLine(line)
+	}
 	g.generateBlockStmt(f.Body)
 	g.indentLevel--
 	g.writeLine("}")
@@ -241,27 +592,63 @@ func (g *Generator) generateWhileStmt(w *ast.WhileStmt) {
 }
 
 func (g *Generator) generateReturnStmt(r *ast.ReturnStmt) {
-	if r.Value != nil {
-		g.writeLine(fmt.Sprintf("return %s", g.generateExpression(r.Value)))
+	g.hoistPropagations(r.Value)
+	if len(g.fn.tries) > 0 {
+		g.generateReturnInTry(r)
+	} else if r.Value != nil {
+		g.writeLine(fmt.Sprintf("return %s", g.generateResult(r.Value)))
 	} else {
 		g.writeLine("return")
 	}
 }
 
 func (g *Generator) generateExpressionStmt(e *ast.ExpressionStmt) {
+	// f()? on its own only checks the error; the other results go to _
+	if p, ok := e.Expression.(*ast.PropagateExpr); ok {
+		g.hoistPropagations(p.Call)
+		g.discardPropagation(p, g.propagatedValues(p))
+		return
+	}
+	// A string on its own, such as a docstring, becomes a comment
+	if lit, ok := e.Expression.(*ast.Literal); ok && lit.Type == "string" {
+		text := commentText(fmt.Sprint(lit.Value))
+		for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			g.writeLine(strings.TrimSpace("// " + strings.TrimSpace(line)))
+		}
+		return
+	}
+	g.hoistPropagations(e.Expression)
 	g.writeLine(g.generateExpression(e.Expression))
 }
 
 func (g *Generator) generateBlockStmt(b *ast.BlockStmt) {
+	g.pushScope()
 	for _, stmt := range b.Statements {
 		g.generateStatement(stmt)
 	}
+	g.popScope()
 }
 
 func (g *Generator) generateExpression(expr ast.Expression) string {
 	switch e := expr.(type) {
 	case *ast.Identifier:
-		return e.Value
+		_, shadowed := g.lookup(e.Value)
+		if shadowed {
+			// A variable keeps its name, even next to pub func of the same name
+			return e.Value
+		}
+		if g.funcs[e.Value] == nil {
+			switch e.Value {
+			case "__name__":
+				return strconv.Quote(g.name)
+			case argvName:
+				return g.qualified("os", "Args")
+			}
+			if name, ok := g.fromImport(e.Value); ok {
+				return name
+			}
+		}
+		return g.topLevelName(e.Value)
 	case *ast.Literal:
 		return g.generateLiteral(e)
 	case *ast.BinaryExpr:
@@ -274,10 +661,34 @@ func (g *Generator) generateExpression(expr ast.Expression) string {
 		return g.generateArrayLiteral(e)
 	case *ast.MapLiteral:
 		return g.generateMapLiteral(e)
+	case *ast.StructLiteral:
+		return g.generateStructLiteral(e)
 	case *ast.IndexExpr:
 		return g.generateIndexExpr(e)
+	case *ast.SliceExpr:
+		return g.generateSliceExpr(e)
+	case *ast.FStringExpr:
+		return g.generateFStringExpr(e)
+	case *ast.ComprehensionExpr:
+		return g.generateComprehensionExpr(e)
 	case *ast.SelectorExpr:
 		return g.generateSelectorExpr(e)
+	case *ast.FunctionLiteral:
+		return g.generateFunctionLiteral(e)
+	case *ast.LambdaExpr:
+		return g.generateLambdaExpr(e)
+	case *ast.InstantiationExpr:
+		return fmt.Sprintf("%s[%s]", g.generateExpression(e.Object), g.generateTypeList(e.TypeArgs))
+	case *ast.TypeExpr:
+		return g.generateTypeSpec(e.Type)
+	case *ast.TupleExpr:
+		var elements []string
+		for _, elem := range e.Elements {
+			elements = append(elements, g.generateExpression(elem))
+		}
+		return strings.Join(elements, ", ")
+	case *ast.PropagateExpr:
+		return g.hoisted[e]
 	default:
 		return ""
 	}
@@ -286,7 +697,7 @@ func (g *Generator) generateExpression(expr ast.Expression) string {
 func (g *Generator) generateLiteral(l *ast.Literal) string {
 	switch l.Type {
 	case "string":
-		return fmt.Sprintf(`"%s"`, l.Value)
+		return quoteString(fmt.Sprint(l.Value))
 	case "int", "float":
 		return fmt.Sprintf("%v", l.Value)
 	case "bool":
@@ -311,7 +722,7 @@ func (g *Generator) generateBinaryExpr(b *ast.BinaryExpr) string {
 		operator = "||"
 	case "**":
 		// Power operator - need to use math.Pow
-		return fmt.Sprintf("math.Pow(%s, %s)", g.generateExpression(b.Left), g.generateExpression(b.Right))
+		return fmt.Sprintf("%s(%s, %s)", g.qualified("math", "Pow"), g.generateExpression(b.Left), g.generateExpression(b.Right))
 	}
 
 	return fmt.Sprintf("(%s %s %s)", g.generateExpression(b.Left), operator, g.generateExpression(b.Right))
@@ -322,39 +733,85 @@ func (g *Generator) generateUnaryExpr(u *ast.UnaryExpr) string {
 	if operator == "not" {
 		operator = "!"
 	}
-	return fmt.Sprintf("%s%s", operator, g.generateExpression(u.Operand))
+	operand := g.generateExpression(u.Operand)
+	// Go reads - -x and & &x written together as -- and &&
+	if strings.HasPrefix(operand, operator) {
+		operand = "(" + operand + ")"
+	}
+	return fmt.Sprintf("%s%s", operator, operand)
 }
 
 func (g *Generator) generateCallExpr(c *ast.CallExpr) string {
 	var args []string
-	for _, arg := range c.Arguments {
-		args = append(args, g.generateExpression(arg))
+	params := g.calleeParams(c)
+	for i, arg := range c.Arguments {
+		if i < len(params) {
+			args = append(args, g.generateValue(arg, params[i]))
+		} else {
+			args = append(args, g.generateExpression(arg))
+		}
+	}
+
+	// Builtins and module functions such as strings.upper
+	switch fn := c.Function.(type) {
+	case *ast.Identifier:
+		if b, ok := g.builtinFunc(fn.Value); ok {
+			return b.generate(g, c.Arguments)
+		}
+	case *ast.SelectorExpr:
+		if b, ok := g.moduleFunc(fn); ok {
+			return b.generate(g, c.Arguments)
+		}
 	}
 
-	// Handle special functions
 	if ident, ok := c.Function.(*ast.Identifier); ok {
-		switch ident.Value {
-		case "print":
-			return fmt.Sprintf("fmt.Println(%s)", strings.Join(args, ", "))
-		case "len":
-			return fmt.Sprintf("len(%s)", strings.Join(args, ", "))
-		case "range":
-			// This should be handled in for loop context
-			if len(args) > 0 {
-				return args[0]
-			}
+		// Person(...) calls the generated constructor of a struct with init
+		if s, ok := g.structs[ident.Value]; ok && s.Constructor != nil {
+			return fmt.Sprintf("%s(%s)", constructorName(g.topLevelName(s.Name)), strings.Join(args, ", "))
+		}
+	}
+
+	// Stack[int](...) calls the constructor of a generic struct
+	if t := ast.TypeFromExpr(c.Function); t != nil && len(t.TypeArgs) > 0 {
+		if s, ok := g.structs[t.Name]; ok && s.Constructor != nil {
+			return fmt.Sprintf("%s[%s](%s)", constructorName(g.topLevelName(s.Name)), g.generateTypeList(t.TypeArgs),
+				strings.Join(args, ", "))
 		}
 	}
 
 	return fmt.Sprintf("%s(%s)", g.generateExpression(c.Function), strings.Join(args, ", "))
 }
 
+// generateArrayLiteral generates a list literal as a slice of the type of
+// its elements, see elementType
 func (g *Generator) generateArrayLiteral(a *ast.ArrayLiteral) string {
+	return g.generateList(a, g.exprType(a))
+}
+
+// generateValue generates a value of type t, for a variable, parameter,
+// field or result of that type. A list literal takes the slice or array
+// type, so [] is an empty []U for var out []U = [].
+func (g *Generator) generateValue(expr ast.Expression, t *ast.TypeSpec) string {
+	if a, ok := expr.(*ast.ArrayLiteral); ok && t != nil && !t.IsPointer && (t.IsSlice || t.IsArray) {
+		return g.generateList(a, t)
+	}
+	return g.generateExpression(expr)
+}
+
+// generateResult generates the value of a return statement
+func (g *Generator) generateResult(expr ast.Expression) string {
+	if len(g.fn.results) == 1 {
+		return g.generateValue(expr, g.fn.results[0])
+	}
+	return g.generateExpression(expr)
+}
+
+func (g *Generator) generateList(a *ast.ArrayLiteral, t *ast.TypeSpec) string {
 	var elements []string
 	for _, elem := range a.Elements {
-		elements = append(elements, g.generateExpression(elem))
+		elements = append(elements, g.generateValue(elem, t.ValueType))
 	}
-	return fmt.Sprintf("[]interface{}{%s}", strings.Join(elements, ", "))
+	return fmt.Sprintf("%s{%s}", g.generateTypeSpec(t), strings.Join(elements, ", "))
 }
 
 func (g *Generator) generateMapLiteral(m *ast.MapLiteral) string {
@@ -365,12 +822,41 @@ func (g *Generator) generateMapLiteral(m *ast.MapLiteral) string {
 	return fmt.Sprintf("map[interface{}]interface{}{%s}", strings.Join(pairs, ", "))
 }
 
-func (g *Generator) generateIndexExpr(i *ast.IndexExpr) string {
-	return fmt.Sprintf("%s[%s]", g.generateExpression(i.Object), g.generateExpression(i.Index))
+func (g *Generator) generateStructLiteral(s *ast.StructLiteral) string {
+	var parts []string
+	t := ast.TypeFromExpr(s.Type)
+	for _, field := range s.Fields {
+		value := g.generateExpression(field.Value)
+		if f, owner := g.fieldOf(t, field.Name); f != nil {
+			value = g.generateValue(field.Value, memberType(t, owner, f.Type))
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", g.selectorName(t, field.Name), value))
+	}
+	for _, value := range s.Values {
+		parts = append(parts, g.generateExpression(value))
+	}
+	return fmt.Sprintf("%s{%s}", g.generateExpression(s.Type), strings.Join(parts, ", "))
 }
 
 func (g *Generator) generateSelectorExpr(s *ast.SelectorExpr) string {
-	return fmt.Sprintf("%s.%s", g.generateExpression(s.Object), s.Selector)
+	if module, ok := g.moduleName(s.Object); ok && module == "math" && mathConstants[s.Selector] != "" {
+		return g.rt(mathConstants[s.Selector])
+	}
+	if ident, ok := s.Object.(*ast.Identifier); ok {
+		if pkg, ok := g.packageRef(ident.Value); ok {
+			if g.gosPackages[ident.Value] != "" {
+				// Only exported names are reachable in another .gos package
+				return pkg + "." + ast.ExportName(s.Selector)
+			}
+			return pkg + "." + s.Selector
+		}
+	}
+	object := g.generateExpression(s.Object)
+	// A number, as int(0) becomes, would take the dot as a decimal point
+	if object != "" && (unicode.IsDigit(rune(object[0])) || object[0] == '.') {
+		object = "(" + object + ")"
+	}
+	return fmt.Sprintf("%s.%s", object, g.selectorName(g.exprType(s.Object), s.Selector))
 }
 
 func (g *Generator) generateParameter(p *ast.Parameter) string {
@@ -391,16 +877,145 @@ func (g *Generator) generateTypeSpec(t *ast.TypeSpec) string {
 	if t.IsArray {
 		result += fmt.Sprintf("[%d]", t.ArraySize)
 	}
-	if t.KeyType != nil && t.ValueType != nil {
+	if len(t.Tuple) > 0 {
+		result += "(" + g.generateTypeList(t.Tuple) + ")"
+	} else if t.IsFunc {
+		result += g.generateFuncType(t)
+	} else if t.KeyType != nil && t.ValueType != nil {
 		result += fmt.Sprintf("map[%s]%s", g.generateTypeSpec(t.KeyType), g.generateTypeSpec(t.ValueType))
 	} else if t.ValueType != nil {
 		result += g.generateTypeSpec(t.ValueType)
 	} else {
-		result += t.Name
+		if pkg, name, ok := strings.Cut(t.Name, "."); ok {
+			// A type of a package, such as time.Time
+			if ref, ok := g.packageRef(pkg); ok {
+				result += ref + "." + name
+			} else {
+				result += t.Name
+			}
+		} else if ref, ok := g.fromImport(t.Name); ok {
+			result += ref
+		} else {
+			result += g.topLevelName(t.Name)
+		}
+		if len(t.TypeArgs) > 0 {
+			result += "[" + g.generateTypeList(t.TypeArgs) + "]"
+		}
 	}
 	return result
 }
 
+func (g *Generator) generateTypeList(types []*ast.TypeSpec) string {
+	var parts []string
+	for _, t := range types {
+		parts = append(parts, g.generateTypeSpec(t))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// generateTypeParams generates the type parameter list of a generic
+// function or struct; parameters without a constraint become any
+func (g *Generator) generateTypeParams(params []*ast.TypeParam) string {
+	if len(params) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, param := range params {
+		constraint := "any"
+		if len(param.Constraint) > 0 {
+			var terms []string
+			for _, term := range param.Constraint {
+				if term.Tilde {
+					terms = append(terms, "~"+g.generateTypeSpec(term.Type))
+				} else {
+					terms = append(terms, g.generateTypeSpec(term.Type))
+				}
+			}
+			constraint = strings.Join(terms, " | ")
+		}
+		parts = append(parts, param.Name+" "+constraint)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func (g *Generator) generateFuncType(t *ast.TypeSpec) string {
+	var params []string
+	for _, param := range t.Params {
+		params = append(params, g.generateTypeSpec(param))
+	}
+	return "func(" + strings.Join(params, ", ") + ")" + g.generateResults(t.Results)
+}
+
+// generateResults generates the result list of a function type or literal,
+// including the leading space
+func (g *Generator) generateResults(results []*ast.TypeSpec) string {
+	switch len(results) {
+	case 0:
+		return ""
+	case 1:
+		return " " + g.generateTypeSpec(results[0])
+	}
+	var types []string
+	for _, result := range results {
+		types = append(types, g.generateTypeSpec(result))
+	}
+	return " (" + strings.Join(types, ", ") + ")"
+}
+
+func (g *Generator) generateFunctionLiteral(f *ast.FunctionLiteral) string {
+	var params []string
+	for _, param := range f.Parameters {
+		params = append(params, g.generateParameter(param))
+	}
+	signature := "func(" + strings.Join(params, ", ") + ")"
+	if f.ReturnType != nil {
+		signature += " " + g.generateTypeSpec(f.ReturnType)
+	}
+	outer := g.enterFunction(f.ReturnType)
+	g.pushScope()
+	g.declareParams(f.Parameters)
+	defer func() {
+		g.popScope()
+		g.fn = outer
+	}()
+	return signature + " {\n" + g.generateNestedBlock(f.Body) + "}"
+}
+
+// generateNestedBlock generates a block that appears inside an expression,
+// such as a func literal body. The lines are indented one level deeper than
+// the enclosing statement and end with the indentation for the closing brace.
+func (g *Generator) generateNestedBlock(b *ast.BlockStmt) string {
+	outer := g.output
+	g.output = strings.Builder{}
+	g.indentLevel++
+	g.generateBlockStmt(b)
+	g.indentLevel--
+	body := g.output.String()
+	g.output = outer
+	return body + strings.Repeat("\t", g.indentLevel)
+}
+
+// generateLambdaExpr generates a one-line Go func literal. Parameters without
+// a type take theirs from the function type the checker inferred.
+func (g *Generator) generateLambdaExpr(l *ast.LambdaExpr) string {
+	var params []string
+	g.pushScope()
+	for i, param := range l.Parameters {
+		if param.Type == nil && l.Type != nil && i < len(l.Type.Params) {
+			param = &ast.Parameter{Name: param.Name, Type: l.Type.Params[i]}
+		}
+		params = append(params, g.generateParameter(param))
+		g.declare(param.Name, param.Type)
+	}
+	signature := "func(" + strings.Join(params, ", ") + ")"
+	body := g.generateExpression(l.Body)
+	g.popScope()
+	if l.Type == nil || len(l.Type.Results) == 0 {
+		return fmt.Sprintf("%s { %s }", signature, body)
+	}
+	return fmt.Sprintf("%s%s { return %s }", signature, g.generateResults(l.Type.Results), body)
+}
+
 func (g *Generator) generateStatementInline(stmt ast.Statement) string {
 	switch s := stmt.(type) {
 	case *ast.VarDecl:
@@ -408,6 +1023,8 @@ func (g *Generator) generateStatementInline(stmt ast.Statement) string {
 			return fmt.Sprintf("var %s %s = %s", s.Name, g.generateTypeSpec(s.Type), g.generateExpression(s.Value))
 		}
 		return fmt.Sprintf("%s := %s", s.Name, g.generateExpression(s.Value))
+	case *ast.AssignStmt:
+		return g.generateAssignStmt(s)
 	case *ast.ExpressionStmt:
 		return g.generateExpression(s.Expression)
 	default:
@@ -415,12 +1032,59 @@ func (g *Generator) generateStatementInline(stmt ast.Statement) string {
 	}
 }
 
+// writeDoc writes the comments above a declaration in the .gos file as its
+// Go doc comment. A comment that starts with the .gos name of the
+// declaration starts with its Go name instead, as Go doc comments do.
+func (g *Generator) writeDoc(doc, name, goName string) {
+	if doc == "" {
+		return
+	}
+	if rest, ok := strings.CutPrefix(doc, name); ok && name != goName {
+		if r, _ := utf8.DecodeRuneInString(rest); rest == "" || !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			doc = goName + rest
+		}
+	}
+	// The comment is not code, so it needs no line directives
+	line := g.line
+	g.line = 0
+	for _, text := range strings.Split(commentText(doc), "\n") {
+		g.writeLine(strings.TrimRight("// "+text, " "))
+	}
+	g.line = line
+}
+
+// commentText returns text that can go in a Go comment. Go source cannot
+// hold invalid UTF-8, NUL or a byte order mark, which .gos strings and
+// comments can.
+func commentText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == 0 || r == '\uFEFF' {
+			return utf8.RuneError
+		}
+		return r
+	}, strings.ToValidUTF8(text, string(utf8.RuneError)))
+}
+
 func (g *Generator) writeLine(line string) {
 	if line == "" {
 		g.output.WriteString("\n")
 		return
 	}
 
+	switch {
+	case g.line > 0:
+		// Line directives must start at the beginning of a line, and
+		// every line needs one, or the lines after it count up from it
+		g.output.WriteString(fmt.Sprintf("//line %s:%d\n", g.options.SourceFile, g.line))
+		g.marked = true
+	case g.marked:
+		// Code of no .gos line, such as a struct type, gets its position
+		// in the generated file back
+		g.output.WriteString(lineReset + "\n")
+		g.directives = true
+		g.marked = false
+	}
+
 	// Add indentation
 	for i := 0; i < g.indentLevel; i++ {
 		g.output.WriteString("\t")
@@ -0,0 +1,189 @@
+package codegen
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/stdlib"
+)
+
+// Imports are collected while the code is generated. Every reference to a
+// package goes through pkg or packageRef, which record the import and
+// return the name the package has in the generated file, so the import
+// block lists exactly the packages the code uses. Imports of the program
+// that the code never refers to are left out; the checker warns about them.
+
+// goImport is an import of the generated file
+type goImport struct {
+	name  string // the name the code refers to the package by
+	alias bool   // whether the import spec names the package
+}
+
+// collectImports records the imports of the program and the names it
+// declares, which the packages the generated code imports must not hide
+func (g *Generator) collectImports(program *ast.Program) {
+	g.imports = make(map[string]goImport)
+	g.packages = make(map[string]string)
+	g.gosPackages = make(map[string]string)
+	g.aliases = make(map[string]bool)
+	g.fromImports = make(map[string]string)
+
+	for _, imp := range program.Imports {
+		for _, pkg := range imp.Packages() {
+			if len(pkg.Names) > 0 {
+				for _, name := range pkg.Names {
+					g.fromImports[name] = pkg.Path
+				}
+				continue
+			}
+			if pkg.Alias {
+				g.aliases[pkg.Name] = true
+			}
+			if strings.HasSuffix(pkg.Path, ".gos") {
+				g.gosPackages[pkg.Name] = pkg.Path
+			} else {
+				g.packages[pkg.Name] = pkg.Path
+			}
+		}
+	}
+
+	g.declared = ast.DeclaredNames(program)
+}
+
+// pkg returns the name the generated code refers to the Go package at path
+// by, and records that the code imports it. An import of the package in the
+// program is reused, unless the program also declares a variable of its
+// name. Otherwise the package gets its usual name, unless the program uses
+// that name for something else.
+func (g *Generator) pkg(importPath string) string {
+	if importPath == RuntimePath && g.options.RuntimePath != "" {
+		importPath = g.options.RuntimePath
+	}
+	if imp, ok := g.imports[importPath]; ok {
+		return imp.name
+	}
+	for name, p := range g.packages {
+		if p == importPath && !g.declared[name] {
+			return g.useImport(name)
+		}
+	}
+
+	base := strings.TrimSuffix(path.Base(importPath), ".gos")
+	if importPath == RuntimePath || importPath == g.options.RuntimePath {
+		base = RuntimeName
+	}
+	name := base
+	for i := 1; g.nameTaken(name); i++ {
+		name = base + "pkg"
+		if i > 1 {
+			name += strconv.Itoa(i)
+		}
+	}
+	g.imports[importPath] = goImport{name: name, alias: name != path.Base(importPath)}
+	return name
+}
+
+// nameTaken reports whether name cannot be given to a package the
+// generated code imports
+func (g *Generator) nameTaken(name string) bool {
+	if g.declared[name] || g.packages[name] != "" || g.gosPackages[name] != "" {
+		return true
+	}
+	for _, imp := range g.imports {
+		if imp.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// useImport records that the code refers to the program's import called
+// name and returns the name
+func (g *Generator) useImport(name string) string {
+	p := g.packages[name]
+	if p == "" {
+		p = g.gosPackages[name]
+	}
+	g.imports[p] = goImport{name: name, alias: g.aliases[name]}
+	return name
+}
+
+// packageRef returns the name of the package that name refers to as the
+// left side of a selector, as os in os.Args, and records the import. It is
+// false when name is a variable, function or type of the program, or not
+// a package: one the program imports, or one of the stdlib.AutoImports.
+func (g *Generator) packageRef(name string) (string, bool) {
+	if _, ok := g.lookup(name); ok || g.funcs[name] != nil || g.structs[name] != nil {
+		return "", false
+	}
+	if g.packages[name] != "" || g.gosPackages[name] != "" {
+		return g.useImport(name), true
+	}
+	if p, ok := stdlib.AutoImports[name]; ok {
+		return g.pkg(p), true
+	}
+	return "", false
+}
+
+// fromImport returns the Go name of a name imported with from ... import,
+// such as json.Marshal for Marshal, and records the import. It is false
+// when name is not imported that way or a struct of the program hides it.
+func (g *Generator) fromImport(name string) (string, bool) {
+	p, ok := g.fromImports[name]
+	if !ok || g.structs[name] != nil {
+		return "", false
+	}
+	if strings.HasSuffix(p, ".gos") {
+		// Only exported names are reachable in another .gos package
+		return g.pkg(p) + "." + ast.ExportName(name), true
+	}
+	return g.qualified(p, name), true
+}
+
+// qualified returns the Go name of fn in the package at importPath, such
+// as fmt.Println
+func (g *Generator) qualified(importPath, fn string) string {
+	return g.pkg(importPath) + "." + fn
+}
+
+// rt returns the Go name of fn in the runtime package
+func (g *Generator) rt(fn string) string {
+	return g.qualified(RuntimePath, fn)
+}
+
+// writeImports writes the import declaration for the packages the code
+// uses, standard library packages first
+func (g *Generator) writeImports(out *strings.Builder) {
+	if len(g.imports) == 0 {
+		return
+	}
+	var std, other []string
+	for p := range g.imports {
+		if first, _, _ := strings.Cut(p, "/"); strings.Contains(first, ".") || strings.HasSuffix(p, ".gos") {
+			other = append(other, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	out.WriteString("import (\n")
+	for i, group := range [][]string{std, other} {
+		if i > 0 && len(std) > 0 && len(other) > 0 {
+			out.WriteString("\n")
+		}
+		for _, p := range group {
+			if imp := g.imports[p]; imp.alias {
+				fmt.Fprintf(out, "\t%s %q\n", imp.name, p)
+			} else {
+				fmt.Fprintf(out, "\t%q\n", p)
+			}
+		}
+	}
+	out.WriteString(")\n\n")
+}
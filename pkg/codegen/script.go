@@ -0,0 +1,37 @@
+package codegen
+
+// Top-level statements other than declarations run when the program starts.
+// In package main they form the body of a generated main function, and in
+// any other package the body of an init function, which Go runs after the
+// package-level vars are initialized. A func main declared next to them is
+// an ordinary function that the statements can call, usually from an
+// if __name__ == "__main__": guard.
+
+// scriptMainName is the Go name of a func main declared in a script
+const scriptMainName = "gosMain"
+
+// generatesMain reports whether the Go main function is generated, to run
+// the script or the @cli function, so that a declared func main needs
+// another name
+func (g *Generator) generatesMain() bool {
+	return g.name == "__main__" && (len(g.script) > 0 || g.cli != nil)
+}
+
+// generateScript writes the function that runs the top-level statements
+func (g *Generator) generateScript() {
+	name := "init"
+	if g.generatesMain() {
+		name = "main"
+	}
+	g.writeLine("func " + name + "() {")
+	g.indentLevel++
+	outer := g.enterFunction(nil)
+	g.pushScope()
+	for _, stmt := range g.script {
+		g.generateStatement(stmt)
+	}
+	g.popScope()
+	g.fn = outer
+	g.indentLevel--
+	g.writeLine("}")
+}
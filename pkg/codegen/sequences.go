@@ -0,0 +1,209 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// Loops over range(), enumerate() and zip() are generated as Go loops
+// rather than calls, so no slice is built for them. Slices and negative
+// indexes follow Python: out of range slice bounds are clamped, and xs[-1]
+// is the last element.
+
+// generateRangeLoop writes the header of a for ... in loop. It returns the
+// lines that start the body, which bind the loop variables the header
+// cannot.
+func (g *Generator) generateRangeLoop(f *ast.ForStmt) []string {
+	g.hoistPropagations(f.RangeExpr)
+
+	if c, ok := f.RangeExpr.(*ast.CallExpr); ok {
+		if ident, ok := c.Function.(*ast.Identifier); ok {
+			if _, ok := g.builtinFunc(ident.Value); ok {
+				switch n := len(c.Arguments); {
+				case ident.Value == "range" && f.ValueVar == "" && n >= 1 && n <= 3:
+					g.generateCountingLoop(f.RangeVar, c.Arguments)
+					return nil
+				case ident.Value == "enumerate" && f.ValueVar != "" && n >= 1 && n <= 2:
+					return g.generateEnumerateLoop(f, c.Arguments)
+				case ident.Value == "zip" && f.ValueVar != "" && n == 2:
+					return g.generateZipLoop(f, c.Arguments)
+				}
+			}
+		}
+	}
+
+	t := g.exprType(f.RangeExpr)
+	first, second := g.rangeVarTypes(f)
+	expr := g.generateExpression(f.RangeExpr)
+	switch {
+	case f.ValueVar != "":
+		g.writeLine(fmt.Sprintf("for %s, %s := range %s {", f.RangeVar, f.ValueVar, expr))
+		g.declare(f.ValueVar, second)
+	case t != nil && t.KeyType != nil:
+		// A single variable ranges over the keys of a map
+		g.writeLine(fmt.Sprintf("for %s := range %s {", f.RangeVar, expr))
+	case f.RangeVar == "_":
+		g.writeLine(fmt.Sprintf("for range %s {", expr))
+		return nil
+	default:
+		g.writeLine(fmt.Sprintf("for _, %s := range %s {", f.RangeVar, expr))
+	}
+	g.declare(f.RangeVar, first)
+	return nil
+}
+
+// generateCountingLoop writes for v in range(stop), range(start, stop) or
+// range(start, stop, step) as a counting loop. A step that is not a literal
+// can be either sign, so its condition checks both directions.
+func (g *Generator) generateCountingLoop(v string, args []ast.Expression) {
+	if v == "_" {
+		v = fmt.Sprintf("_i%d", g.nextTemp())
+	}
+	g.declare(v, named("int"))
+
+	start := "0"
+	if len(args) > 1 {
+		start = g.generateExpression(args[0])
+		args = args[1:]
+	}
+	stop := g.evalOnce(args[0])
+
+	condition := fmt.Sprintf("%s < %s", v, stop)
+	update := v + "++"
+	if len(args) == 2 {
+		step, ok := ast.IntValue(args[1])
+		switch {
+		case ok && step == -1:
+			condition, update = fmt.Sprintf("%s > %s", v, stop), v+"--"
+		case ok && step < 0:
+			condition, update = fmt.Sprintf("%s > %s", v, stop), fmt.Sprintf("%s -= %d", v, -step)
+		case ok && step > 1:
+			update = fmt.Sprintf("%s += %d", v, step)
+		case !ok || step == 0:
+			s := fmt.Sprintf("_s%d", g.nextTemp())
+			g.writeLine(fmt.Sprintf("%s := %s(%s)", s, g.rt("Step"), g.generateExpression(args[1])))
+			condition = fmt.Sprintf("(%s > 0 && %s < %s) || (%s < 0 && %s > %s)", s, v, stop, s, v, stop)
+			update = fmt.Sprintf("%s += %s", v, s)
+		}
+	}
+
+	g.writeLine(fmt.Sprintf("for %s := %s; %s; %s {", v, start, condition, update))
+}
+
+// generateEnumerateLoop writes for i, x in enumerate(xs, start) as a range
+// loop that offsets the index
+func (g *Generator) generateEnumerateLoop(f *ast.ForStmt, args []ast.Expression) []string {
+	var body []string
+	if len(args) == 2 && f.RangeVar != "_" {
+		start := g.evalOnce(args[1])
+		if offset, ok := ast.IntValue(args[1]); !ok || offset != 0 {
+			body = append(body, fmt.Sprintf("%s += %s", f.RangeVar, start))
+		}
+	}
+	g.writeLine(fmt.Sprintf("for %s, %s := range %s {", f.RangeVar, f.ValueVar, g.generateExpression(args[0])))
+	g.declare(f.RangeVar, named("int"))
+	g.declare(f.ValueVar, rangeValueType(g.exprType(args[0])))
+	return body
+}
+
+// generateZipLoop writes for x, y in zip(xs, ys) as an index loop up to the
+// end of the shorter slice
+func (g *Generator) generateZipLoop(f *ast.ForStmt, args []ast.Expression) []string {
+	xs, ys := g.evalOnce(args[0]), g.evalOnce(args[1])
+	i := fmt.Sprintf("_i%d", g.nextTemp())
+	g.writeLine(fmt.Sprintf("for %s := 0; %s < min(len(%s), len(%s)); %s++ {", i, i, xs, ys, i))
+
+	var body []string
+	for n, v := range []string{f.RangeVar, f.ValueVar} {
+		if v != "_" {
+			body = append(body, fmt.Sprintf("%s := %s[%s]", v, []string{xs, ys}[n], i))
+			g.declare(v, rangeValueType(g.exprType(args[n])))
+		}
+	}
+	return body
+}
+
+// evalOnce returns an expression that can be evaluated repeatedly without
+// repeating side effects, storing the value in a variable if needed
+func (g *Generator) evalOnce(expr ast.Expression) string {
+	if isSimple(expr) {
+		return g.generateExpression(expr)
+	}
+	temp := fmt.Sprintf("_n%d", g.nextTemp())
+	g.writeLine(fmt.Sprintf("%s := %s", temp, g.generateExpression(expr)))
+	return temp
+}
+
+// isSimple reports whether an expression is a literal, a variable or a
+// field of one, which have no side effects
+func isSimple(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.Literal, *ast.Identifier:
+		return true
+	case *ast.UnaryExpr:
+		return e.Operator == "-" && isLiteral(e.Operand)
+	case *ast.SelectorExpr:
+		return isSimple(e.Object)
+	}
+	return false
+}
+
+// generateIndexExpr generates xs[i], where a negative i counts from the end
+// of a slice, array or string. A literal index is resolved in the generated
+// code, and one computed at run time by the runtime, when the type of xs
+// shows that it is not a map.
+func (g *Generator) generateIndexExpr(i *ast.IndexExpr) string {
+	object := g.generateExpression(i.Object)
+	t := g.exprType(i.Object)
+	index := g.generateExpression(i.Index)
+
+	if n, ok := ast.IntValue(i.Index); ok {
+		if n >= 0 || t != nil && t.KeyType != nil {
+			return fmt.Sprintf("%s[%s]", object, index)
+		}
+		switch {
+		case isSimple(i.Object):
+			return fmt.Sprintf("%s[len(%s)%d]", object, object, n)
+		case isType(t, "string"):
+			return fmt.Sprintf("%s(%s, %d)", g.rt("ByteAt"), object, n)
+		default:
+			return fmt.Sprintf("%s(%s, %d)", g.rt("At"), object, n)
+		}
+	}
+
+	sequence := t != nil && !t.IsPointer && (t.IsSlice || t.IsArray || isType(t, "string"))
+	switch {
+	case !sequence:
+		return fmt.Sprintf("%s[%s]", object, index)
+	case isSimple(i.Object):
+		return fmt.Sprintf("%s[%s(len(%s), %s)]", object, g.rt("Index"), object, index)
+	case isType(t, "string"):
+		return fmt.Sprintf("%s(%s, %s)", g.rt("ByteAt"), object, index)
+	case t.IsSlice:
+		return fmt.Sprintf("%s(%s, %s)", g.rt("At"), object, index)
+	}
+	// An array that is not a variable cannot be sliced to a slice for At
+	return fmt.Sprintf("%s[%s]", object, index)
+}
+
+// generateSliceExpr generates xs[low:high:step] as a runtime call, which
+// clamps the bounds the way Python does
+func (g *Generator) generateSliceExpr(s *ast.SliceExpr) string {
+	bound := func(e ast.Expression) string {
+		if e == nil {
+			return g.rt("Omit")
+		}
+		return g.generateExpression(e)
+	}
+	step := "1"
+	if s.Step != nil {
+		step = g.generateExpression(s.Step)
+	}
+	fn := "Slice"
+	if isType(g.exprType(s.Object), "string") {
+		fn = "SliceString"
+	}
+	return fmt.Sprintf("%s(%s, %s, %s, %s)", g.rt(fn),
+		g.generateExpression(s.Object), bound(s.Low), bound(s.High), step)
+}
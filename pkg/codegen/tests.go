@@ -0,0 +1,169 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// A test file, name_test.gos, holds tests of the program in name.gos. It is
+// generated as a Go test file of the same package: each test, such as
+// func test_add(t):, becomes func Test_add(t *testing.T), which go test
+// runs.
+
+// lineReset marks the end of the code of a .gos line until the line it
+// ends on in the generated file is known, see resolveLineDirectives
+const lineReset = "//line -"
+
+// GenerateTests generates the Go test file for a test file. The tests can
+// use the functions and structs of code, the program they test, which is
+// generated on its own with Generate; code is nil when the test file
+// stands alone.
+func (g *Generator) GenerateTests(tests, code *ast.Program) string {
+	program := tests
+	if code != nil {
+		program = &ast.Program{Package: code.Package, Imports: tests.Imports}
+		for _, stmt := range code.Statements {
+			if ast.IsDeclaration(stmt) {
+				program.Statements = append(program.Statements, stmt)
+			}
+		}
+		program.Statements = append(program.Statements, tests.Statements...)
+	}
+
+	g.collect(program)
+	g.testing = true
+	g.script = nil
+	g.cli = nil
+	for _, stmt := range tests.Statements {
+		if fn, ok := stmt.(*ast.FunctionDecl); ok && fn.IsTest() {
+			// Go runs the functions named TestXxx
+			g.exported[fn.Name] = true
+		}
+	}
+	return g.generateFile(program.Package, "", tests.Statements)
+}
+
+// assertComparisons are the operators of the conditions whose operands a
+// failed assert reports
+var assertComparisons = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+// generateAssertStmt writes an assert as an if statement that fails the
+// test when the condition is false, or panics outside a test. The operands
+// of a comparison are evaluated once into variables, so the failure can
+// report their values; constants are left in place, where Go gives them
+// the type of the other operand.
+func (g *Generator) generateAssertStmt(a *ast.AssertStmt) {
+	g.hoistPropagations(a.Condition)
+	if a.Message != nil {
+		g.hoistPropagations(a.Message)
+	}
+
+	// The source is reported as written when the parser recorded it
+	source := a.Source
+	condition := g.generateExpression(a.Condition)
+	b, binary := a.Condition.(*ast.BinaryExpr)
+	if source == "" && binary {
+		source = fmt.Sprintf("%s %s %s", b.Left.String(), b.Operator, b.Right.String())
+	} else if source == "" {
+		source = a.Condition.String()
+	}
+	if !binary {
+		condition = "(" + condition + ")"
+	}
+	var names, values, reports []string
+	if binary && assertComparisons[b.Operator] {
+		n := g.nextTemp()
+		operand := func(e ast.Expression, i int, name string) string {
+			value := g.generateExpression(e)
+			if isConstant(e) {
+				return value
+			}
+			report := e.String()
+			if len(a.Operands) == 2 {
+				report = a.Operands[i]
+			}
+			names = append(names, name)
+			values = append(values, value)
+			reports = append(reports, report)
+			return name
+		}
+		left := operand(b.Left, 0, fmt.Sprintf("_l%d", n))
+		right := operand(b.Right, 1, fmt.Sprintf("_r%d", n))
+		condition = fmt.Sprintf("(%s %s %s)", left, b.Operator, right)
+	}
+
+	// The format reports the assert, its message and the operand values
+	format := "assert " + strings.ReplaceAll(source, "%", "%%") + " failed"
+	if g.test == "" {
+		format += fmt.Sprintf(" at line %d", a.Line)
+	}
+	var args []string
+	if a.Message != nil {
+		format += ": %v"
+		args = append(args, g.generateExpression(a.Message))
+	}
+	// go test and panic indent the lines after the first themselves
+	for _, report := range reports {
+		format += "\n" + strings.ReplaceAll(report, "%", "%%") + " = %#v"
+	}
+	args = append([]string{strconv.Quote(format)}, append(args, names...)...)
+
+	if len(names) > 0 {
+		g.writeLine(fmt.Sprintf("if %s := %s; !%s {", strings.Join(names, ", "), strings.Join(values, ", "), condition))
+	} else {
+		g.writeLine(fmt.Sprintf("if !%s {", condition))
+	}
+	g.indentLevel++
+	g.atLine(a.Line, func() {
+		if g.test != "" {
+			g.writeLine(fmt.Sprintf("%s.Fatalf(%s)", g.test, strings.Join(args, ", ")))
+		} else {
+			g.writeLine(fmt.Sprintf("panic(%s(%s))", g.qualified("fmt", "Sprintf"), strings.Join(args, ", ")))
+		}
+	})
+	g.indentLevel--
+	g.writeLine("}")
+}
+
+// isConstant reports whether e is a literal, or a negated one
+func isConstant(e ast.Expression) bool {
+	if u, ok := e.(*ast.UnaryExpr); ok && (u.Operator == "-" || u.Operator == "+") {
+		e = u.Operand
+	}
+	_, ok := e.(*ast.Literal)
+	return ok
+}
+
+// atLine runs generate with the code it writes marked by a line directive
+// as the given line of the .gos file, so Go reports positions in it as
+// positions in the .gos file, when Options names the files. The lines after
+// it get their positions in the generated file back.
+func (g *Generator) atLine(line int, generate func()) {
+	if g.options.SourceFile == "" || g.options.OutputFile == "" || line == 0 || g.options.LineDirectives {
+		generate()
+		return
+	}
+	// Line directives must start at the beginning of a line
+	g.output.WriteString(fmt.Sprintf("//line %s:%d\n", g.options.SourceFile, line))
+	generate()
+	g.output.WriteString(lineReset + "\n")
+	g.directives = true
+}
+
+// resolveLineDirectives replaces the lineReset marks with line directives
+// that give the lines after them their own positions in the generated file
+func (g *Generator) resolveLineDirectives(file string) string {
+	lines := strings.Split(file, "\n")
+	for i, line := range lines {
+		if line == lineReset {
+			// Line i+1 is the directive; the next one is line i+2
+			lines[i] = fmt.Sprintf("//line %s:%d", g.options.OutputFile, i+2)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,473 @@
+package codegen
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// The generator tracks the types of variables where they are evident from
+// declarations, parameters and literals, so builtins can be generated as
+// direct Go calls. A nil type means unknown; the generated code then falls
+// back to the runtime package, which accepts any value.
+
+// pushScope starts a scope for the variables of a function body
+func (g *Generator) pushScope() {
+	g.scopes = append(g.scopes, make(map[string]*ast.TypeSpec))
+}
+
+func (g *Generator) popScope() {
+	g.scopes = g.scopes[:len(g.scopes)-1]
+}
+
+// declare records the type of a variable in the innermost scope. An unknown
+// type is recorded too, so it hides a variable of an outer scope.
+func (g *Generator) declare(name string, t *ast.TypeSpec) {
+	if len(g.scopes) == 0 {
+		g.pushScope()
+	}
+	g.scopes[len(g.scopes)-1][name] = t
+}
+
+func (g *Generator) declareParams(params []*ast.Parameter) {
+	types := paramTypes(params)
+	for i, param := range params {
+		g.declare(param.Name, types[i])
+	}
+}
+
+// paramTypes returns the type of each parameter. In (a, b int) only the
+// last name of the group carries the type.
+func paramTypes(params []*ast.Parameter) []*ast.TypeSpec {
+	types := make([]*ast.TypeSpec, len(params))
+	var next *ast.TypeSpec
+	for i := len(params) - 1; i >= 0; i-- {
+		if params[i].Type != nil {
+			next = params[i].Type
+		}
+		types[i] = next
+	}
+	return types
+}
+
+func (g *Generator) lookup(name string) (*ast.TypeSpec, bool) {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if t, ok := g.scopes[i][name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// basicTypes are the Go types whose name converts a value: float64(x)
+var basicTypes = map[string]bool{
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"float32": true, "float64": true, "byte": true, "rune": true, "string": true,
+}
+
+func named(name string) *ast.TypeSpec {
+	return &ast.TypeSpec{Name: name}
+}
+
+// isType reports whether t is the plain named type name
+func isType(t *ast.TypeSpec, name string) bool {
+	return t != nil && t.Name == name && t.IsNamed()
+}
+
+// isNumeric reports whether t is an integer or floating point type
+func isNumeric(t *ast.TypeSpec) bool {
+	return t != nil && t.IsNamed() && basicTypes[t.Name] && t.Name != "string"
+}
+
+// exprType returns the type of an expression, or nil if it is not known
+func (g *Generator) exprType(expr ast.Expression) *ast.TypeSpec {
+	switch e := expr.(type) {
+	case *ast.Literal:
+		switch e.Type {
+		case "int", "string", "bool":
+			return named(e.Type)
+		case "float":
+			return named("float64")
+		}
+	case *ast.Identifier:
+		t, declared := g.lookup(e.Value)
+		if !declared && e.Value == argvName && g.funcs[e.Value] == nil {
+			return &ast.TypeSpec{IsSlice: true, ValueType: named("string")}
+		}
+		return t
+	case *ast.BinaryExpr:
+		switch e.Operator {
+		case "==", "!=", "<", "<=", ">", ">=", "and", "or":
+			return named("bool")
+		case "**":
+			return named("float64")
+		}
+		if t := g.exprType(e.Left); t != nil {
+			return t
+		}
+		return g.exprType(e.Right)
+	case *ast.UnaryExpr:
+		switch e.Operator {
+		case "not":
+			return named("bool")
+		case "&":
+			if t := g.exprType(e.Operand); t != nil && !t.IsPointer {
+				ptr := *t
+				ptr.IsPointer = true
+				return &ptr
+			}
+			return nil
+		}
+		return g.exprType(e.Operand)
+	case *ast.CallExpr:
+		return g.callType(e)
+	case *ast.SelectorExpr:
+		if pkg, ok := e.Object.(*ast.Identifier); ok && pkg.Value == "math" && mathConstants[e.Selector] != "" {
+			return named("float64")
+		}
+		t := g.exprType(e.Object)
+		if field, owner := g.fieldOf(t, e.Selector); field != nil {
+			return memberType(t, owner, field.Type)
+		}
+	case *ast.IndexExpr:
+		t := g.exprType(e.Object)
+		switch {
+		case isType(t, "string"):
+			return named("byte")
+		case t != nil && !t.IsPointer && t.ValueType != nil:
+			return t.ValueType
+		}
+	case *ast.SliceExpr:
+		return g.exprType(e.Object)
+	case *ast.FStringExpr:
+		return named("string")
+	case *ast.ComprehensionExpr:
+		return g.comprehensionType(e)
+	case *ast.ArrayLiteral:
+		return &ast.TypeSpec{IsSlice: true, ValueType: g.elementType(e)}
+	case *ast.MapLiteral:
+		return &ast.TypeSpec{KeyType: named("interface{}"), ValueType: named("interface{}")}
+	case *ast.StructLiteral:
+		return ast.TypeFromExpr(e.Type)
+	case *ast.PropagateExpr:
+		return g.exprType(e.Call)
+	}
+	return nil
+}
+
+// callType returns the type of the first result of a call
+func (g *Generator) callType(c *ast.CallExpr) *ast.TypeSpec {
+	switch fn := c.Function.(type) {
+	case *ast.Identifier:
+		if decl, ok := g.funcs[fn.Value]; ok {
+			return instantiate(firstResult(decl.ReturnType), decl.TypeParams, nil)
+		}
+		if s, ok := g.structs[fn.Value]; ok && s.Constructor != nil {
+			return &ast.TypeSpec{Name: s.Name, IsPointer: true}
+		}
+		if b, ok := g.builtinFunc(fn.Value); ok {
+			return b.result(g, c.Arguments)
+		}
+		if _, shadowed := g.lookup(fn.Value); !shadowed && basicTypes[fn.Value] {
+			return named(fn.Value)
+		}
+	case *ast.SelectorExpr:
+		if f, ok := g.moduleFunc(fn); ok {
+			return f.result(g, c.Arguments)
+		}
+		t := g.exprType(fn.Object)
+		if method, owner := g.methodOf(t, fn.Selector); method != nil {
+			return memberType(t, owner, firstResult(method.ReturnType))
+		}
+	}
+	return nil
+}
+
+func firstResult(t *ast.TypeSpec) *ast.TypeSpec {
+	if results := t.ResultTypes(); len(results) > 0 {
+		return results[0]
+	}
+	return nil
+}
+
+// structOf returns the declaration of a struct type or a pointer to one
+func (g *Generator) structOf(t *ast.TypeSpec) *ast.StructDecl {
+	if t == nil || t.IsSlice || t.IsArray || t.IsFunc || t.ValueType != nil || len(t.Tuple) > 0 {
+		return nil
+	}
+	return g.structs[t.Name]
+}
+
+// embeddedStructs returns the declaration of a struct type and those of the
+// structs embedded in it, directly or through others, shallowest first as
+// Go looks up promoted members. Each struct is listed once, as a struct can
+// embed a pointer to itself.
+func (g *Generator) embeddedStructs(t *ast.TypeSpec) []*ast.StructDecl {
+	var structs []*ast.StructDecl
+	seen := make(map[*ast.StructDecl]bool)
+	if s := g.structOf(t); s != nil {
+		structs, seen[s] = append(structs, s), true
+	}
+	for i := 0; i < len(structs); i++ {
+		for _, field := range structs[i].Fields {
+			if s := g.structOf(field.Type); field.Embedded && s != nil && !seen[s] {
+				structs, seen[s] = append(structs, s), true
+			}
+		}
+	}
+	return structs
+}
+
+// fieldOf finds a field of a struct type, including promoted fields of
+// embedded structs, and the struct that declares it
+func (g *Generator) fieldOf(t *ast.TypeSpec, name string) (*ast.Field, *ast.StructDecl) {
+	for _, s := range g.embeddedStructs(t) {
+		for _, field := range s.Fields {
+			if field.Name == name && !field.Embedded {
+				return field, s
+			}
+		}
+	}
+	return nil, nil
+}
+
+// methodOf finds a method of a struct type, including promoted methods, and
+// the struct that declares it
+func (g *Generator) methodOf(t *ast.TypeSpec, name string) (*ast.FunctionDecl, *ast.StructDecl) {
+	for _, s := range g.embeddedStructs(t) {
+		for _, method := range s.Methods {
+			if method.Name == name {
+				return method, s
+			}
+		}
+	}
+	return nil, nil
+}
+
+// memberType returns the type mt of a member of struct owner, for a value
+// of type t: the items []T of a Stack[int] are []int
+func memberType(t *ast.TypeSpec, owner *ast.StructDecl, mt *ast.TypeSpec) *ast.TypeSpec {
+	var args []*ast.TypeSpec
+	if t != nil && t.Name == owner.Name {
+		args = t.TypeArgs
+	}
+	return instantiate(mt, owner.TypeParams, args)
+}
+
+// instantiate returns type t of a generic declaration with its type
+// parameters replaced by the type arguments of a use of it. The type
+// arguments of calls of generic functions are inferred by Go and not
+// known here, so a type that mentions a type parameter without an argument
+// is unknown.
+func instantiate(t *ast.TypeSpec, params []*ast.TypeParam, args []*ast.TypeSpec) *ast.TypeSpec {
+	if t == nil || len(params) == 0 {
+		return t
+	}
+	types := make(map[string]*ast.TypeSpec)
+	for i, param := range params {
+		types[param.Name] = nil
+		if i < len(args) {
+			types[param.Name] = args[i]
+		}
+	}
+	result, ok := substitute(t, types)
+	if !ok {
+		return nil
+	}
+	return result
+}
+
+// substitute replaces the type parameters in t with their types; it fails
+// on a parameter without one
+func substitute(t *ast.TypeSpec, types map[string]*ast.TypeSpec) (*ast.TypeSpec, bool) {
+	if t == nil {
+		return nil, true
+	}
+	if arg, isParam := types[t.Name]; isParam && !t.IsSlice && !t.IsArray && len(t.TypeArgs) == 0 {
+		// T or *T
+		if arg == nil || t.IsPointer && arg.IsPointer {
+			return nil, false
+		}
+		result := *arg
+		result.IsPointer = result.IsPointer || t.IsPointer
+		return &result, true
+	}
+
+	result := *t
+	ok := true
+	one := func(t *ast.TypeSpec) *ast.TypeSpec {
+		s, substituted := substitute(t, types)
+		ok = ok && substituted
+		return s
+	}
+	list := func(types []*ast.TypeSpec) []*ast.TypeSpec {
+		var result []*ast.TypeSpec
+		for _, t := range types {
+			result = append(result, one(t))
+		}
+		return result
+	}
+	result.KeyType, result.ValueType = one(t.KeyType), one(t.ValueType)
+	result.Params, result.Results = list(t.Params), list(t.Results)
+	result.TypeArgs, result.Tuple = list(t.TypeArgs), list(t.Tuple)
+	return &result, ok
+}
+
+// elementType returns the element type of a list literal: the type of its
+// elements, with integer literals taking the numeric type of the others,
+// as in [x, 1] for a float64 x. Elements of unknown or different types,
+// and an empty list, give interface{}.
+func (g *Generator) elementType(a *ast.ArrayLiteral) *ast.TypeSpec {
+	var elem *ast.TypeSpec
+	untyped := false // elem is that of integer literals
+	for _, e := range a.Elements {
+		t := g.exprType(e)
+		_, isInt := ast.IntValue(e)
+		switch {
+		case t == nil || len(t.Tuple) > 0:
+			return named("interface{}")
+		case elem == nil, untyped && isNumeric(t):
+			elem, untyped = t, isInt
+		case t.String() == elem.String(), isInt && isNumeric(elem):
+		default:
+			return named("interface{}")
+		}
+	}
+	if elem == nil {
+		return named("interface{}")
+	}
+	return elem
+}
+
+// calleeParams returns the parameter types of the function or method of
+// the program a call calls. Types that mention the type parameters of a
+// generic function are unknown.
+func (g *Generator) calleeParams(c *ast.CallExpr) []*ast.TypeSpec {
+	var params []*ast.TypeSpec
+	switch fn := c.Function.(type) {
+	case *ast.Identifier:
+		if _, shadowed := g.lookup(fn.Value); shadowed {
+			return nil
+		}
+		if decl, ok := g.funcs[fn.Value]; ok {
+			for _, t := range paramTypes(decl.Parameters) {
+				params = append(params, instantiate(t, decl.TypeParams, nil))
+			}
+		} else if s, ok := g.structs[fn.Value]; ok && s.Constructor != nil && len(s.TypeParams) == 0 {
+			params = paramTypes(s.Constructor.Parameters)
+		}
+	case *ast.SelectorExpr:
+		t := g.exprType(fn.Object)
+		if method, owner := g.methodOf(t, fn.Selector); method != nil {
+			for _, mt := range paramTypes(method.Parameters) {
+				params = append(params, memberType(t, owner, mt))
+			}
+		}
+	}
+	return params
+}
+
+// declareAssignment records the variables declared by a := assignment
+func (g *Generator) declareAssignment(a *ast.AssignStmt) {
+	if a.Operator != ":=" {
+		return
+	}
+	switch target := a.Target.(type) {
+	case *ast.Identifier:
+		g.declare(target.Value, g.exprType(a.Value))
+	case *ast.TupleExpr:
+		results := g.resultTypes(a.Value)
+		for i, elem := range target.Elements {
+			if ident, ok := elem.(*ast.Identifier); ok {
+				var t *ast.TypeSpec
+				if i < len(results) {
+					t = results[i]
+				}
+				g.declare(ident.Value, t)
+			}
+		}
+	}
+}
+
+// resultTypes returns the result types of a call to a function of the
+// program; f()? leaves out the error
+func (g *Generator) resultTypes(expr ast.Expression) []*ast.TypeSpec {
+	propagate, ok := expr.(*ast.PropagateExpr)
+	if ok {
+		expr = propagate.Call
+	}
+	c, isCall := expr.(*ast.CallExpr)
+	if !isCall {
+		return nil
+	}
+	var results []*ast.TypeSpec
+	switch fn := c.Function.(type) {
+	case *ast.Identifier:
+		if decl, found := g.funcs[fn.Value]; found {
+			for _, t := range decl.ReturnType.ResultTypes() {
+				results = append(results, instantiate(t, decl.TypeParams, nil))
+			}
+		}
+	case *ast.SelectorExpr:
+		t := g.exprType(fn.Object)
+		if method, owner := g.methodOf(t, fn.Selector); method != nil {
+			for _, mt := range method.ReturnType.ResultTypes() {
+				results = append(results, memberType(t, owner, mt))
+			}
+		}
+	}
+	if ok && len(results) > 0 {
+		results = results[:len(results)-1]
+	}
+	return results
+}
+
+// rangeVarTypes returns the types of the variables of a for ... in loop
+func (g *Generator) rangeVarTypes(f *ast.ForStmt) (*ast.TypeSpec, *ast.TypeSpec) {
+	if c, ok := f.RangeExpr.(*ast.CallExpr); ok && g.isLoopBuiltin(c) && len(c.Arguments) > 0 {
+		switch c.Function.(*ast.Identifier).Value {
+		case "range":
+			return named("int"), nil
+		case "enumerate":
+			return named("int"), rangeValueType(g.exprType(c.Arguments[0]))
+		case "zip":
+			if len(c.Arguments) == 2 {
+				return rangeValueType(g.exprType(c.Arguments[0])), rangeValueType(g.exprType(c.Arguments[1]))
+			}
+		}
+	}
+
+	t := g.exprType(f.RangeExpr)
+	if f.ValueVar == "" && (t == nil || t.KeyType == nil) {
+		// A single variable ranges over the values, except in a map
+		return rangeValueType(t), nil
+	}
+	return rangeKeyType(t), rangeValueType(t)
+}
+
+// rangeKeyType returns the type of the first variable of a Go range loop
+// over a value of type t
+func rangeKeyType(t *ast.TypeSpec) *ast.TypeSpec {
+	switch {
+	case t == nil || t.IsPointer:
+		return nil
+	case t.KeyType != nil:
+		return t.KeyType
+	case t.IsSlice || t.IsArray || isType(t, "string"):
+		return named("int")
+	}
+	return nil
+}
+
+// rangeValueType returns the type of the second variable of a Go range loop
+// over a value of type t
+func rangeValueType(t *ast.TypeSpec) *ast.TypeSpec {
+	switch {
+	case t == nil || t.IsPointer:
+		return nil
+	case isType(t, "string"):
+		return named("rune")
+	case t.IsSlice || t.IsArray || t.KeyType != nil:
+		return t.ValueType
+	}
+	return nil
+}
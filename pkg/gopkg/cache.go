@@ -0,0 +1,76 @@
+package gopkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The cache keeps each package as JSON, at its import path within the
+// directory of the Go version and the format of the JSON, as
+// go1.22.2-2/net/http.json. A package the cache cannot read is loaded again
+// and its file replaced.
+
+// cacheFormat is the version of the JSON of Package, changed when what it
+// keeps changes
+const cacheFormat = 2
+
+// DefaultCacheDir returns the directory gos caches Go packages in, within
+// the user's cache directory, or "" when there is none
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gos", "gopkg")
+}
+
+// versionDir returns the directory of the packages of a Go version
+func versionDir(cacheDir, version string) string {
+	return filepath.Join(cacheDir, fmt.Sprintf("%s-%d", version, cacheFormat))
+}
+
+func cacheFile(dir, path string) string {
+	return filepath.Join(dir, filepath.FromSlash(path)+".json")
+}
+
+func readCache(dir, path string) *Package {
+	data, err := os.ReadFile(cacheFile(dir, path))
+	if err != nil {
+		return nil
+	}
+	var pkg Package
+	if err := json.Unmarshal(data, &pkg); err != nil || pkg.Path != path {
+		return nil
+	}
+	return &pkg
+}
+
+// writeCache stores a package in the cache, through a temporary file so
+// another gos never reads half of it. Failing to is not an error, since
+// the package is only loaded again the next time.
+func writeCache(dir string, pkg *Package) {
+	data, err := json.Marshal(pkg)
+	if err != nil {
+		return
+	}
+	file := cacheFile(dir, pkg.Path)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,275 @@
+package gopkg
+
+import (
+	"fmt"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The compiler passes references to Go packages, such as http.Get, through
+// to the generated code. To check them before Go does, a Loader reads the
+// exported names of the packages from the export data the go command
+// builds for them, and keeps what the checker and editor completion need
+// of each: its kind, its type, and for funcs the parameters and results.
+
+// Member is an exported name of a Go package
+type Member struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"` // "func", "type", "var" or "const"
+	Type     string   `json:"type"` // the Go type, with other packages by their name
+	Params   []*Param `json:"params,omitempty"`
+	Variadic bool     `json:"variadic,omitempty"` // the last parameter is ...T
+	Results  []string `json:"results,omitempty"`
+	// The import paths of the other packages the types refer to, by name
+	Imports map[string]string `json:"imports,omitempty"`
+}
+
+// Param is a parameter of an exported func
+type Param struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	// The kind of basic type the parameter has underneath: "string",
+	// "int", "float", "complex" or "bool", or "" for any other type
+	Basic string `json:"basic,omitempty"`
+}
+
+// Package is the exported API of a Go package
+type Package struct {
+	Path    string             `json:"path"`
+	Name    string             `json:"name"`
+	Members map[string]*Member `json:"members"`
+}
+
+// Lookup returns the exported member called name, or nil
+func (p *Package) Lookup(name string) *Member {
+	return p.Members[name]
+}
+
+// Names returns the names of the members in order
+func (p *Package) Names() []string {
+	names := make([]string, 0, len(p.Members))
+	for name := range p.Members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Suggest returns the member a misspelled name most likely meant: one that
+// differs only in case, or else the closest within two edits, or ""
+func (p *Package) Suggest(name string) string {
+	best, bestDist := "", 3
+	for _, candidate := range p.Names() {
+		if strings.EqualFold(candidate, name) {
+			return candidate
+		}
+		if d := editDistance(strings.ToLower(candidate), strings.ToLower(name)); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// Arity returns the least number of arguments a call to a func member
+// takes, and whether it takes more
+func (m *Member) Arity() (int, bool) {
+	if m.Variadic {
+		return len(m.Params) - 1, true
+	}
+	return len(m.Params), false
+}
+
+// Loader loads the exported API of Go packages, by import path. Packages
+// of the standard library are kept in a cache directory per Go version,
+// since reading them from export data takes the go command some time.
+type Loader struct {
+	cacheDir string // for the current Go version, or "" for no cache
+
+	mu       sync.Mutex
+	importer types.Importer
+	packages map[string]*Package
+	failed   map[string]error
+}
+
+// NewLoader returns a loader that caches packages under cacheDir, or one
+// without a cache when cacheDir is ""
+func NewLoader(cacheDir string) *Loader {
+	l := &Loader{
+		importer: importer.ForCompiler(token.NewFileSet(), "gc", nil),
+		packages: make(map[string]*Package),
+		failed:   make(map[string]error),
+	}
+	if cacheDir != "" {
+		l.cacheDir = versionDir(cacheDir, GoVersion())
+	}
+	return l
+}
+
+// Load returns the exported API of the Go package at path. The go command
+// finds the package as go build does in the current directory.
+func (l *Loader) Load(path string) (*Package, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if pkg, ok := l.packages[path]; ok {
+		return pkg, nil
+	}
+	if err, ok := l.failed[path]; ok {
+		return nil, err
+	}
+
+	cacheable := l.cacheDir != "" && isStandard(path)
+	if cacheable {
+		if pkg := readCache(l.cacheDir, path); pkg != nil {
+			l.packages[path] = pkg
+			return pkg, nil
+		}
+	}
+	imported, err := l.importer.Import(path)
+	if err != nil {
+		err = fmt.Errorf("loading Go package %q: %v", path, err)
+		l.failed[path] = err
+		return nil, err
+	}
+	pkg := newPackage(imported)
+	if cacheable {
+		writeCache(l.cacheDir, pkg)
+	}
+	l.packages[path] = pkg
+	return pkg, nil
+}
+
+var goVersion = sync.OnceValue(func() string {
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if version := strings.TrimSpace(string(out)); err == nil && version != "" {
+		return version
+	}
+	return "unknown"
+})
+
+// GoVersion returns the version of the go command that builds the
+// generated code, such as go1.22.2, which the standard library packages
+// come from
+func GoVersion() string {
+	return goVersion()
+}
+
+// isStandard reports whether path is a package of the standard library,
+// whose first element has no dot, unlike example.com/pkg
+func isStandard(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// newPackage keeps the exported API of a package the importer read
+func newPackage(imported *types.Package) *Package {
+	pkg := &Package{Path: imported.Path(), Name: imported.Name(), Members: make(map[string]*Member)}
+	var member *Member
+	qualifier := func(other *types.Package) string {
+		if other == imported {
+			return ""
+		}
+		if member.Imports == nil {
+			member.Imports = make(map[string]string)
+		}
+		member.Imports[other.Name()] = other.Path()
+		return other.Name()
+	}
+	scope := imported.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		member = &Member{Name: name}
+		member.Type = types.TypeString(obj.Type(), qualifier)
+		switch obj := obj.(type) {
+		case *types.Func:
+			member.Kind = "func"
+			sig := obj.Type().(*types.Signature)
+			member.Variadic = sig.Variadic()
+			for i := 0; i < sig.Params().Len(); i++ {
+				param := sig.Params().At(i)
+				member.Params = append(member.Params, &Param{
+					Name:  param.Name(),
+					Type:  types.TypeString(param.Type(), qualifier),
+					Basic: basicKind(param.Type()),
+				})
+			}
+			for i := 0; i < sig.Results().Len(); i++ {
+				member.Results = append(member.Results, types.TypeString(sig.Results().At(i).Type(), qualifier))
+			}
+		case *types.TypeName:
+			member.Kind = "type"
+			member.Type = underlying(obj.Type(), qualifier)
+		case *types.Var:
+			member.Kind = "var"
+		case *types.Const:
+			member.Kind = "const"
+		default:
+			continue
+		}
+		pkg.Members[name] = member
+	}
+	return pkg
+}
+
+// underlying returns the type a named type is defined as, with the fields
+// of structs and the methods of interfaces left out
+func underlying(t types.Type, qualifier types.Qualifier) string {
+	switch t.Underlying().(type) {
+	case *types.Struct:
+		return "struct{...}"
+	case *types.Interface:
+		return "interface{...}"
+	}
+	return types.TypeString(t.Underlying(), qualifier)
+}
+
+// basicKind returns the kind of basic type t has underneath, for the
+// constants a parameter of type t accepts
+func basicKind(t types.Type) string {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return ""
+	}
+	info := basic.Info()
+	switch {
+	case info&types.IsString != 0:
+		return "string"
+	case info&types.IsInteger != 0:
+		return "int"
+	case info&types.IsFloat != 0:
+		return "float"
+	case info&types.IsComplex != 0:
+		return "complex"
+	case info&types.IsBoolean != 0:
+		return "bool"
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
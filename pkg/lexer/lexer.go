@@ -1,6 +1,10 @@
 package lexer
 
-// No additional imports needed for basic lexer functionality
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 // Lexer represents the lexical analyzer
 type Lexer struct {
@@ -11,6 +15,7 @@ type Lexer struct {
 	line         int   // current line number
 	column       int   // current column number
 	indentStack  []int // stack to track indentation levels
+	errors       []string
 }
 
 // New creates a new lexer instance
@@ -43,6 +48,15 @@ func (l *Lexer) readChar() {
 	}
 }
 
+// Source returns the input between the byte offsets start and end, such
+// as the Position of two tokens
+func (l *Lexer) Source(start, end int) string {
+	if start < 0 || end > len(l.input) || start > end {
+		return ""
+	}
+	return l.input[start:end]
+}
+
 // peekChar returns the next character without advancing position
 func (l *Lexer) peekChar() byte {
 	if l.readPosition >= len(l.input) {
@@ -69,11 +83,25 @@ func (l *Lexer) skipWhitespace() {
 
 // readIdentifier reads an identifier or keyword
 func (l *Lexer) readIdentifier() string {
-	position := l.position
+	position, line := l.position, l.line
 	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	name := l.input[position:l.position]
+
+	// isLetter takes every byte of a multi-byte character; the characters
+	// themselves must be letters, and digits after the first
+	for i, r := range name {
+		if r == utf8.RuneError && !strings.HasPrefix(name[i:], string(utf8.RuneError)) {
+			l.errorf("invalid UTF-8 encoding in a name at line %d", line)
+			break
+		}
+		if r > unicode.MaxASCII && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			l.errorf("invalid character %q in a name at line %d", r, line)
+			break
+		}
+	}
+	return name
 }
 
 // readNumber reads a number (integer or float)
@@ -109,21 +137,6 @@ func (l *Lexer) readNumber() (string, TokenType) {
 	return l.input[position:l.position], tokenType
 }
 
-// readString reads a string literal
-func (l *Lexer) readString(delimiter byte) string {
-	position := l.position + 1
-	for {
-		l.readChar()
-		if l.ch == delimiter || l.ch == 0 {
-			break
-		}
-		if l.ch == '\\' {
-			l.readChar() // skip escaped character
-		}
-	}
-	return l.input[position:l.position]
-}
-
 // readComment reads a comment
 func (l *Lexer) readComment() string {
 	position := l.position
@@ -304,6 +317,12 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(BITWISE_OR, l.ch, l.line, l.column, l.position)
 	case '^':
 		tok = newToken(BITWISE_XOR, l.ch, l.line, l.column, l.position)
+	case '~':
+		tok = newToken(TILDE, l.ch, l.line, l.column, l.position)
+	case '?':
+		tok = newToken(QUESTION, l.ch, l.line, l.column, l.position)
+	case '@':
+		tok = newToken(AT, l.ch, l.line, l.column, l.position)
 	case ':':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -330,24 +349,14 @@ func (l *Lexer) NextToken() Token {
 		tok = newToken(LBRACE, l.ch, l.line, l.column, l.position)
 	case '}':
 		tok = newToken(RBRACE, l.ch, l.line, l.column, l.position)
-	case '"':
-		tok.Type = STRING
-		tok.Literal = l.readString('"')
-		tok.Line = l.line
-		tok.Column = l.column
-		tok.Position = l.position
-	case '\'':
-		tok.Type = CHAR
-		tok.Literal = l.readString('\'')
+	case '"', '\'':
+		return l.readStringToken()
+	case '#':
 		tok.Line = l.line
 		tok.Column = l.column
 		tok.Position = l.position
-	case '#':
 		tok.Type = COMMENT
 		tok.Literal = l.readComment()
-		tok.Line = l.line
-		tok.Column = l.column
-		tok.Position = l.position
 		return tok // Don't advance past comment
 	case '\n':
 		tok = newToken(NEWLINE, l.ch, l.line, l.column, l.position)
@@ -358,18 +367,21 @@ func (l *Lexer) NextToken() Token {
 		tok.Column = l.column
 		tok.Position = l.position
 	default:
-		if isLetter(l.ch) {
+		if l.stringPrefix() > 0 {
+			return l.readStringToken()
+		} else if isLetter(l.ch) {
+			// Record the start before reading, which may move onto the next line
+			tok.Line = l.line
+			tok.Column = l.column
+			tok.Position = l.position
 			tok.Literal = l.readIdentifier()
 			tok.Type = LookupIdent(tok.Literal)
-			tok.Line = l.line
-			tok.Column = l.column - len(tok.Literal)
-			tok.Position = l.position - len(tok.Literal)
 			return tok // Don't advance past identifier
 		} else if isDigit(l.ch) {
-			tok.Literal, tok.Type = l.readNumber()
 			tok.Line = l.line
-			tok.Column = l.column - len(tok.Literal)
-			tok.Position = l.position - len(tok.Literal)
+			tok.Column = l.column
+			tok.Position = l.position
+			tok.Literal, tok.Type = l.readNumber()
 			return tok // Don't advance past number
 		} else {
 			tok = newToken(ILLEGAL, l.ch, l.line, l.column, l.position)
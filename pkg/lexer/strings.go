@@ -0,0 +1,177 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// String literals follow Python: "..." and '...' hold a single line,
+// """...""" and '''...''' may span lines, an r prefix keeps backslashes as
+// they are and an f prefix makes an f-string. The token literal is the
+// decoded text, without the quotes.
+
+// stringPrefix returns the length of an r, f, rf or fr prefix (in either
+// case) that starts a string literal at the current character, or 0
+func (l *Lexer) stringPrefix() int {
+	isPrefix := func(ch byte) bool {
+		return ch == 'r' || ch == 'R' || ch == 'f' || ch == 'F'
+	}
+	isQuote := func(ch byte) bool {
+		return ch == '"' || ch == '\''
+	}
+	switch {
+	case !isPrefix(l.ch):
+		return 0
+	case isQuote(l.peekChar()):
+		return 1
+	case isPrefix(l.peekChar()) && (l.ch|0x20) != (l.peekChar()|0x20) && isQuote(l.peekCharAt(2)):
+		return 2
+	}
+	return 0
+}
+
+// readStringToken reads a string literal, with its prefix if it has one,
+// starting at the current character
+func (l *Lexer) readStringToken() Token {
+	tok := Token{Line: l.line, Column: l.column, Position: l.position}
+
+	raw, format := false, false
+	for n := l.stringPrefix(); n > 0; n-- {
+		switch l.ch {
+		case 'r', 'R':
+			raw = true
+		case 'f', 'F':
+			format = true
+		}
+		l.readChar()
+	}
+
+	switch {
+	case format:
+		tok.Type = FSTRING
+	case l.ch == '\'':
+		tok.Type = CHAR
+	default:
+		tok.Type = STRING
+	}
+	quote := l.ch
+	tok.Literal = l.readString(quote, raw)
+	if l.ch == quote {
+		l.readChar()
+	}
+	return tok
+}
+
+// readString reads a string literal that starts at the current quote and
+// leaves the lexer on the closing quote, or where the literal was cut off
+func (l *Lexer) readString(quote byte, raw bool) string {
+	line := l.line
+	triple := l.peekChar() == quote && l.peekCharAt(2) == quote
+	if triple {
+		l.readChar()
+		l.readChar()
+	}
+
+	var text strings.Builder
+	for {
+		l.readChar()
+		switch {
+		case l.ch == 0:
+			l.errorf("unterminated string starting at line %d", line)
+			return text.String()
+		case l.ch == quote && !triple:
+			return text.String()
+		case l.ch == quote && l.peekChar() == quote && l.peekCharAt(2) == quote:
+			l.readChar()
+			l.readChar()
+			return text.String()
+		case l.ch == '\n' && !triple:
+			l.errorf("unterminated string at line %d; use triple quotes for a string that spans lines", line)
+			return text.String()
+		case l.ch == '\\' && raw:
+			// A backslash still keeps the next quote from ending the string
+			text.WriteByte(l.ch)
+			if l.peekChar() == quote || l.peekChar() == '\\' {
+				l.readChar()
+				text.WriteByte(l.ch)
+			}
+		case l.ch == '\\':
+			l.readEscape(&text)
+		default:
+			text.WriteByte(l.ch)
+		}
+	}
+}
+
+// simpleEscapes are the escape sequences of a single character
+var simpleEscapes = map[byte]byte{
+	'\\': '\\', '\'': '\'', '"': '"',
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+}
+
+// readEscape decodes the escape sequence that starts at the current
+// backslash
+func (l *Lexer) readEscape(text *strings.Builder) {
+	l.readChar()
+	ch := l.ch
+
+	if c, ok := simpleEscapes[ch]; ok {
+		text.WriteByte(c)
+		return
+	}
+
+	// \x, \u and \U name a code point in hex, \0 to \777 in octal
+	digits, base := 0, 16
+	switch {
+	case ch == '\n':
+		// A backslash at the end of a line continues the string
+		return
+	case ch == 'x':
+		digits = 2
+	case ch == 'u':
+		digits = 4
+	case ch == 'U':
+		digits = 8
+	case '0' <= ch && ch <= '7':
+		base = 8
+		digits = 1
+		for digits < 3 && '0' <= l.peekCharAt(digits) && l.peekCharAt(digits) <= '7' {
+			digits++
+		}
+	default:
+		l.errorf("invalid escape sequence \\%c at line %d; use a raw string such as r\"\\d\" to keep backslashes",
+			ch, l.line)
+		text.WriteByte('\\')
+		text.WriteByte(ch)
+		return
+	}
+
+	start := l.position
+	if base == 16 {
+		start++
+	}
+	end := start + digits
+	if end > len(l.input) {
+		end = len(l.input)
+	}
+	code, err := strconv.ParseUint(l.input[start:end], base, 32)
+	if err != nil || end-start != digits || code > utf8.MaxRune {
+		l.errorf("invalid escape sequence \\%s at line %d", l.input[l.position:end], l.line)
+		return
+	}
+	for l.position < end-1 {
+		l.readChar()
+	}
+	text.WriteRune(rune(code))
+}
+
+func (l *Lexer) errorf(format string, args ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+// Errors returns the malformed string literals found so far
+func (l *Lexer) Errors() []string {
+	return l.errors
+}
@@ -12,11 +12,12 @@ const (
 	COMMENT
 
 	// Literals
-	IDENT  // identifiers
-	INT    // integers
-	FLOAT  // floating point numbers
-	STRING // string literals
-	CHAR   // character literals
+	IDENT   // identifiers
+	INT     // integers
+	FLOAT   // floating point numbers
+	STRING  // string literals
+	CHAR    // character literals
+	FSTRING // f-strings: f"Hello {name}"
 
 	// Keywords
 	AND
@@ -51,6 +52,13 @@ const (
 	SWITCH
 	TYPE
 	PACKAGE
+	PUB
+	LAMBDA
+	TRY
+	EXCEPT
+	FINALLY
+	RAISE
+	ASSERT
 
 	// Operators
 	ASSIGN    // =
@@ -78,6 +86,7 @@ const (
 	LEFT_SHIFT  // <<
 	RIGHT_SHIFT // >>
 	BIT_CLEAR   // &^
+	TILDE       // ~
 	INCREMENT   // ++
 	DECREMENT   // --
 
@@ -88,6 +97,8 @@ const (
 	DOT       // .
 	ARROW     // ->
 	CHANNEL   // <-
+	QUESTION  // ?
+	AT        // @
 
 	// Brackets
 	LPAREN   // (
@@ -136,6 +147,8 @@ func TokenTypeString(tokenType TokenType) string {
 		return "STRING"
 	case CHAR:
 		return "CHAR"
+	case FSTRING:
+		return "FSTRING"
 	case AND:
 		return "AND"
 	case OR:
@@ -200,6 +213,20 @@ func TokenTypeString(tokenType TokenType) string {
 		return "TYPE"
 	case PACKAGE:
 		return "PACKAGE"
+	case PUB:
+		return "PUB"
+	case LAMBDA:
+		return "LAMBDA"
+	case TRY:
+		return "TRY"
+	case EXCEPT:
+		return "EXCEPT"
+	case FINALLY:
+		return "FINALLY"
+	case RAISE:
+		return "RAISE"
+	case ASSERT:
+		return "ASSERT"
 	case ASSIGN:
 		return "ASSIGN"
 	case WALRUS:
@@ -242,6 +269,8 @@ func TokenTypeString(tokenType TokenType) string {
 		return "BITWISE_AND"
 	case BITWISE_OR:
 		return "BITWISE_OR"
+	case TILDE:
+		return "TILDE"
 	case BITWISE_XOR:
 		return "BITWISE_XOR"
 	case LEFT_SHIFT:
@@ -266,6 +295,10 @@ func TokenTypeString(tokenType TokenType) string {
 		return "ARROW"
 	case CHANNEL:
 		return "CHANNEL"
+	case QUESTION:
+		return "QUESTION"
+	case AT:
+		return "AT"
 	case LPAREN:
 		return "LPAREN"
 	case RPAREN:
@@ -323,6 +356,13 @@ var Keywords = map[string]TokenType{
 	"switch":    SWITCH,
 	"type":      TYPE,
 	"package":   PACKAGE,
+	"pub":       PUB,
+	"lambda":    LAMBDA,
+	"try":       TRY,
+	"except":    EXCEPT,
+	"finally":   FINALLY,
+	"raise":     RAISE,
+	"assert":    ASSERT,
 }
 
 // LookupIdent checks if an identifier is a keyword
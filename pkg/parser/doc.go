@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// Comments on the lines right above a declaration document it, as in Go:
+//
+//	# discount returns the price after the discount of a customer
+//	pub func discount(price float64, c Customer) float64:
+//
+// The code generator writes them as the Go doc comment of the generated
+// declaration. Comments on the lines above the package declaration
+// document the package. A #! line and directives such as # gos:ignore are
+// not part of the text.
+
+// docComment returns the text of the comments on the lines right above
+// line, without the # and the space after it
+func (p *Parser) docComment(line int) string {
+	var lines []string
+	for l := line - 1; ; l-- {
+		comment, ok := p.comments[l]
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(comment, "#!") {
+			continue
+		}
+		text := strings.TrimPrefix(comment, "#")
+		text = strings.TrimPrefix(text, " ")
+		if strings.HasPrefix(text, "gos:") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(text, " \t"))
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setDoc gives a top-level declaration that starts at line the comments
+// above it
+func (p *Parser) setDoc(stmt ast.Statement, line int) {
+	switch s := stmt.(type) {
+	case *ast.FunctionDecl:
+		if s != nil {
+			s.Doc = p.docComment(line)
+		}
+	case *ast.StructDecl:
+		if s != nil {
+			s.Doc = p.docComment(line)
+		}
+	case *ast.VarDecl:
+		if s != nil && ast.IsDeclaration(s) {
+			s.Doc = p.docComment(line)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+)
+
+// parseFStringLiteral splits an f-string into text and replacement fields.
+// The expression of each field is parsed by a parser of its own.
+func (p *Parser) parseFStringLiteral() ast.Expression {
+	text, line := p.curToken.Literal, p.curToken.Line
+	fstring := &ast.FStringExpr{}
+	fail := func(format string, args ...interface{}) ast.Expression {
+		p.errors = append(p.errors, fmt.Sprintf(format+" in f-string at line %d", append(args, line)...))
+		return nil
+	}
+
+	var literal strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "{{") || strings.HasPrefix(text[i:], "}}"):
+			literal.WriteByte(text[i])
+			i++
+		case text[i] == '}':
+			return fail("single '}' is not allowed; write }} for a brace")
+		case text[i] == '{':
+			if literal.Len() > 0 {
+				fstring.Parts = append(fstring.Parts, &ast.FStringPart{Text: literal.String()})
+				literal.Reset()
+			}
+			part, end, err := parseReplacementField(text, i+1)
+			if err != "" {
+				return fail("%s", err)
+			}
+			fstring.Parts = append(fstring.Parts, part)
+			i = end
+		default:
+			literal.WriteByte(text[i])
+		}
+	}
+	if literal.Len() > 0 {
+		fstring.Parts = append(fstring.Parts, &ast.FStringPart{Text: literal.String()})
+	}
+	return fstring
+}
+
+// parseReplacementField parses the field that starts after the { at start
+// and returns it with the index of its closing }
+func parseReplacementField(text string, start int) (*ast.FStringPart, int, string) {
+	// The expression ends at a colon, ! or } outside brackets and strings
+	end, depth := start, 0
+	var quote byte
+scan:
+	for ; end < len(text); end++ {
+		switch ch := text[end]; {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(' || ch == '[' || ch == '{':
+			depth++
+		case (ch == ')' || ch == ']' || ch == '}') && depth > 0:
+			depth--
+		case depth == 0 && (ch == '}' || ch == ':'):
+			break scan
+		case depth == 0 && ch == '!' && end+1 < len(text) && text[end+1] != '=':
+			break scan
+		}
+	}
+	if end == len(text) {
+		return nil, 0, "expected '}' after {" + text[start:end]
+	}
+
+	source := text[start:end]
+	if strings.TrimSpace(source) == "" {
+		return nil, 0, "empty expression {}"
+	}
+	value, err := parseEmbeddedExpression(source)
+	if err != "" {
+		return nil, 0, fmt.Sprintf("invalid expression {%s}: %s", source, err)
+	}
+	part := &ast.FStringPart{Value: value}
+
+	if text[end] == '!' {
+		if end+2 >= len(text) || !strings.ContainsRune("rsa", rune(text[end+1])) || !strings.ContainsRune(":}", rune(text[end+2])) {
+			return nil, 0, fmt.Sprintf("invalid conversion in {%s}; expected !r, !s or !a", text[start:])
+		}
+		part.Conversion = string(text[end+1])
+		end += 2
+	}
+
+	if text[end] == ':' {
+		closing := strings.IndexByte(text[end:], '}')
+		if closing < 0 {
+			return nil, 0, "expected '}' after {" + text[start:]
+		}
+		specText := text[end+1 : end+closing]
+		if strings.Contains(specText, "{") {
+			return nil, 0, fmt.Sprintf("nested replacement fields are not supported in the format spec of {%s}", text[start:end+closing])
+		}
+		spec, err := parseFormatSpec(specText)
+		if err != nil {
+			return nil, 0, err.Error()
+		}
+		part.Spec = spec
+		end += closing
+	}
+	return part, end, ""
+}
+
+// parseEmbeddedExpression parses the expression of a replacement field and
+// returns the first error in it
+func parseEmbeddedExpression(source string) (ast.Expression, string) {
+	sub := New(lexer.New(source))
+	expr := sub.parseExpression(LOWEST)
+	if errors := sub.Errors(); len(errors) > 0 {
+		return nil, errors[0]
+	}
+	if expr == nil || !sub.peekTokenIs(lexer.EOF) {
+		return nil, "unexpected " + lexer.TokenTypeString(sub.peekToken.Type)
+	}
+	return expr, ""
+}
+
+// parseFormatSpec parses a format spec such as ">10", ".2f" or ",d" and
+// rejects the combinations that no value accepts
+func parseFormatSpec(text string) (*ast.FormatSpec, error) {
+	spec := &ast.FormatSpec{Text: text, Width: -1, Precision: -1}
+	runes := []rune(text)
+	i := 0
+	isAlign := func(r rune) bool { return strings.ContainsRune("<>^=", r) }
+	switch {
+	case len(runes) >= 2 && isAlign(runes[1]):
+		spec.Fill, spec.Align = runes[0], byte(runes[1])
+		i = 2
+	case len(runes) >= 1 && isAlign(runes[0]):
+		spec.Align = byte(runes[0])
+		i = 1
+	}
+	next := func(chars string) byte {
+		if i < len(runes) && strings.ContainsRune(chars, runes[i]) {
+			i++
+			return byte(runes[i-1])
+		}
+		return 0
+	}
+	number := func() int {
+		start := i
+		for i < len(runes) && '0' <= runes[i] && runes[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return -1
+		}
+		n, _ := strconv.Atoi(string(runes[start:i]))
+		return n
+	}
+
+	spec.Sign = next("+- ")
+	spec.Alternate = next("#") != 0
+	spec.Zero = next("0") != 0
+	spec.Width = number()
+	spec.Grouping = next(",_")
+	if next(".") != 0 {
+		if spec.Precision = number(); spec.Precision < 0 {
+			return nil, fmt.Errorf("format spec %q needs a precision after the '.'", text)
+		}
+	}
+	spec.Type = next("bcdeEfFgGnosxX%")
+	if i != len(runes) {
+		return nil, fmt.Errorf("invalid format spec %q", text)
+	}
+
+	switch {
+	case spec.Precision >= 0 && strings.ContainsRune("bcdoxXn", rune(spec.Type)):
+		return nil, fmt.Errorf("format spec %q: precision is not allowed with the integer format '%c'", text, spec.Type)
+	case spec.Type == 's' && (spec.Sign != 0 || spec.Alternate || spec.Grouping != 0 || spec.Align == '='):
+		return nil, fmt.Errorf("format spec %q: sign, #, grouping and '=' alignment are not allowed with 's'", text)
+	case spec.Grouping == ',' && strings.ContainsRune("bcnoxX", rune(spec.Type)):
+		return nil, fmt.Errorf("format spec %q: ',' is not allowed with '%c'", text, spec.Type)
+	case spec.Type == 'c' && (spec.Sign != 0 || spec.Alternate || spec.Grouping != 0):
+		return nil, fmt.Errorf("format spec %q: sign, # and grouping are not allowed with 'c'", text)
+	}
+	return spec, nil
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	gotoken "go/token"
 	"strconv"
 	"strings"
 
@@ -19,6 +20,16 @@ type Parser struct {
 
 	errors []string
 
+	// indent is the column of the statements in the block being parsed;
+	// nested blocks must be indented further than this
+	indent int
+
+	// comments are the comments on lines of their own, by line, which
+	// document the declaration below them; codeLine is the line of the last
+	// token that is code
+	comments map[int]string
+	codeLine int
+
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
 }
@@ -55,15 +66,19 @@ var precedences = map[lexer.TokenType]int{
 	lexer.MODULO:   PRODUCT,
 	lexer.POWER:    PRODUCT,
 	lexer.LPAREN:   CALL,
+	lexer.LBRACE:   CALL,
 	lexer.LBRACKET: INDEX,
 	lexer.DOT:      INDEX,
+	lexer.QUESTION: INDEX,
 }
 
 // New creates a new parser instance
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:        l,
+		errors:   []string{},
+		indent:   1,
+		comments: make(map[int]string),
 	}
 
 	p.prefixParseFns = make(map[lexer.TokenType]prefixParseFn)
@@ -71,14 +86,21 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(lexer.INT, p.parseIntegerLiteral)
 	p.registerPrefix(lexer.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(lexer.STRING, p.parseStringLiteral)
+	p.registerPrefix(lexer.CHAR, p.parseStringLiteral)
+	p.registerPrefix(lexer.FSTRING, p.parseFStringLiteral)
 	p.registerPrefix(lexer.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(lexer.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(lexer.NIL, p.parseNilLiteral)
 	p.registerPrefix(lexer.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(lexer.NOT, p.parsePrefixExpression)
+	p.registerPrefix(lexer.BITWISE_AND, p.parsePrefixExpression)
 	p.registerPrefix(lexer.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(lexer.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(lexer.LBRACE, p.parseMapLiteral)
+	p.registerPrefix(lexer.FUNC, p.parseFunctionLiteral)
+	p.registerPrefix(lexer.LAMBDA, p.parseLambdaExpression)
+	p.registerPrefix(lexer.TYPE, p.parseBuiltinName)
+	p.registerPrefix(lexer.RANGE, p.parseBuiltinName)
 
 	p.infixParseFns = make(map[lexer.TokenType]infixParseFn)
 	p.registerInfix(lexer.PLUS, p.parseInfixExpression)
@@ -96,8 +118,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.AND, p.parseInfixExpression)
 	p.registerInfix(lexer.OR, p.parseInfixExpression)
 	p.registerInfix(lexer.LPAREN, p.parseCallExpression)
+	p.registerInfix(lexer.LBRACE, p.parseStructLiteral)
 	p.registerInfix(lexer.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(lexer.DOT, p.parseSelectorExpression)
+	p.registerInfix(lexer.QUESTION, p.parsePropagateExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -118,13 +142,24 @@ func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
 
-	// Skip comments
+	// Skip comments, keeping those on lines of their own for docComment
 	for p.peekToken.Type == lexer.COMMENT {
+		if p.peekToken.Line != p.codeLine {
+			p.comments[p.peekToken.Line] = p.peekToken.Literal
+		}
 		p.peekToken = p.l.NextToken()
 	}
+	switch p.peekToken.Type {
+	case lexer.NEWLINE, lexer.INDENT, lexer.DEDENT, lexer.EOF:
+	default:
+		p.codeLine = p.peekToken.Line
+	}
 }
 
 func (p *Parser) Errors() []string {
+	if lexErrors := p.l.Errors(); len(lexErrors) > 0 {
+		return append(append([]string{}, lexErrors...), p.errors...)
+	}
 	return p.errors
 }
 
@@ -157,6 +192,68 @@ func (p *Parser) expectPeek(t lexer.TokenType) bool {
 	}
 }
 
+// expectName is expectPeek(lexer.IDENT) for function and member names,
+// which may also be .gos keywords that Go allows as names, such as raise
+func (p *Parser) expectName() bool {
+	if _, ok := lexer.Keywords[p.peekToken.Literal]; ok && !gotoken.IsKeyword(p.peekToken.Literal) {
+		p.nextToken()
+		return true
+	}
+	return p.expectPeek(lexer.IDENT)
+}
+
+// curIsName reports whether curToken can be a name in the generated code:
+// an identifier, or a .gos keyword that Go allows as a name
+func (p *Parser) curIsName() bool {
+	_, keyword := lexer.Keywords[p.curToken.Literal]
+	return p.curTokenIs(lexer.IDENT) || keyword && !gotoken.IsKeyword(p.curToken.Literal)
+}
+
+// skipNewlines advances past any NEWLINE tokens following curToken
+func (p *Parser) skipNewlines() {
+	for p.peekTokenIs(lexer.NEWLINE) {
+		p.nextToken()
+	}
+}
+
+// enterBlock moves past the newlines following a block header's colon and
+// makes the indentation of the next line the current block indentation.
+// It returns the enclosing indentation, to be restored with leaveBlock.
+func (p *Parser) enterBlock() (int, bool) {
+	p.skipNewlines()
+	if p.peekTokenIs(lexer.EOF) || p.peekToken.Column <= p.indent {
+		p.errors = append(p.errors, fmt.Sprintf("expected an indented block at line %d", p.peekToken.Line))
+		return p.indent, false
+	}
+	outer := p.indent
+	p.indent = p.peekToken.Column
+	return outer, true
+}
+
+func (p *Parser) leaveBlock(outer int) {
+	p.indent = outer
+}
+
+// continueBlock is called after each statement of an indented block and
+// reports whether peekToken starts another statement of the same block
+func (p *Parser) continueBlock() bool {
+	if !p.peekTokenIs(lexer.NEWLINE) && !p.peekTokenIs(lexer.EOF) && !p.curTokenIs(lexer.NEWLINE) {
+		p.errors = append(p.errors, fmt.Sprintf("unexpected %s at line %d",
+			lexer.TokenTypeString(p.peekToken.Type), p.peekToken.Line))
+		for !p.peekTokenIs(lexer.NEWLINE) && !p.peekTokenIs(lexer.EOF) {
+			p.nextToken()
+		}
+	}
+	p.skipNewlines()
+	if p.peekTokenIs(lexer.EOF) || p.peekToken.Column < p.indent {
+		return false
+	}
+	if p.peekToken.Column > p.indent {
+		p.errors = append(p.errors, fmt.Sprintf("unexpected indent at line %d", p.peekToken.Line))
+	}
+	return true
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -176,12 +273,21 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
+	// Comments above the package declaration leave the newlines after them
+	for p.curTokenIs(lexer.NEWLINE) {
+		p.nextToken()
+	}
+
 	// Parse package declaration
 	if p.curTokenIs(lexer.PACKAGE) {
+		program.Doc = p.docComment(p.curToken.Line)
 		p.nextToken()
 		if p.curTokenIs(lexer.IDENT) {
 			program.Package = p.curToken.Literal
 			p.nextToken()
+		} else {
+			p.errors = append(p.errors, fmt.Sprintf("expected a package name, got %s at line %d",
+				lexer.TokenTypeString(p.curToken.Type), p.curToken.Line))
 		}
 	} else {
 		program.Package = "main" // default package
@@ -212,8 +318,10 @@ func (p *Parser) ParseProgram() *ast.Program {
 			continue
 		}
 
+		line := p.curToken.Line
 		stmt := p.parseStatement()
 		if stmt != nil {
+			p.setDoc(stmt, line)
 			program.Statements = append(program.Statements, stmt)
 		}
 
@@ -227,7 +335,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 }
 
 func (p *Parser) parseImportDeclaration() *ast.ImportDecl {
-	importDecl := &ast.ImportDecl{}
+	importDecl := &ast.ImportDecl{Line: p.curToken.Line}
 
 	if p.curTokenIs(lexer.FROM) {
 		// from "path" import item1, item2
@@ -235,8 +343,7 @@ func (p *Parser) parseImportDeclaration() *ast.ImportDecl {
 		if !p.curTokenIs(lexer.STRING) {
 			return nil
 		}
-		importDecl.Path = p.curToken.Literal
-		p.nextToken()
+		importDecl.Path = `"` + stdlib.GetRealPackagePath(strings.Trim(p.curToken.Literal, `"`)) + `"`
 
 		if !p.expectPeek(lexer.IMPORT) {
 			return nil
@@ -290,29 +397,15 @@ func (p *Parser) parseImportDeclaration() *ast.ImportDecl {
 			}
 		} else if p.curTokenIs(lexer.IDENT) {
 			// import os (without quotes for standard library)
-			importDecl.Path = p.curToken.Literal
-			// Convert to quoted format for standard library
-			if isStandardLibrary(p.curToken.Literal) {
-				importDecl.Path = p.curToken.Literal
-			}
+			importDecl.Path = `"` + stdlib.GetRealPackagePath(p.curToken.Literal) + `"`
 		}
 	}
 
-	return importDecl
-}
-
-// Helper function to check if a package is in Go's standard library
-func isStandardLibrary(pkg string) bool {
-	standardLibs := map[string]bool{
-		"os": true, "fmt": true, "time": true, "json": true, "math": true,
-		"strings": true, "strconv": true, "io": true, "bufio": true,
-		"net": true, "http": true, "url": true, "path": true, "filepath": true,
-		"sort": true, "sync": true, "context": true, "errors": true,
-		"log": true, "regexp": true, "crypto": true, "encoding": true,
-		"database": true, "html": true, "image": true, "mime": true,
-		"reflect": true, "runtime": true, "testing": true, "unsafe": true,
+	// Move past the last token of the import, unless it was the path
+	if !p.curTokenIs(lexer.NEWLINE) && !p.curTokenIs(lexer.EOF) {
+		p.nextToken()
 	}
-	return standardLibs[pkg]
+	return importDecl
 }
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -321,6 +414,10 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseFunctionDeclaration()
 	case lexer.STRUCT:
 		return p.parseStructDeclaration()
+	case lexer.PUB:
+		return p.parsePublicDeclaration()
+	case lexer.AT:
+		return p.parseAnnotatedDeclaration()
 	case lexer.VAR:
 		return p.parseVarDeclaration()
 	case lexer.IF:
@@ -331,6 +428,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseWhileStatement()
 	case lexer.RETURN:
 		return p.parseReturnStatement()
+	case lexer.TRY:
+		return p.parseTryStatement()
+	case lexer.RAISE:
+		return p.parseRaiseStatement()
+	case lexer.ASSERT:
+		return p.parseAssertStatement()
 	case lexer.IDENT:
 		// Check if this is a variable assignment (identifier := value or identifier = value)
 		if p.peekTokenIs(lexer.WALRUS) || p.peekTokenIs(lexer.ASSIGN) {
@@ -342,15 +445,76 @@ func (p *Parser) parseStatement() ast.Statement {
 	}
 }
 
+// parsePublicDeclaration parses "pub func" and "pub struct", which are
+// exported from the generated Go package
+func (p *Parser) parsePublicDeclaration() ast.Statement {
+	p.nextToken()
+	switch p.curToken.Type {
+	case lexer.FUNC:
+		if fn := p.parseFunctionDeclaration(); fn != nil {
+			fn.Public = true
+			return fn
+		}
+	case lexer.STRUCT:
+		if s := p.parseStructDeclaration(); s != nil {
+			s.Public = true
+			return s
+		}
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("pub must be followed by func or struct, got %s at line %d",
+			lexer.TokenTypeString(p.curToken.Type), p.curToken.Line))
+	}
+	return nil
+}
+
+// parseAnnotatedDeclaration parses a function declaration preceded by
+// annotations, one per line: @cli
+func (p *Parser) parseAnnotatedDeclaration() ast.Statement {
+	var annotations []string
+	for p.curTokenIs(lexer.AT) {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		annotations = append(annotations, p.curToken.Literal)
+		p.skipNewlines()
+		p.nextToken()
+	}
+
+	var fn *ast.FunctionDecl
+	if stmt := p.parseStatement(); stmt != nil {
+		fn, _ = stmt.(*ast.FunctionDecl)
+	}
+	if fn == nil {
+		p.errors = append(p.errors, fmt.Sprintf("@%s must be followed by a func declaration at line %d",
+			annotations[0], p.curToken.Line))
+		return nil
+	}
+	fn.Annotations = annotations
+	return fn
+}
+
 func (p *Parser) parseFunctionDeclaration() *ast.FunctionDecl {
-	stmt := &ast.FunctionDecl{}
+	stmt := &ast.FunctionDecl{Line: p.curToken.Line}
 
-	if !p.expectPeek(lexer.IDENT) {
+	if !p.expectName() {
 		return nil
 	}
 
+	// "func mut name(self)" declares a method with a pointer receiver
+	if p.curToken.Literal == "mut" && !p.peekTokenIs(lexer.LPAREN) && !p.peekTokenIs(lexer.LBRACKET) {
+		stmt.Mutating = true
+		if !p.expectName() {
+			return nil
+		}
+	}
+
 	stmt.Name = p.curToken.Literal
 
+	if p.peekTokenIs(lexer.LBRACKET) {
+		p.nextToken()
+		stmt.TypeParams = p.parseTypeParams()
+	}
+
 	if !p.expectPeek(lexer.LPAREN) {
 		return nil
 	}
@@ -362,7 +526,7 @@ func (p *Parser) parseFunctionDeclaration() *ast.FunctionDecl {
 	}
 
 	// Optional return type
-	if p.peekTokenIs(lexer.IDENT) || p.peekTokenIs(lexer.LPAREN) {
+	if p.peekTypeStart() || p.peekTokenIs(lexer.LPAREN) {
 		p.nextToken()
 		stmt.ReturnType = p.parseTypeSpec()
 	}
@@ -371,11 +535,6 @@ func (p *Parser) parseFunctionDeclaration() *ast.FunctionDecl {
 		return nil
 	}
 
-	// Skip newlines
-	for p.peekTokenIs(lexer.NEWLINE) {
-		p.nextToken()
-	}
-
 	stmt.Body = p.parseBlockStatement()
 
 	return stmt
@@ -388,27 +547,58 @@ func (p *Parser) parseFunctionParameters() []*ast.Parameter {
 		return params
 	}
 
-	p.nextToken()
+	for {
+		p.nextToken()
+		// *self asks for a pointer receiver
+		self := p.curTokenIs(lexer.MULTIPLY) && p.peekToken.Literal == "self"
+		if !p.curIsName() && !self {
+			p.errors = append(p.errors, fmt.Sprintf("expected a parameter name, got %s at line %d",
+				p.curToken.Literal, p.curToken.Line))
+		} else {
+			params = append(params, p.parseParameter())
+		}
+		if !p.peekTokenIs(lexer.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	// As in Go, parameters without a type share the type of the next one,
+	// as in (a, b int), so the last needs a type if any has one
+	for _, param := range params {
+		if last := params[len(params)-1]; param.Type != nil && last.Type == nil {
+			p.errors = append(p.errors, fmt.Sprintf("parameter %s needs a type at line %d", last.Name, p.curToken.Line))
+			break
+		}
+	}
+	return params
+}
+
+func (p *Parser) parseParameter() *ast.Parameter {
+	// "*self" asks for a pointer receiver; the receiver type is filled in
+	// by the enclosing struct
+	if p.curTokenIs(lexer.MULTIPLY) && p.peekTokenIs(lexer.IDENT) && p.peekToken.Literal == "self" {
+		p.nextToken()
+		return &ast.Parameter{Name: "self", Type: &ast.TypeSpec{IsPointer: true}}
+	}
 
 	param := &ast.Parameter{Name: p.curToken.Literal}
-	if p.peekTokenIs(lexer.IDENT) {
+	if p.peekTypeStart() {
 		p.nextToken()
 		param.Type = p.parseTypeSpec()
 	}
-	params = append(params, param)
-
-	for p.peekTokenIs(lexer.COMMA) {
+	if p.peekTokenIs(lexer.ASSIGN) {
 		p.nextToken()
 		p.nextToken()
-		param := &ast.Parameter{Name: p.curToken.Literal}
-		if p.peekTokenIs(lexer.IDENT) {
-			p.nextToken()
-			param.Type = p.parseTypeSpec()
-		}
-		params = append(params, param)
+		param.Default = p.parseExpression(LOWEST)
 	}
+	return param
+}
 
-	return params
+// peekTypeStart reports whether peekToken can begin a type specification
+func (p *Parser) peekTypeStart() bool {
+	return p.peekTokenIs(lexer.IDENT) || p.peekTokenIs(lexer.MULTIPLY) || p.peekTokenIs(lexer.LBRACKET) ||
+		p.peekTokenIs(lexer.FUNC)
 }
 
 func (p *Parser) parseTypeSpec() *ast.TypeSpec {
@@ -427,7 +617,9 @@ func (p *Parser) parseTypeSpec() *ast.TypeSpec {
 			// Slice type []T
 			typeSpec.IsSlice = true
 			p.nextToken()
-			typeSpec.ValueType = p.parseTypeSpec()
+			if typeSpec.ValueType = p.parseTypeSpec(); typeSpec.ValueType == nil {
+				return nil
+			}
 		} else {
 			// Array type [N]T
 			typeSpec.IsArray = true
@@ -439,11 +631,33 @@ func (p *Parser) parseTypeSpec() *ast.TypeSpec {
 				return nil
 			}
 			p.nextToken()
-			typeSpec.ValueType = p.parseTypeSpec()
+			if typeSpec.ValueType = p.parseTypeSpec(); typeSpec.ValueType == nil {
+				return nil
+			}
+		}
+		return typeSpec
+	}
+
+	// Handle multiple results: (int, error)
+	if p.curTokenIs(lexer.LPAREN) {
+		p.nextToken()
+		typeSpec.Tuple = []*ast.TypeSpec{p.parseTypeSpec()}
+		for p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			typeSpec.Tuple = append(typeSpec.Tuple, p.parseTypeSpec())
+		}
+		if !p.expectPeek(lexer.RPAREN) || hasNilType(typeSpec.Tuple) {
+			return nil
 		}
 		return typeSpec
 	}
 
+	// Handle function types: func(int, string) bool
+	if p.curTokenIs(lexer.FUNC) {
+		return p.parseFuncType(typeSpec)
+	}
+
 	// Handle map types
 	if p.curTokenIs(lexer.IDENT) && p.curToken.Literal == "map" {
 		if !p.expectPeek(lexer.LBRACKET) {
@@ -451,21 +665,180 @@ func (p *Parser) parseTypeSpec() *ast.TypeSpec {
 		}
 		p.nextToken()
 		typeSpec.KeyType = p.parseTypeSpec()
-		if !p.expectPeek(lexer.RBRACKET) {
+		if typeSpec.KeyType == nil || !p.expectPeek(lexer.RBRACKET) {
 			return nil
 		}
 		p.nextToken()
-		typeSpec.ValueType = p.parseTypeSpec()
+		if typeSpec.ValueType = p.parseTypeSpec(); typeSpec.ValueType == nil {
+			return nil
+		}
 		return typeSpec
 	}
 
-	// Basic type
+	// Basic type, possibly qualified with a package name (time.Time)
+	if !p.curIsName() {
+		p.errors = append(p.errors, fmt.Sprintf("expected a type, got %s at line %d",
+			lexer.TokenTypeString(p.curToken.Type), p.curToken.Line))
+		return nil
+	}
 	typeSpec.Name = p.curToken.Literal
+	if p.peekTokenIs(lexer.DOT) {
+		p.nextToken()
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		typeSpec.Name += "." + p.curToken.Literal
+	}
+
+	// Type arguments of a generic struct: Stack[int], Pair[string, int]
+	if p.peekTokenIs(lexer.LBRACKET) {
+		p.nextToken()
+		p.nextToken()
+		if typeSpec.TypeArgs = p.parseTypeList(); typeSpec.TypeArgs == nil {
+			return nil
+		}
+	}
+	return typeSpec
+}
+
+// parseTypeParams parses the type parameters of a generic function or
+// struct, [T, U] or [K comparable, N ~int | ~float64], with curToken on
+// the [
+func (p *Parser) parseTypeParams() []*ast.TypeParam {
+	params := []*ast.TypeParam{}
+	for {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		param := &ast.TypeParam{Name: p.curToken.Literal}
+		if !p.peekTokenIs(lexer.COMMA) && !p.peekTokenIs(lexer.RBRACKET) {
+			p.nextToken()
+			param.Constraint = p.parseConstraint()
+		}
+		params = append(params, param)
+		if !p.peekTokenIs(lexer.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(lexer.RBRACKET) {
+		return nil
+	}
+
+	// As in Go, [K, V comparable] gives K the constraint of V
+	for i := len(params) - 2; i >= 0; i-- {
+		if params[i].Constraint == nil {
+			params[i].Constraint = params[i+1].Constraint
+		}
+	}
+	return params
+}
+
+// parseConstraint parses a union of constraint terms: any, comparable,
+// int | string or ~int | ~float64
+func (p *Parser) parseConstraint() []*ast.ConstraintTerm {
+	var terms []*ast.ConstraintTerm
+	for {
+		term := &ast.ConstraintTerm{}
+		if p.curTokenIs(lexer.TILDE) {
+			term.Tilde = true
+			p.nextToken()
+		}
+		term.Type = p.parseTypeSpec()
+		terms = append(terms, term)
+		if !p.peekTokenIs(lexer.BITWISE_OR) {
+			break
+		}
+		p.nextToken()
+		p.nextToken()
+	}
+	return terms
+}
+
+// typeParamTypes returns the type parameters as type arguments, for the
+// receiver of a generic struct's methods: Stack[T]
+func typeParamTypes(params []*ast.TypeParam) []*ast.TypeSpec {
+	var types []*ast.TypeSpec
+	for _, param := range params {
+		types = append(types, &ast.TypeSpec{Name: param.Name})
+	}
+	return types
+}
+
+// parseTypeList parses comma-separated types up to the closing ], with
+// curToken on the first type. It returns nil if a type failed to parse.
+func (p *Parser) parseTypeList() []*ast.TypeSpec {
+	types := []*ast.TypeSpec{p.parseTypeSpec()}
+	failed := types[0] == nil
+	for p.peekTokenIs(lexer.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		t := p.parseTypeSpec()
+		failed = failed || t == nil
+		types = append(types, t)
+	}
+	if !p.expectPeek(lexer.RBRACKET) || failed {
+		return nil
+	}
+	return types
+}
+
+// parseFuncType parses the parameter and result types of a function type,
+// with curToken on the func keyword
+func (p *Parser) parseFuncType(typeSpec *ast.TypeSpec) *ast.TypeSpec {
+	typeSpec.IsFunc = true
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+	if !p.peekTokenIs(lexer.RPAREN) {
+		p.nextToken()
+		typeSpec.Params = append(typeSpec.Params, p.parseTypeSpec())
+		for p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			typeSpec.Params = append(typeSpec.Params, p.parseTypeSpec())
+		}
+	}
+	if !p.expectPeek(lexer.RPAREN) || hasNilType(typeSpec.Params) {
+		return nil
+	}
+
+	// Results: a single type or a parenthesized list
+	if p.peekTypeStart() {
+		p.nextToken()
+		typeSpec.Results = []*ast.TypeSpec{p.parseTypeSpec()}
+	} else if p.peekTokenIs(lexer.LPAREN) {
+		p.nextToken()
+		for {
+			p.nextToken()
+			typeSpec.Results = append(typeSpec.Results, p.parseTypeSpec())
+			if !p.peekTokenIs(lexer.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(lexer.RPAREN) {
+			return nil
+		}
+	}
+	if hasNilType(typeSpec.Results) {
+		return nil
+	}
 	return typeSpec
 }
 
+// hasNilType reports whether a type of types failed to parse
+func hasNilType(types []*ast.TypeSpec) bool {
+	for _, t := range types {
+		if t == nil {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseStructDeclaration() *ast.StructDecl {
-	stmt := &ast.StructDecl{}
+	stmt := &ast.StructDecl{Line: p.curToken.Line}
 
 	if !p.expectPeek(lexer.IDENT) {
 		return nil
@@ -473,50 +846,119 @@ func (p *Parser) parseStructDeclaration() *ast.StructDecl {
 
 	stmt.Name = p.curToken.Literal
 
+	if p.peekTokenIs(lexer.LBRACKET) {
+		p.nextToken()
+		stmt.TypeParams = p.parseTypeParams()
+	}
+
 	if !p.expectPeek(lexer.COLON) {
 		return nil
 	}
 
-	// Skip newlines
-	for p.peekTokenIs(lexer.NEWLINE) {
-		p.nextToken()
+	outer, ok := p.enterBlock()
+	if !ok {
+		return stmt
 	}
+	defer p.leaveBlock(outer)
+
+	// Parse fields, embedded types and methods
+	for {
+		p.nextToken()
 
-	// Parse fields
-	for !p.curTokenIs(lexer.EOF) && p.curTokenIs(lexer.IDENT) || p.curTokenIs(lexer.FUNC) {
-		if p.curTokenIs(lexer.NEWLINE) {
+		line := p.curToken.Line
+		public := false
+		if p.curTokenIs(lexer.PUB) {
+			public = true
 			p.nextToken()
-			continue
 		}
 
-		if p.curTokenIs(lexer.FUNC) {
-			// Method declaration
+		switch {
+		case p.curTokenIs(lexer.FUNC):
 			method := p.parseFunctionDeclaration()
-			if method != nil {
-				// Add receiver
-				method.Receiver = &ast.Parameter{
-					Name: "self",
-					Type: &ast.TypeSpec{Name: stmt.Name},
+			if method == nil {
+				break
+			}
+			method.Public = public
+			method.Doc = p.docComment(line)
+			if len(method.TypeParams) > 0 {
+				p.errors = append(p.errors, fmt.Sprintf("method %s.%s cannot have type parameters at line %d",
+					stmt.Name, method.Name, p.curToken.Line))
+			}
+			// The explicit self parameter becomes the receiver; mut and
+			// *self make it a pointer receiver
+			pointer := method.Mutating
+			if len(method.Parameters) > 0 && method.Parameters[0].Name == "self" {
+				if self := method.Parameters[0]; self.Type != nil && self.Type.IsPointer && self.Type.Name == "" {
+					pointer = true
 				}
-				stmt.Methods = append(stmt.Methods, method)
+				method.Parameters = method.Parameters[1:]
 			}
-		} else if p.curTokenIs(lexer.IDENT) {
+			if method.Name == "init" {
+				// func init(self, ...) is the constructor, generated as NewName(...).
+				// It always works on a pointer, so mut is redundant there.
+				method.Mutating = false
+				stmt.Constructor = method
+				break
+			}
+			method.Receiver = &ast.Parameter{
+				Name: "self",
+				Type: &ast.TypeSpec{Name: stmt.Name, IsPointer: pointer, TypeArgs: typeParamTypes(stmt.TypeParams)},
+			}
+			stmt.Methods = append(stmt.Methods, method)
+		case p.curTokenIs(lexer.MULTIPLY),
+			p.curTokenIs(lexer.IDENT) && (p.peekTokenIs(lexer.NEWLINE) || p.peekTokenIs(lexer.EOF) || p.peekTokenIs(lexer.DOT)):
+			// Embedded field: Animal, *Animal or sync.Mutex
+			if public {
+				p.errors = append(p.errors, fmt.Sprintf("embedded field in struct %s cannot be pub at line %d",
+					stmt.Name, p.curToken.Line))
+			}
+			field := &ast.Field{Embedded: true, Doc: p.docComment(line), Line: line, Type: p.parseTypeSpec()}
+			if field.Type != nil {
+				field.Name = embeddedFieldName(field.Type)
+				p.parseFieldTag(field)
+				stmt.Fields = append(stmt.Fields, field)
+			}
+		case p.curTokenIs(lexer.IDENT):
 			// Field declaration
-			field := &ast.Field{Name: p.curToken.Literal}
+			field := &ast.Field{Name: p.curToken.Literal, Public: public, Doc: p.docComment(line), Line: line}
 			p.nextToken()
-			if p.curTokenIs(lexer.IDENT) {
-				field.Type = p.parseTypeSpec()
-			}
+			field.Type = p.parseTypeSpec()
+			p.parseFieldTag(field)
 			stmt.Fields = append(stmt.Fields, field)
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("unexpected %s in struct %s at line %d",
+				lexer.TokenTypeString(p.curToken.Type), stmt.Name, p.curToken.Line))
+		}
+
+		if !p.continueBlock() {
+			break
 		}
-		p.nextToken()
 	}
 
 	return stmt
 }
 
+// parseFieldTag parses an optional struct tag after a field type, written
+// as a string: name string 'json:"full_name,omitempty"'
+func (p *Parser) parseFieldTag(field *ast.Field) {
+	if p.peekTokenIs(lexer.CHAR) || p.peekTokenIs(lexer.STRING) {
+		p.nextToken()
+		field.Tag = p.curToken.Literal
+	}
+}
+
+// embeddedFieldName returns the implicit field name of an embedded type,
+// which is the unqualified type name without the pointer
+func embeddedFieldName(t *ast.TypeSpec) string {
+	name := t.Name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
 func (p *Parser) parseVarDeclaration() *ast.VarDecl {
-	stmt := &ast.VarDecl{}
+	stmt := &ast.VarDecl{Line: p.curToken.Line}
 
 	if p.curTokenIs(lexer.VAR) {
 		// var name type = value OR var name = value
@@ -525,7 +967,7 @@ func (p *Parser) parseVarDeclaration() *ast.VarDecl {
 		}
 		stmt.Name = p.curToken.Literal
 
-		if p.peekTokenIs(lexer.IDENT) {
+		if p.peekTypeStart() {
 			// var name type = value
 			p.nextToken()
 			stmt.Type = p.parseTypeSpec()
@@ -539,6 +981,10 @@ func (p *Parser) parseVarDeclaration() *ast.VarDecl {
 			p.nextToken()
 			p.nextToken()
 			stmt.Value = p.parseExpression(LOWEST)
+		} else {
+			p.errors = append(p.errors, fmt.Sprintf("var %s at line %d needs a type or a value",
+				stmt.Name, p.curToken.Line))
+			return nil
 		}
 	} else if p.curTokenIs(lexer.IDENT) {
 		// name := value (walrus operator) or name = value (assignment)
@@ -560,7 +1006,8 @@ func (p *Parser) parseVarDeclaration() *ast.VarDecl {
 }
 
 func (p *Parser) parseIfStatement() *ast.IfStmt {
-	stmt := &ast.IfStmt{}
+	stmt := &ast.IfStmt{Line: p.curToken.Line}
+	column := p.curToken.Column
 
 	p.nextToken()
 	stmt.Condition = p.parseExpression(LOWEST)
@@ -569,15 +1016,10 @@ func (p *Parser) parseIfStatement() *ast.IfStmt {
 		return nil
 	}
 
-	// Skip newlines
-	for p.peekTokenIs(lexer.NEWLINE) {
-		p.nextToken()
-	}
-
 	stmt.ThenBranch = p.parseBlockStatement()
 
-	// Handle elif/else
-	if p.peekTokenIs(lexer.ELIF) || p.peekTokenIs(lexer.ELSE) {
+	// Handle elif/else, which must line up with the if they belong to
+	if (p.peekTokenIs(lexer.ELIF) || p.peekTokenIs(lexer.ELSE)) && p.peekToken.Column == column {
 		p.nextToken()
 		if p.curTokenIs(lexer.ELIF) {
 			stmt.ElseBranch = p.parseIfStatement()
@@ -586,10 +1028,6 @@ func (p *Parser) parseIfStatement() *ast.IfStmt {
 			if !p.expectPeek(lexer.COLON) {
 				return nil
 			}
-			// Skip newlines
-			for p.peekTokenIs(lexer.NEWLINE) {
-				p.nextToken()
-			}
 			stmt.ElseBranch = p.parseBlockStatement()
 		}
 	}
@@ -598,25 +1036,45 @@ func (p *Parser) parseIfStatement() *ast.IfStmt {
 }
 
 func (p *Parser) parseForStatement() *ast.ForStmt {
-	stmt := &ast.ForStmt{}
+	stmt := &ast.ForStmt{Line: p.curToken.Line}
 
 	p.nextToken()
 
-	// Check for range-based for loop
-	if p.peekTokenIs(lexer.IN) {
-		stmt.IsRange = true
+	// Check for range-based for loop: "for x in xs" or "for i, x in xs"
+	if p.curTokenIs(lexer.IDENT) && p.peekTokenIs(lexer.COMMA) {
 		stmt.RangeVar = p.curToken.Literal
-		p.nextToken() // consume 'in'
 		p.nextToken()
-		stmt.RangeExpr = p.parseExpression(LOWEST)
-	} else {
-		// Traditional for loop
-		stmt.Init = p.parseStatement()
-		if !p.expectPeek(lexer.SEMICOLON) {
+		if !p.expectPeek(lexer.IDENT) {
 			return nil
 		}
-		p.nextToken()
-		stmt.Condition = p.parseExpression(LOWEST)
+		stmt.ValueVar = p.curToken.Literal
+		if !p.peekTokenIs(lexer.IN) {
+			p.errors = append(p.errors, fmt.Sprintf("expected in after for %s, %s at line %d",
+				stmt.RangeVar, stmt.ValueVar, p.curToken.Line))
+			return nil
+		}
+	}
+	if p.peekTokenIs(lexer.IN) {
+		stmt.IsRange = true
+		if stmt.ValueVar == "" {
+			if !p.curTokenIs(lexer.IDENT) {
+				p.errors = append(p.errors, fmt.Sprintf("expected a loop variable after for, got %s at line %d",
+					lexer.TokenTypeString(p.curToken.Type), p.curToken.Line))
+				return nil
+			}
+			stmt.RangeVar = p.curToken.Literal
+		}
+		p.nextToken() // consume 'in'
+		p.nextToken()
+		stmt.RangeExpr = p.parseExpression(LOWEST)
+	} else {
+		// Traditional for loop
+		stmt.Init = p.parseStatement()
+		if !p.expectPeek(lexer.SEMICOLON) {
+			return nil
+		}
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
 		if !p.expectPeek(lexer.SEMICOLON) {
 			return nil
 		}
@@ -628,18 +1086,13 @@ func (p *Parser) parseForStatement() *ast.ForStmt {
 		return nil
 	}
 
-	// Skip newlines
-	for p.peekTokenIs(lexer.NEWLINE) {
-		p.nextToken()
-	}
-
 	stmt.Body = p.parseBlockStatement()
 
 	return stmt
 }
 
 func (p *Parser) parseWhileStatement() *ast.WhileStmt {
-	stmt := &ast.WhileStmt{}
+	stmt := &ast.WhileStmt{Line: p.curToken.Line}
 
 	p.nextToken()
 	stmt.Condition = p.parseExpression(LOWEST)
@@ -648,18 +1101,88 @@ func (p *Parser) parseWhileStatement() *ast.WhileStmt {
 		return nil
 	}
 
-	// Skip newlines
-	for p.peekTokenIs(lexer.NEWLINE) {
+	stmt.Body = p.parseBlockStatement()
+
+	return stmt
+}
+
+func (p *Parser) parseReturnStatement() *ast.ReturnStmt {
+	stmt := &ast.ReturnStmt{Line: p.curToken.Line}
+
+	if !p.peekTokenIs(lexer.NEWLINE) && !p.peekTokenIs(lexer.EOF) {
+		p.nextToken()
+		stmt.Value = p.parseTuple(p.parseExpression(LOWEST))
+	}
+
+	return stmt
+}
+
+// parseTuple continues a comma-separated list of expressions after first,
+// returning first alone if there is no comma
+func (p *Parser) parseTuple(first ast.Expression) ast.Expression {
+	if !p.peekTokenIs(lexer.COMMA) {
+		return first
+	}
+	tuple := &ast.TupleExpr{Elements: []ast.Expression{first}}
+	for p.peekTokenIs(lexer.COMMA) {
 		p.nextToken()
+		p.nextToken()
+		tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
 	}
+	return tuple
+}
+
+// parseTryStatement parses try: with its except and finally clauses, which
+// must line up with the try
+func (p *Parser) parseTryStatement() *ast.TryStmt {
+	stmt := &ast.TryStmt{Line: p.curToken.Line}
+	line, column := p.curToken.Line, p.curToken.Column
 
+	if !p.expectPeek(lexer.COLON) {
+		return nil
+	}
 	stmt.Body = p.parseBlockStatement()
 
+	for p.peekTokenIs(lexer.EXCEPT) && p.peekToken.Column == column {
+		p.nextToken()
+		clause := &ast.ExceptClause{}
+
+		// except:, except ErrType:, except ErrType as e:
+		if !p.peekTokenIs(lexer.COLON) {
+			p.nextToken()
+			clause.Type = p.parseTypeSpec()
+			if p.peekTokenIs(lexer.IDENT) && p.peekToken.Literal == "as" {
+				p.nextToken()
+				if !p.expectPeek(lexer.IDENT) {
+					return nil
+				}
+				clause.Name = p.curToken.Literal
+			}
+		}
+		if !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+		clause.Body = p.parseBlockStatement()
+		stmt.Handlers = append(stmt.Handlers, clause)
+	}
+
+	if p.peekTokenIs(lexer.FINALLY) && p.peekToken.Column == column {
+		p.nextToken()
+		if !p.expectPeek(lexer.COLON) {
+			return nil
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+
+	if len(stmt.Handlers) == 0 && stmt.Finally == nil {
+		p.errors = append(p.errors, fmt.Sprintf("try at line %d needs an except or finally clause", line))
+	}
+
 	return stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStmt {
-	stmt := &ast.ReturnStmt{}
+func (p *Parser) parseRaiseStatement() *ast.RaiseStmt {
+	stmt := &ast.RaiseStmt{Line: p.curToken.Line}
 
 	if !p.peekTokenIs(lexer.NEWLINE) && !p.peekTokenIs(lexer.EOF) {
 		p.nextToken()
@@ -669,42 +1192,194 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStmt {
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStmt {
-	stmt := &ast.ExpressionStmt{}
-	stmt.Expression = p.parseExpression(LOWEST)
+// parseAssertStatement parses assert cond and assert cond, message
+func (p *Parser) parseAssertStatement() *ast.AssertStmt {
+	stmt := &ast.AssertStmt{Line: p.curToken.Line}
+
+	if p.peekTokenIs(lexer.NEWLINE) || p.peekTokenIs(lexer.EOF) {
+		p.errors = append(p.errors, fmt.Sprintf("assert at line %d needs a condition", stmt.Line))
+		return stmt
+	}
+	p.nextToken()
+	start := p.curToken.Position
+	stmt.Condition = p.parseExpression(LOWEST)
+	p.assertSource(stmt, start)
+	if p.peekTokenIs(lexer.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Message = p.parseExpression(LOWEST)
+	}
+
 	return stmt
 }
 
+// comparisonTokens are the operators of the conditions whose operands an
+// assert reports
+var comparisonTokens = map[lexer.TokenType]bool{
+	lexer.EQ: true, lexer.NOT_EQ: true, lexer.LT: true, lexer.LT_EQ: true, lexer.GT: true, lexer.GT_EQ: true,
+}
+
+// assertSource records the source of the condition of an assert, which
+// starts at the byte offset start and ends before peekToken, and of the
+// operands of a comparison. The comparison is the last operator outside
+// brackets, since comparisons are left-associative.
+func (p *Parser) assertSource(stmt *ast.AssertStmt, start int) {
+	text := p.l.Source(start, p.peekToken.Position)
+	depth, split := 0, -1
+	operator := ""
+	l := lexer.New(text)
+scan:
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case lexer.COMMENT:
+			text = text[:tok.Position]
+			break scan
+		case lexer.LPAREN, lexer.LBRACKET, lexer.LBRACE:
+			depth++
+		case lexer.RPAREN, lexer.RBRACKET, lexer.RBRACE:
+			depth--
+		default:
+			if depth == 0 && comparisonTokens[tok.Type] {
+				split, operator = tok.Position, tok.Literal
+			}
+		}
+	}
+
+	stmt.Source = strings.TrimSpace(text)
+	if b, ok := stmt.Condition.(*ast.BinaryExpr); ok && split >= 0 && b.Operator == operator {
+		stmt.Operands = []string{strings.TrimSpace(text[:split]), strings.TrimSpace(text[split+len(operator):])}
+	}
+}
+
+var assignOperators = map[lexer.TokenType]bool{
+	lexer.ASSIGN:   true,
+	lexer.PLUS_EQ:  true,
+	lexer.MINUS_EQ: true,
+	lexer.MULT_EQ:  true,
+	lexer.DIV_EQ:   true,
+	lexer.MOD_EQ:   true,
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
+	line := p.curToken.Line
+	expr := p.parseExpression(LOWEST)
+
+	// Multiple assignment: a, b = b, a or value, err := f()
+	if p.peekTokenIs(lexer.COMMA) {
+		target := p.parseTuple(expr)
+		if !p.peekTokenIs(lexer.ASSIGN) && !p.peekTokenIs(lexer.WALRUS) {
+			// Elements that failed to parse have been reported already
+			for _, elem := range target.(*ast.TupleExpr).Elements {
+				if elem == nil {
+					return nil
+				}
+			}
+			p.errors = append(p.errors, fmt.Sprintf("expected = or := after %s at line %d",
+				target.String(), p.curToken.Line))
+			return nil
+		}
+		for _, elem := range target.(*ast.TupleExpr).Elements {
+			if !p.checkAssignable(elem) {
+				return nil
+			}
+		}
+		p.nextToken()
+		stmt := &ast.AssignStmt{Target: target, Operator: p.curToken.Literal, Line: line}
+		p.nextToken()
+		stmt.Value = p.parseTuple(p.parseExpression(LOWEST))
+		return stmt
+	}
+
+	// Assignment to an arbitrary target: self.name = value, items[i] += 1, count++
+	if assignOperators[p.peekToken.Type] {
+		if !p.checkAssignable(expr) {
+			return nil
+		}
+		p.nextToken()
+		stmt := &ast.AssignStmt{Target: expr, Operator: p.curToken.Literal, Line: line}
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+		return stmt
+	}
+	if p.peekTokenIs(lexer.INCREMENT) || p.peekTokenIs(lexer.DECREMENT) {
+		if !p.checkAssignable(expr) {
+			return nil
+		}
+		p.nextToken()
+		return &ast.AssignStmt{Target: expr, Operator: p.curToken.Literal, Line: line}
+	}
+
+	return &ast.ExpressionStmt{Expression: expr, Line: line}
+}
+
+// checkAssignable reports whether target can be assigned to: a variable,
+// a field or an element. A target that failed to parse has been reported
+// already.
+func (p *Parser) checkAssignable(target ast.Expression) bool {
+	switch target.(type) {
+	case nil:
+		return false
+	case *ast.Identifier, *ast.SelectorExpr, *ast.IndexExpr:
+		return true
+	}
+	p.errors = append(p.errors, fmt.Sprintf("cannot assign to %s at line %d", target.String(), p.curToken.Line))
+	// The rest of the statement has no error of its own to report
+	for !p.peekTokenIs(lexer.NEWLINE) && !p.peekTokenIs(lexer.EOF) {
+		p.nextToken()
+	}
+	return false
+}
+
+// parseBlockStatement parses the body following a block header's colon,
+// either a single statement on the same line or an indented block. On
+// return curToken is the last token of the block, so callers can look at
+// peekToken for a continuation such as elif or else.
 func (p *Parser) parseBlockStatement() *ast.BlockStmt {
 	block := &ast.BlockStmt{}
 	block.Statements = []ast.Statement{}
 
-	// Parse all statements until we hit EOF or a function declaration
-	for !p.curTokenIs(lexer.EOF) {
-		// Skip newlines
-		if p.curTokenIs(lexer.NEWLINE) {
-			p.nextToken()
-			continue
+	// Single-line body: "if x: return y"
+	if !p.peekTokenIs(lexer.NEWLINE) && !p.peekTokenIs(lexer.EOF) {
+		p.nextToken()
+		if stmt := p.parseBlockItem(); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
 		}
+		return block
+	}
 
-		// Stop if we encounter another function (top-level)
-		if p.curTokenIs(lexer.FUNC) {
-			break
-		}
+	outer, ok := p.enterBlock()
+	if !ok {
+		return block
+	}
+	defer p.leaveBlock(outer)
 
-		stmt := p.parseStatement()
-		if stmt != nil {
+	for {
+		p.nextToken()
+		if stmt := p.parseBlockItem(); stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
-
-		if !p.curTokenIs(lexer.EOF) {
-			p.nextToken()
+		if !p.continueBlock() {
+			break
 		}
 	}
 
 	return block
 }
 
+// parseBlockItem parses a statement of a block. Go only declares functions
+// at the top level, so a named function in a block is an error.
+func (p *Parser) parseBlockItem() ast.Statement {
+	if !p.curTokenIs(lexer.FUNC) || p.peekTokenIs(lexer.LPAREN) {
+		return p.parseStatement()
+	}
+	line := p.curToken.Line
+	if fn := p.parseFunctionDeclaration(); fn != nil {
+		p.errors = append(p.errors, fmt.Sprintf("func %s at line %d: functions are declared at the top level; in a block, use a func literal, as in %s := func(...):",
+			fn.Name, line, fn.Name))
+	}
+	return nil
+}
+
 // Expression parsing methods
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -713,7 +1388,12 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
+	// An expression with a part that failed to parse fails as a whole; the
+	// error is reported where the part failed
 	leftExp := prefix()
+	if leftExp == nil {
+		return nil
+	}
 
 	for !p.peekTokenIs(lexer.NEWLINE) && !p.peekTokenIs(lexer.EOF) && !p.peekTokenIs(lexer.INDENT) && !p.peekTokenIs(lexer.DEDENT) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -722,7 +1402,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		}
 
 		p.nextToken()
-		leftExp = infix(leftExp)
+		if leftExp = infix(leftExp); leftExp == nil {
+			return nil
+		}
 	}
 
 	return leftExp
@@ -732,6 +1414,17 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Value: p.curToken.Literal}
 }
 
+// parseBuiltinName parses the builtins type() and range(), whose names are
+// keywords, as identifiers
+func (p *Parser) parseBuiltinName() ast.Expression {
+	if !p.peekTokenIs(lexer.LPAREN) {
+		p.errors = append(p.errors, fmt.Sprintf("%s must be called, as in %s(x), at line %d",
+			p.curToken.Literal, p.curToken.Literal, p.curToken.Line))
+		return nil
+	}
+	return &ast.Identifier{Value: p.curToken.Literal}
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.Literal{Type: "int"}
 
@@ -779,6 +1472,9 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 	p.nextToken()
 	expression.Operand = p.parseExpression(PREFIX)
+	if expression.Operand == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -792,6 +1488,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	precedence := p.curPrecedence()
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
+	if expression.Right == nil {
+		return nil
+	}
 
 	return expression
 }
@@ -809,15 +1508,78 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	array := &ast.ArrayLiteral{}
-	array.Elements = p.parseExpressionList(lexer.RBRACKET)
+	array := &ast.ArrayLiteral{Elements: []ast.Expression{}}
+
+	p.skipNewlines()
+	if p.peekTokenIs(lexer.RBRACKET) {
+		p.nextToken()
+		return array
+	}
+
+	p.nextToken()
+	first := p.parseExpression(LOWEST)
+	p.skipNewlines()
+	if first != nil && p.peekTokenIs(lexer.FOR) {
+		return p.parseComprehension(&ast.ComprehensionExpr{Kind: "list", Value: first}, lexer.RBRACKET)
+	}
+
+	if array.Elements = p.parseRestOfList(first, lexer.RBRACKET); array.Elements == nil {
+		return nil
+	}
 	return array
 }
 
+// parseComprehension parses the for and if clauses of a comprehension, up
+// to the closing token end
+func (p *Parser) parseComprehension(c *ast.ComprehensionExpr, end lexer.TokenType) ast.Expression {
+	for p.peekTokenIs(lexer.FOR) {
+		p.nextToken()
+		clause := &ast.ComprehensionClause{}
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		clause.RangeVar = p.curToken.Literal
+		if p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+			if !p.expectPeek(lexer.IDENT) {
+				return nil
+			}
+			clause.ValueVar = p.curToken.Literal
+		}
+		if !p.expectPeek(lexer.IN) {
+			return nil
+		}
+		p.nextToken()
+		if clause.Iterable = p.parseExpression(LOWEST); clause.Iterable == nil {
+			return nil
+		}
+		p.skipNewlines()
+
+		for p.peekTokenIs(lexer.IF) {
+			p.nextToken()
+			p.nextToken()
+			condition := p.parseExpression(LOWEST)
+			if condition == nil {
+				return nil
+			}
+			clause.Conditions = append(clause.Conditions, condition)
+			p.skipNewlines()
+		}
+		c.Clauses = append(c.Clauses, clause)
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+	return c
+}
+
 func (p *Parser) parseMapLiteral() ast.Expression {
 	mapLit := &ast.MapLiteral{}
 	mapLit.Pairs = []ast.MapPair{}
 
+	// Map literals may span several lines
+	p.skipNewlines()
 	if p.peekTokenIs(lexer.RBRACE) {
 		p.nextToken()
 		return mapLit
@@ -825,20 +1587,38 @@ func (p *Parser) parseMapLiteral() ast.Expression {
 
 	p.nextToken()
 
-	for {
+	for first := true; ; first = false {
 		key := p.parseExpression(LOWEST)
+		if key == nil {
+			return nil
+		}
+		p.skipNewlines()
+		if first && p.peekTokenIs(lexer.FOR) {
+			return p.parseComprehension(&ast.ComprehensionExpr{Kind: "set", Value: key}, lexer.RBRACE)
+		}
 		if !p.expectPeek(lexer.COLON) {
 			return nil
 		}
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
 
+		p.skipNewlines()
+		if first && p.peekTokenIs(lexer.FOR) {
+			return p.parseComprehension(&ast.ComprehensionExpr{Kind: "map", Key: key, Value: value}, lexer.RBRACE)
+		}
 		mapLit.Pairs = append(mapLit.Pairs, ast.MapPair{Key: key, Value: value})
 
 		if !p.peekTokenIs(lexer.COMMA) {
 			break
 		}
 		p.nextToken()
+		p.skipNewlines()
+		if p.peekTokenIs(lexer.RBRACE) {
+			break // trailing comma
+		}
 		p.nextToken()
 	}
 
@@ -849,17 +1629,191 @@ func (p *Parser) parseMapLiteral() ast.Expression {
 	return mapLit
 }
 
+// parseStructLiteral parses a composite literal following a type name:
+// Person{name: "Alice", age: 30} or Person{"Alice", 30}
+func (p *Parser) parseStructLiteral(typeName ast.Expression) ast.Expression {
+	switch typeName.(type) {
+	case *ast.Identifier, *ast.SelectorExpr, *ast.IndexExpr, *ast.InstantiationExpr:
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("unexpected { at line %d", p.curToken.Line))
+		return nil
+	}
+
+	lit := &ast.StructLiteral{Type: typeName}
+
+	p.skipNewlines()
+	if p.peekTokenIs(lexer.RBRACE) {
+		p.nextToken()
+		return lit
+	}
+
+	failed := false
+	for {
+		p.nextToken()
+		if p.curTokenIs(lexer.IDENT) && p.peekTokenIs(lexer.COLON) {
+			name := p.curToken.Literal
+			p.nextToken()
+			p.nextToken()
+			value := p.parseExpression(LOWEST)
+			failed = failed || value == nil
+			lit.Fields = append(lit.Fields, ast.FieldValue{Name: name, Value: value})
+		} else {
+			value := p.parseExpression(LOWEST)
+			failed = failed || value == nil
+			lit.Values = append(lit.Values, value)
+		}
+
+		p.skipNewlines()
+		if !p.peekTokenIs(lexer.COMMA) {
+			break
+		}
+		p.nextToken()
+		p.skipNewlines()
+		if p.peekTokenIs(lexer.RBRACE) {
+			break // trailing comma
+		}
+	}
+
+	if !p.expectPeek(lexer.RBRACE) || failed {
+		return nil
+	}
+
+	if len(lit.Fields) > 0 && len(lit.Values) > 0 {
+		p.errors = append(p.errors, fmt.Sprintf("mixture of field:value and value initializers in %s literal",
+			typeName.String()))
+	}
+
+	return lit
+}
+
+// parseFunctionLiteral parses an anonymous function used as a value:
+// func(x int) int: followed by a single-line or indented body
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{}
+
+	if !p.expectPeek(lexer.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(lexer.RPAREN) {
+		return nil
+	}
+
+	if p.peekTypeStart() || p.peekTokenIs(lexer.LPAREN) {
+		p.nextToken()
+		lit.ReturnType = p.parseTypeSpec()
+	}
+
+	if !p.expectPeek(lexer.COLON) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseLambdaExpression parses lambda x, y: x + y. Parameters may carry
+// types (lambda x int: x * 2); otherwise they come from context.
+func (p *Parser) parseLambdaExpression() ast.Expression {
+	lambda := &ast.LambdaExpr{Parameters: []*ast.Parameter{}}
+
+	if !p.peekTokenIs(lexer.COLON) {
+		if !p.expectPeek(lexer.IDENT) {
+			return nil
+		}
+		lambda.Parameters = append(lambda.Parameters, p.parseParameter())
+		for p.peekTokenIs(lexer.COMMA) {
+			p.nextToken()
+			if !p.expectPeek(lexer.IDENT) {
+				return nil
+			}
+			lambda.Parameters = append(lambda.Parameters, p.parseParameter())
+		}
+	}
+
+	if !p.expectPeek(lexer.COLON) {
+		return nil
+	}
+	p.nextToken()
+	if lambda.Body = p.parseExpression(LOWEST); lambda.Body == nil {
+		return nil
+	}
+
+	return lambda
+}
+
 func (p *Parser) parseCallExpression(fn ast.Expression) ast.Expression {
 	exp := &ast.CallExpr{Function: fn}
-	exp.Arguments = p.parseExpressionList(lexer.RPAREN)
+
+	// The type make and new take first, where it cannot be read as an
+	// expression: make([]int, n), make(map[string]int), new(*T)
+	if ident, ok := fn.(*ast.Identifier); ok && (ident.Value == "make" || ident.Value == "new") &&
+		(p.peekTokenIs(lexer.LBRACKET) || p.peekTokenIs(lexer.MULTIPLY) || p.peekTokenIs(lexer.FUNC) ||
+			p.peekTokenIs(lexer.IDENT) && p.peekToken.Literal == "map") {
+		p.nextToken()
+		t := p.parseTypeSpec()
+		if t == nil {
+			return nil
+		}
+		if exp.Arguments = p.parseRestOfList(&ast.TypeExpr{Type: t}, lexer.RPAREN); exp.Arguments == nil {
+			return nil
+		}
+		return exp
+	}
+
+	if exp.Arguments = p.parseExpressionList(lexer.RPAREN); exp.Arguments == nil {
+		return nil
+	}
 	return exp
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	// Type arguments that cannot be read as an index: f[[]int], f[*T],
+	// f[map[string]int], f[func()]
+	if p.peekTokenIs(lexer.LBRACKET) || p.peekTokenIs(lexer.MULTIPLY) || p.peekTokenIs(lexer.FUNC) ||
+		p.peekTokenIs(lexer.IDENT) && p.peekToken.Literal == "map" {
+		p.nextToken()
+		if args := p.parseTypeList(); args != nil {
+			return &ast.InstantiationExpr{Object: left, TypeArgs: args}
+		}
+		return nil
+	}
+
 	exp := &ast.IndexExpr{Object: left}
 
+	// A slice without a lower bound: xs[:n], xs[::-1]
+	if p.peekTokenIs(lexer.COLON) {
+		return p.parseSliceExpression(left, nil)
+	}
+
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
+	if exp.Index == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(lexer.COLON) {
+		return p.parseSliceExpression(left, exp.Index)
+	}
+
+	// Several type arguments: Pair[string, int]
+	if p.peekTokenIs(lexer.COMMA) {
+		first := ast.TypeFromExpr(exp.Index)
+		if first == nil {
+			p.errors = append(p.errors, fmt.Sprintf("expected a type argument, got %s at line %d",
+				exp.Index.String(), p.curToken.Line))
+			return nil
+		}
+		p.nextToken()
+		p.nextToken()
+		if args := p.parseTypeList(); args != nil {
+			return &ast.InstantiationExpr{Object: left, TypeArgs: append([]*ast.TypeSpec{first}, args...)}
+		}
+		return nil
+	}
 
 	if !p.expectPeek(lexer.RBRACKET) {
 		return nil
@@ -868,35 +1822,92 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseSliceExpression parses the rest of xs[low:high:step] from the token
+// before the first colon. Any of the bounds may be left out.
+func (p *Parser) parseSliceExpression(object, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpr{Object: object, Low: low}
+
+	p.nextToken() // the first colon
+	if !p.peekTokenIs(lexer.COLON) && !p.peekTokenIs(lexer.RBRACKET) {
+		p.nextToken()
+		exp.High = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(lexer.COLON) {
+		p.nextToken()
+		if !p.peekTokenIs(lexer.RBRACKET) {
+			p.nextToken()
+			exp.Step = p.parseExpression(LOWEST)
+		}
+	}
+
+	if !p.expectPeek(lexer.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+// parsePropagateExpression parses the ? that follows a call
+func (p *Parser) parsePropagateExpression(left ast.Expression) ast.Expression {
+	if _, ok := left.(*ast.CallExpr); !ok {
+		p.errors = append(p.errors, fmt.Sprintf("? must follow a call, got %s at line %d",
+			left.String(), p.curToken.Line))
+		return nil
+	}
+	return &ast.PropagateExpr{Call: left}
+}
+
 func (p *Parser) parseSelectorExpression(left ast.Expression) ast.Expression {
 	exp := &ast.SelectorExpr{Object: left}
 
-	if !p.expectPeek(lexer.IDENT) {
+	if !p.expectName() {
 		return nil
 	}
 
 	exp.Selector = p.curToken.Literal
+	if lit, ok := left.(*ast.Literal); ok && (lit.Type == "int" || lit.Type == "float") {
+		p.errors = append(p.errors, fmt.Sprintf("a number has no fields or methods: %s at line %d",
+			exp.String(), p.curToken.Line))
+		return nil
+	}
 	return exp
 }
 
 func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
 	args := []ast.Expression{}
 
+	p.skipNewlines()
 	if p.peekTokenIs(end) {
 		p.nextToken()
 		return args
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	return p.parseRestOfList(p.parseExpression(LOWEST), end)
+}
+
+// parseRestOfList parses the elements of a list that follow the first one,
+// up to the closing token end. It returns nil if an element failed to parse.
+func (p *Parser) parseRestOfList(first ast.Expression, end lexer.TokenType) []ast.Expression {
+	args := []ast.Expression{first}
+	failed := first == nil
 
+	// Argument lists may span several lines, for example after a
+	// multi-line func literal
+	p.skipNewlines()
 	for p.peekTokenIs(lexer.COMMA) {
 		p.nextToken()
+		p.skipNewlines()
+		if p.peekTokenIs(end) {
+			break // trailing comma
+		}
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		arg := p.parseExpression(LOWEST)
+		failed = failed || arg == nil
+		args = append(args, arg)
+		p.skipNewlines()
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectPeek(end) || failed {
 		return nil
 	}
 
@@ -110,6 +110,21 @@ var ImportAliases = map[string]string{
 	"utf16":   "unicode/utf16",
 }
 
+// AutoImports are the Go packages a program can use without importing
+// them, by the name it refers to them with
+var AutoImports = map[string]string{
+	"bufio":   "bufio",
+	"errors":  "errors",
+	"flag":    "flag",
+	"fmt":     "fmt",
+	"math":    "math",
+	"os":      "os",
+	"reflect": "reflect",
+	"strconv": "strconv",
+	"strings": "strings",
+	"time":    "time",
+}
+
 // GetRealPackagePath returns the actual Go package path for a given alias
 // If no alias exists, returns the original name
 func GetRealPackagePath(alias string) string {
@@ -22,8 +22,12 @@ var Builtins = map[string]*BuiltinFunction{
 	"println":     {Name: "println", Fn: Println},
 	"printf":      {Name: "printf", Fn: Printf},
 	"input":       {Name: "input", Fn: Input},
+	"args":        {Name: "args", Fn: Args},
+	"exit":        {Name: "exit", Fn: Exit},
 	"len":         {Name: "len", Fn: Len},
 	"range":       {Name: "range", Fn: Range},
+	"enumerate":   {Name: "enumerate", Fn: Enumerate},
+	"zip":         {Name: "zip", Fn: Zip},
 	"str":         {Name: "str", Fn: Str},
 	"int":         {Name: "int", Fn: Int},
 	"float":       {Name: "float", Fn: Float},
@@ -103,6 +107,23 @@ func Len(args ...interface{}) interface{} {
 	}
 }
 
+// Args returns the command-line arguments without the program name
+func Args(args ...interface{}) interface{} {
+	return append([]string{}, os.Args[1:]...)
+}
+
+// Exit ends the program with the exit code, which defaults to 0
+func Exit(args ...interface{}) interface{} {
+	code := 0
+	if len(args) > 0 {
+		if n, ok := args[0].(int); ok {
+			code = n
+		}
+	}
+	os.Exit(code)
+	return nil
+}
+
 // Range generates a range of numbers
 func Range(args ...interface{}) interface{} {
 	switch len(args) {
@@ -147,6 +168,51 @@ func Range(args ...interface{}) interface{} {
 	}
 }
 
+// Enumerate pairs each element of a slice with its index, counting from
+// the optional second argument
+func Enumerate(args ...interface{}) interface{} {
+	if len(args) < 1 || len(args) > 2 {
+		panic("enumerate() takes 1 or 2 arguments")
+	}
+	start := 0
+	if len(args) == 2 {
+		start = toInt(args[1])
+	}
+	v := reflect.ValueOf(args[0])
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		panic(fmt.Sprintf("'%T' object is not iterable", args[0]))
+	}
+	result := make([][]interface{}, v.Len())
+	for i := range result {
+		result[i] = []interface{}{start + i, v.Index(i).Interface()}
+	}
+	return result
+}
+
+// Zip pairs up the elements of slices at the same index, stopping at the
+// end of the shortest one
+func Zip(args ...interface{}) interface{} {
+	values := make([]reflect.Value, len(args))
+	n := -1
+	for i, arg := range args {
+		values[i] = reflect.ValueOf(arg)
+		if values[i].Kind() != reflect.Slice && values[i].Kind() != reflect.Array {
+			panic(fmt.Sprintf("'%T' object is not iterable", arg))
+		}
+		if n < 0 || values[i].Len() < n {
+			n = values[i].Len()
+		}
+	}
+	result := make([][]interface{}, max(n, 0))
+	for i := range result {
+		result[i] = make([]interface{}, len(values))
+		for j, v := range values {
+			result[i][j] = v.Index(i).Interface()
+		}
+	}
+	return result
+}
+
 // Str converts a value to string
 func Str(args ...interface{}) interface{} {
 	if len(args) != 1 {
@@ -0,0 +1,218 @@
+package vet
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/checker"
+)
+
+// The checks gos vet runs unless told otherwise
+func init() {
+	Register(&Check{
+		ID:       "unused-variable",
+		Severity: Error,
+		Doc:      "local variables that are declared but never read, which Go does not compile",
+		Run:      unusedVariables,
+	})
+	Register(&Check{
+		ID:       "unused-import",
+		Severity: Warning,
+		Doc:      "imports the program never refers to",
+		Run:      unusedImports,
+	})
+	Register(&Check{
+		ID:       "shadow",
+		Severity: Warning,
+		Doc:      "variables declared with := that hide a variable of an enclosing scope which is used after them",
+		Run:      shadowedVariables,
+	})
+	Register(&Check{
+		ID:       "unreachable",
+		Severity: Warning,
+		Doc:      "statements after a return, raise or panic that never run",
+		Run:      unreachableCode,
+	})
+	Register(&Check{
+		ID:       "list-compare",
+		Severity: Error,
+		Doc:      "== and != on lists, which are Go slices that Go only compares with nil",
+		Run:      listComparisons,
+	})
+	Register(&Check{
+		ID:       "value-receiver",
+		Severity: Warning,
+		Doc:      "assignments to fields of self in methods with a value receiver, which only change a copy",
+		Run:      valueReceivers,
+	})
+	Register(&Check{
+		ID:       "missing-return",
+		Severity: Error,
+		Doc:      "functions with a return type that can reach the end of their body",
+		Run:      missingReturns,
+	})
+}
+
+func unusedVariables(pass *Pass) {
+	for _, v := range pass.resolved().vars {
+		if !v.param && !v.used {
+			pass.Reportf(v.line, "%s is declared but never used", v.name)
+		}
+	}
+}
+
+// unusedImports and valueReceivers report what the checker warns about,
+// which gos vet leaves out of what it reports from the checker
+func unusedImports(pass *Pass) {
+	checker.UnusedImports(pass.Program, func(line int, msg string) {
+		pass.Reportf(line, "%s", msg)
+	})
+}
+
+// shadowedVariables reports a := that hides a variable only when the
+// hidden one is used after it, since the program then likely meant to
+// assign to it
+func shadowedVariables(pass *Pass) {
+	for _, v := range pass.resolved().vars {
+		if v.walrus && v.shadows != nil && v.shadows.lastUse > v.line {
+			pass.Reportf(v.line, "%s := hides the %s declared at line %d, which is used after it at line %d; use = to assign to it",
+				v.name, v.name, v.shadows.line, v.shadows.lastUse)
+		}
+	}
+}
+
+func unreachableCode(pass *Pass) {
+	check := func(stmts []ast.Statement) {
+		for i, stmt := range stmts[:max(len(stmts)-1, 0)] {
+			if terminates(stmt) {
+				pass.Reportf(firstLine(stmts[i+1]), "unreachable code after the %s at line %d", describe(stmt), firstLine(stmt))
+				return
+			}
+		}
+	}
+	check(pass.Program.Script())
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		if block, ok := node.(*ast.BlockStmt); ok {
+			check(block.Statements)
+		}
+		return true
+	})
+}
+
+func listComparisons(pass *Pass) {
+	for _, c := range pass.resolved().comparisons {
+		if (c.left || c.right) && !isNil(c.expr.Left) && !isNil(c.expr.Right) {
+			pass.Reportf(c.line, "%s %s %s compares lists, which are Go slices that Go only compares with nil; use reflect.DeepEqual",
+				c.expr.Left, c.expr.Operator, c.expr.Right)
+		}
+	}
+}
+
+func valueReceivers(pass *Pass) {
+	ast.Inspect(pass.Program, func(node ast.Node) bool {
+		fn, ok := node.(*ast.FunctionDecl)
+		if !ok || fn.Receiver == nil {
+			return true
+		}
+		checker.ValueReceiverAssignments(fn, func(line int, msg string) {
+			pass.Reportf(line, "%s", msg)
+		})
+		return false
+	})
+}
+
+func missingReturns(pass *Pass) {
+	ast.InspectLines(pass.Program, func(node ast.Node, line int) bool {
+		switch fn := node.(type) {
+		case *ast.FunctionDecl:
+			if fn.ReturnType != nil && fn.Body != nil && !terminates(fn.Body) {
+				name := fn.Name
+				if fn.Receiver != nil {
+					name = fn.Receiver.Type.Name + "." + name
+				}
+				pass.Reportf(line, "func %s returns %s but can reach the end of its body without a return", name, fn.ReturnType)
+			}
+		case *ast.FunctionLiteral:
+			if fn.ReturnType != nil && fn.Body != nil && !terminates(fn.Body) {
+				pass.Reportf(line, "the func literal returns %s but can reach the end of its body without a return", fn.ReturnType)
+			}
+		}
+		return true
+	})
+}
+
+// terminates reports whether a statement always leaves the function or
+// try body it is in: a return, a raise, a call to panic, or an if, block
+// or try whose every way through ends in one. Loops do not, since Go does
+// not count a loop with a condition, such as a while True, as leaving.
+func terminates(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.ReturnStmt, *ast.RaiseStmt:
+		return true
+	case *ast.ExpressionStmt:
+		return isPanic(s)
+	case *ast.BlockStmt:
+		return s != nil && len(s.Statements) > 0 && terminates(s.Statements[len(s.Statements)-1])
+	case *ast.IfStmt:
+		return s.ElseBranch != nil && terminates(s.ThenBranch) && terminates(s.ElseBranch)
+	case *ast.TryStmt:
+		// An error no except clause handles is raised again
+		if s.Finally != nil && terminates(s.Finally) {
+			return true
+		}
+		if !terminates(s.Body) {
+			return false
+		}
+		for _, h := range s.Handlers {
+			if !terminates(h.Body) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func isPanic(stmt *ast.ExpressionStmt) bool {
+	call, ok := stmt.Expression.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "panic"
+}
+
+// describe names a statement that terminates, for messages
+func describe(stmt ast.Statement) string {
+	switch s := stmt.(type) {
+	case *ast.ReturnStmt:
+		return "return"
+	case *ast.RaiseStmt:
+		return "raise"
+	case *ast.ExpressionStmt:
+		return "panic"
+	case *ast.BlockStmt:
+		return describe(s.Statements[len(s.Statements)-1])
+	case *ast.IfStmt:
+		return "if statement, whose branches all leave,"
+	case *ast.TryStmt:
+		return "try statement, which always leaves,"
+	}
+	return "statement"
+}
+
+func isNil(expr ast.Expression) bool {
+	lit, ok := expr.(*ast.Literal)
+	return ok && lit.Type == "nil"
+}
+
+// firstLine returns the line a statement starts on, or that of the first
+// statement in it with a line
+func firstLine(stmt ast.Statement) int {
+	line := 0
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		if s, ok := node.(ast.Statement); ok && line == 0 {
+			line = ast.Line(s)
+		}
+		return line == 0
+	})
+	return line
+}
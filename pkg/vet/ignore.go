@@ -0,0 +1,62 @@
+package vet
+
+import (
+	"strings"
+
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+)
+
+// ignorePrefix starts a comment that leaves out diagnostics
+const ignorePrefix = "gos:ignore"
+
+// Ignored returns the IDs of the checks whose diagnostics # gos:ignore
+// comments in source leave out, by line. A comment after code applies to
+// its own line, and a comment on a line of its own to the next line with
+// code.
+func Ignored(source string) map[int]map[string]bool {
+	ignored := make(map[int]map[string]bool)
+	add := func(line int, ids []string) {
+		if ignored[line] == nil {
+			ignored[line] = make(map[string]bool)
+		}
+		for _, id := range ids {
+			ignored[line][id] = true
+		}
+	}
+
+	l := lexer.New(source)
+	codeLine := 0        // the line of the last token that is code
+	var pending []string // the IDs of comments on lines of their own
+	for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case lexer.COMMENT:
+			ids := ignoreIDs(tok.Literal)
+			if tok.Line == codeLine {
+				add(tok.Line, ids)
+			} else {
+				pending = append(pending, ids...)
+			}
+		case lexer.NEWLINE, lexer.INDENT, lexer.DEDENT:
+		default:
+			codeLine = tok.Line
+			if pending != nil {
+				add(tok.Line, pending)
+				pending = nil
+			}
+		}
+	}
+	return ignored
+}
+
+// ignoreIDs returns the check IDs of a # gos:ignore comment, separated by
+// commas or spaces, or nil for any other comment
+func ignoreIDs(comment string) []string {
+	text := strings.TrimSpace(strings.TrimPrefix(comment, "#"))
+	rest, ok := strings.CutPrefix(text, ignorePrefix)
+	if !ok || rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		return nil
+	}
+	return strings.FieldsFunc(rest, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
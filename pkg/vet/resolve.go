@@ -0,0 +1,313 @@
+package vet
+
+import (
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// The checks of variables need to know which declaration a name refers to.
+// resolve follows the scopes of the generated Go code: a function body and
+// its parameters, and each block, loop and except clause within it. The
+// top-level statements that run when the program starts are the body of a
+// function of their own.
+
+// variable is a local variable or parameter
+type variable struct {
+	name    string
+	line    int
+	param   bool      // a parameter, or a name gos uses itself, which may go unused
+	list    bool      // holds a list, which is generated as a Go slice
+	walrus  bool      // declared with :=
+	used    bool      // read somewhere, which assigning to it is not
+	shadows *variable // the variable of an enclosing scope with the same name
+	lastUse int       // the line it is last mentioned on
+}
+
+// scope is a block of a function, where names are declared
+type scope struct {
+	parent *scope
+	vars   map[string]*variable
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, vars: make(map[string]*variable)}
+}
+
+func (s *scope) lookup(name string) *variable {
+	for ; s != nil; s = s.parent {
+		if v := s.vars[name]; v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// comparison is an == or != whose operands may be lists
+type comparison struct {
+	expr        *ast.BinaryExpr
+	line        int
+	left, right bool // the operand is a list
+}
+
+// resolver holds what resolve finds out about the names of a program
+type resolver struct {
+	vars        []*variable // in the order they are declared
+	uses        map[*ast.Identifier]*variable
+	comparisons []comparison
+	line        int // the line of the statement being resolved
+}
+
+// resolve finds the local variables of a program and where they are used
+func resolve(program *ast.Program) *resolver {
+	r := &resolver{uses: make(map[*ast.Identifier]*variable)}
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionDecl:
+			if s != nil {
+				r.function(nil, s, s.Parameters, s.Body)
+			}
+		case *ast.StructDecl:
+			if s == nil {
+				continue
+			}
+			// The constructor has a self too, which is not a parameter
+			if s.Constructor != nil {
+				self := &ast.Parameter{Name: "self"}
+				r.function(nil, s.Constructor, append([]*ast.Parameter{self}, s.Constructor.Parameters...), s.Constructor.Body)
+			}
+			for _, method := range s.Methods {
+				r.function(nil, method, append([]*ast.Parameter{method.Receiver}, method.Parameters...), method.Body)
+			}
+		}
+	}
+	r.function(nil, nil, nil, &ast.BlockStmt{Statements: program.Script()})
+	return r
+}
+
+// function resolves a function body, in a scope of its own within parent
+func (r *resolver) function(parent *scope, decl *ast.FunctionDecl, params []*ast.Parameter, body *ast.BlockStmt) {
+	if decl != nil {
+		r.line = decl.Line
+	}
+	s := newScope(parent)
+	for _, param := range params {
+		if param != nil {
+			r.declare(s, param.Name, false).param = true
+		}
+	}
+	if body != nil {
+		r.block(s, body.Statements)
+	}
+}
+
+// declare declares a name in a scope, or returns its variable if the scope
+// has it already, as := does for the names of x, err := f() that exist
+func (r *resolver) declare(s *scope, name string, list bool) *variable {
+	if name == "" || name == "_" {
+		return &variable{}
+	}
+	if v := s.vars[name]; v != nil {
+		return v
+	}
+	v := &variable{name: name, line: r.line, list: list, lastUse: r.line}
+	v.shadows = s.parent.lookup(name)
+	s.vars[name] = v
+	r.vars = append(r.vars, v)
+	return v
+}
+
+// mention records that a name is read, or assigned when used is false
+func (r *resolver) mention(s *scope, ident *ast.Identifier, used bool) {
+	v := s.lookup(ident.Value)
+	if v == nil {
+		return
+	}
+	v.lastUse = r.line
+	if used {
+		v.used = true
+		r.uses[ident] = v
+	}
+}
+
+func (r *resolver) block(s *scope, stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.stmt(s, stmt)
+	}
+}
+
+func (r *resolver) stmt(s *scope, stmt ast.Statement) {
+	if line := ast.Line(stmt); line > 0 {
+		r.line = line
+	}
+	switch st := stmt.(type) {
+	case *ast.BlockStmt:
+		if st != nil {
+			r.block(newScope(s), st.Statements)
+		}
+	case *ast.VarDecl:
+		r.expr(s, st.Value)
+		if st.Type == nil && !st.IsWalrus {
+			r.mention(s, &ast.Identifier{Value: st.Name}, false)
+			return
+		}
+		r.declare(s, st.Name, declaresList(st.Type, st.Value)).walrus = st.IsWalrus
+	case *ast.AssignStmt:
+		r.expr(s, st.Value)
+		targets := []ast.Expression{st.Target}
+		if tuple, ok := st.Target.(*ast.TupleExpr); ok {
+			targets = tuple.Elements
+		}
+		for _, target := range targets {
+			ident, ok := target.(*ast.Identifier)
+			switch {
+			case ok && st.Operator == ":=":
+				r.declare(s, ident.Value, len(targets) == 1 && declaresList(nil, st.Value)).walrus = true
+			case ok:
+				r.mention(s, ident, false)
+			default:
+				r.expr(s, target)
+			}
+		}
+	case *ast.IfStmt:
+		r.expr(s, st.Condition)
+		r.stmt(s, st.ThenBranch)
+		if st.ElseBranch != nil {
+			r.stmt(newScope(s), st.ElseBranch)
+		}
+	case *ast.ForStmt:
+		loop := newScope(s)
+		if st.IsRange {
+			r.expr(s, st.RangeExpr)
+			// for i in range(n) is a counting loop, whose condition uses i
+			r.declare(loop, st.RangeVar, false).param = isRangeCall(st.RangeExpr)
+			r.declare(loop, st.ValueVar, false)
+		} else {
+			if st.Init != nil {
+				r.stmt(loop, st.Init)
+			}
+			r.expr(loop, st.Condition)
+			if st.Update != nil {
+				r.stmt(loop, st.Update)
+			}
+		}
+		if st.Body != nil {
+			r.block(newScope(loop), st.Body.Statements)
+		}
+	case *ast.WhileStmt:
+		r.expr(s, st.Condition)
+		if st.Body != nil {
+			r.block(newScope(s), st.Body.Statements)
+		}
+	case *ast.ReturnStmt:
+		r.expr(s, st.Value)
+	case *ast.ExpressionStmt:
+		r.expr(s, st.Expression)
+	case *ast.RaiseStmt:
+		r.expr(s, st.Value)
+	case *ast.AssertStmt:
+		r.expr(s, st.Condition)
+		r.expr(s, st.Message)
+	case *ast.TryStmt:
+		r.stmt(s, st.Body)
+		for _, h := range st.Handlers {
+			// The generated code uses the name of the error itself
+			handler := newScope(s)
+			r.declare(handler, h.Name, false).param = true
+			if h.Body != nil {
+				r.block(handler, h.Body.Statements)
+			}
+		}
+		if st.Finally != nil {
+			r.stmt(s, st.Finally)
+		}
+	}
+}
+
+// expr resolves the names in an expression. Func literals, lambdas and
+// comprehensions declare names of their own.
+func (r *resolver) expr(s *scope, expr ast.Expression) {
+	if expr == nil {
+		return
+	}
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			r.mention(s, n, true)
+		case *ast.StructLiteral:
+			// The type is not a variable
+			for _, field := range n.Fields {
+				r.expr(s, field.Value)
+			}
+			for _, value := range n.Values {
+				r.expr(s, value)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			r.function(s, nil, n.Parameters, n.Body)
+			return false
+		case *ast.LambdaExpr:
+			lambda := newScope(s)
+			for _, param := range n.Parameters {
+				r.declare(lambda, param.Name, false).param = true
+			}
+			r.expr(lambda, n.Body)
+			return false
+		case *ast.ComprehensionExpr:
+			comp := newScope(s)
+			for _, clause := range n.Clauses {
+				r.expr(comp, clause.Iterable)
+				r.declare(comp, clause.RangeVar, false)
+				r.declare(comp, clause.ValueVar, false)
+				for _, cond := range clause.Conditions {
+					r.expr(comp, cond)
+				}
+			}
+			r.expr(comp, n.Key)
+			r.expr(comp, n.Value)
+			return false
+		case *ast.BinaryExpr:
+			if n.Operator == "==" || n.Operator == "!=" {
+				r.comparisons = append(r.comparisons, comparison{
+					expr:  n,
+					line:  r.line,
+					left:  r.isList(s, n.Left),
+					right: r.isList(s, n.Right),
+				})
+			}
+		}
+		return true
+	})
+}
+
+// isList reports whether an expression is a list, which is generated as a
+// Go slice
+func (r *resolver) isList(s *scope, expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.ArrayLiteral:
+		return true
+	case *ast.Identifier:
+		v := s.lookup(e.Value)
+		return v != nil && v.list
+	}
+	return false
+}
+
+func isRangeCall(expr ast.Expression) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == "range"
+}
+
+// declaresList reports whether a variable declared with a type and a value
+// holds a list: it has the type []interface{} or []any, or no type and a
+// list literal for its value
+func declaresList(t *ast.TypeSpec, value ast.Expression) bool {
+	if t == nil {
+		_, ok := value.(*ast.ArrayLiteral)
+		return ok
+	}
+	return t.IsSlice && t.ValueType != nil && t.ValueType.IsNamed() &&
+		(t.ValueType.Name == "interface{}" || t.ValueType.Name == "any")
+}
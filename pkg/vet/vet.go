@@ -0,0 +1,135 @@
+package vet
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+)
+
+// gos vet looks for likely mistakes in programs that parse and pass the
+// checker. Each kind of mistake is found by a Check, which has an ID such
+// as unused-variable, and reports Diagnostics at lines of the .gos file.
+// Checks are registered with Register, so tools built on gos can add their
+// own. A comment of the form
+//
+//	# gos:ignore unused-variable, shadow
+//
+// at the end of a line leaves out the diagnostics of those checks on that
+// line, and on a line of its own, those on the next line.
+
+// Severity tells how serious a diagnostic is
+type Severity int
+
+const (
+	// Warning is code that compiles but likely does not do what was meant
+	Warning Severity = iota
+	// Error is code that the Go compiler rejects once it is generated
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a problem a check found
+type Diagnostic struct {
+	Check    string // the ID of the check
+	Severity Severity
+	Line     int
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s: %s [%s]", d.Line, d.Severity, d.Message, d.Check)
+}
+
+// Check finds one kind of mistake
+type Check struct {
+	ID       string // a name for the mistake, as in # gos:ignore ID
+	Severity Severity
+	Doc      string // a sentence on what the check reports
+	Run      func(pass *Pass)
+}
+
+// checks are the registered checks in order of registration
+var checks []*Check
+
+// Register adds a check to the checks gos vet runs. It panics if a check
+// with the same ID is registered.
+func Register(check *Check) {
+	if Lookup(check.ID) != nil {
+		panic("vet: check " + check.ID + " is registered twice")
+	}
+	checks = append(checks, check)
+}
+
+// Checks returns the registered checks
+func Checks() []*Check {
+	return append([]*Check(nil), checks...)
+}
+
+// Lookup returns the registered check with the given ID, or nil
+func Lookup(id string) *Check {
+	for _, check := range checks {
+		if check.ID == id {
+			return check
+		}
+	}
+	return nil
+}
+
+// Pass is what a check gets to look at: the program and a way to report
+// what it finds
+type Pass struct {
+	Program *ast.Program
+
+	check       *Check
+	diagnostics *[]Diagnostic
+	names       *resolver
+}
+
+// Reportf reports a diagnostic of the check at a line of the .gos file
+func (p *Pass) Reportf(line int, format string, args ...interface{}) {
+	*p.diagnostics = append(*p.diagnostics, Diagnostic{
+		Check:    p.check.ID,
+		Severity: p.check.Severity,
+		Line:     line,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// resolved returns the local variables of the program, found the first
+// time a check asks for them
+func (p *Pass) resolved() *resolver {
+	if p.names.uses == nil {
+		*p.names = *resolve(p.Program)
+	}
+	return p.names
+}
+
+// Run runs checks over a program parsed from source, and returns the
+// diagnostics that are not ignored by # gos:ignore comments, in the order
+// of their lines
+func Run(program *ast.Program, source string, checks []*Check) []Diagnostic {
+	var diagnostics []Diagnostic
+	names := &resolver{}
+	for _, check := range checks {
+		check.Run(&Pass{Program: program, check: check, diagnostics: &diagnostics, names: names})
+	}
+
+	ignored := Ignored(source)
+	kept := diagnostics[:0]
+	for _, d := range diagnostics {
+		if !ignored[d.Line][d.Check] {
+			kept = append(kept, d)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Line < kept[j].Line
+	})
+	return kept
+}
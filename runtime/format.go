@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Format specs of f-strings compile to fmt verbs. These helpers cover what
+// fmt cannot do: fill characters, centering and digit grouping.
+
+// Pad pads s to width runes with fill. align is '<' (left), '>' (right), '^'
+// (centered) or '=' (right, with the padding after any sign).
+func Pad(s string, width int, align byte, fill rune) string {
+	n := width - utf8.RuneCountInString(s)
+	if n <= 0 {
+		return s
+	}
+	pad := func(count int) string { return strings.Repeat(string(fill), count) }
+	switch align {
+	case '<':
+		return s + pad(n)
+	case '^':
+		return pad(n/2) + s + pad(n-n/2)
+	case '=':
+		if s != "" && strings.ContainsRune("+- ", rune(s[0])) {
+			return s[:1] + pad(n) + s[1:]
+		}
+	}
+	return pad(n) + s
+}
+
+// Group inserts sep between groups of size digits in the integer part of a
+// formatted number, after any sign and base prefix: Group("1234567.5", ',',
+// 3) is "1,234,567.5"
+func Group(s string, sep byte, size int) string {
+	start := 0
+	if start < len(s) && strings.ContainsRune("+- ", rune(s[start])) {
+		start++
+	}
+	if len(s) > start+1 && s[start] == '0' && strings.ContainsRune("xXbBoO", rune(s[start+1])) {
+		start += 2
+	}
+	end := start
+	for end < len(s) && isDigit(s[end], size == 4) {
+		end++
+	}
+
+	var b strings.Builder
+	b.WriteString(s[:start])
+	for i := start; i < end; i++ {
+		if i > start && (end-i)%size == 0 {
+			b.WriteByte(sep)
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteString(s[end:])
+	return b.String()
+}
+
+func isDigit(ch byte, hex bool) bool {
+	return '0' <= ch && ch <= '9' || hex && ('a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F')
+}
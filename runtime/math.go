@@ -0,0 +1,80 @@
+package runtime
+
+import "math"
+
+// The math module: math.sqrt(x) and friends. The functions are generic, so
+// they take ints and floats without conversions.
+
+// Number is any integer or floating point type
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Constants of the math module
+const (
+	Pi = math.Pi
+	E  = math.E
+)
+
+// Abs returns the absolute value of x, of the same type
+func Abs[N Number](x N) N {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Ceil returns the least integer value greater than or equal to x
+func Ceil[N Number](x N) float64 { return math.Ceil(float64(x)) }
+
+// Floor returns the greatest integer value less than or equal to x
+func Floor[N Number](x N) float64 { return math.Floor(float64(x)) }
+
+// Round returns the nearest integer, rounding half away from zero
+func Round[N Number](x N) float64 { return math.Round(float64(x)) }
+
+// Sqrt returns the square root of x
+func Sqrt[N Number](x N) float64 { return math.Sqrt(float64(x)) }
+
+// Pow returns x**y
+func Pow[X, Y Number](x X, y Y) float64 { return math.Pow(float64(x), float64(y)) }
+
+// Sin returns the sine of the radian argument x
+func Sin[N Number](x N) float64 { return math.Sin(float64(x)) }
+
+// Cos returns the cosine of the radian argument x
+func Cos[N Number](x N) float64 { return math.Cos(float64(x)) }
+
+// Tan returns the tangent of the radian argument x
+func Tan[N Number](x N) float64 { return math.Tan(float64(x)) }
+
+// Log returns the natural logarithm of x
+func Log[N Number](x N) float64 { return math.Log(float64(x)) }
+
+// Log10 returns the decimal logarithm of x
+func Log10[N Number](x N) float64 { return math.Log10(float64(x)) }
+
+// Exp returns e**x
+func Exp[N Number](x N) float64 { return math.Exp(float64(x)) }
+
+// Min returns the smallest of its arguments
+func Min[N Number](first N, rest ...N) N {
+	for _, x := range rest {
+		if x < first {
+			first = x
+		}
+	}
+	return first
+}
+
+// Max returns the largest of its arguments
+func Max[N Number](first N, rest ...N) N {
+	for _, x := range rest {
+		if x > first {
+			first = x
+		}
+	}
+	return first
+}
@@ -0,0 +1,193 @@
+// Package runtime implements the Go-Script builtins and standard modules for
+// generated programs. Generated code imports it as gosrt, so it does not
+// clash with Go's own runtime package.
+//
+// The functions are typed: the code generator calls Go functions and
+// conversions directly where the argument types are known, and these
+// functions where they are not.
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// Input prints the optional prompt and reads a line from standard input,
+// without the line ending. It returns "" at the end of the input.
+func Input(prompt ...any) string {
+	if len(prompt) > 0 {
+		fmt.Print(prompt...)
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return ""
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// Args returns the command-line arguments of the program, without the
+// program name
+func Args() []string {
+	return append([]string{}, os.Args[1:]...)
+}
+
+// Str converts a value to its string form
+func Str(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// Int converts a number, bool or numeric string to an int. Floats are
+// truncated; anything else panics with an error.
+func Int(v any) int {
+	switch val := reflect.ValueOf(v); val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		return int(val.Float())
+	case reflect.Bool:
+		if val.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.String:
+		return Atoi(val.String())
+	}
+	panic(fmt.Errorf("int() cannot convert %T", v))
+}
+
+// Atoi parses a decimal integer, ignoring surrounding whitespace
+func Atoi(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		panic(fmt.Errorf("invalid literal for int(): %q", s))
+	}
+	return n
+}
+
+// Float converts a number, bool or numeric string to a float64
+func Float(v any) float64 {
+	switch val := reflect.ValueOf(v); val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		return val.Float()
+	case reflect.Bool:
+		if val.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.String:
+		return ParseFloat(val.String())
+	}
+	panic(fmt.Errorf("float() cannot convert %T", v))
+}
+
+// ParseFloat parses a floating point number, ignoring surrounding whitespace
+func ParseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		panic(fmt.Errorf("invalid literal for float(): %q", s))
+	}
+	return f
+}
+
+// Bool reports whether a value is truthy: not nil, not the zero value and
+// not an empty string, slice, map or channel
+func Bool(v any) bool {
+	if v == nil {
+		return false
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Chan, reflect.Array:
+		return val.Len() > 0
+	}
+	return !val.IsZero()
+}
+
+// Type returns the Go type of a value, such as "int" or "[]string"
+func Type(v any) string {
+	if v == nil {
+		return "nil"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// Range returns the integers from start up to, but not including, stop:
+// Range(stop), Range(start, stop) or Range(start, stop, step)
+func Range(args ...int) []int {
+	start, stop, step := 0, 0, 1
+	switch len(args) {
+	case 1:
+		stop = args[0]
+	case 2:
+		start, stop = args[0], args[1]
+	case 3:
+		start, stop, step = args[0], args[1], args[2]
+	default:
+		panic(fmt.Errorf("range() takes 1 to 3 arguments, got %d", len(args)))
+	}
+	if step == 0 {
+		panic(fmt.Errorf("range() step must not be zero"))
+	}
+
+	var result []int
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		result = append(result, i)
+	}
+	return result
+}
+
+// Step returns the step of a range() loop, which must not be zero
+func Step(step int) int {
+	if step == 0 {
+		panic(fmt.Errorf("range() step must not be zero"))
+	}
+	return step
+}
+
+// timeFormats maps the placeholders of FormatTime to Go layout elements,
+// longest first so that YYYY is not read as two YY
+var timeFormats = []struct{ placeholder, layout string }{
+	{"YYYY", "2006"}, {"YY", "06"},
+	{"MM", "01"}, {"DD", "02"},
+	{"HH", "15"}, {"hh", "03"},
+	{"mm", "04"}, {"ss", "05"},
+	{"AM", "PM"}, {"am", "pm"},
+}
+
+// FormatTime formats a time with placeholders such as "YYYY-MM-DD HH:mm:ss".
+// Other text is used as a Go layout, so "Mon Jan 2" also works.
+func FormatTime(t time.Time, format string) string {
+	var layout strings.Builder
+	for i := 0; i < len(format); {
+		matched := false
+		for _, f := range timeFormats {
+			if strings.HasPrefix(format[i:], f.placeholder) {
+				layout.WriteString(f.layout)
+				i += len(f.placeholder)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			layout.WriteByte(format[i])
+			i++
+		}
+	}
+	return t.Format(layout.String())
+}
@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+)
+
+// Sequences: Python slicing, negative indexes, enumerate() and zip(). Indexes
+// into strings count bytes, as s[i] does in Go.
+
+// Omit stands for a bound left out of a slice expression, as in xs[:n]
+const Omit = math.MinInt
+
+// Pair holds the values produced by Enumerate and Zip
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// sliceBounds resolves the bounds of a slice of a sequence of length n the
+// way Python does: negative bounds count from the end and bounds past either
+// end are clamped. It returns the first index and the index to stop before.
+func sliceBounds(n, low, high, step int) (int, int) {
+	if step == 0 {
+		panic(fmt.Errorf("slice step cannot be zero"))
+	}
+	// A negative step walks from the end, down to before the first element
+	lower, upper, first, last := 0, n, 0, n
+	if step < 0 {
+		lower, upper, first, last = -1, n-1, n-1, -1
+	}
+	bound := func(i, omitted int) int {
+		if i == Omit {
+			return omitted
+		}
+		if i < 0 {
+			i += n
+		}
+		return min(max(i, lower), upper)
+	}
+	return bound(low, first), bound(high, last)
+}
+
+// Slice returns the elements of xs from low up to high, taking every step
+// elements, like xs[low:high:step] in Python. Omitted bounds are Omit. The
+// result is a new slice.
+func Slice[S ~[]E, E any](xs S, low, high, step int) S {
+	start, stop := sliceBounds(len(xs), low, high, step)
+	result := make(S, 0)
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		result = append(result, xs[i])
+	}
+	return result
+}
+
+// SliceString is Slice for the bytes of a string
+func SliceString(s string, low, high, step int) string {
+	start, stop := sliceBounds(len(s), low, high, step)
+	if step == 1 {
+		return s[start:max(start, stop)]
+	}
+	var result []byte
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		result = append(result, s[i])
+	}
+	return string(result)
+}
+
+// Index resolves a possibly negative index into a sequence of length n, so
+// xs[Index(len(xs), i)] is the element i counts to from the end when it is
+// negative
+func Index(n, i int) int {
+	j := i
+	if j < 0 {
+		j += n
+	}
+	if j < 0 || j >= n {
+		panic(fmt.Errorf("index %d out of range for length %d", i, n))
+	}
+	return j
+}
+
+// At returns xs[i], where a negative i counts from the end: At(xs, -1) is
+// the last element
+func At[S ~[]E, E any](xs S, i int) E {
+	return xs[Index(len(xs), i)]
+}
+
+// ByteAt is At for the bytes of a string. Like indexing a string in Go it
+// gives a byte; SliceString gives the strings of its parts.
+func ByteAt(s string, i int) byte {
+	return s[Index(len(s), i)]
+}
+
+// Enumerate pairs each element of xs with its index, counting from start if
+// it is given
+func Enumerate[S ~[]E, E any](xs S, start ...int) []Pair[int, E] {
+	offset := 0
+	if len(start) > 0 {
+		offset = start[0]
+	}
+	result := make([]Pair[int, E], len(xs))
+	for i, x := range xs {
+		result[i] = Pair[int, E]{i + offset, x}
+	}
+	return result
+}
+
+// Zip pairs the elements of xs and ys at the same index, stopping at the end
+// of the shorter one
+func Zip[A, B any](xs []A, ys []B) []Pair[A, B] {
+	result := make([]Pair[A, B], min(len(xs), len(ys)))
+	for i := range result {
+		result[i] = Pair[A, B]{xs[i], ys[i]}
+	}
+	return result
+}
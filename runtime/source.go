@@ -0,0 +1,9 @@
+package runtime
+
+import "embed"
+
+// Source holds the Go files of this package, which the gos command vendors
+// into the module of the programs it builds
+//
+//go:embed *.go
+var Source embed.FS
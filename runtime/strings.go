@@ -0,0 +1,99 @@
+package runtime
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The strings module: strings.upper(s) and friends
+
+// Upper converts a string to upper case
+func Upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+// Lower converts a string to lower case
+func Lower(s string) string {
+	return strings.ToLower(s)
+}
+
+// Title upper-cases the first letter of each word and lower-cases the rest
+func Title(s string) string {
+	runes := []rune(s)
+	start := true
+	for i, r := range runes {
+		if unicode.IsLetter(r) {
+			if start {
+				runes[i] = unicode.ToUpper(r)
+			} else {
+				runes[i] = unicode.ToLower(r)
+			}
+			start = false
+		} else {
+			start = true
+		}
+	}
+	return string(runes)
+}
+
+// Strip removes whitespace from both ends
+func Strip(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// LStrip removes whitespace from the start
+func LStrip(s string) string {
+	return strings.TrimLeftFunc(s, unicode.IsSpace)
+}
+
+// RStrip removes whitespace from the end
+func RStrip(s string) string {
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
+
+// Split splits a string around sep, or around runs of whitespace when sep is
+// left out
+func Split(s string, sep ...string) []string {
+	if len(sep) == 0 {
+		return strings.Fields(s)
+	}
+	return strings.Split(s, sep[0])
+}
+
+// Join joins items with sep in between
+func Join(sep string, items []string) string {
+	return strings.Join(items, sep)
+}
+
+// Replace replaces old with new, at most n times if n is given
+func Replace(s, old, new string, n ...int) string {
+	if len(n) > 0 {
+		return strings.Replace(s, old, new, n[0])
+	}
+	return strings.ReplaceAll(s, old, new)
+}
+
+// Contains reports whether substr is in s
+func Contains(s, substr string) bool {
+	return strings.Contains(s, substr)
+}
+
+// StartsWith reports whether s begins with prefix
+func StartsWith(s, prefix string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// EndsWith reports whether s ends with suffix
+func EndsWith(s, suffix string) bool {
+	return strings.HasSuffix(s, suffix)
+}
+
+// Find returns the index of the first substr in s, or -1
+func Find(s, substr string) int {
+	return strings.Index(s, substr)
+}
+
+// Count counts the non-overlapping instances of substr in s
+func Count(s, substr string) int {
+	return strings.Count(s, substr)
+}
@@ -0,0 +1,768 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/checker"
+	"github.com/GrandpaEJ/go-script/pkg/gopkg"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+	"github.com/GrandpaEJ/go-script/pkg/parser"
+)
+
+const checkerStructs = `struct Animal:
+    name string
+
+struct Dog:
+    Animal
+    breed string
+
+struct Person:
+    name string
+    age int
+
+    func init(self, name string, age int):
+        self.name = name
+        self.age = age
+`
+
+func TestCheckerStructLiterals(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`p := Person{name: "Alice", age: 30}`, ""},
+		{`p := Person{"Alice", 30}`, ""},
+		{`d := Dog{Animal: Animal{name: "Rex"}, breed: "lab"}`, ""},
+		{`t := time.Time{}`, ""},
+		{`p := Person("Alice", 30)`, ""},
+		{`p := Person{nme: "Alice"}`, "unknown field nme in Person literal"},
+		{`p := Person{age: 1, age: 2}`, "duplicate field age in Person literal"},
+		{`p := Person{"Alice"}`, "too few values in Person literal"},
+		{`p := Person{"Alice", 30, true}`, "too many values in Person literal"},
+		{`d := Dog{name: "Rex"}`, "cannot set promoted field name in Dog literal"},
+		{`p := Person("Alice")`, "wrong number of arguments to Person constructor"},
+	}
+
+	for _, tt := range tests {
+		input := checkerStructs + "\nfunc main():\n    " + tt.input
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		errors := c.Errors()
+
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%s: unexpected checker errors: %v", tt.input, errors)
+			}
+			continue
+		}
+
+		if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerExportCollisions(t *testing.T) {
+	input := `pub func add(a int, b int) int:
+    return a + b
+
+func Add(a int, b int) int:
+    return a + b
+
+struct Point:
+    pub x int
+    X int`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	c := checker.New()
+	c.Check(program)
+	errors := c.Errors()
+
+	expected := []string{
+		"line 1: pub func add conflicts with Add once exported",
+		"line 8: pub field Point.x conflicts with X once exported",
+	}
+
+	if len(errors) != len(expected) {
+		t.Fatalf("expected %d errors, got %v", len(expected), errors)
+	}
+	for i, want := range expected {
+		if errors[i] != want {
+			t.Errorf("error %d wrong. expected=%q, got=%q", i, want, errors[i])
+		}
+	}
+}
+
+func TestCheckerErrorLines(t *testing.T) {
+	input := `struct B:
+    x int
+    y int
+
+func pair[T any](a T, b T) []T:
+    return [a, b]
+
+func main():
+    b := B{x: 1, z: 2}
+    c := B{1}
+    for i in range(1, 2, 0):
+        print(i, b, c)
+    p := pair[int, int](1, 2)
+    f := lambda x: x
+    print(p, f)
+`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	c := checker.New()
+	c.Check(program)
+
+	// Lambdas are typed before the other checks run
+	expected := []string{
+		"line 14: cannot infer the type of lambda x: x; pass it where a function type is expected or use a func literal",
+		"line 9: unknown field z in B literal",
+		"line 10: too few values in B literal: expected 2, got 1",
+		"line 11: range() step must not be zero",
+		"line 13: wrong number of type arguments to pair: expected 1, got 2",
+	}
+	got := c.Errors()
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckerReceivers(t *testing.T) {
+	input := `struct Account:
+    owner string
+    balance int
+
+    func deposit(self, amount int):
+        self.balance += amount
+        self.balance += 0
+
+    func mut withdraw(self, amount int):
+        self.balance -= amount
+
+    func rename(*self, owner string):
+        self.owner = owner
+
+    func report(self) int:
+        total := self.balance
+        total += 1
+        return total
+
+func mut helper():
+    return
+
+func main():
+    a := Account{owner: "Al", balance: 1}
+    a.deposit(1)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	c := checker.New()
+	c.Check(program)
+
+	warnings := c.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(warnings), warnings)
+	}
+	if !strings.Contains(warnings[0], "line 6: method Account.deposit assigns to self.balance but has a value receiver") {
+		t.Errorf("unexpected warning: %q", warnings[0])
+	}
+
+	errors := c.Errors()
+	if len(errors) != 1 || !strings.Contains(errors[0], "mut is only allowed on struct methods") {
+		t.Errorf("expected an error for func mut outside a struct, got %v", errors)
+	}
+}
+
+func TestCheckerLambdaInference(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedType  string
+		expectedError string
+	}{
+		{`var f func(int, int) int = lambda a, b: a + b`, "func(int, int) int", ""},
+		{`apply(lambda x: x * 2)`, "func(int) int", ""},
+		{`sort.Slice(names, lambda i, j: names[i] < names[j])`, "func(int, int) bool", ""},
+		{`n := bytes.IndexFunc(data, lambda r: r > 64)`, "func(rune) bool", ""},
+		// A named func type takes the func type it names
+		{`filepath.Walk(".", lambda path, info, err: nil)`, "func(string, fs.FileInfo, error) error", ""},
+		{`b := Button{on_click: lambda: print("hi")}`, "func()", ""},
+		{`f := lambda x: x`, "", "cannot infer the type of lambda x: x"},
+		{`apply(lambda x, y: x)`, "", "lambda x, y: x has 2 parameters but func(int) int expects 1"},
+	}
+
+	// The types of Go callbacks come from the packages
+	loader := gopkg.NewLoader("")
+
+	for _, tt := range tests {
+		input := `import "bytes"
+import "io/fs"
+import "path/filepath"
+import "sort"
+
+struct Button:
+    on_click func()
+
+func apply(f func(int) int) int:
+    return f(1)
+
+func main():
+    ` + tt.input
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.UsePackages(loader)
+		c.Check(program)
+		errors := c.Errors()
+
+		if tt.expectedError != "" {
+			if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+				t.Errorf("%s: expected error %q, got %v", tt.input, tt.expectedError, errors)
+			}
+			continue
+		}
+		if len(errors) != 0 {
+			t.Errorf("%s: unexpected checker errors: %v", tt.input, errors)
+			continue
+		}
+
+		var lambda *ast.LambdaExpr
+		ast.Inspect(program, func(node ast.Node) bool {
+			if l, ok := node.(*ast.LambdaExpr); ok {
+				lambda = l
+			}
+			return true
+		})
+		if lambda == nil || lambda.Type == nil || lambda.Type.String() != tt.expectedType {
+			t.Errorf("%s: expected lambda type %q, got %v", tt.input, tt.expectedType, lambda)
+		}
+	}
+}
+
+func TestCheckerNestedLambdaReturn(t *testing.T) {
+	input := `func adder() func(int) func(int) int:
+    return lambda x: lambda y: x + y`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	c := checker.New()
+	c.Check(program)
+
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Fatalf("unexpected checker errors: %v", errors)
+	}
+
+	ret := program.Statements[0].(*ast.FunctionDecl).Body.Statements[0].(*ast.ReturnStmt)
+	outer := ret.Value.(*ast.LambdaExpr)
+	inner := outer.Body.(*ast.LambdaExpr)
+	if outer.Type.String() != "func(int) func(int) int" || inner.Type.String() != "func(int) int" {
+		t.Errorf("lambda types wrong. outer=%s, inner=%s", outer.Type, inner.Type)
+	}
+}
+
+func TestCheckerGenerics(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`s := Stack[int]{}`, ""},
+		{`p := Pair[string, int]{key: "a", value: 1}`, ""},
+		{`ys := map_values[int, string](xs, lambda x: str(x))`, ""},
+		{`ys := map_values(xs, to_string)`, ""},
+		{`var s Stack[string] = Stack[string]{}`, ""},
+		{`s := Stack{}`, "cannot use generic struct Stack without type arguments in a literal"},
+		{`var s Stack = nil`, "cannot use generic struct Stack without type arguments"},
+		{`p := Pair[string]{}`, "wrong number of type arguments to Pair: expected 2, got 1"},
+		{`ys := map_values[int, string, bool](xs, f)`, "wrong number of type arguments to map_values: expected 2, got 3"},
+		{`q := Plain[int, string]{}`, "Plain is not generic but is given type arguments"},
+		{`ys := map_values(xs, lambda x: str(x))`, "cannot infer the type of lambda x: str(x)"},
+		{`p := Pair[string, int]{key: "a", val: 1}`, "unknown field val in Pair literal"},
+	}
+
+	for _, tt := range tests {
+		input := `struct Stack[T]:
+    items []T
+
+struct Pair[K comparable, V any]:
+    key K
+    value V
+
+struct Plain:
+    n int
+
+func map_values[T, U](xs []T, f func(T) U) []U:
+    return nil
+
+func main():
+    ` + tt.input
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		errors := c.Errors()
+
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%s: unexpected checker errors: %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerErrorFlow(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"func f() error:\n    check()?\n    return nil", ""},
+		{"func f() (int, error):\n    n := parse()?\n    return n, nil", ""},
+		{"func f():\n    try:\n        check()?\n    except:\n        raise", ""},
+		{"func f():\n    raise \"failed\"", ""},
+		{"func f() error:\n    if ok(load()?):\n        return nil\n    return nil", ""},
+		{"func f():\n    check()?", "check()? needs func f to return an error, or an enclosing try"},
+		{"func f():\n    try:\n        run()\n    except:\n        check()?", "check()? needs func f to return an error, or an enclosing try"},
+		{"func f():\n    raise", "bare raise in func f is only allowed in an except clause"},
+		{"func f() error:\n    while next()?:\n        run()\n    return nil", "next()? cannot be used in a while condition"},
+		{"func f() error:\n    g := lambda: load()?\n    return nil", "load()? cannot be used in a lambda"},
+		{"func f() error:\n    g := func():\n        check()?\n    return nil", "check()? needs the func literal to return an error, or an enclosing try"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		var errors []string
+		for _, err := range c.Errors() {
+			// Lambdas in these snippets have no inferable type
+			if !strings.Contains(err, "cannot infer the type") {
+				errors = append(errors, err)
+			}
+		}
+
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected checker errors: %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerSequenceBuiltins(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"for i in range(0, 10, -1):\n    print(i)", ""},
+		{"for a, b in zip(xs, ys):\n    print(a)", ""},
+		{"func zip(a, b, c []int) int:\n    return 0\nn := zip(a, b, c)", ""},
+		{"for i in range(0, 10, 0):\n    print(i)", "range() step must not be zero"},
+		{"for i in range():\n    print(i)", "range() takes 1 to 3 arguments, got 0"},
+		{"for a, b in zip(xs, ys, zs):\n    print(a)", "zip() takes 2 arguments, got 3"},
+		{"pairs := enumerate(xs, 1, 2)", "enumerate() takes 1 to 2 arguments, got 3"},
+		{"x := xs[::0]", "slice step must not be zero"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		errors := c.Errors()
+
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected checker errors: %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerComprehensionPropagation(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"func f(xs []string) []int:\n    return [len(x) for x in xs]", ""},
+		{"func f(xs []string) ([]int, error):\n    return [parse(x)? for x in xs], nil", "parse(x)? cannot be used in a comprehension"},
+		{"func f(xs []string) ([]int, error):\n    return [x for x in load()? if x], nil", "load()? cannot be used in a comprehension"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		errors := c.Errors()
+
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected checker errors: %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerFStringFormatCodes(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`x := f"{3:.2f} {0.5:%} {'a':>3s} {n:d} {'a'!r:>5}"`, ""},
+		{`x := f"{'text':d}"`, `format code 'd' is not valid for the string "text"`},
+		{`x := f"{2.5:x}"`, "format code 'x' is not valid for the float 2.5"},
+		{`x := f"{7:s}"`, "format code 's' is not valid for the int 7"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		errors := c.Errors()
+
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected checker errors: %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerScript(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedError   string
+		expectedWarning string
+	}{
+		{"print(1)", "", ""},
+		{"func main():\n    print(1)\n\nif __name__ == \"__main__\":\n    main()", "", ""},
+		{"func main():\n    print(1)\n\nprint(2)", "", "line 1: func main does not run"},
+		{"package util\n\nfunc main():\n    print(1)\n\nprint(2)", "", ""},
+		{"n := strconv.Atoi(\"1\")?", "needs the top-level code to return an error", ""},
+		{"try:\n    n := strconv.Atoi(\"1\")?\nexcept:\n    print(0)", "", ""},
+		{"x := 5\n\nfunc helper() int:\n    return x * 2\n\nprint(helper())", "line 4: func helper uses x, but x is declared at line 1 in the top-level code", ""},
+		{"x := 5\n\nfunc helper() int:\n    x := 2\n    return x\n\nprint(helper(), x)", "", ""},
+		{"var x int = 5\n\nfunc helper() int:\n    return x * 2\n\nprint(helper())", "", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+
+		for _, check := range []struct {
+			kind     string
+			expected string
+			got      []string
+		}{{"error", tt.expectedError, c.Errors()}, {"warning", tt.expectedWarning, c.Warnings()}} {
+			if check.expected == "" {
+				if len(check.got) != 0 {
+					t.Errorf("%q: unexpected %ss: %v", tt.input, check.kind, check.got)
+				}
+			} else if len(check.got) != 1 || !strings.Contains(check.got[0], check.expected) {
+				t.Errorf("%q: expected %s %q, got %v", tt.input, check.kind, check.expected, check.got)
+			}
+		}
+	}
+}
+
+func TestCheckerCLI(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"@cli\nfunc main(name string = \"x\", n int = -2, rate float64 = 1, v bool, rest []string) error:\n    return nil", ""},
+		{"@cli\nfunc greet(name string) int:\n    return 0", ""},
+		{"@cli\nfunc main(n int = \"x\"):\n    print(n)", "the default value of parameter n must be a int literal"},
+		{"@cli\nfunc main(m map[string]int):\n    print(m)", "@cli parameters must be string, int"},
+		{"@cli\nfunc main(rest []string, n int):\n    print(n)", "parameter rest has []string"},
+		{"@cli\nfunc main() string:\n    return \"\"", "may return nothing, an error or an int exit code"},
+		{"@cli\nfunc greet():\n    print(1)\n\nfunc main():\n    greet()", "cannot also declare func main"},
+		{"@cli\nfunc greet():\n    print(1)\n\nprint(2)", "cannot also have top-level statements"},
+		{"@cli\nfunc a():\n    print(1)\n\n@cli\nfunc b():\n    print(2)", "only one function can be annotated with @cli"},
+		{"@cached\nfunc main():\n    print(1)", "unknown annotation @cached"},
+		{"func add(a int, b int = 1) int:\n    return a + b", "only the parameters of a @cli function may have"},
+		{"n := args(1)", "args() takes 0 arguments, got 1"},
+		{"exit(1, 2)", "exit() takes 0 to 1 arguments, got 2"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		errors := c.Errors()
+
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected checker errors: %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerUnusedImports(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedWarning string
+	}{
+		{"import \"os\"\n\nprint(os.Args)", ""},
+		{"import \"strings\"\n\nprint(strings.upper(\"a\"))", ""},
+		{"import \"time\"\n\nfunc wait(d time.Duration):\n    print(d)", ""},
+		{"import \"os\"\n\nprint(1)", "line 1: import \"os\" is not used"},
+		{"import \"json\" as j\n\nprint(1)", "line 1: import \"encoding/json\" as j is not used"},
+		{"from \"os\" import Getpid, Exit\n\nExit(Getpid())", ""},
+		{"from \"os\" import Getpid, Exit\n\nprint(Getpid())", "line 1: Exit imported from \"os\" is not used"},
+		{"import \"os\"\nimport \"time\"\n\nprint(os.Args)", "line 2: import \"time\" is not used"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		warnings := c.Warnings()
+		if tt.expectedWarning == "" {
+			if len(warnings) != 0 {
+				t.Errorf("%q: unexpected warnings: %v", tt.input, warnings)
+			}
+		} else if len(warnings) != 1 || !strings.Contains(warnings[0], tt.expectedWarning) {
+			t.Errorf("%q: expected warning %q, got %v", tt.input, tt.expectedWarning, warnings)
+		}
+	}
+}
+
+func TestCheckerImportNames(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"import \"math/rand\"\nimport \"crypto/rand\" as cryptorand\n\nprint(rand.Intn(2), cryptorand.Reader)", ""},
+		{"import \"math/rand\"\nimport \"crypto/rand\"\n\nprint(rand.Intn(2))",
+			"line 2: import \"crypto/rand\": rand is already the name of \"math/rand\", imported at line 1; name one of them with as, as in import \"crypto/rand\" as cryptorand"},
+		{"import \"os\"\nimport \"os\"\n\nprint(os.Args)", "line 2: \"os\" is already imported as os at line 1"},
+		{"from \"os\" import Exit\nfrom \"syscall\" import Exit\n\nExit(0)", "line 2: Exit is imported from \"syscall\" and, at line 1, from \"os\""},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.Check(program)
+		errors := c.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected errors: %v", tt.input, errors)
+			}
+		} else if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerTests(t *testing.T) {
+	code := `struct Point:
+    x int
+
+func add(a int, b int) int:
+    return a + b`
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"func test_add(t):\n    assert add(1, 2) == 3", ""},
+		{"func test_point(t):\n    p := Point{x: 1}\n    assert p.x == 1", ""},
+		{"func helper(a int) int:\n    return a", ""},
+		{"func test_add():\n    assert true", "func test_add: a test takes one parameter without a type"},
+		{"func test_add(t testing.T):\n    assert true", "func test_add: a test takes one parameter without a type"},
+		{"func test_add(t) int:\n    return 1", "func test_add: a test cannot return a value"},
+		{"print(1)", "a test file can only declare functions, structs and typed vars"},
+		{"func test_point(t):\n    p := Point{y: 1}", "unknown field"},
+	}
+
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		tests := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		c := checker.New()
+		c.CheckTests(tests, program)
+		errors := c.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("%q: unexpected errors: %v", tt.input, errors)
+			}
+		} else if len(errors) != 1 || !strings.Contains(errors[0], tt.expectedError) {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestCheckerGoPackages(t *testing.T) {
+	input := `import "net/http"
+import "strconv"
+from "strings" import ToUpper, Tolower
+
+var client http.Clinet = nil
+
+func main():
+    resp, err := http.Gett("http://example.com")
+    print(resp, err, client)
+    print(strconv.Itoa("5"), strconv.Itoa(5, 6), strconv.Itoa(int(2.5)))
+    fmt.Printf()
+    fmt.Println(strings.upper("a"), ToUpper("a", "b"), math.Sqrt(2), math.Pi)
+    os.Exit(1.5)
+    print(time.Duration(1, 2), time.Secnd, time.Second * 2)
+    math.Pi()
+    print(strconv.Atoi(fmt.Sprint(1)))
+`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	// A second loader reads the packages from the cache of the first
+	cacheDir := t.TempDir()
+	for _, loader := range []*gopkg.Loader{gopkg.NewLoader(cacheDir), gopkg.NewLoader(cacheDir)} {
+		c := checker.New()
+		c.UsePackages(loader)
+		c.Check(program)
+
+		expected := []string{
+			`line 3: Tolower imported from "strings" is not declared by the package; did you mean ToLower?`,
+			`line 8: http.Gett is not declared by package "net/http"; did you mean http.Get?`,
+			`line 10: cannot use "5" as int in argument 1 to strconv.Itoa`,
+			`line 10: strconv.Itoa takes 1 argument, got 2: func(i int) string`,
+			`line 11: fmt.Printf takes at least 1 argument, got 0: func(format string, a ...any) (n int, err error)`,
+			`line 12: ToUpper takes 1 argument, got 2: func(s string) string`,
+			`line 13: cannot use 1.5 as int in argument 1 to os.Exit`,
+			`line 14: converting to time.Duration takes 1 argument, got 2`,
+			`line 14: time.Secnd is not declared by package "time"; did you mean time.Second?`,
+			`line 15: math.Pi is a const of type untyped float, not a func`,
+			`line 5: http.Clinet is not declared by package "net/http"; did you mean http.Client?`,
+		}
+		if got := strings.Join(c.Errors(), "\n"); got != strings.Join(expected, "\n") {
+			t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), got)
+		}
+	}
+
+	// Without a loader, Go packages are left to the Go compiler
+	c := checker.New()
+	c.Check(program)
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Errorf("expected no errors without a loader, got %v", errors)
+	}
+}
+
+func TestCheckerGoPackagesHidden(t *testing.T) {
+	input := `struct Timer:
+    Second int
+
+func Printf(s string):
+    print(s)
+
+func main():
+    time := Timer{Second: 1}
+    print(time.Second, time.Minute)
+    Printf("a")
+`
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	c := checker.New()
+	c.UsePackages(gopkg.NewLoader(""))
+	c.Check(program)
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Errorf("expected a variable to hide the package, got %v", errors)
+	}
+}
@@ -0,0 +1,887 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/checker"
+	"github.com/GrandpaEJ/go-script/pkg/codegen"
+	"github.com/GrandpaEJ/go-script/pkg/gopkg"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+	"github.com/GrandpaEJ/go-script/pkg/parser"
+	"github.com/GrandpaEJ/go-script/pkg/stdlib/core"
+	gomath "github.com/GrandpaEJ/go-script/pkg/stdlib/math"
+	gostrings "github.com/GrandpaEJ/go-script/pkg/stdlib/strings"
+)
+
+func TestExportModel(t *testing.T) {
+	input := `pub struct person:
+    pub name string
+    age int
+    pub email string 'json:"mail,omitempty"'
+
+    pub func greet(self) string:
+        return "Hi " + self.name
+
+    func older(self) int:
+        return self.age + 1
+
+pub func make_person(name string) person:
+    return person{name: name, age: 3}
+
+func main():
+    p := make_person("Al")
+    print(p.greet(), p.older())`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"type Person struct {",
+		"Name string `json:\"name\"`",
+		"\tage int\n",
+		"Email string `json:\"mail,omitempty\"`",
+		"func (self Person) Greet() string {",
+		"return (\"Hi \" + self.Name)",
+		"func (self Person) older() int {",
+		"func Make_person(name string) Person {",
+		"return Person{Name: name, age: 3}",
+		"p := Make_person(\"Al\")",
+		"fmt.Println(p.Greet(), p.older())",
+		"func main() {",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestExportedMembersPerStruct(t *testing.T) {
+	input := `pub struct user:
+    pub name string
+
+pub struct secret:
+    name string
+    inner user
+
+    func show(self) string:
+        return self.name + self.inner.name
+
+func main():
+    u := user{name: "Al"}
+    s := secret{name: "key", inner: u}
+    print(u.name, s.name, s.show())`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"Name string `json:\"name\"`",
+		"\tname string\n",
+		"return (self.name + self.inner.Name)",
+		"u := User{Name: \"Al\"}",
+		"s := Secret{name: \"key\", inner: u}",
+		"fmt.Println(u.Name, s.name, s.show())",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestExportShadowedByVariable(t *testing.T) {
+	input := `pub func count() int:
+    return 1
+
+pub func pair() (int, int):
+    return 1, 2
+
+func main():
+    total := count()
+    count := 5
+    pair, b := pair()
+    print(count, pair, b, total)`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"total := Count()",
+		"count := 5",
+		"pair, b := Pair()",
+		"fmt.Println(count, pair, b, total)",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestAutoExport(t *testing.T) {
+	input := `struct point:
+    x int
+    y int
+
+    func init(self, x int, y int):
+        self.x = x
+        self.y = y
+
+    func sum(self) int:
+        return self.x + self.y
+
+func main():
+    p := point(1, 2)
+    print(p.sum())`
+
+	output := generate(t, input, codegen.Options{AutoExport: true})
+
+	expected := []string{
+		"type Point struct {",
+		"X int `json:\"x\"`",
+		"func NewPoint(x int, y int) *Point {",
+		"self.X = x",
+		"func (self Point) Sum() int {",
+		"p := NewPoint(1, 2)",
+		"func main() {",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+
+	// Without auto-export the unexported struct gets an unexported constructor
+	output = generate(t, input, codegen.Options{})
+	if !strings.Contains(output, "func newPoint(x int, y int) *point {") {
+		t.Errorf("expected unexported constructor newPoint:\n%s", output)
+	}
+}
+
+func TestPointerReceiverCodegen(t *testing.T) {
+	input := `struct Counter:
+    n int
+
+    func mut inc(self):
+        self.n++
+
+    func add(*self, k int):
+        self.n += k
+
+    func get(self) int:
+        return self.n`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"func (self *Counter) inc() {",
+		"func (self *Counter) add(k int) {",
+		"func (self Counter) get() int {",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestFunctionLiteralCodegen(t *testing.T) {
+	input := `func makeCounter() func() int:
+    count := 0
+    return func() int:
+        count++
+        return count
+
+func main():
+    var add func(int, int) int = lambda a, b: a + b
+    sort.Slice(names, lambda i, j: names[i] < names[j])
+    web.HandleFunc("/", lambda w, r: print(r.URL))
+    web.Handle("/x", web.HandlerFunc(lambda w, r: print(r.Method)))`
+
+	l := lexer.New("import \"net/http\" as web\nimport \"sort\"\n\n" + input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	c := checker.New()
+	c.UsePackages(gopkg.NewLoader(""))
+	c.Check(program)
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Fatalf("unexpected checker errors: %v", errors)
+	}
+
+	output := codegen.New().Generate(program)
+
+	expected := []string{
+		"func makeCounter() func() int {",
+		"\treturn func() int {\n\t\tcount++\n\t\treturn count\n\t}\n",
+		"var add func(int, int) int = func(a int, b int) int { return (a + b) }",
+		"sort.Slice(names, func(i int, j int) bool { return (names[i] < names[j]) })",
+		"web.HandleFunc(\"/\", func(w web.ResponseWriter, r *web.Request) { fmt.Println(r.URL) })",
+		// A conversion to a named func type, under the name of the import
+		"web.Handle(\"/x\", web.HandlerFunc(func(w web.ResponseWriter, r *web.Request) { fmt.Println(r.Method) }))",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestGenericsCodegen(t *testing.T) {
+	input := `struct Stack[T]:
+    items []T
+
+    func init(self):
+        self.items = nil
+
+    func mut push(self, item T):
+        self.items = append(self.items, item)
+
+func sum[N ~int | ~float64](xs []N) N:
+    var total N = 0
+    return total
+
+func keys[K, V comparable](m map[K]V) []K:
+    return nil
+
+func main():
+    s := Stack[string]()
+    p := Pair[string, int]{key: "a", value: 1}
+    print(sum[float64](nums))`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"type Stack[T any] struct {",
+		"func NewStack[T any]() *Stack[T] {",
+		"self := &Stack[T]{}",
+		"func (self *Stack[T]) push(item T) {",
+		"func sum[N ~int | ~float64](xs []N) N {",
+		"func keys[K comparable, V comparable](m map[K]V) []K {",
+		"s := NewStack[string]()",
+		"p := Pair[string, int]{key: \"a\", value: 1}",
+		"fmt.Println(sum[float64](nums))",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func generate(t *testing.T, input string, options codegen.Options) string {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	return codegen.NewWithOptions(options).Generate(program)
+}
+
+func TestErrorHandlingCodegen(t *testing.T) {
+	input := `func parse(s string) (int, error):
+    if s == "":
+        raise "empty"
+    n := strconv.Atoi(s)?
+    return n, nil
+
+func load(path string) string:
+    try:
+        return read(path)?
+    except io.EOF:
+        return ""
+    except *os.PathError as e:
+        print(e.Path)
+        raise
+    finally:
+        print("done")
+
+func main():
+    x, y := pair()?
+    a, b = b, a`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"func parse(s string) (int, error) {",
+		"return 0, errors.New(\"empty\")",
+		"_v1_0, _err1 := strconv.Atoi(s)",
+		"if _err1 != nil {\n\t\treturn 0, _err1\n\t}\n\tn := _v1_0",
+		"var _r2_0 string",
+		"_done2, _err2 := func() (_done bool, _err error) {",
+		"if r := recover(); r != nil {",
+		"_v3_0, _err3 := read(path)",
+		"return false, _err3",
+		"_r2_0 = _v3_0\n\t\treturn true, nil\n\t}()",
+		"if _done2 {\n\t\tfmt.Println(\"done\")\n\t\treturn _r2_0\n\t}",
+		"if errors.Is(_err2, io.EOF) {",
+		"} else if e := *new(*os.PathError); errors.As(_err2, &e) {",
+		"fmt.Println(\"done\")\n\t\t\tpanic(_err2)",
+		"} else {\n\t\t\tfmt.Println(\"done\")\n\t\t\tpanic(_err2)\n\t\t}",
+		"panic(\"unreachable\")",
+		"_v4_0, _v4_1, _err4 := pair()",
+		"x, y := _v4_0, _v4_1",
+		"a, b = b, a",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestDiscardedResultsCodegen(t *testing.T) {
+	input := `import "os"
+
+struct Store:
+    n int
+
+    func load(self) (int, error):
+        return self.n, nil
+
+func parse(s string) (int, error):
+    return 0, nil
+
+func check() error:
+    return nil
+
+func run(path string) error:
+    parse("1")?
+    os.ReadFile(path)?
+    st := Store{n: 1}
+    st.load()?
+    check()?
+    return nil`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	// The results of Go functions come from the packages
+	c := checker.New()
+	c.UsePackages(gopkg.NewLoader(""))
+	c.Check(program)
+	if errors := c.Errors(); len(errors) != 0 {
+		t.Fatalf("unexpected checker errors: %v", errors)
+	}
+
+	output := codegen.New().Generate(program)
+
+	expected := []string{
+		"_, _err1 := parse(\"1\")",
+		"_, _err2 := os.ReadFile(path)",
+		"_, _err3 := st.load()",
+		"_err4 := check()",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestBuiltinCodegen(t *testing.T) {
+	input := `func area(r float64) float64:
+    return math.pi * r * r
+
+func main():
+    n := 42
+    s := "  text  "
+    var f float64 = 2.5
+    print(str(n), str(s), str(f))
+    print(int(s), int(f), int(2.5), int(n))
+    print(float(n), float(s), float(f))
+    print(bool(n > 1), bool(s))
+    print(strings.upper(strings.strip(s)), math.sqrt(n))
+    for i in range(10):
+        print(str(i))
+    items := range(1, 10, 2)
+    print(type(items), len(items))`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"return ((gosrt.Pi * r) * r)",
+		"fmt.Println(strconv.Itoa(n), s, gosrt.Str(f))",
+		"fmt.Println(gosrt.Atoi(s), int(f), gosrt.Int(2.5), n)",
+		"fmt.Println(float64(n), gosrt.ParseFloat(s), f)",
+		"fmt.Println((n > 1), gosrt.Bool(s))",
+		"fmt.Println(gosrt.Upper(gosrt.Strip(s)), gosrt.Sqrt(n))",
+		"items := gosrt.Range(1, 10, 2)",
+		"fmt.Println(gosrt.Type(items), len(items))",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRangeLoopCodegen(t *testing.T) {
+	input := `func ids() []int:
+    return range(3)
+
+func main():
+    xs := ids()
+    s := "hello"
+    for x in xs:
+        print(x)
+    for i, x in xs:
+        print(i, x)
+    for i in range(10, 0, -2):
+        print(i)
+    for i in range(1, len(xs), step):
+        print(i)
+    for _ in range(3):
+        print("again")
+    for i, x in enumerate(xs, 1):
+        print(i, x)
+    for a, b in zip(xs, ids()):
+        print(a, b)
+    print(xs[-1], ids()[-1], s[-2], xs[1:], s[::-1])
+    j := -1
+    m := {"a": 1}
+    k := "a"
+    print(xs[j], ids()[j], s[j - 1], xs[0], m[k])`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"for _, x := range xs {",
+		"for i, x := range xs {",
+		"for i := 10; i > 0; i -= 2 {",
+		"_n1 := len(xs)\n\t_s2 := gosrt.Step(step)\n\tfor i := 1; (_s2 > 0 && i < _n1) || (_s2 < 0 && i > _n1); i += _s2 {",
+		"for _i3 := 0; _i3 < 3; _i3++ {",
+		"for i, x := range xs {\n\t\ti += 1\n",
+		"_n4 := ids()\n\tfor _i5 := 0; _i5 < min(len(xs), len(_n4)); _i5++ {\n\t\ta := xs[_i5]\n\t\tb := _n4[_i5]\n",
+		"fmt.Println(xs[len(xs)-1], gosrt.At(ids(), -1), s[len(s)-2], gosrt.Slice(xs, 1, gosrt.Omit, 1), gosrt.SliceString(s, gosrt.Omit, gosrt.Omit, -1))",
+		// An index computed at run time may be negative too, except in a map
+		"fmt.Println(xs[gosrt.Index(len(xs), j)], gosrt.At(ids(), j), s[gosrt.Index(len(s), (j - 1))], xs[0], m[k])",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestComprehensionCodegen(t *testing.T) {
+	input := `func words() []string:
+    return ["a", "bb"]
+
+func main():
+    xs := range(5)
+    squares := [x * x for x in xs if x > 1]
+    lengths := {w: len(w) for w in words()}
+    sizes := {len(w) for w in words()}
+    pairs := [i * j for i in range(3) for j in range(i)]
+    print(squares, lengths, sizes, pairs)`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"squares := func() []int {\n\t\t_c1 := make([]int, 0, len(xs))\n\t\tfor _, x := range xs {\n\t\t\tif (x > 1) {\n\t\t\t\t_c1 = append(_c1, (x * x))\n\t\t\t}\n\t\t}\n\t\treturn _c1\n\t}()",
+		"lengths := func() map[string]int {\n\t\t_n3 := words()\n\t\t_c2 := make(map[string]int, len(_n3))\n\t\tfor _, w := range _n3 {\n\t\t\t_c2[w] = len(w)\n",
+		"sizes := func() map[int]struct{} {",
+		"_c4[len(w)] = struct{}{}",
+		"_c6 := []int{}\n\t\tfor i := 0; i < 3; i++ {\n\t\t\tfor j := 0; j < i; j++ {\n\t\t\t\t_c6 = append(_c6, (i * j))\n",
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestStringCodegen(t *testing.T) {
+	input := `func main():
+    """Prints a greeting."""
+    name := "Ada"
+    n := 42
+    x := 2.5
+    print("quote \" and \\ and tab\t", r"C:\dir", 'single')
+    print("""two
+lines""")
+    print(f"Hi {name:<6}|{n:05d}|{x:.1f}|{n:.2f}|{n:,}|{name:^7}|{0.5:.0%}|{name!r}|100%")`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"// Prints a greeting.",
+		`fmt.Println("quote \" and \\ and tab\t", "C:\\dir", "single")`,
+		"fmt.Println(`two\nlines`)",
+		`fmt.Sprintf("Hi %-6v|%05d|%.1f|%.2f|%s|%s|%.0f%%|%#v|100%%", name, n, x, float64(n), ` +
+			`gosrt.Group(fmt.Sprintf("%v", n), ',', 3), gosrt.Pad(fmt.Sprintf("%v", name), 7, '^', ' '), 0.5 * 100, name)`,
+	}
+
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestFStringTypeErrors(t *testing.T) {
+	input := `func main():
+    s := "a"
+    n := 3
+    x := 2.5
+    print(f"{s:>4} {n:05d} {n:.2f} {x:.1%} {n!r:>3} {s:s}")
+    print(f"{s:d}")
+    print(f"{s:.2f} {x:x}")
+    print(f"{n!s:d} {true:d}")`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	g := codegen.New()
+	g.Generate(program)
+	expected := []string{
+		`line 6: format code 'd' is not valid for the string s in f"{s:d}"`,
+		`line 7: format code 'f' is not valid for the string s in f"{s:.2f} {x:x}"`,
+		`line 7: format code 'x' is not valid for the float64 x in f"{s:.2f} {x:x}"`,
+		`line 8: format code 'd' is not valid for the string that !s makes of n in f"{n!s:d} {true:d}"`,
+		`line 8: format code 'd' is not valid for the bool true in f"{n!s:d} {true:d}"`,
+	}
+	if got := strings.Join(g.Errors(), "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+func TestBuiltinsAreGenerated(t *testing.T) {
+	// A program's own str function hides the builtin
+	output := generate(t, "func str(x int) string:\n    return \"mine\"\n\nfunc main():\n    print(str(1))", codegen.Options{})
+	if !strings.Contains(output, "fmt.Println(str(1))") {
+		t.Errorf("user function str was replaced by the builtin:\n%s", output)
+	}
+
+	// Builtins that Go also has are called as they are
+	goBuiltins := map[string]bool{"len": true, "append": true, "make": true, "new": true}
+
+	calls := map[string]bool{}
+	for name := range core.Builtins {
+		if !goBuiltins[name] {
+			calls[name+"(x)"] = true
+		}
+	}
+	for name := range gostrings.StringFunctions {
+		calls["strings."+name+"(x)"] = true
+	}
+	for name := range gomath.MathFunctions {
+		calls["math."+name+"(x)"] = true
+	}
+
+	for call := range calls {
+		output := generate(t, "func main():\n    y := "+call, codegen.Options{})
+		if strings.Contains(output, call) {
+			t.Errorf("%s is not generated as a builtin:\n%s", call, output)
+		}
+	}
+}
+
+func TestMakeAndNewCodegen(t *testing.T) {
+	input := `struct Point:
+    x int
+
+func main():
+    xs := make([]int, 2)
+    m := make(map[string]int)
+    p := new(Point)
+    print(xs[-1], m, p.x)`
+
+	output := generate(t, input, codegen.Options{})
+
+	// make and new give their results the type they take, so xs is known to
+	// be a slice
+	for _, expected := range []string{
+		"xs := make([]int, 2)",
+		"m := make(map[string]int)",
+		"p := new(Point)",
+		"fmt.Println(xs[len(xs)-1], m, p.x)",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestScriptCodegen(t *testing.T) {
+	input := `#!/usr/bin/env gos
+var limit int = 3
+
+func main():
+    print("main")
+
+for i in range(limit):
+    print(i, __name__)
+if __name__ == "__main__":
+    main()
+else:
+    print("imported")`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"var limit int = 3\n\nfunc gosMain() {",
+		"func main() {\n\tfor i := 0; i < limit; i++ {\n\t\tfmt.Println(i, \"__main__\")\n\t}\n\tgosMain()\n}",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "imported") {
+		t.Errorf("the else branch of the __name__ guard was generated:\n%s", output)
+	}
+
+	// Outside package main the statements run in init, and func main keeps
+	// its name
+	output = generate(t, "package util\n\nfunc main():\n    print(1)\n\nprint(__name__)", codegen.Options{})
+	if !strings.Contains(output, "func main() {") || !strings.Contains(output, "func init() {\n\tfmt.Println(\"util\")\n}") {
+		t.Errorf("expected an init function in package util:\n%s", output)
+	}
+}
+
+func TestCLICodegen(t *testing.T) {
+	input := `@cli
+func main(user_name string = "you", count int = 2, files []string) error:
+    """Greets the user."""
+    print(user_name, count, files, argv[0], args())
+    return nil`
+
+	output := generate(t, input, codegen.Options{})
+
+	expected := []string{
+		"func gosMain(user_name string, count int, files []string) error {",
+		"fmt.Println(user_name, count, files, os.Args[0], gosrt.Args())",
+		"flag.Usage = func() {\n\t\tfmt.Fprintf(flag.CommandLine.Output(), \"%s\\n\\n\", \"Greets the user.\")\n\t\tflag.PrintDefaults()\n\t}",
+		"_user_name := flag.String(\"user-name\", \"you\", \"\")\n\t_count := flag.Int(\"count\", 2, \"\")\n\tflag.Parse()",
+		"if err := gosMain(*_user_name, *_count, flag.Args()); err != nil {\n\t\tfmt.Fprintln(os.Stderr, \"error:\", err)\n\t\tos.Exit(1)\n\t}",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+
+	output = generate(t, "@cli\nfunc greet(verbose bool) int:\n    exit(3)\n    return 0", codegen.Options{})
+	for _, want := range []string{"_verbose := flag.Bool(\"verbose\", false, \"\")", "os.Exit(greet(*_verbose))", "os.Exit(3)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestImportCodegen(t *testing.T) {
+	tests := []struct {
+		input    string
+		imports  string
+		contains []string
+	}{
+		// Only the packages the code uses are imported, fmt included
+		{"x := 1", "", nil},
+		{"import \"os\"\n\nprint(argv)", "import (\n\t\"fmt\"\n\t\"os\"\n)\n", []string{"fmt.Println(os.Args)"}},
+		// An unused import is left out, and strings.upper is the runtime's
+		{"import \"os\"\nimport \"strings\"\n\nx := strings.upper(\"a\")",
+			"import (\n\tgosrt \"github.com/GrandpaEJ/go-script/runtime\"\n)\n", []string{"gosrt.Upper(\"a\")"}},
+		// Packages the program uses without importing them
+		{"x := strings.Repeat(\"a\", 2)\ny := 2 ** 3", "import (\n\t\"math\"\n\t\"strings\"\n)\n", []string{"math.Pow(2, 3)"}},
+		// A program's alias for a package is reused by the builtins
+		{"import \"os\" as system\n\nexit(system.Getpid())", "import (\n\tsystem \"os\"\n)\n", []string{"system.Exit(system.Getpid())"}},
+		{"import \"json\" as j\n\nb, _ := j.Marshal(1)", "import (\n\tj \"encoding/json\"\n)\n", nil},
+		// Names the program declares are not hidden by an import
+		{"time := 3\nprint(time, now())", "import (\n\t\"fmt\"\n\ttimepkg \"time\"\n)\n", []string{"fmt.Println(time, timepkg.Now())"}},
+		{"func fmt(x int) int:\n    return x\n\nprint(fmt(1))", "import (\n\tfmtpkg \"fmt\"\n)\n", []string{"fmtpkg.Println(fmt(1))"}},
+		{"import \"fmt\"\n\nfmt := \"shadow\"\nprint(fmt)", "import (\n\tfmtpkg \"fmt\"\n)\n", []string{"fmtpkg.Println(fmt)"}},
+		// Names imported with from ... import are used unqualified
+		{"from \"json\" import Marshal, Unmarshal\n\nb, _ := Marshal(1)\nprint(b)",
+			"import (\n\t\"encoding/json\"\n\t\"fmt\"\n)\n", []string{"b, _ := json.Marshal(1)"}},
+		// Package types import their package
+		{"func wait(d time.Duration):\n    print(d)", "import (\n\t\"fmt\"\n\t\"time\"\n)\n", nil},
+	}
+
+	for _, tt := range tests {
+		output := generate(t, tt.input, codegen.Options{})
+		header := strings.TrimPrefix(output, "package main\n\n")
+		if tt.imports == "" {
+			if strings.HasPrefix(header, "import") {
+				t.Errorf("%q: expected no imports:\n%s", tt.input, output)
+			}
+		} else if !strings.HasPrefix(header, tt.imports+"\n") {
+			t.Errorf("%q: expected imports\n%s\ngot:\n%s", tt.input, tt.imports, output)
+		}
+		for _, want := range tt.contains {
+			if !strings.Contains(output, want) {
+				t.Errorf("%q: generated code does not contain %q:\n%s", tt.input, want, output)
+			}
+		}
+	}
+}
+
+func TestTestCodegen(t *testing.T) {
+	code := `func add(a int, b int) int:
+    return a + b
+
+func main():
+    print(add(1, 2))`
+	tests := `func test_add(t):
+    x := 2
+    assert add(x, 3) == 5, "sum"
+
+func test_float(t):
+    assert 2.5 > x_of(1)
+
+func x_of(n int) float64:
+    return 1.0`
+
+	parse := func(input string) *ast.Program {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		return program
+	}
+	options := codegen.Options{SourceFile: "calc_test.gos", OutputFile: "main_test.go"}
+	output := codegen.NewWithOptions(options).GenerateTests(parse(tests), parse(code))
+
+	expected := []string{
+		"\t\"testing\"",
+		"func Test_add(t *testing.T) {",
+		"if _l1 := add(x, 3); !(_l1 == 5) {",
+		"//line calc_test.gos:3\n",
+		`t.Fatalf("assert add(x, 3) == 5 failed: %v\nadd(x, 3) = %#v", "sum", _l1)`,
+		// Constants stay in place, so 2.5 is compared as a float64
+		"if _r2 := x_of(1); !(2.5 > _r2) {",
+		"func x_of(n int) float64 {",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated tests do not contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "func main") || strings.Contains(output, "func add") {
+		t.Errorf("expected the tested program to be left out of the tests:\n%s", output)
+	}
+
+	// The lines after an assert get their positions in the Go file back
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "//line main_test.go:") && line != fmt.Sprintf("//line main_test.go:%d", i+2) {
+			t.Errorf("line %d: expected the directive to name line %d, got %q", i+1, i+2, line)
+		}
+	}
+
+	// Outside a test, a failed assert panics with its line
+	output = generate(t, "func check(n int):\n    assert n > 0", codegen.Options{})
+	want := `panic(fmt.Sprintf("assert n > 0 failed at line 2\nn = %#v", _l1))`
+	if !strings.Contains(output, want) {
+		t.Errorf("generated code does not contain %q:\n%s", want, output)
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	input := `func total(xs []int) int:
+    sum := 0
+    for x in xs:
+        sum += x
+    return sum
+
+pub struct Counter:
+    pub count int
+
+    func init(self):
+        self.count = 0`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	options := codegen.Options{SourceFile: "/src/counter.gos", OutputFile: "main.go", LineDirectives: true}
+	g := codegen.NewWithOptions(options)
+	output := g.Generate(program)
+
+	// Every line of a statement's code is marked with its line, and the
+	// rest of a compound statement with the line it starts on
+	expected := []string{
+		"//line /src/counter.gos:1\nfunc total(xs []int) int {",
+		"//line /src/counter.gos:3\n\tfor _, x := range xs {",
+		"//line /src/counter.gos:4\n\t\tsum += x",
+		"//line /src/counter.gos:3\n\t}",
+		"//line /src/counter.gos:5\n\treturn sum",
+		"//line /src/counter.gos:1\n}",
+		"//line /src/counter.gos:10\nfunc NewCounter() *Counter {",
+		"//line /src/counter.gos:11\n\tself.Count = 0",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+	// The code of no statement gets its position in main.go back
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if line == "type Counter struct {" && lines[i-1] != fmt.Sprintf("//line main.go:%d", i+1) {
+			t.Errorf("expected the struct to be marked as line %d of main.go, got %q", i+1, lines[i-1])
+		}
+	}
+
+	names := g.Names()
+	if len(names.TopLevel) != 0 {
+		t.Errorf("expected no renamed top-level names, got %v", names.TopLevel)
+	}
+	if names.Members["count"] != "Count" || names.Constructors["Counter"] != "NewCounter" {
+		t.Errorf("expected count and the constructor of Counter to be renamed, got %+v", names)
+	}
+	for name, want := range map[string]bool{"_err1": true, "_r2_1": true, "_l3": true, "_count": false, "err1": false} {
+		if got := codegen.IsTemporary(name); got != want {
+			t.Errorf("IsTemporary(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestDocCommentCodegen(t *testing.T) {
+	input := `# Package rules holds the pricing rules.
+package rules
+
+# discount returns the price after a discount
+pub func discount(price float64) float64:
+    return price * 0.9
+
+# Customer is a buyer
+pub struct Customer:
+    # Name of the customer
+    pub name string
+
+    # init makes a customer
+    func init(self, name string):
+        self.name = name`
+
+	output := generate(t, input, codegen.Options{SourceFile: "/src/rules.gos", OutputFile: "rules.go", LineDirectives: true})
+	expected := []string{
+		"// Package rules holds the pricing rules.\npackage rules\n",
+		"// Discount returns the price after a discount\n//line /src/rules.gos:5\nfunc Discount(",
+		"// Customer is a buyer\n",
+		"\t// Name of the customer\n\tName string `json:\"name\"`\n",
+		"// NewCustomer makes a customer\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, output)
+		}
+	}
+}
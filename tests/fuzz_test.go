@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"fmt"
+	goparser "go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/GrandpaEJ/go-script/pkg/codegen"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+	"github.com/GrandpaEJ/go-script/pkg/parser"
+)
+
+// The fuzz targets feed the compiler mistyped programs. The seeds are the
+// programs of the golden corpus; go test runs the targets on them alone,
+// and go test -fuzz mutates them, as in
+//
+//	go test ./tests -run '^$' -fuzz FuzzCodegen -fuzztime 1m
+//
+// Inputs that fail are saved in testdata/fuzz and run by go test from then
+// on.
+
+// fuzzTimeout is how long a stage may take on one input before the fuzz
+// target reports that it does not terminate
+const fuzzTimeout = 5 * time.Second
+
+// addFuzzSeeds adds the programs of the golden corpus to the seed corpus
+func addFuzzSeeds(f *testing.F) {
+	for _, pattern := range []string{"testdata/*.gos", "../examples/*.gos"} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, file := range files {
+			input, err := os.ReadFile(file)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(string(input))
+		}
+	}
+	f.Add("")
+	f.Add("func main(:\n    print(")
+	f.Add("if x:\n\tprint(1)\n  else:\n")
+	f.Add("x := [i for i in")
+	f.Add("s := f\"{x:\"\n")
+}
+
+// terminates runs stage, and fails the test if it panics or does not
+// return within fuzzTimeout. Stage runs in a goroutine of its own, so it
+// reports failures with t.Error.
+func terminates(t *testing.T, name string, stage func()) {
+	t.Helper()
+	done := make(chan string)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Sprintf("%v\n%s", p, debug.Stack())
+			}
+			close(done)
+		}()
+		stage()
+	}()
+	select {
+	case p := <-done:
+		if p != "" {
+			t.Fatalf("%s panicked: %s", name, p)
+		}
+	case <-time.After(fuzzTimeout):
+		t.Fatalf("%s did not finish within %v", name, fuzzTimeout)
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, input string) {
+		terminates(t, "the lexer", func() {
+			l := lexer.New(input)
+			// Every byte makes at most one token, and each line can close
+			// every indentation level; any more and the lexer is stuck
+			limit := 2*len(input) + 100
+			for i := 0; ; i++ {
+				if i > limit {
+					t.Errorf("the lexer made more than %d tokens of %d bytes", limit, len(input))
+					return
+				}
+				if l.NextToken().Type == lexer.EOF {
+					return
+				}
+			}
+		})
+	})
+}
+
+func FuzzParser(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, input string) {
+		terminates(t, "the parser", func() {
+			p := parser.New(lexer.New(input))
+			if program := p.ParseProgram(); program == nil {
+				t.Error("ParseProgram returned no program")
+			}
+		})
+	})
+}
+
+// FuzzCodegen checks that the Go code generated for a program the parser
+// accepts is valid Go syntax. It does not type-check the code, so the
+// programs need not pass the checker.
+func FuzzCodegen(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, input string) {
+		var code string
+		terminates(t, "the compiler", func() {
+			p := parser.New(lexer.New(input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				return
+			}
+			code = codegen.New().Generate(program)
+		})
+		if code == "" {
+			return
+		}
+		if _, err := goparser.ParseFile(token.NewFileSet(), "main.go", code, 0); err != nil {
+			t.Fatalf("the generated code is not valid Go: %v\n%s", err, code)
+		}
+	})
+}
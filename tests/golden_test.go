@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/checker"
+	"github.com/GrandpaEJ/go-script/pkg/codegen"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+	"github.com/GrandpaEJ/go-script/pkg/parser"
+)
+
+// The golden corpus holds .gos programs with the expected output of each
+// compiler stage next to them: name.tokens, name.ast, name.go.golden and
+// name.stdout. The programs are those in testdata and the examples, whose
+// expected output is kept in testdata/examples. After a change to the
+// compiler, rewrite the expected output with
+//
+//	go test ./tests -run TestGolden -update
+//
+// and review the diff.
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestGolden")
+
+// goldenCase is a program of the corpus and where its golden files go
+type goldenCase struct {
+	source string
+	golden string // the golden file path without its extension
+}
+
+// goldenCases returns the programs of the corpus
+func goldenCases(t *testing.T) []goldenCase {
+	var cases []goldenCase
+	for _, dir := range []struct{ programs, golden string }{
+		{"testdata", "testdata"},
+		{filepath.Join("..", "examples"), filepath.Join("testdata", "examples")},
+	} {
+		files, err := filepath.Glob(filepath.Join(dir.programs, "*.gos"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), ".gos")
+			cases = append(cases, goldenCase{source: file, golden: filepath.Join(dir.golden, name)})
+		}
+	}
+	if len(cases) == 0 {
+		t.Fatal("no programs in the golden corpus")
+	}
+	return cases
+}
+
+// dumpTokens returns the tokens of input, one per line
+func dumpTokens(input string) string {
+	var out strings.Builder
+	l := lexer.New(input)
+	for {
+		tok := l.NextToken()
+		fmt.Fprintf(&out, "%d:%d %s %q\n", tok.Line, tok.Column, lexer.TokenTypeString(tok.Type), tok.Literal)
+		if tok.Type == lexer.EOF {
+			break
+		}
+	}
+	return out.String()
+}
+
+// checkGolden compares got with the golden file at path, or writes it there
+// with -update
+func checkGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test ./tests -run TestGolden -update to create it", err)
+	}
+	if got == string(want) {
+		return
+	}
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Errorf("%s differs at line %d:\n got: %s\nwant: %s", path, i+1, g, w)
+			return
+		}
+	}
+}
+
+func TestGolden(t *testing.T) {
+	_, goErr := exec.LookPath("go")
+	gos := ""
+	if goErr == nil {
+		gos = buildGos(t)
+	}
+
+	for _, tc := range goldenCases(t) {
+		tc := tc
+		t.Run(tc.golden, func(t *testing.T) {
+			t.Parallel()
+			input, err := os.ReadFile(tc.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tc.golden+".tokens", dumpTokens(string(input)))
+
+			p := parser.New(lexer.New(string(input)))
+			program := p.ParseProgram()
+			if errs := p.Errors(); len(errs) > 0 {
+				t.Fatalf("parse errors: %v", errs)
+			}
+			checkGolden(t, tc.golden+".ast", ast.Dump(program))
+
+			c := checker.New()
+			c.Check(program)
+			if errs := c.Errors(); len(errs) > 0 {
+				t.Fatalf("check errors: %v", errs)
+			}
+			checkGolden(t, tc.golden+".go.golden", codegen.New().Generate(program))
+
+			if goErr != nil {
+				t.Skip("go is not installed, so the program is not run")
+			}
+			cmd := exec.Command(gos, "-q", "run", tc.source)
+			cmd.Stdin = strings.NewReader("")
+			output, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("running %s: %v", tc.source, err)
+			}
+			checkGolden(t, tc.golden+".stdout", string(output))
+		})
+	}
+}
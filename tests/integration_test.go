@@ -1,11 +1,21 @@
 package tests
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"net/textproto"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestHelloWorldIntegration(t *testing.T) {
@@ -18,13 +28,13 @@ func TestHelloWorldIntegration(t *testing.T) {
 	defer os.Remove(tempFile)
 
 	// Build the gos binary
-	buildGos(t)
+	gos := buildGos(t)
 
 	// Test compilation
 	goFile := strings.TrimSuffix(tempFile, ".gos") + ".go"
 	defer os.Remove(goFile)
 
-	cmd := exec.Command("./gos", "build", tempFile)
+	cmd := exec.Command(gos, "build", tempFile)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to compile .gos file: %v\nOutput: %s", err, output)
@@ -36,7 +46,7 @@ func TestHelloWorldIntegration(t *testing.T) {
 	}
 
 	// Test running
-	cmd = exec.Command("./gos", "run", tempFile)
+	cmd = exec.Command(gos, "run", tempFile)
 	output, err = cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to run .gos file: %v\nOutput: %s", err, output)
@@ -68,9 +78,9 @@ func main():
 	tempFile := createTempGosFile(t, "calc_test.gos", content)
 	defer os.Remove(tempFile)
 
-	buildGos(t)
+	gos := buildGos(t)
 
-	cmd := exec.Command("./gos", "run", tempFile)
+	cmd := exec.Command(gos, "run", tempFile)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to run calculator: %v\nOutput: %s", err, output)
@@ -113,9 +123,9 @@ func TestVariablesAndTypesIntegration(t *testing.T) {
 	tempFile := createTempGosFile(t, "vars_test.gos", content)
 	defer os.Remove(tempFile)
 
-	buildGos(t)
+	gos := buildGos(t)
 
-	cmd := exec.Command("./gos", "run", tempFile)
+	cmd := exec.Command(gos, "run", tempFile)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to run variables test: %v\nOutput: %s", err, output)
@@ -164,9 +174,9 @@ func TestControlFlowIntegration(t *testing.T) {
 	tempFile := createTempGosFile(t, "control_test.gos", content)
 	defer os.Remove(tempFile)
 
-	buildGos(t)
+	gos := buildGos(t)
 
-	cmd := exec.Command("./gos", "run", tempFile)
+	cmd := exec.Command(gos, "run", tempFile)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to run control flow test: %v\nOutput: %s", err, output)
@@ -197,9 +207,9 @@ func TestErrorHandlingIntegration(t *testing.T) {
 	tempFile := createTempGosFile(t, "error_test.gos", content)
 	defer os.Remove(tempFile)
 
-	buildGos(t)
+	gos := buildGos(t)
 
-	cmd := exec.Command("./gos", "build", tempFile)
+	cmd := exec.Command(gos, "build", tempFile)
 	output, err := cmd.CombinedOutput()
 	if err == nil {
 		t.Fatalf("Expected compilation to fail, but it succeeded. Output: %s", output)
@@ -241,9 +251,9 @@ func main():
 	tempFile := createTempGosFile(t, "complex_test.gos", content)
 	defer os.Remove(tempFile)
 
-	buildGos(t)
+	gos := buildGos(t)
 
-	cmd := exec.Command("./gos", "run", tempFile)
+	cmd := exec.Command(gos, "run", tempFile)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to run complex program: %v\nOutput: %s", err, output)
@@ -262,11 +272,168 @@ func main():
 	}
 }
 
+func TestRuntimeIntegration(t *testing.T) {
+	content := `func main():
+    n := int("20") + 1
+    print("Answer:", str(n * 2))
+    print(strings.upper("shout"), math.sqrt(81))
+    print("Evens:", range(0, 7, 2))`
+
+	tempFile := createTempGosFile(t, "runtime_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	// The runtime package is vendored into the generated module, so this
+	// works without network access
+	cmd := exec.Command(gos, "run", tempFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nOutput: %s", err, output)
+	}
+
+	for _, line := range []string{"Answer: 42", "SHOUT 9", "Evens: [0 2 4 6]"} {
+		if !strings.Contains(string(output), line) {
+			t.Fatalf("Expected output to contain '%s', but got:\n%s", line, output)
+		}
+	}
+}
+
+func TestRangeLoopIntegration(t *testing.T) {
+	content := `func main():
+    xs := range(1, 6)
+    total := 0
+    for i in range(len(xs) - 1, -1, -2):
+        total += xs[i]
+    print("Total:", total)
+    for i, x in enumerate(xs[1:3], 1):
+        print("Item", i, x)
+    for a, b in zip(xs, xs[::-1]):
+        print("Pair", a, b)
+    print("Last:", xs[-1], "hello"[1:-1], "hello"[-1], "hello"[-1:])`
+
+	tempFile := createTempGosFile(t, "range_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	cmd := exec.Command(gos, "run", tempFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nOutput: %s", err, output)
+	}
+
+	for _, line := range []string{"Total: 9", "Item 1 2", "Item 2 3", "Pair 1 5", "Pair 5 1", "Last: 5 ell 111 o"} {
+		if !strings.Contains(string(output), line) {
+			t.Fatalf("Expected output to contain '%s', but got:\n%s", line, output)
+		}
+	}
+}
+
+func TestListLiteralIntegration(t *testing.T) {
+	content := `func sum[N int | float64](xs []N) N:
+    total := N(0)
+    for x in xs:
+        total += x
+    return total
+
+func map_values[T, U any](xs []T, f func(T) U) []U:
+    var out []U = []
+    for x in xs:
+        out = append(out, f(x))
+    return out
+
+func main():
+    print("Sum:", sum([1, 2, 3]), sum([1.5, 2]))
+    var nums []int = [4, 5]
+    doubled := map_values(nums, func(n int) int:
+        return n * 2
+    )
+    print("Doubled:", doubled, doubled[0] + 1)
+    print("Mixed:", [1, "a"])`
+
+	tempFile := createTempGosFile(t, "list_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	cmd := exec.Command(gos, "run", tempFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nOutput: %s", err, output)
+	}
+
+	for _, line := range []string{"Sum: 6 3.5", "Doubled: [8 10] 9", "Mixed: [1 a]"} {
+		if !strings.Contains(string(output), line) {
+			t.Fatalf("Expected output to contain '%s', but got:\n%s", line, output)
+		}
+	}
+}
+
+func TestComprehensionIntegration(t *testing.T) {
+	content := `func main():
+    xs := range(1, 7)
+    evens := [x * 10 for x in xs if x % 2 == 0]
+    print("Evens:", evens)
+    squares := {x: x * x for x in xs if x > 4}
+    print("Squares:", squares)
+    lengths := {len(w) for w in strings.split("go is fun", " ")}
+    print("Lengths:", len(lengths))
+    print("Pairs:", [a * b for a in range(1, 3) for b in range(a, 3)])
+    print("Literal:", [x * 2 for x in [1, 2, 3] if x > 1], {w: len(w) for w in ["go", "gos"]})`
+
+	tempFile := createTempGosFile(t, "comprehension_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	cmd := exec.Command(gos, "run", tempFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nOutput: %s", err, output)
+	}
+
+	for _, line := range []string{"Evens: [20 40 60]", "Squares: map[5:25 6:36]", "Lengths: 2", "Pairs: [1 2 4]",
+		"Literal: [4 6] map[go:2 gos:3]"} {
+		if !strings.Contains(string(output), line) {
+			t.Fatalf("Expected output to contain '%s', but got:\n%s", line, output)
+		}
+	}
+}
+
+func TestFStringIntegration(t *testing.T) {
+	content := `func main():
+    name := "Go"
+    price := 1234.5
+    count := 7
+    print(f"{name:>4}|{price:,.2f}|{count:03d}|{0.25:.0%}|{{ok}}")
+    print("line one\nline two", 'it\'s', r"raw\n")
+    print("""triple "quoted"
+text""")`
+
+	tempFile := createTempGosFile(t, "fstring_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	cmd := exec.Command(gos, "run", tempFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nOutput: %s", err, output)
+	}
+
+	for _, line := range []string{"  Go|1,234.50|007|25%|{ok}", "line one\nline two it's raw\\n", "triple \"quoted\"\ntext"} {
+		if !strings.Contains(string(output), line) {
+			t.Fatalf("Expected output to contain '%s', but got:\n%s", line, output)
+		}
+	}
+}
+
 func TestCLICommands(t *testing.T) {
-	buildGos(t)
+	gos := buildGos(t)
 
 	// Test version command
-	cmd := exec.Command("./gos", "version")
+	cmd := exec.Command(gos, "version")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to run version command: %v", err)
@@ -277,7 +444,7 @@ func TestCLICommands(t *testing.T) {
 	}
 
 	// Test help command
-	cmd = exec.Command("./gos", "help")
+	cmd = exec.Command(gos, "help")
 	output, err = cmd.CombinedOutput()
 	if err != nil {
 		t.Fatalf("Failed to run help command: %v", err)
@@ -288,7 +455,7 @@ func TestCLICommands(t *testing.T) {
 	}
 
 	// Test invalid command
-	cmd = exec.Command("./gos", "invalid")
+	cmd = exec.Command(gos, "invalid")
 	output, err = cmd.CombinedOutput()
 	if err == nil {
 		t.Fatalf("Expected invalid command to fail")
@@ -313,15 +480,809 @@ func createTempGosFile(t *testing.T, filename, content string) string {
 	return tempFile
 }
 
-func buildGos(t *testing.T) {
-	// Check if gos binary already exists
-	if _, err := os.Stat("./gos"); err == nil {
-		return
+// gosBinary is the gos binary the integration tests run, which buildGos
+// builds from the current sources once per test process
+var gosBinary struct {
+	once   sync.Once
+	dir    string // the temporary directory of the binary, see TestMain
+	path   string
+	err    error
+	output []byte
+}
+
+// buildGos returns the path of the gos binary, which it builds the first
+// time it is called. A binary left by an earlier run is never used, so the
+// tests always run the code under test.
+func buildGos(t *testing.T) string {
+	t.Helper()
+	gosBinary.once.Do(func() {
+		gosBinary.dir, gosBinary.err = os.MkdirTemp("", "gos-test-")
+		if gosBinary.err != nil {
+			return
+		}
+		gosBinary.path = filepath.Join(gosBinary.dir, "gos")
+		cmd := exec.Command("go", "build", "-o", gosBinary.path, "../cmd/gos")
+		gosBinary.output, gosBinary.err = cmd.CombinedOutput()
+	})
+	if gosBinary.err != nil {
+		t.Fatalf("Failed to build gos binary: %v\nOutput: %s", gosBinary.err, gosBinary.output)
+	}
+	return gosBinary.path
+}
+
+// TestMain removes the gos binary buildGos built once the tests are done
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if gosBinary.dir != "" {
+		os.RemoveAll(gosBinary.dir)
+	}
+	os.Exit(code)
+}
+
+func TestScriptIntegration(t *testing.T) {
+	content := `#!/usr/bin/env gos
+func double(n int) int:
+    return n * 2
+
+total := 0
+for i in range(1, 4):
+    total += double(i)
+print("Total:", total)
+if __name__ == "__main__":
+    print("Running as", __name__)`
+
+	tempFile := createTempGosFile(t, "script_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	// gos file.gos is the same as gos run file.gos
+	cmd := exec.Command(gos, tempFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nOutput: %s", err, output)
+	}
+
+	for _, line := range []string{"Total: 12", "Running as __main__"} {
+		if !strings.Contains(string(output), line) {
+			t.Fatalf("Expected output to contain '%s', but got:\n%s", line, output)
+		}
+	}
+}
+
+func TestCLIIntegration(t *testing.T) {
+	content := `@cli
+func main(name string = "world", times int = 1, files []string) int:
+    for i in range(times):
+        print("Hello", name)
+    print("Files:", files, len(args()))
+    return len(files)`
+
+	tempFile := createTempGosFile(t, "cli_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	cmd := exec.Command(gos, "run", tempFile, "--", "-name", "Ada", "-times", "2", "a.txt", "b.txt")
+	output, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("Expected exit code 2, got %v\nOutput: %s", err, output)
+	}
+
+	for _, line := range []string{"Hello Ada\nHello Ada", "Files: [a.txt b.txt] 6"} {
+		if !strings.Contains(string(output), line) {
+			t.Fatalf("Expected output to contain '%s', but got:\n%s", line, output)
+		}
+	}
+}
+
+func TestArgvIntegration(t *testing.T) {
+	content := `print(argv[0], argv[1:])`
+
+	tempFile := createTempGosFile(t, "argv_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	// argv[0] is the .gos file, not the temporary program built from it
+	cmd := exec.Command(gos, "run", tempFile, "--", "a", "b")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nOutput: %s", err, output)
+	}
+
+	if want := tempFile + " [a b]"; !strings.Contains(string(output), want) {
+		t.Fatalf("Expected output to contain '%s', but got:\n%s", want, output)
+	}
+}
+
+func TestOutputStreamsIntegration(t *testing.T) {
+	content := `print("only this")`
+
+	tempFile := createTempGosFile(t, "streams_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	// Status lines go to stderr, so stdout is the program's output alone
+	cmd := exec.Command(gos, "-v", "run", tempFile)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to run program: %v\nStderr: %s", err, stderr.String())
+	}
+	if string(output) != "only this\n" {
+		t.Fatalf("Expected stdout to be the program output, but got:\n%s", output)
+	}
+	for _, line := range []string{"Compiled in:", "Running:", "Execution completed in:"} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Fatalf("Expected stderr to contain '%s', but got:\n%s", line, stderr.String())
+		}
+	}
+	if strings.Contains(stderr.String(), "\033[") {
+		t.Fatalf("Expected no colors when stderr is not a terminal, but got:\n%q", stderr.String())
+	}
+
+	cmd = exec.Command(gos, "-q", "--timing", "build", tempFile)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to build: %v\nOutput: %s", err, output)
+	}
+	defer os.Remove(strings.TrimSuffix(tempFile, ".gos") + ".go")
+	if strings.Contains(string(output), "Success:") {
+		t.Fatalf("Expected -q to hide the success message, but got:\n%s", output)
+	}
+	for _, phase := range []string{"lex", "parse", "check", "codegen", "total"} {
+		if !strings.Contains(string(output), "  "+phase) {
+			t.Fatalf("Expected --timing to report '%s', but got:\n%s", phase, output)
+		}
+	}
+}
+
+func TestWarningPositionsIntegration(t *testing.T) {
+	content := "import \"os\"\nimport \"json\" as j\n\nprint(os.Args[0] != \"\")"
+	tempFile := createTempGosFile(t, "warnings_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	// Warnings give the file and line they are about
+	cmd := exec.Command(gos, "run", tempFile)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run program: %v\nStderr: %s", err, stderr.String())
+	}
+	want := tempFile + ":2: import \"encoding/json\" as j is not used"
+	if !strings.Contains(stderr.String(), want) {
+		t.Errorf("Expected stderr to contain %q, but got:\n%s", want, stderr.String())
+	}
+}
+
+func TestSubcommandsIntegration(t *testing.T) {
+	content := `func main():
+    print("built")`
+
+	tempFile := createTempGosFile(t, "subcommands_test.gos", content)
+	defer os.Remove(tempFile)
+
+	gos := buildGos(t)
+
+	// Each command lists its own flags
+	output, err := exec.Command(gos, "help", "build").CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to show help: %v\nOutput: %s", err, output)
+	}
+	for _, flag := range []string{"-o file", "-tags list", "-race", "-ldflags flags", "-goos", "-goarch", "-quiet"} {
+		if !strings.Contains(string(output), flag) {
+			t.Fatalf("Expected help to list '%s', but got:\n%s", flag, output)
+		}
+	}
+
+	// Flags are parsed wherever they come before the file
+	binary := filepath.Join(t.TempDir(), "program")
+	cmd := exec.Command(gos, "build", "-tags", "gos", "-o", binary, "-ldflags", "-s -w", "-q", tempFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build binary: %v\nOutput: %s", err, output)
+	}
+	output, err = exec.Command(binary).Output()
+	if err != nil || string(output) != "built\n" {
+		t.Fatalf("Expected the binary to print 'built', got %q (%v)", output, err)
+	}
+
+	// The go build flags need a binary to apply to
+	cmd = exec.Command(gos, "build", "-race", tempFile)
+	output, err = cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("Expected exit code 2 for a misused flag, got %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "gos help build") {
+		t.Fatalf("Expected a pointer to the build help, but got:\n%s", output)
+	}
+
+	// Flags may also follow the file
+	binary = filepath.Join(t.TempDir(), "after")
+	cmd = exec.Command(gos, "build", tempFile, "-o", binary, "-q")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build binary: %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(binary); err != nil {
+		t.Fatalf("Expected -o after the file to build %s: %v", binary, err)
+	}
+
+	// Arguments the command does not take are errors
+	cmd = exec.Command(gos, "build", tempFile, "extra")
+	output, err = cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("Expected exit code 2 for an extra argument, got %v\nOutput: %s", err, output)
+	}
+	if !strings.Contains(string(output), "unexpected argument 'extra'") {
+		t.Fatalf("Expected the extra argument to be reported, but got:\n%s", output)
+	}
+}
+
+func TestReleaseBuildIntegration(t *testing.T) {
+	content := `var version string = "dev"
+
+func main():
+    print("version", version)`
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "tool.gos")
+	if err := os.WriteFile(source, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "gos.mod"), []byte("module tool\n\nversion \"1.4.0\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write gos.mod: %v", err)
+	}
+
+	gos := buildGos(t)
+
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	dist := filepath.Join(dir, "dist")
+	cmd := exec.Command(gos, "build", "--target", host+",windows/amd64", "-o", dist, source)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build release: %v\nOutput: %s", err, output)
+	}
+
+	hostBinary := "tool-" + runtime.GOOS + "-" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		hostBinary += ".exe"
+	}
+	sums, err := os.ReadFile(filepath.Join(dist, "SHA256SUMS"))
+	if err != nil {
+		t.Fatalf("Failed to read checksums: %v", err)
+	}
+	for _, name := range []string{hostBinary, "tool-windows-amd64.exe"} {
+		if _, err := os.Stat(filepath.Join(dist, name)); err != nil {
+			t.Fatalf("Expected binary %s: %v", name, err)
+		}
+		if !strings.Contains(string(sums), "  "+name+"\n") {
+			t.Fatalf("Expected checksums to list %s, but got:\n%s", name, sums)
+		}
+	}
+
+	// The version in gos.mod is stamped into the program
+	output, err := exec.Command(filepath.Join(dist, hostBinary)).Output()
+	if err != nil || string(output) != "version 1.4.0\n" {
+		t.Fatalf("Expected 'version 1.4.0', got %q (%v)", output, err)
+	}
+}
+
+func TestTestCommandIntegration(t *testing.T) {
+	code := `func add(a int, b int) int:
+    return a + b`
+	tests := `func test_add(t):
+    assert add(2, 3) == 5
+
+func test_wrong(t):
+    x := 4
+    assert add(x, 2) == 7, "off by one"`
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "calc.gos"), []byte(code), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
 	}
+	if err := os.WriteFile(filepath.Join(dir, "calc_test.gos"), []byte(tests), 0644); err != nil {
+		t.Fatalf("Failed to write tests: %v", err)
+	}
+
+	gos := buildGos(t)
 
-	cmd := exec.Command("go", "build", "-o", "gos", "../cmd/gos")
+	// A failed assert reports its .gos line and the operand values
+	cmd := exec.Command(gos, "test", dir)
 	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected exit code 1 from failing tests, got %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{
+		"--- FAIL: Test_wrong",
+		"calc_test.gos:6: assert add(x, 2) == 7 failed: off by one",
+		"add(x, 2) = 6",
+		"FAIL\t" + filepath.Join(dir, "calc_test.gos"),
+	} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(string(output), "Test_add") {
+		t.Errorf("Expected passing tests to be quiet without -v, got:\n%s", output)
+	}
+
+	// -run selects tests by their .gos names
+	cmd = exec.Command(gos, "test", "-v", "-cover", "-run", "^test_add$", dir+"/...")
+	output, err = cmd.CombinedOutput()
 	if err != nil {
-		t.Fatalf("Failed to build gos binary: %v\nOutput: %s", err, output)
+		t.Fatalf("Expected test_add to pass: %v\nOutput: %s", err, output)
+	}
+	for _, want := range []string{"--- PASS: Test_add", "coverage: 100.0% of statements"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(string(output), "Test_wrong") {
+		t.Errorf("Expected -run to skip test_wrong, got:\n%s", output)
+	}
+}
+
+func TestDebugJSONIntegration(t *testing.T) {
+	content := `func main():
+    print("ran")`
+
+	tempFile := createTempGosFile(t, "debug.gos", content)
+	gos := buildGos(t)
+
+	// The outputs of the stages are written as JSON, and the program is
+	// not run
+	cmd := exec.Command(gos, "debug", "--tokens", "--ast", "--go", "--json", tempFile)
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to run debug: %v\nOutput: %s", err, output)
+	}
+	var doc struct {
+		Tokens []struct {
+			Type   string
+			Line   int
+			Column int
+		}
+		AST struct {
+			Node       string
+			Statements []map[string]interface{}
+		}
+		Go     string
+		Errors []string
+	}
+	if err := json.Unmarshal(output, &doc); err != nil {
+		t.Fatalf("Expected JSON output: %v\n%s", err, output)
+	}
+	if len(doc.Tokens) == 0 || doc.Tokens[0].Type != "FUNC" || doc.Tokens[0].Line != 1 || doc.Tokens[0].Column != 1 {
+		t.Errorf("Expected the first token to be FUNC at 1:1, got %+v", doc.Tokens)
+	}
+	if doc.AST.Node != "Program" || len(doc.AST.Statements) != 1 || doc.AST.Statements[0]["node"] != "FunctionDecl" {
+		t.Errorf("Expected a program with a function, got %+v", doc.AST)
+	}
+	if !strings.Contains(doc.Go, "func main() {") || doc.Errors != nil {
+		t.Errorf("Expected the Go code and no errors, got %q and %v", doc.Go, doc.Errors)
+	}
+	if strings.Contains(string(output), "ran\n") {
+		t.Errorf("Expected the program not to run, got:\n%s", output)
+	}
+
+	// Errors are reported in the document
+	badFile := createTempGosFile(t, "bad.gos", "func main(:\n")
+	output, err = exec.Command(gos, "debug", "--ast", "--json", badFile).Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected exit code 1 for a file with errors, got %v", err)
+	}
+	doc.Errors = nil
+	if err := json.Unmarshal(output, &doc); err != nil || len(doc.Errors) == 0 {
+		t.Errorf("Expected a JSON document with errors, got %v\n%s", err, output)
+	}
+}
+
+// dapClient talks to gos debug --dap over its stdin and stdout
+type dapClient struct {
+	t      *testing.T
+	stdin  io.Writer
+	stdout *bufio.Reader
+	seq    int
+	events []map[string]interface{}
+}
+
+// request sends a request and returns its response, keeping the events
+// that come before it
+func (c *dapClient) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.seq++
+	body, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("Failed to send %s: %v", command, err)
+	}
+	for {
+		header, err := textproto.NewReader(c.stdout).ReadMIMEHeader()
+		if err != nil {
+			c.t.Fatalf("Failed to read the response to %s: %v", command, err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(c.stdout, body); err != nil {
+			c.t.Fatalf("Failed to read the response to %s: %v", command, err)
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			c.t.Fatalf("Invalid DAP message %s: %v", body, err)
+		}
+		if msg["type"] == "response" && msg["request_seq"] == float64(c.seq) {
+			return msg
+		}
+		c.events = append(c.events, msg)
+	}
+}
+
+func TestDebugDAPIntegration(t *testing.T) {
+	content := `pub struct Counter:
+    pub count int
+
+    func init(self):
+        self.count = 0
+
+    pub func mut inc(self):
+        self.count += 1
+
+func main():
+    c := Counter()
+    c.inc()
+    print(c.count)
+
+main()`
+
+	source := createTempGosFile(t, "counter.gos", content)
+	gos := buildGos(t)
+
+	// fakedlv answers as Delve would for the program gos builds
+	dlv := filepath.Join(t.TempDir(), "dlv")
+	if output, err := exec.Command("go", "build", "-o", dlv, "./testdata/fakedlv").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build fakedlv: %v\nOutput: %s", err, output)
+	}
+	cmd := exec.Command(gos, "debug", "--dap", "--dlv", dlv)
+	cmd.Dir = filepath.Dir(source)
+	cmd.Env = append(os.Environ(), "FAKEDLV_SOURCE="+source)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start debug: %v", err)
+	}
+	defer cmd.Process.Kill()
+	c := &dapClient{t: t, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	c.request("initialize", map[string]interface{}{"adapterID": "go-script"})
+
+	// A program with errors is reported without starting it
+	bad := createTempGosFile(t, "bad.gos", "func main(:\n")
+	if resp := c.request("launch", map[string]interface{}{"program": bad}); resp["success"] != false ||
+		!strings.Contains(fmt.Sprint(resp["message"]), "expected a parameter name") {
+		t.Errorf("Expected launch to fail with the parse error, got %v", resp)
+	}
+
+	// The .gos program is built, and Delve runs the binary
+	if resp := c.request("launch", map[string]interface{}{"program": source}); resp["success"] != true {
+		t.Fatalf("Expected launch to succeed, got %v", resp)
+	}
+	var launch map[string]interface{}
+	for _, event := range c.events {
+		if event["event"] == "output" {
+			json.Unmarshal([]byte(event["body"].(map[string]interface{})["output"].(string)), &launch)
+		}
+	}
+	if launch["mode"] != "exec" || strings.HasSuffix(fmt.Sprint(launch["program"]), ".gos") {
+		t.Errorf("Expected Delve to launch the built binary, got %v", launch)
+	}
+
+	// Breakpoints are set on the .gos file by its absolute path
+	resp := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": "counter.gos"},
+		"breakpoints": []interface{}{map[string]interface{}{"line": 8}},
+	})
+	breakpoint := resp["body"].(map[string]interface{})["breakpoints"].([]interface{})[0].(map[string]interface{})
+	if path := breakpoint["source"].(map[string]interface{})["path"]; path != source {
+		t.Errorf("Expected the breakpoint path %s, got %v", source, path)
+	}
+
+	// Stack frames have the .gos names
+	resp = c.request("stackTrace", map[string]interface{}{"threadId": 1})
+	var names []string
+	for _, f := range resp["body"].(map[string]interface{})["stackFrames"].([]interface{}) {
+		frame := f.(map[string]interface{})
+		names = append(names, fmt.Sprintf("%v/%v", frame["name"], frame["presentationHint"]))
+	}
+	if got, want := strings.Join(names, " "), "Counter.inc/<nil> Counter.init/<nil> main/<nil> runtime.main/subtle"; got != want {
+		t.Errorf("Expected the frames %s, got %s", want, got)
+	}
+
+	// Variables have the .gos names, without the generated ones
+	resp = c.request("variables", map[string]interface{}{"variablesReference": 1})
+	var variables []string
+	for _, v := range resp["body"].(map[string]interface{})["variables"].([]interface{}) {
+		variable := v.(map[string]interface{})
+		variables = append(variables, fmt.Sprintf("%v %v = %v (%v)", variable["name"], variable["type"], variable["value"], variable["evaluateName"]))
+	}
+	if got, want := strings.Join(variables, "; "), "count int = 2 (c.count); c *Counter = *Counter {Count: 2} (c)"; got != want {
+		t.Errorf("Expected the variables %s, got %s", want, got)
+	}
+
+	// Expressions are evaluated with the Go names
+	resp = c.request("evaluate", map[string]interface{}{"expression": `c.count + len("c.count")`})
+	if result := resp["body"].(map[string]interface{})["result"]; result != `c.Count + len("c.count")` {
+		t.Errorf("Expected the expression to use the Go names, got %v", result)
+	}
+
+	c.request("disconnect", nil)
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("Expected debug to exit when the session ends: %v", err)
+	}
+}
+
+func TestWatchIntegration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("watch mode is stopped with an interrupt, which Windows cannot send")
+	}
+	source := createTempGosFile(t, "watched.gos", "func main():\n    print(\"v1\")\n")
+	gos := buildGos(t)
+
+	cmd := exec.Command(gos, "run", "--watch", source)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start run --watch: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case line := <-lines:
+			if line != want {
+				t.Fatalf("Expected the output %q, got %q", want, line)
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatalf("Timed out waiting for the output %q; stderr:\n%s", want, stderr.String())
+		}
+	}
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(source, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect("v1")
+
+	// Errors are listed in full once, and after that only the new ones
+	write("func main(:\n")
+	time.Sleep(time.Second)
+	write("func main(:\n    x = )\n")
+	time.Sleep(time.Second)
+
+	// The program runs again once it compiles
+	write("func main():\n    print(\"v2\")\n")
+	expect("v2")
+
+	cmd.Process.Signal(os.Interrupt)
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("Expected run --watch to exit when interrupted: %v", err)
+	}
+	output := stderr.String()
+	if strings.Count(output, "expected a parameter name") != 1 {
+		t.Errorf("Expected the first errors to be listed once, got:\n%s", output)
+	}
+	if !strings.Contains(output, "+ no prefix parse function for RPAREN found") ||
+		!strings.Contains(output, "fixed all") {
+		t.Errorf("Expected the new errors and the fix to be reported, got:\n%s", output)
+	}
+}
+
+func TestVetIntegration(t *testing.T) {
+	source := createTempGosFile(t, "vetted.gos", `import "os"
+
+func main():
+    count := 0
+    # gos:ignore unused-variable
+    total := 0
+
+main()
+`)
+	clean := createTempGosFile(t, "clean.gos", "func main():\n    print(1)\n\nmain()\n")
+	gos := buildGos(t)
+
+	cmd := exec.Command(gos, "vet", source)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected vet to exit with code 1, got %v\nOutput: %s", err, output)
+	}
+	expected := source + `:1: warning: import "os" is not used [unused-import]
+` + source + `:4: error: count is declared but never used [unused-variable]
+`
+	if string(output) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+	}
+
+	// Only the checks asked for run, and a clean file passes
+	output, err = exec.Command(gos, "vet", "--checks", "unused-import", source, clean).CombinedOutput()
+	if err == nil || strings.Contains(string(output), "unused-variable") {
+		t.Errorf("Expected only the unused import, got %v\nOutput: %s", err, output)
+	}
+	if output, err := exec.Command(gos, "vet", clean).CombinedOutput(); err != nil {
+		t.Errorf("Expected a clean file to pass: %v\nOutput: %s", err, output)
+	}
+}
+
+func TestCompleteIntegration(t *testing.T) {
+	source := createTempGosFile(t, "complete.gos", "import \"net/http\" as web\n\nfunc main():\n    web.\n")
+	gos := buildGos(t)
+
+	output, err := exec.Command(gos, "complete", source, "web").Output()
+	if err != nil {
+		t.Fatalf("gos complete failed: %v", err)
+	}
+	if !strings.Contains(string(output), "Get\tfunc\tfunc(url string) (resp *Response, err error)\n") {
+		t.Errorf("Expected the members of net/http, got:\n%s", output)
+	}
+
+	// The text being edited comes from stdin, and fmt needs no import
+	cmd := exec.Command(gos, "complete", "--json", "-", "fmt")
+	cmd.Stdin = strings.NewReader("func main():\n    fmt.\n")
+	output, err = cmd.Output()
+	if err != nil {
+		t.Fatalf("gos complete - failed: %v", err)
+	}
+	var members []struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(output, &members); err != nil {
+		t.Fatalf("Expected JSON, got %v:\n%s", err, output)
+	}
+	found := false
+	for _, m := range members {
+		found = found || m.Name == "Println" && m.Kind == "func"
+	}
+	if !found {
+		t.Errorf("Expected fmt.Println among %v", members)
+	}
+
+	if err := exec.Command(gos, "complete", source, "nothing").Run(); err == nil {
+		t.Error("Expected an error for a name that is not a package")
+	}
+}
+
+func TestLibraryBuildIntegration(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rules/pricing.gos": `# Package rules holds the pricing rules.
+package rules
+
+import "os"
+
+# discount returns the price after a discount
+pub func discount(price int, percent int) int:
+    return price - price * percent / 100`,
+		"rules/customer.gos": `package rules
+
+pub struct Customer:
+    pub name string
+    level int
+
+# count counts the arguments of the program
+pub func count() int:
+    return len(args())
+
+pub func greet(c Customer) string:
+    return "Hello, " + c.name`,
+		"bad/a.gos": `package bad
+
+pub func one() int:
+    return 1`,
+		"bad/b.gos": `package bad
+
+pub struct Point:
+    pub x int
+
+pub func origin() Point:
+    return Point{x: 0, y: 0}`,
+		"rules/rules_test.gos": `package rules
+
+func test_discount(t):
+    assert discount(100, 10) == 90`,
+		"svc/go.mod": "module example.com/svc\n\ngo 1.22\n\nrequire example.com/rules v0.0.0\n\nreplace example.com/rules => ../out\n",
+		"svc/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/rules"
+)
+
+func main() {
+	fmt.Println(rules.Discount(200, 10), rules.Greet(rules.Customer{Name: "Ada"}), rules.Count())
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	gos := buildGos(t)
+
+	out := filepath.Join(dir, "out")
+	cmd := exec.Command(gos, "build", "--lib", "--module", "example.com/rules", "-o", out, filepath.Join(dir, "rules"))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to build library: %v\nOutput: %s", err, output)
+	}
+	// Diagnostics give the file of the package they are about
+	if want := filepath.Join(dir, "rules", "pricing.gos") + ":4: import \"os\" is not used"; !strings.Contains(string(output), want) {
+		t.Errorf("Expected the warning %q, got:\n%s", want, output)
+	}
+	goMod, err := os.ReadFile(filepath.Join(out, "go.mod"))
+	if err != nil || !strings.HasPrefix(string(goMod), "module example.com/rules\n") {
+		t.Fatalf("Expected a go.mod for example.com/rules, got %q (%v)", goMod, err)
+	}
+	code, err := os.ReadFile(filepath.Join(out, "rules.go"))
+	if err != nil {
+		t.Fatalf("Failed to read Go code: %v", err)
+	}
+	for _, want := range []string{
+		"// Package rules holds the pricing rules.\npackage rules\n",
+		"\"example.com/rules/internal/runtime\"",
+		"// Discount returns the price after a discount\n",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("Expected the Go code to contain %q:\n%s", want, code)
+		}
+	}
+	if strings.Contains(string(code), "TestDiscount") {
+		t.Errorf("Expected the tests to be left out:\n%s", code)
+	}
+	if formatted, err := format.Source(code); err != nil || string(formatted) != string(code) {
+		t.Errorf("Expected the Go code to be gofmt'd (%v):\n%s", err, code)
+	}
+
+	// A Go module imports the package
+	run := exec.Command("go", "run", ".", "a", "b")
+	run.Dir = filepath.Join(dir, "svc")
+	run.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	output, err = run.CombinedOutput()
+	if err != nil || string(output) != "180 Hello, Ada 2\n" {
+		t.Fatalf("Expected '180 Hello, Ada 2', got %q (%v)", output, err)
+	}
+
+	output, err = exec.Command(gos, "build", "--lib", "-o", filepath.Join(dir, "bad-out"), filepath.Join(dir, "bad")).CombinedOutput()
+	if want := filepath.Join(dir, "bad", "b.gos") + ":7: unknown field y in Point literal"; err == nil || !strings.Contains(string(output), want) {
+		t.Errorf("Expected the error %q, got %q (%v)", want, output, err)
+	}
+
+	// A program is not a library
+	main := filepath.Join(dir, "main.gos")
+	if err := os.WriteFile(main, []byte("func main():\n    print(1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output, err = exec.Command(gos, "build", "--lib", main).CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "package main") {
+		t.Errorf("Expected an error for package main, got %q (%v)", output, err)
 	}
 }
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/GrandpaEJ/go-script/pkg/lexer"
@@ -185,7 +186,7 @@ func TestLexerStrings(t *testing.T) {
 		expectedLiteral string
 	}{
 		{lexer.STRING, "hello world"},
-		{lexer.STRING, "escaped \\\"quote\\\""},
+		{lexer.STRING, "escaped \"quote\""},
 		{lexer.CHAR, "single quote"},
 		{lexer.EOF, ""},
 	}
@@ -239,3 +240,49 @@ func main():
 		}
 	}
 }
+
+func TestLexerStringLiterals(t *testing.T) {
+	input := `"tab\there\n" "\x41\u00e9\101" r"C:\dir\"" '''multi
+'line''' f"{x:>4}" Rb rf'\d{n}'`
+
+	tests := []struct {
+		expectedType    lexer.TokenType
+		expectedLiteral string
+	}{
+		{lexer.STRING, "tab\there\n"},
+		{lexer.STRING, "AéA"},
+		{lexer.STRING, `C:\dir\"`},
+		{lexer.CHAR, "multi\n'line"},
+		{lexer.FSTRING, "{x:>4}"},
+		{lexer.IDENT, "Rb"},
+		{lexer.FSTRING, `\d{n}`},
+		{lexer.EOF, ""},
+	}
+
+	l := lexer.New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q, got %s %q", i,
+				lexer.TokenTypeString(tt.expectedType), tt.expectedLiteral,
+				lexer.TokenTypeString(tok.Type), tok.Literal)
+		}
+	}
+	if errors := l.Errors(); len(errors) != 0 {
+		t.Errorf("unexpected lexer errors: %v", errors)
+	}
+
+	for input, expectedError := range map[string]string{
+		`"\d"`:          `invalid escape sequence \d at line 1`,
+		`"\x4"`:         `invalid escape sequence \x4"`,
+		"\"open\nx":     "unterminated string at line 1",
+		`"""never done`: "unterminated string starting at line 1",
+	} {
+		l := lexer.New(input)
+		for tok := l.NextToken(); tok.Type != lexer.EOF; tok = l.NextToken() {
+		}
+		if errors := l.Errors(); len(errors) == 0 || !strings.Contains(errors[0], expectedError) {
+			t.Errorf("%q: expected error %q, got %v", input, expectedError, errors)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package tests
 
 import (
+	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/GrandpaEJ/go-script/pkg/ast"
@@ -239,6 +242,150 @@ func TestStructDeclaration(t *testing.T) {
 	}
 }
 
+func TestStructLiteral(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedFields []string
+		expectedValues int
+		addressOf      bool
+	}{
+		{`Person{name: "Alice", age: 30}`, []string{"name", "age"}, 0, false},
+		{`Person{"Bob", 25}`, nil, 2, false},
+		{`&Person{name: "Carol"}`, []string{"name"}, 0, true},
+		{"Person{\n    name: \"Dave\",\n    age: 40,\n}", []string{"name", "age"}, 0, false},
+		{`Person{}`, nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStmt)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ExpressionStmt. got=%T",
+				program.Statements[0])
+		}
+
+		exp := stmt.Expression
+		if tt.addressOf {
+			unary, ok := exp.(*ast.UnaryExpr)
+			if !ok || unary.Operator != "&" {
+				t.Fatalf("expression is not &T{...}. got=%T(%s)", exp, exp)
+			}
+			exp = unary.Operand
+		}
+
+		lit, ok := exp.(*ast.StructLiteral)
+		if !ok {
+			t.Fatalf("expression is not *ast.StructLiteral. got=%T", exp)
+		}
+
+		if !testIdentifier(t, lit.Type, "Person") {
+			return
+		}
+
+		if len(lit.Fields) != len(tt.expectedFields) {
+			t.Fatalf("wrong number of fields. expected=%d, got=%d", len(tt.expectedFields), len(lit.Fields))
+		}
+		for i, name := range tt.expectedFields {
+			if lit.Fields[i].Name != name {
+				t.Fatalf("field %d wrong. expected=%q, got=%q", i, name, lit.Fields[i].Name)
+			}
+		}
+
+		if len(lit.Values) != tt.expectedValues {
+			t.Fatalf("wrong number of values. expected=%d, got=%d", tt.expectedValues, len(lit.Values))
+		}
+	}
+}
+
+func TestStructLiteralMixedInitializers(t *testing.T) {
+	l := lexer.New(`Person{name: "Alice", 30}`)
+	p := parser.New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected an error for mixed field:value and value initializers")
+	}
+}
+
+func TestStructEmbeddingAndConstructor(t *testing.T) {
+	input := `struct Employee:
+    Person
+    *sync.Mutex
+    salary float64
+
+    func init(self, name string, salary float64):
+        self.name = name
+        self.salary = salary
+
+    func raise(self, amount float64):
+        self.salary += amount`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.StructDecl)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.StructDecl. got=%T",
+			program.Statements[0])
+	}
+
+	if len(stmt.Fields) != 3 {
+		t.Fatalf("struct fields wrong. expected=3, got=%d", len(stmt.Fields))
+	}
+
+	if !stmt.Fields[0].Embedded || stmt.Fields[0].Name != "Person" {
+		t.Fatalf("field 0 is not embedded Person. got=%+v", stmt.Fields[0])
+	}
+
+	if !stmt.Fields[1].Embedded || stmt.Fields[1].Name != "Mutex" || !stmt.Fields[1].Type.IsPointer {
+		t.Fatalf("field 1 is not embedded *sync.Mutex. got=%+v", stmt.Fields[1])
+	}
+
+	if stmt.Fields[2].Embedded || stmt.Fields[2].Name != "salary" {
+		t.Fatalf("field 2 wrong. expected='salary float64', got=%+v", stmt.Fields[2])
+	}
+
+	if stmt.Constructor == nil {
+		t.Fatalf("struct constructor not parsed")
+	}
+
+	if len(stmt.Constructor.Parameters) != 2 {
+		t.Fatalf("constructor parameters wrong. expected=2 (self excluded), got=%d",
+			len(stmt.Constructor.Parameters))
+	}
+
+	if len(stmt.Constructor.Body.Statements) != 2 {
+		t.Fatalf("constructor body wrong. expected=2 statements, got=%d",
+			len(stmt.Constructor.Body.Statements))
+	}
+
+	if len(stmt.Methods) != 1 || stmt.Methods[0].Name != "raise" {
+		t.Fatalf("struct methods wrong. expected=[raise], got=%d", len(stmt.Methods))
+	}
+
+	assign, ok := stmt.Methods[0].Body.Statements[0].(*ast.AssignStmt)
+	if !ok {
+		t.Fatalf("method body is not *ast.AssignStmt. got=%T", stmt.Methods[0].Body.Statements[0])
+	}
+
+	if assign.Operator != "+=" {
+		t.Fatalf("assignment operator wrong. expected='+=', got=%q", assign.Operator)
+	}
+}
+
 func TestExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -385,3 +532,698 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, ope
 
 	return true
 }
+
+func TestPointerReceivers(t *testing.T) {
+	tests := []struct {
+		method          string
+		expectedPointer bool
+	}{
+		{"func age(self) int:\n        return self.years", false},
+		{"func mut birthday(self):\n        self.years += 1", true},
+		{"func rename(*self, name string):\n        self.name = name", true},
+		{"func mut(self) int:\n        return 0", false},
+	}
+
+	for _, tt := range tests {
+		input := "struct Person:\n    name string\n    years int\n\n    " + tt.method
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.StructDecl)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.StructDecl. got=%T",
+				program.Statements[0])
+		}
+
+		if len(stmt.Methods) != 1 {
+			t.Fatalf("%q: struct methods wrong. expected=1, got=%d", tt.method, len(stmt.Methods))
+		}
+
+		method := stmt.Methods[0]
+		if method.Receiver.Type.IsPointer != tt.expectedPointer {
+			t.Errorf("%q: pointer receiver wrong. expected=%t, got=%t",
+				tt.method, tt.expectedPointer, method.Receiver.Type.IsPointer)
+		}
+
+		for _, param := range method.Parameters {
+			if param.Name == "self" {
+				t.Errorf("%q: self was not removed from the parameters", tt.method)
+			}
+		}
+	}
+}
+
+func TestFunctionLiteralsAndLambdas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f := lambda x, y: x + y", "lambda x, y: (x + y)"},
+		{"f := lambda: 42", "lambda: 42"},
+		{"f := lambda x int: x * 2", "lambda x int: (x * 2)"},
+		{"f := lambda x: lambda y: x + y", "lambda x: lambda y: (x + y)"},
+		{"f := func(x int) int: return x * 2", "func(x int) int:\n    return (x * 2)"},
+		{"f := func():\n    print(1)\n    print(2)", "func():\n    print(1)\n    print(2)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.VarDecl)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.VarDecl. got=%T",
+				program.Statements[0])
+		}
+
+		if stmt.Value.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, stmt.Value.String())
+		}
+	}
+}
+
+func TestFunctionTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var f func(int, int) int = g", "func(int, int) int"},
+		{"var f func() = g", "func()"},
+		{"var f func(string) (int, error) = g", "func(string) (int, error)"},
+		{"var f func(func(int) bool) []int = g", "func(func(int) bool) []int"},
+		{"var f []func() = g", "[]func()"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.VarDecl)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.VarDecl. got=%T",
+				program.Statements[0])
+		}
+
+		if stmt.Type == nil || stmt.Type.String() != tt.expected {
+			t.Errorf("%q: expected type %q, got %v", tt.input, tt.expected, stmt.Type)
+		}
+	}
+}
+
+func TestGenericDeclarations(t *testing.T) {
+	input := `struct Stack[T]:
+    items []T
+
+    func mut push(self, item T):
+        self.items = append(self.items, item)
+
+func map_values[T, U](xs []T, f func(T) U) []U:
+    return nil
+
+func keys[K, V comparable](m map[K]V) []K:
+    return nil
+
+func sum[N ~int | ~float64, M any](xs []N) N:
+    return 0`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	stack, ok := program.Statements[0].(*ast.StructDecl)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.StructDecl. got=%T",
+			program.Statements[0])
+	}
+	if len(stack.TypeParams) != 1 || stack.TypeParams[0].String() != "T any" {
+		t.Errorf("struct type params wrong. got=%v", stack.TypeParams)
+	}
+	if receiver := stack.Methods[0].Receiver.Type.String(); receiver != "*Stack[T]" {
+		t.Errorf("method receiver wrong. expected=*Stack[T], got=%s", receiver)
+	}
+
+	expected := []string{
+		"func map_values[T any, U any](xs []T, f func(T) U) []U:",
+		"func keys[K comparable, V comparable](m map[K]V) []K:",
+		"func sum[N ~int | ~float64, M any](xs []N) N:",
+	}
+	for i, want := range expected {
+		fn, ok := program.Statements[i+1].(*ast.FunctionDecl)
+		if !ok {
+			t.Fatalf("program.Statements[%d] is not *ast.FunctionDecl. got=%T",
+				i+1, program.Statements[i+1])
+		}
+		if got := strings.SplitN(fn.String(), "\n", 2)[0]; got != want {
+			t.Errorf("function wrong. expected=%q, got=%q", want, got)
+		}
+	}
+}
+
+func TestGenericInstantiation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x := Stack[int]{}", "Stack[int]{}"},
+		{"x := Pair[string, int]{key: \"a\", value: 1}", "Pair[string, int]{key: \"a\", value: 1}"},
+		{"x := make_list[[]int]()", "make_list[[]int]()"},
+		{"x := lookup[map[string]int, *Node[T]](m)", "lookup[map[string]int, *Node[T]](m)"},
+		{"x := items[i]", "items[i]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.VarDecl)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.VarDecl. got=%T",
+				program.Statements[0])
+		}
+		if stmt.Value.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, stmt.Value.String())
+		}
+	}
+}
+
+func TestMakeAndNewTypeArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		typeArg  bool // the first argument is an *ast.TypeExpr
+	}{
+		{"x := make([]int, 2, 4)", "make([]int, 2, 4)", true},
+		{"x := make(map[string][]int)", "make(map[string][]int)", true},
+		{"x := new(*Node[T])", "new(*Node[T])", true},
+		{"x := new(Point)", "new(Point)", false},
+		{"x := make(kind, 2)", "make(kind, 2)", false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.VarDecl)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.VarDecl. got=%T",
+				program.Statements[0])
+		}
+		if stmt.Value.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, stmt.Value.String())
+		}
+		call := stmt.Value.(*ast.CallExpr)
+		if _, ok := call.Arguments[0].(*ast.TypeExpr); ok != tt.typeArg {
+			t.Errorf("%q: first argument is %T", tt.input, call.Arguments[0])
+		}
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	input := `func load(path string) (string, error):
+    try:
+        data := read(path)?
+        return data, nil
+    except io.EOF:
+        return "", nil
+    except *os.PathError as e:
+        raise e
+    except:
+        raise
+    finally:
+        close(path)`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	fn, ok := program.Statements[0].(*ast.FunctionDecl)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.FunctionDecl. got=%T",
+			program.Statements[0])
+	}
+	if fn.ReturnType.String() != "(string, error)" {
+		t.Errorf("return type wrong. expected=(string, error), got=%s", fn.ReturnType)
+	}
+
+	try, ok := fn.Body.Statements[0].(*ast.TryStmt)
+	if !ok {
+		t.Fatalf("fn.Body.Statements[0] is not *ast.TryStmt. got=%T", fn.Body.Statements[0])
+	}
+	if len(try.Body.Statements) != 2 {
+		t.Errorf("try body has wrong number of statements. got=%d", len(try.Body.Statements))
+	}
+	if len(try.Handlers) != 3 {
+		t.Fatalf("wrong number of except clauses. got=%d", len(try.Handlers))
+	}
+	if try.Handlers[0].Type.String() != "io.EOF" || try.Handlers[0].Name != "" {
+		t.Errorf("first except clause wrong. got=%s as %q", try.Handlers[0].Type, try.Handlers[0].Name)
+	}
+	if try.Handlers[1].Type.String() != "*os.PathError" || try.Handlers[1].Name != "e" {
+		t.Errorf("second except clause wrong. got=%s as %q", try.Handlers[1].Type, try.Handlers[1].Name)
+	}
+	if try.Handlers[2].Type != nil {
+		t.Errorf("bare except has a type. got=%s", try.Handlers[2].Type)
+	}
+	if raise, ok := try.Handlers[2].Body.Statements[0].(*ast.RaiseStmt); !ok || raise.Value != nil {
+		t.Errorf("bare raise wrong. got=%v", try.Handlers[2].Body.Statements[0])
+	}
+	if try.Finally == nil || len(try.Finally.Statements) != 1 {
+		t.Errorf("finally clause missing")
+	}
+
+	decl, ok := try.Body.Statements[0].(*ast.VarDecl)
+	if !ok {
+		t.Fatalf("try.Body.Statements[0] is not *ast.VarDecl. got=%T", try.Body.Statements[0])
+	}
+	if _, ok := decl.Value.(*ast.PropagateExpr); !ok || decl.Value.String() != "read(path)?" {
+		t.Errorf("propagation wrong. got=%T %s", decl.Value, decl.Value)
+	}
+	ret := try.Body.Statements[1].(*ast.ReturnStmt)
+	if tuple, ok := ret.Value.(*ast.TupleExpr); !ok || len(tuple.Elements) != 2 {
+		t.Errorf("return value is not a pair. got=%T %s", ret.Value, ret.Value)
+	}
+}
+
+func TestTupleAssignmentAndPropagation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"n, err := strconv.Atoi(s)", "n, err := strconv.Atoi(s)"},
+		{"a, b = b, a", "a, b = b, a"},
+		{"x, y := parse(s)?", "x, y := parse(s)?"},
+		{"total += count(xs)? * 2", "total += (count(xs)? * 2)"},
+		{"check(s)?", "check(s)?"},
+		{"n := load(cfg.path())?.size", "n := load(cfg.path())?.size"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTryStatementErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"try:\n    run()\nprint(1)", "try at line 1 needs an except or finally clause"},
+		{"x := f?", "? must follow a call, got f"},
+		{"a, b", "expected = or := after a, b"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		found := false
+		for _, err := range p.Errors() {
+			if strings.Contains(err, tt.expectedError) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestRangeLoopsAndSlices(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for i, v in xs:\n    print(v)", "for i, v in xs:\n"},
+		{"for k, v in m:\n    print(k)", "for k, v in m:\n"},
+		{"x := xs[1:3]", "x := xs[1:3]"},
+		{"x := xs[:n]", "x := xs[:n]"},
+		{"x := xs[2:]", "x := xs[2:]"},
+		{"x := s[::-1]", "x := s[::(-1)]"},
+		{"x := xs[a:b:2]", "x := xs[a:b:2]"},
+		{"x := xs[-1]", "x := xs[(-1)]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if got := program.Statements[0].String(); !strings.HasPrefix(got, tt.expected) {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parser.New(lexer.New("for i, v in xs:\n    print(v)")).ParseProgram()
+	loop := program.Statements[0].(*ast.ForStmt)
+	if !loop.IsRange || loop.RangeVar != "i" || loop.ValueVar != "v" {
+		t.Errorf("expected a range loop over i, v, got %+v", loop)
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x := [n * 2 for n in xs]", "x := [(n * 2) for n in xs]"},
+		{"x := [n for n in xs if n > 0 if n < 9]", "x := [n for n in xs if (n > 0) if (n < 9)]"},
+		{"x := [i + j for i in range(3) for j in range(i)]", "x := [(i + j) for i in range(3) for j in range(i)]"},
+		{"x := {k: v for k, v in m}", "x := {k: v for k, v in m}"},
+		{"x := {len(w) for w in words}", "x := {len(w) for w in words}"},
+		{"x := [\n    w.upper()\n    for w in words\n    if w != \"\"\n]", "x := [w.upper() for w in words if (w != \"\")]"},
+		{"x := [1, 2, 3]", "x := [1, 2, 3]"},
+		{"x := {\"a\": 1}", "x := {\"a\": 1}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parser.New(lexer.New("x := {k: v for k, v in m if v}")).ParseProgram()
+	c := program.Statements[0].(*ast.VarDecl).Value.(*ast.ComprehensionExpr)
+	if c.Kind != "map" || len(c.Clauses) != 1 || c.Clauses[0].RangeVar != "k" || c.Clauses[0].ValueVar != "v" ||
+		len(c.Clauses[0].Conditions) != 1 {
+		t.Errorf("map comprehension parsed wrong: %+v", c)
+	}
+}
+
+func TestFStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`x := f"Hello {name}!"`, `x := f"Hello {name}!"`},
+		{`x := f"{a + b:>10.2f} {{braces}}"`, `x := f"{(a + b):>10.2f} {{braces}}"`},
+		{`x := f"{user.name!r:^12} {items[0]}"`, `x := f"{user.name!r:^12} {items[0]}"`},
+		{`x := f"{a != b} {d['k']}"`, `x := f"{(a != b)} {d[\"k\"]}"`},
+		{`x := 'single' + "say \"hi\""`, `x := ("single" + "say \"hi\"")`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	program := parser.New(lexer.New(`x := f"{n:*^+#010,.3f}"`)).ParseProgram()
+	fstring := program.Statements[0].(*ast.VarDecl).Value.(*ast.FStringExpr)
+	spec := fstring.Parts[0].Spec
+	if spec.Fill != '*' || spec.Align != '^' || spec.Sign != '+' || !spec.Alternate || !spec.Zero ||
+		spec.Width != 10 || spec.Grouping != ',' || spec.Precision != 3 || spec.Type != 'f' {
+		t.Errorf("format spec parsed wrong: %+v", spec)
+	}
+}
+
+func TestFStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`x := f"{}"`, "empty expression {} in f-string at line 1"},
+		{`x := f"{name"`, "expected '}' after {name in f-string"},
+		{`x := f"a } b"`, "single '}' is not allowed"},
+		{`x := f"{n:.f}"`, `format spec ".f" needs a precision`},
+		{`x := f"{n:.2d}"`, "precision is not allowed with the integer format 'd'"},
+		{`x := f"{n:10q}"`, `invalid format spec "10q"`},
+		{`x := f"{n!x}"`, "expected !r, !s or !a"},
+		{`x := f"{a +}"`, "invalid expression {a +}"},
+		{`x := f"{n:{w}}"`, "nested replacement fields are not supported"},
+		{`x := "C:\dir"`, `invalid escape sequence \d`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		found := false
+		for _, err := range p.Errors() {
+			if strings.Contains(err, tt.expectedError) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	input := `@cli
+pub func run(name string = "world", count int = -1, files []string) error:
+    return nil`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	fn, ok := program.Statements[0].(*ast.FunctionDecl)
+	if !ok {
+		t.Fatalf("expected a function declaration, got %T", program.Statements[0])
+	}
+	if !fn.HasAnnotation("cli") || !fn.Public || len(fn.Parameters) != 3 {
+		t.Fatalf("annotated function parsed wrong: %s", fn.String())
+	}
+	if got := fn.Parameters[0].String(); got != `name string = "world"` {
+		t.Errorf("expected parameter with default, got %q", got)
+	}
+	if fn.Parameters[2].Default != nil {
+		t.Errorf("expected no default for files, got %s", fn.Parameters[2].Default.String())
+	}
+
+	p = parser.New(lexer.New("@cli\nx := 1"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) == 0 || !strings.Contains(errors[0], "@cli must be followed by a func declaration") {
+		t.Errorf("expected an annotation error, got %v", errors)
+	}
+}
+
+func TestImportDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		packages []ast.ImportedPackage
+	}{
+		{`import "os"`, []ast.ImportedPackage{{Name: "os", Path: "os"}}},
+		{`import strings`, []ast.ImportedPackage{{Name: "strings", Path: "strings"}}},
+		{`import "json" as j`, []ast.ImportedPackage{{Name: "j", Path: "encoding/json", Alias: true}}},
+		{`import ("os", "http")`, []ast.ImportedPackage{{Name: "os", Path: "os"}, {Name: "http", Path: "net/http"}}},
+		{`from "json" import Marshal, Unmarshal`, []ast.ImportedPackage{{Name: "json", Path: "encoding/json", Names: []string{"Marshal", "Unmarshal"}}}},
+	}
+
+	for _, tt := range tests {
+		// The statement after the import must not pick up its last token
+		p := parser.New(lexer.New(tt.input + "\nx := 1"))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Imports) != 1 || len(program.Statements) != 1 {
+			t.Errorf("%q: expected 1 import and 1 statement, got %d and %d", tt.input, len(program.Imports), len(program.Statements))
+			continue
+		}
+		if got := program.Imports[0].Packages(); !reflect.DeepEqual(got, tt.packages) {
+			t.Errorf("%q: expected packages %+v, got %+v", tt.input, tt.packages, got)
+		}
+	}
+}
+
+func TestAssertStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		source   string
+		operands []string
+		message  bool
+	}{
+		{"assert ok", "ok", nil, false},
+		{"assert add(-1, 2) == 1", "add(-1, 2) == 1", []string{"add(-1, 2)", "1"}, false},
+		{"assert len(xs) >= 2, \"too short\"  # comment", "len(xs) >= 2", []string{"len(xs)", "2"}, true},
+		{"assert f(a == b) != c", "f(a == b) != c", []string{"f(a == b)", "c"}, false},
+		{"assert (a == b) == c", "(a == b) == c", []string{"(a == b)", "c"}, false},
+		{"assert ready(x)", "ready(x)", nil, false},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New("\n" + tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.AssertStmt)
+		if !ok {
+			t.Fatalf("%q: expected *ast.AssertStmt, got %T", tt.input, program.Statements[0])
+		}
+		if stmt.Line != 2 {
+			t.Errorf("%q: expected line 2, got %d", tt.input, stmt.Line)
+		}
+		if stmt.Source != tt.source || !reflect.DeepEqual(stmt.Operands, tt.operands) {
+			t.Errorf("%q: expected source %q and operands %q, got %q and %q",
+				tt.input, tt.source, tt.operands, stmt.Source, stmt.Operands)
+		}
+		if (stmt.Message != nil) != tt.message {
+			t.Errorf("%q: expected a message: %v, got %v", tt.input, tt.message, stmt.Message)
+		}
+	}
+
+	p := parser.New(lexer.New("assert\n"))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) == 0 || !strings.Contains(errors[0], "assert at line 1 needs a condition") {
+		t.Errorf("expected a missing condition error, got %v", errors)
+	}
+}
+
+func TestMalformedProgramErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"func f(0):\n    pass", "expected a parameter name, got 0"},
+		{"func f(a int, b):\n    pass", "parameter b needs a type"},
+		{"func f():\n    func g():\n        pass", "func g at line 2: functions are declared at the top level"},
+		{"struct A:\n    a +", "expected a type, got PLUS"},
+		{"var x", "var x at line 1 needs a type or a value"},
+		{"for 1 in xs:\n    pass", "expected a loop variable after for, got INT"},
+		{"f()? = 1", "cannot assign to f()?"},
+		{"x := 1.5.real", "a number has no fields or methods"},
+		{"package", "expected a package name, got EOF"},
+		{"caf\xe9 := 1", "invalid UTF-8 encoding in a name at line 1"},
+		{"x€ := 1", "invalid character '€' in a name"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		p.ParseProgram()
+
+		found := false
+		for _, err := range p.Errors() {
+			if strings.Contains(err, tt.expectedError) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedError, p.Errors())
+		}
+	}
+}
+
+func TestASTJSON(t *testing.T) {
+	input := `func add(x int, y int) int:
+    return x + y`
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	got, err := json.Marshal(ast.JSON(program))
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	want := `{"node":"Program","package":"main","statements":[{"node":"FunctionDecl","name":"add",` +
+		`"parameters":[{"node":"Parameter","name":"x","type":"int"},{"node":"Parameter","name":"y","type":"int"}],` +
+		`"returnType":"int","body":{"node":"BlockStmt","statements":[{"node":"ReturnStmt","value":{"node":"BinaryExpr",` +
+		`"left":{"node":"Identifier","value":"x"},"operator":"+","right":{"node":"Identifier","value":"y"}},"line":2}]},"line":1}]}`
+	if string(got) != want {
+		t.Errorf("ast.JSON:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	input := `#!/usr/bin/env gos
+# Package rules holds the pricing rules.
+package rules
+
+# unrelated
+
+# discount returns the price
+# after the discount
+# gos:ignore shadow
+pub func discount(price float64) float64:
+    return price
+
+# Customer is a buyer
+pub struct Customer:
+    # Name of the customer
+    pub Name string
+    pub Vip bool  # not a doc comment
+
+    # greet greets the customer
+    func greet(self) string:
+        return self.Name
+
+# rate is the discount rate
+var rate float64 = 0.1
+count := 0`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.Doc != "Package rules holds the pricing rules." {
+		t.Errorf("package doc: got %q", program.Doc)
+	}
+	fn := program.Statements[0].(*ast.FunctionDecl)
+	if fn.Doc != "discount returns the price\nafter the discount" {
+		t.Errorf("function doc: got %q", fn.Doc)
+	}
+	s := program.Statements[1].(*ast.StructDecl)
+	if s.Doc != "Customer is a buyer" {
+		t.Errorf("struct doc: got %q", s.Doc)
+	}
+	if s.Fields[0].Doc != "Name of the customer" || s.Fields[1].Doc != "" {
+		t.Errorf("field docs: got %q and %q", s.Fields[0].Doc, s.Fields[1].Doc)
+	}
+	if s.Methods[0].Doc != "greet greets the customer" {
+		t.Errorf("method doc: got %q", s.Methods[0].Doc)
+	}
+	if v := program.Statements[2].(*ast.VarDecl); v.Doc != "rate is the discount rate" {
+		t.Errorf("variable doc: got %q", v.Doc)
+	}
+	if v := program.Statements[3].(*ast.VarDecl); v.Doc != "" {
+		t.Errorf("a short variable declaration has no doc, got %q", v.Doc)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gosrt "github.com/GrandpaEJ/go-script/runtime"
+)
+
+func TestRuntimeConversions(t *testing.T) {
+	if got := gosrt.Int(" 42 "); got != 42 {
+		t.Errorf("Int(\" 42 \") = %d, expected 42", got)
+	}
+	if got := gosrt.Int(2.9); got != 2 {
+		t.Errorf("Int(2.9) = %d, expected 2", got)
+	}
+	if got := gosrt.Float("1.5"); got != 1.5 {
+		t.Errorf("Float(\"1.5\") = %v, expected 1.5", got)
+	}
+	if got := gosrt.Str(3.5); got != "3.5" {
+		t.Errorf("Str(3.5) = %q, expected \"3.5\"", got)
+	}
+	for value, want := range map[any]bool{"": false, "x": true, 0: false, 7: true, nil: false} {
+		if got := gosrt.Bool(value); got != want {
+			t.Errorf("Bool(%#v) = %v, expected %v", value, got, want)
+		}
+	}
+
+	defer func() {
+		if _, ok := recover().(error); !ok {
+			t.Errorf("Int(\"abc\") did not panic with an error")
+		}
+	}()
+	gosrt.Int("abc")
+}
+
+func TestRuntimeRange(t *testing.T) {
+	tests := []struct {
+		args     []int
+		expected []int
+	}{
+		{[]int{4}, []int{0, 1, 2, 3}},
+		{[]int{2, 5}, []int{2, 3, 4}},
+		{[]int{10, 0, -3}, []int{10, 7, 4, 1}},
+		{[]int{3, 1}, nil},
+	}
+
+	for _, tt := range tests {
+		if got := gosrt.Range(tt.args...); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Range(%v) = %v, expected %v", tt.args, got, tt.expected)
+		}
+	}
+}
+
+func TestRuntimeSequences(t *testing.T) {
+	xs := []int{0, 1, 2, 3, 4}
+	tests := []struct {
+		low, high, step int
+		expected        []int
+	}{
+		{1, 3, 1, []int{1, 2}},
+		{gosrt.Omit, gosrt.Omit, 2, []int{0, 2, 4}},
+		{-2, gosrt.Omit, 1, []int{3, 4}},
+		{gosrt.Omit, gosrt.Omit, -1, []int{4, 3, 2, 1, 0}},
+		{3, 0, -2, []int{3, 1}},
+		{-100, 100, 1, []int{0, 1, 2, 3, 4}},
+		{4, 1, 1, []int{}},
+	}
+
+	for _, tt := range tests {
+		if got := gosrt.Slice(xs, tt.low, tt.high, tt.step); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Slice(%d, %d, %d) = %v, expected %v", tt.low, tt.high, tt.step, got, tt.expected)
+		}
+	}
+
+	if got := gosrt.SliceString("hello", gosrt.Omit, gosrt.Omit, -1); got != "olleh" {
+		t.Errorf("SliceString reversed = %q, expected \"olleh\"", got)
+	}
+	if got := gosrt.SliceString("hello", 1, 10, 1); got != "ello" {
+		t.Errorf("SliceString(1, 10) = %q, expected \"ello\"", got)
+	}
+	if got := gosrt.At(xs, -1); got != 4 {
+		t.Errorf("At(-1) = %d, expected 4", got)
+	}
+	if got := gosrt.ByteAt("abc", -3); got != 'a' {
+		t.Errorf("ByteAt(-3) = %q, expected 'a'", got)
+	}
+	if got := gosrt.Index(4, -1); got != 3 {
+		t.Errorf("Index(4, -1) = %d, expected 3", got)
+	}
+
+	pairs := gosrt.Enumerate([]string{"a", "b"}, 1)
+	if !reflect.DeepEqual(pairs, []gosrt.Pair[int, string]{{First: 1, Second: "a"}, {First: 2, Second: "b"}}) {
+		t.Errorf("Enumerate = %v", pairs)
+	}
+	zipped := gosrt.Zip([]string{"a", "b", "c"}, []int{1, 2})
+	if !reflect.DeepEqual(zipped, []gosrt.Pair[string, int]{{First: "a", Second: 1}, {First: "b", Second: 2}}) {
+		t.Errorf("Zip = %v", zipped)
+	}
+
+	defer func() {
+		if _, ok := recover().(error); !ok {
+			t.Errorf("At(xs, 5) did not panic with an error")
+		}
+	}()
+	gosrt.At(xs, 5)
+}
+
+func TestRuntimeFormatting(t *testing.T) {
+	tests := []struct {
+		got, expected string
+	}{
+		{gosrt.Pad("ab", 6, '^', '*'), "**ab**"},
+		{gosrt.Pad("ab", 5, '<', '.'), "ab..."},
+		{gosrt.Pad("-42", 6, '=', '0'), "-00042"},
+		{gosrt.Pad("toolong", 3, '>', ' '), "toolong"},
+		{gosrt.Group("1234567", ',', 3), "1,234,567"},
+		{gosrt.Group("-1234.5678", ',', 3), "-1,234.5678"},
+		{gosrt.Group("0xdeadbeef", '_', 4), "0xdead_beef"},
+		{gosrt.Group("123", ',', 3), "123"},
+	}
+
+	for i, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("tests[%d]: got %q, expected %q", i, tt.got, tt.expected)
+		}
+	}
+}
+
+func TestRuntimeModules(t *testing.T) {
+	if got := gosrt.Title("hello wORLD"); got != "Hello World" {
+		t.Errorf("Title = %q, expected \"Hello World\"", got)
+	}
+	if got := gosrt.Split(" a  b "); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Split without separator = %q", got)
+	}
+	if got := gosrt.Replace("aaa", "a", "b", 2); got != "bba" {
+		t.Errorf("Replace with count = %q, expected \"bba\"", got)
+	}
+	if got := gosrt.Abs(-3); got != 3 {
+		t.Errorf("Abs(-3) = %v, expected 3", got)
+	}
+	if got := gosrt.Max(1.5, 4, 2); got != 4 {
+		t.Errorf("Max = %v, expected 4", got)
+	}
+
+	date := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+	if got := gosrt.FormatTime(date, "YYYY-MM-DD HH:mm:ss"); got != "2024-03-05 14:07:09" {
+		t.Errorf("FormatTime = %q, expected \"2024-03-05 14:07:09\"", got)
+	}
+}
@@ -0,0 +1,105 @@
+// Fakedlv stands in for dlv dap in the tests of gos debug --dap. It serves
+// one client as Delve does, and answers requests with what a program
+// generated by gos looks like to Delve: Go names, and the generated
+// variables. It reports the arguments of the launch and the expressions it
+// evaluates back to the client.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+)
+
+type message map[string]interface{}
+
+func main() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("DAP server listening at: %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	if err != nil {
+		os.Exit(1)
+	}
+	r := bufio.NewReader(conn)
+
+	seq := 0
+	send := func(m message) {
+		seq++
+		m["seq"] = seq
+		body, _ := json.Marshal(m)
+		fmt.Fprintf(conn, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	respond := func(req message, body interface{}) {
+		send(message{"type": "response", "request_seq": req["seq"], "command": req["command"], "success": true, "body": body})
+	}
+
+	var program string
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+		var req message
+		json.Unmarshal(body, &req)
+		args, _ := req["arguments"].(map[string]interface{})
+
+		switch req["command"] {
+		case "initialize":
+			respond(req, message{})
+			send(message{"type": "event", "event": "initialized"})
+		case "launch":
+			launch, _ := json.Marshal(args)
+			program, _ = args["program"].(string)
+			if _, err := os.Stat(program); err != nil {
+				send(message{"type": "response", "request_seq": req["seq"], "command": "launch", "success": false, "message": err.Error()})
+				continue
+			}
+			send(message{"type": "event", "event": "output", "body": message{"category": "console", "output": string(launch)}})
+			respond(req, nil)
+		case "setBreakpoints":
+			source := args["source"].(map[string]interface{})
+			var breakpoints []message
+			for _, bp := range args["breakpoints"].([]interface{}) {
+				line := bp.(map[string]interface{})["line"]
+				breakpoints = append(breakpoints, message{"verified": true, "line": line, "source": source})
+			}
+			respond(req, message{"breakpoints": breakpoints})
+		case "stackTrace":
+			path := os.Getenv("FAKEDLV_SOURCE")
+			respond(req, message{"stackFrames": []message{
+				{"id": 1, "name": "main.(*Counter).Inc", "line": 8, "source": message{"path": path}},
+				{"id": 2, "name": "main.NewCounter", "line": 5, "source": message{"path": path}},
+				{"id": 3, "name": "main.gosMain", "line": 12, "source": message{"path": path}},
+				{"id": 4, "name": "runtime.main", "line": 283, "source": message{"path": "/usr/local/go/src/runtime/proc.go"}},
+			}, "totalFrames": 4})
+		case "variables":
+			respond(req, message{"variables": []message{
+				{"name": "_err1", "type": "error", "value": "nil", "variablesReference": 0},
+				{"name": "Count", "type": "int", "value": "2", "evaluateName": "c.Count", "variablesReference": 0},
+				{"name": "c", "type": "*main.Counter", "value": "*main.Counter {Count: 2}", "evaluateName": "c", "variablesReference": 7},
+			}})
+		case "evaluate":
+			respond(req, message{"result": args["expression"], "type": "main.Counter", "variablesReference": 0})
+		case "disconnect":
+			respond(req, nil)
+			conn.Close()
+			return
+		default:
+			respond(req, nil)
+		}
+	}
+}
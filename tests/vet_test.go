@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GrandpaEJ/go-script/pkg/ast"
+	"github.com/GrandpaEJ/go-script/pkg/lexer"
+	"github.com/GrandpaEJ/go-script/pkg/parser"
+	"github.com/GrandpaEJ/go-script/pkg/vet"
+)
+
+// vetSource parses a program and returns what the checks with the given
+// IDs report about it, one diagnostic per line
+func vetSource(t *testing.T, input string, ids ...string) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser errors: %v", errors)
+	}
+	var checks []*vet.Check
+	for _, id := range ids {
+		check := vet.Lookup(id)
+		if check == nil {
+			t.Fatalf("no check %s", id)
+		}
+		checks = append(checks, check)
+	}
+	var lines []string
+	for _, d := range vet.Run(program, input, checks) {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestVetChecks(t *testing.T) {
+	tests := []struct {
+		check    string
+		input    string
+		expected string
+	}{
+		{"unused-variable", `func main():
+    x := 1
+    y := 2
+    y = 3
+    for i in range(3):
+        print(x)
+    for k, v in {"a": 1}:
+        print(k)
+`, `line 3: error: y is declared but never used [unused-variable]
+line 7: error: v is declared but never used [unused-variable]`},
+		{"unused-variable", `func main():
+    n, err := parse("1")
+    try:
+        print(n)
+    except error as e:
+        print(err)
+    f := func(x int):
+        print(x)
+    f(1)
+`, ``},
+		{"unused-import", `import "os"
+from "strings" import ToUpper, ToLower
+import "fmt" as f
+
+func main():
+    f.Println(ToUpper("a"))
+`, `line 1: warning: import "os" is not used [unused-import]
+line 2: warning: ToLower imported from "strings" is not used [unused-import]`},
+		{"shadow", `func main():
+    err := 1
+    if true:
+        err := 2
+        print(err)
+    print(err)
+    n := 1
+    if true:
+        n := 2
+        print(n)
+`, `line 4: warning: err := hides the err declared at line 2, which is used after it at line 6; use = to assign to it [shadow]`},
+		{"unreachable", `func f(n int) int:
+    if n > 0:
+        return 1
+        print("a")
+    while n < 0:
+        n += 1
+    if n == 0:
+        return 0
+    else:
+        raise errors.New("b")
+    print("c")
+    return 0
+`, `line 4: warning: unreachable code after the return at line 3 [unreachable]
+line 11: warning: unreachable code after the if statement, whose branches all leave, at line 7 [unreachable]`},
+		{"list-compare", `func main():
+    xs := [1, 2]
+    var ys []any = [1, 2]
+    n := 1
+    print(xs == ys, xs != nil, n == 1, [1] == [1])
+`, `line 5: error: xs == ys compares lists, which are Go slices that Go only compares with nil; use reflect.DeepEqual [list-compare]
+line 5: error: [1] == [1] compares lists, which are Go slices that Go only compares with nil; use reflect.DeepEqual [list-compare]`},
+		{"value-receiver", `struct Counter:
+    count int
+
+    func inc(self):
+        self.count += 1
+
+    func mut dec(self):
+        self.count -= 1
+`, `line 5: warning: method Counter.inc assigns to self.count but has a value receiver, so the change is lost; declare it as func mut inc(self) or func inc(*self) [value-receiver]`},
+		{"missing-return", `func sign(n int) int:
+    if n > 0:
+        return 1
+    elif n < 0:
+        return -1
+
+func parse(s string) (int, error):
+    try:
+        return 1, nil
+    except error as e:
+        return 0, e
+
+func must(n int) int:
+    if n > 0:
+        return n
+    panic("negative")
+
+func forever() int:
+    while true:
+        print("x")
+`, `line 1: error: func sign returns int but can reach the end of its body without a return [missing-return]
+line 18: error: func forever returns int but can reach the end of its body without a return [missing-return]`},
+	}
+
+	for _, tt := range tests {
+		if got := vetSource(t, tt.input, tt.check); got != tt.expected {
+			t.Errorf("%s of\n%s\nexpected:\n%s\ngot:\n%s", tt.check, tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestVetIgnore(t *testing.T) {
+	input := `func main():
+    # gos:ignore unused-variable
+    a := 1
+    b := 2 # gos:ignore shadow, unused-variable
+    c := 3 # gos:ignore shadow
+    # gos:ignoreunused-variable
+    d := 4
+`
+	expected := `line 5: error: c is declared but never used [unused-variable]
+line 7: error: d is declared but never used [unused-variable]`
+	if got := vetSource(t, input, "unused-variable"); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestVetRegister(t *testing.T) {
+	// The registry outlives the test when it runs more than once
+	if vet.Lookup("test-print") == nil {
+		vet.Register(&vet.Check{
+			ID:  "test-print",
+			Doc: "calls to print, for this test",
+			Run: func(pass *vet.Pass) {
+				ast.Inspect(pass.Program, func(node ast.Node) bool {
+					if stmt, ok := node.(*ast.ExpressionStmt); ok && strings.HasPrefix(stmt.String(), "print(") {
+						pass.Reportf(stmt.Line, "print called")
+					}
+					return true
+				})
+			},
+		})
+	}
+
+	expected := "line 2: warning: print called [test-print]"
+	if got := vetSource(t, "func main():\n    print(1)\n", "test-print"); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a check twice to panic")
+		}
+	}()
+	vet.Register(&vet.Check{ID: "test-print"})
+}
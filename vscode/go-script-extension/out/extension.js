@@ -12,6 +12,44 @@ function activate(context) {
     const debugCommand = vscode.commands.registerCommand('go-script.debug', debugGoScript);
     const checkCommand = vscode.commands.registerCommand('go-script.check', checkSyntax);
     context.subscriptions.push(runCommand, buildCommand, debugCommand, checkCommand);
+    // Debugging: gos debug --dap runs the program with Delve and speaks the
+    // Debug Adapter Protocol on its stdin and stdout
+    const debugAdapter = vscode.debug.registerDebugAdapterDescriptorFactory('go-script', {
+        createDebugAdapterDescriptor: () => new vscode.DebugAdapterExecutable(getGosPath(), ['debug', '--dap', '--dlv', getDlvPath()])
+    });
+    const debugConfigurations = vscode.debug.registerDebugConfigurationProvider('go-script', {
+        resolveDebugConfiguration: (folder, config) => {
+            // Without a launch.json, debug the active file
+            if (!config.type && !config.request && !config.name) {
+                config.type = 'go-script';
+                config.request = 'launch';
+                config.name = 'Debug Go-Script file';
+            }
+            if (!config.program) {
+                const filePath = getActiveFilePath();
+                if (!filePath)
+                    return undefined;
+                config.program = filePath;
+            }
+            return config;
+        }
+    });
+    context.subscriptions.push(debugAdapter, debugConfigurations);
+    // Completion: gos complete lists the members of the Go package before
+    // the dot, read from the export data of the package
+    const completion = vscode.languages.registerCompletionItemProvider('go-script', {
+        provideCompletionItems: (document, position) => {
+            const config = vscode.workspace.getConfiguration('go-script');
+            if (!config.get('enableAutoCompletion', true))
+                return undefined;
+            const before = document.lineAt(position).text.slice(0, position.character);
+            const match = /([A-Za-z_][A-Za-z0-9_]*)\.[A-Za-z0-9_]*$/.exec(before);
+            if (!match)
+                return undefined;
+            return completeMembers(document.getText(), match[1]);
+        }
+    }, '.');
+    context.subscriptions.push(completion);
     // Set up diagnostics
     const diagnosticCollection = vscode.languages.createDiagnosticCollection('go-script');
     context.subscriptions.push(diagnosticCollection);
@@ -59,11 +97,14 @@ async function debugGoScript(uri) {
     const filePath = getActiveFilePath(uri);
     if (!filePath)
         return;
-    const terminal = getOrCreateTerminal();
-    const gosPath = getGosPath();
-    terminal.show();
-    terminal.sendText(`${gosPath} debug "${filePath}"`);
-    vscode.window.showInformationMessage(`Debugging Go-Script: ${path.basename(filePath)}`);
+    const folder = vscode.workspace.getWorkspaceFolder(vscode.Uri.file(filePath));
+    await vscode.debug.startDebugging(folder, {
+        type: 'go-script',
+        request: 'launch',
+        name: `Debug ${path.basename(filePath)}`,
+        program: filePath,
+        cwd: folder ? folder.uri.fsPath : path.dirname(filePath)
+    });
 }
 async function checkSyntax(uri) {
     const filePath = getActiveFilePath(uri);
@@ -152,6 +193,35 @@ function getGosPath() {
     const config = vscode.workspace.getConfiguration('go-script');
     return config.get('gosPath', 'gos');
 }
+function getDlvPath() {
+    const config = vscode.workspace.getConfiguration('go-script');
+    return config.get('dlvPath', 'dlv');
+}
+const memberKinds = {
+    func: vscode.CompletionItemKind.Function,
+    type: vscode.CompletionItemKind.Class,
+    var: vscode.CompletionItemKind.Variable,
+    const: vscode.CompletionItemKind.Constant
+};
+// completeMembers runs gos complete over the text being edited, so it sees
+// imports that are not saved yet
+function completeMembers(text, name) {
+    return new Promise(resolve => {
+        const child = cp.execFile(getGosPath(), ['complete', '--json', '-', name], (error, stdout) => {
+            if (error) {
+                resolve([]);
+                return;
+            }
+            const members = JSON.parse(stdout);
+            resolve(members.map(member => {
+                const item = new vscode.CompletionItem(member.name, memberKinds[member.kind]);
+                item.detail = member.type;
+                return item;
+            }));
+        });
+        child.stdin?.end(text);
+    });
+}
 function execAsync(command) {
     return new Promise((resolve, reject) => {
         cp.exec(command, (error, stdout, stderr) => {